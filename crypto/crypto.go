@@ -29,6 +29,13 @@ func RandomHex(nbytes uint32) string {
 	return fmt.Sprintf("%x", RandomBytes(nbytes))
 }
 
+// Plain digest is enough only for random inputs like generated secrets,
+// passwords have to be hashed with a slow hash instead
+func Sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
 func RandomHash(nbytes uint32, h hash.Hash) string {
 	b := RandomBytes(nbytes)
 	h.Reset()
@@ -0,0 +1,91 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	TokenUseEmailVerification = "email_verification"
+	TokenUsePasswordReset     = "password_reset"
+
+	// NOTE: Claim of verification tokens binding them to the address they
+	// were sent to
+	EmailClaim = "email"
+
+	DefaultVerificationTokenDuration = 24 * time.Hour
+	DefaultResetTokenDuration        = 30 * time.Minute
+)
+
+var (
+	ErrAccountsNotSupported = errors.New("users registry does not support account flows")
+	ErrNoEmail              = errors.New("user has no email")
+	ErrEmailVerified        = errors.New("email is already verified")
+)
+
+type UserEmail struct {
+	Address    string
+	IsVerified bool
+}
+
+// NOTE: Optional extension of UsersRegistry enabling email verification
+// and password reset, UpdateCredentials receives plain credentials, so
+// hashing them is up to the registry as in CreateUser
+type AccountRegistry[U User] interface {
+	GetUserByEmail(context.Context, string) (*U, error)
+	GetUserEmail(context.Context, *U) (UserEmail, error)
+	MarkEmailVerified(context.Context, *U, string) error
+	UpdateCredentials(context.Context, *U, Credentials) error
+}
+
+type AccountProvider[U User] interface {
+	RequestEmailVerification(context.Context, *U) error
+	VerifyEmail(context.Context, *Token) (bool, error)
+	RequestPasswordReset(context.Context, string) error
+	ResetPassword(context.Context, ResetPasswordRequest) (*ResetPasswordResult, error)
+}
+
+type AccountOptions struct {
+	Mailer Mailer
+	Tokens OneTimeTokenStore
+
+	VerificationTokenDuration time.Duration
+	ResetTokenDuration        time.Duration
+
+	// NOTE: Build links put into emails, usually pointing to frontend pages
+	// submitting the token back, the token itself is sent when nil
+	VerificationLink func(token string) string
+	ResetLink        func(token string) string
+
+	// NOTE: Credentials field updated by password reset, "password" is used
+	// when empty
+	PasswordField string
+
+	SignupVerificationDisabled bool
+	EmailVerificationRequired  bool
+}
+
+type ResetPasswordRequest struct {
+	Token    *Token `json:"-"`
+	Password string `json:"password"`
+}
+
+type ResetPasswordResult struct {
+	NotAuthorized      bool             `json:"notAuthorized"`
+	InvalidCredentials bool             `json:"invalidCredentials"`
+	CredentialsCheck   CredentialsCheck `json:"credentialsCheck"`
+}
+
+func NewAccountOptions(mailer Mailer) *AccountOptions {
+	return &AccountOptions{
+		Mailer:                    mailer,
+		Tokens:                    NewMemoryOneTimeTokenStore(),
+		VerificationTokenDuration: DefaultVerificationTokenDuration,
+		ResetTokenDuration:        DefaultResetTokenDuration,
+	}
+}
+
+func (r *ResetPasswordResult) IsSuccess() bool {
+	return !r.NotAuthorized && !r.InvalidCredentials
+}
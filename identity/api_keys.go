@@ -0,0 +1,221 @@
+package identity
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yandzee/go-svc/crypto"
+)
+
+const (
+	DefaultApiKeyPrefix = "sk"
+
+	apiKeyIdBytes     = 8
+	apiKeySecretBytes = 32
+)
+
+var (
+	ErrApiKeysNotSupported = errors.New("identity provider does not support API keys")
+	ErrApiKeyScope         = errors.New("API key scope is not allowed")
+	ErrApiKeyExpiration    = errors.New("API key expiration is not allowed")
+)
+
+// NOTE: Only hash of the secret part is stored, Prefix is the visible part
+// of the key ("<prefix>_<id>") shown to users to tell their keys apart
+type ApiKey struct {
+	Id         string     `json:"id"`
+	Prefix     string     `json:"prefix"`
+	Name       string     `json:"name"`
+	UserId     uuid.UUID  `json:"userId"`
+	Scopes     []string   `json:"scopes"`
+	SecretHash string     `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+}
+
+type ApiKeyStore interface {
+	SaveApiKey(context.Context, *ApiKey) error
+	GetApiKey(context.Context, string) (*ApiKey, error)
+	ListApiKeys(context.Context, uuid.UUID) ([]*ApiKey, error)
+	DeleteApiKey(context.Context, string) (bool, error)
+}
+
+// NOTE: AuthenticateApiKey returns nil key if it is unknown, expired or
+// its secret does not match
+type ApiKeyProvider[U User] interface {
+	CreateApiKey(context.Context, *U, ApiKeyRequest) (*CreatedApiKey, error)
+	ListApiKeys(context.Context, *U) ([]*ApiKey, error)
+	RevokeApiKey(context.Context, *U, string) (bool, error)
+	AuthenticateApiKey(context.Context, string) (*ApiKey, error)
+	GetApiKeyUser(context.Context, *ApiKey) (*U, error)
+}
+
+type ApiKeyOptions struct {
+	Store  ApiKeyStore
+	Prefix string
+
+	// NOTE: Scopes keys can be created with, any scopes are allowed when
+	// empty
+	Scopes []string
+
+	// NOTE: Keys have to expire within MaxDuration when set, keys without
+	// expiration are not allowed then
+	MaxDuration time.Duration
+}
+
+type ApiKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// NOTE: Key is returned once at creation and cannot be recovered later
+type CreatedApiKey struct {
+	*ApiKey
+	Key string `json:"key"`
+}
+
+func NewApiKeyOptions() *ApiKeyOptions {
+	return &ApiKeyOptions{
+		Store:  NewMemoryApiKeyStore(),
+		Prefix: DefaultApiKeyPrefix,
+	}
+}
+
+// NOTE: Returns the key to be handed to the user along with its record
+// holding hash of the secret part
+func GenerateApiKey(prefix string, userId uuid.UUID) (string, *ApiKey) {
+	if len(prefix) == 0 {
+		prefix = DefaultApiKeyPrefix
+	}
+
+	id := crypto.RandomHex(apiKeyIdBytes)
+	secret := crypto.RandomHex(apiKeySecretBytes)
+	visible := prefix + "_" + id
+
+	return visible + "_" + secret, &ApiKey{
+		Id:         id,
+		Prefix:     visible,
+		UserId:     userId,
+		SecretHash: hashApiKeySecret(secret),
+		CreatedAt:  time.Now(),
+	}
+}
+
+// NOTE: Splits "<prefix>_<id>_<secret>" key, prefix itself may contain
+// underscores
+func ParseApiKey(key string) (string, string, string, bool) {
+	rest, secret, isOk := cutLast(key, "_")
+	if !isOk || len(secret) != 2*apiKeySecretBytes {
+		return "", "", "", false
+	}
+
+	prefix, id, isOk := cutLast(rest, "_")
+	if !isOk || len(prefix) == 0 || len(id) != 2*apiKeyIdBytes {
+		return "", "", "", false
+	}
+
+	return prefix, id, secret, true
+}
+
+func (k *ApiKey) CheckSecret(secret string) bool {
+	hashed := hashApiKeySecret(secret)
+	return subtle.ConstantTimeCompare([]byte(hashed), []byte(k.SecretHash)) == 1
+}
+
+func (k *ApiKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+func (k *ApiKey) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(k.Scopes, scope) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hashApiKeySecret(secret string) string {
+	return crypto.Sha256Hex(secret)
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	idx := strings.LastIndex(s, sep)
+	if idx < 0 {
+		return s, "", false
+	}
+
+	return s[:idx], s[idx+len(sep):], true
+}
+
+type MemoryApiKeyStore struct {
+	mx   sync.Mutex
+	keys map[string]*ApiKey
+}
+
+func NewMemoryApiKeyStore() *MemoryApiKeyStore {
+	return &MemoryApiKeyStore{
+		keys: map[string]*ApiKey{},
+	}
+}
+
+func (s *MemoryApiKeyStore) SaveApiKey(ctx context.Context, key *ApiKey) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	stored := *key
+	s.keys[key.Id] = &stored
+
+	return nil
+}
+
+func (s *MemoryApiKeyStore) GetApiKey(ctx context.Context, id string) (*ApiKey, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	key, exists := s.keys[id]
+	if !exists {
+		return nil, nil
+	}
+
+	stored := *key
+	return &stored, nil
+}
+
+func (s *MemoryApiKeyStore) ListApiKeys(ctx context.Context, userId uuid.UUID) ([]*ApiKey, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	keys := []*ApiKey{}
+
+	for _, key := range s.keys {
+		if key.UserId == userId {
+			stored := *key
+			keys = append(keys, &stored)
+		}
+	}
+
+	slices.SortFunc(keys, func(a, b *ApiKey) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return keys, nil
+}
+
+func (s *MemoryApiKeyStore) DeleteApiKey(ctx context.Context, id string) (bool, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	_, exists := s.keys[id]
+	delete(s.keys, id)
+
+	return exists, nil
+}
@@ -0,0 +1,158 @@
+package authserver
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/yandzee/go-svc/crypto"
+	idhttp "github.com/yandzee/go-svc/identity/http"
+	"github.com/yandzee/go-svc/router"
+)
+
+// NOTE: Authorization endpoint of the code flow, PKCE with S256 is required
+// for all clients. Errors are redirected back to the client once its
+// redirect uri is validated
+func (s *Server[U]) Authorize() router.Handler {
+	logger := s.log()
+
+	return func(rctx *router.RequestContext) {
+		ctx := rctx.Context()
+		q := rctx.Request.URL().Query()
+
+		client, err := s.Clients.GetClient(ctx, q.Get("client_id"))
+		if err != nil {
+			logger.Error("Authorize: client lookup failure", "err", err.Error())
+			rctx.Response.String(http.StatusInternalServerError, "Authorize: client lookup failure")
+			return
+		}
+
+		if client == nil {
+			rctx.Response.String(http.StatusBadRequest, "Authorize: unknown client")
+			return
+		}
+
+		redirectURI := q.Get("redirect_uri")
+		if len(redirectURI) == 0 && len(client.RedirectURIs) == 1 {
+			redirectURI = client.RedirectURIs[0]
+		}
+
+		if !client.AllowsRedirect(redirectURI) {
+			rctx.Response.String(http.StatusBadRequest, "Authorize: redirect uri is not registered")
+			return
+		}
+
+		redirect := authRedirect{
+			uri:    redirectURI,
+			state:  q.Get("state"),
+			issuer: s.Issuer,
+		}
+
+		switch {
+		case q.Get("response_type") != "code":
+			redirect.error(rctx, "unsupported_response_type", "only code response type is supported")
+			return
+		case !client.AllowsGrant(GrantAuthorizationCode):
+			redirect.error(rctx, "unauthorized_client", "client cannot use authorization code grant")
+			return
+		case len(q.Get("code_challenge")) == 0 || q.Get("code_challenge_method") != "S256":
+			redirect.error(rctx, "invalid_request", "PKCE code challenge with S256 method is required")
+			return
+		}
+
+		guard, err := s.Endpoint.Guard(rctx, idhttp.GuardOptions{IsOptional: true})
+		if err != nil || guard.IsResponded {
+			return
+		}
+
+		if guard.User == nil {
+			if s.LoginURL == nil {
+				rctx.Response.String(http.StatusUnauthorized, "Authorize: user is not signed in")
+				return
+			}
+
+			authorizeURL := s.Issuer + s.Paths.Authorize + "?" + q.Encode()
+			rctx.Response.Redirect(http.StatusFound, s.LoginURL(authorizeURL))
+			return
+		}
+
+		scopes := s.allowedScopes(client, parseScopes(q.Get("scope")))
+
+		if !client.IsTrusted && s.Consent != nil {
+			scopes, err = s.Consent(ctx, ConsentRequest[U]{
+				User:   guard.User,
+				Client: client,
+				Scopes: scopes,
+			})
+
+			if err != nil {
+				logger.Error("Authorize: consent failure", "err", err.Error())
+				redirect.error(rctx, "server_error", "consent failure")
+				return
+			}
+
+			if len(scopes) == 0 {
+				redirect.error(rctx, "access_denied", "user denied access")
+				return
+			}
+		}
+
+		now := time.Now()
+		code := crypto.RandomHex(32)
+
+		err = s.Grants.SaveCode(ctx, hashToken(code), &Grant{
+			ClientId:      client.Id,
+			UserId:        (*guard.User).GetId(),
+			Scopes:        scopes,
+			AuthTime:      now,
+			ExpiresAt:     now.Add(durationOr(s.CodeDuration, DefaultCodeDuration)),
+			RedirectURI:   redirectURI,
+			CodeChallenge: q.Get("code_challenge"),
+			Nonce:         q.Get("nonce"),
+		})
+
+		if err != nil {
+			logger.Error("Authorize: failed to save code", "err", err.Error())
+			redirect.error(rctx, "server_error", "failed to issue code")
+			return
+		}
+
+		redirect.respond(rctx, url.Values{"code": {code}})
+	}
+}
+
+type authRedirect struct {
+	uri    string
+	state  string
+	issuer string
+}
+
+func (r *authRedirect) error(rctx *router.RequestContext, code, description string) {
+	r.respond(rctx, url.Values{
+		"error":             {code},
+		"error_description": {description},
+	})
+}
+
+// NOTE: Issuer is added as RFC 9207 requires to prevent mix-up attacks
+func (r *authRedirect) respond(rctx *router.RequestContext, params url.Values) {
+	target, err := url.Parse(r.uri)
+	if err != nil {
+		rctx.Response.String(http.StatusBadRequest, "Authorize: invalid redirect uri")
+		return
+	}
+
+	q := target.Query()
+	for key, vals := range params {
+		q[key] = vals
+	}
+
+	if len(r.state) > 0 {
+		q.Set("state", r.state)
+	}
+
+	q.Set("iss", r.issuer)
+	target.RawQuery = q.Encode()
+
+	rctx.Response.Redirect(http.StatusFound, target.String())
+}
@@ -0,0 +1,118 @@
+package authserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/yandzee/go-svc/crypto"
+)
+
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+)
+
+// NOTE: Public clients (e.g. SPAs and CLIs) have no secret and can only use
+// authorization code grant with PKCE
+type Client struct {
+	Id           string   `json:"id"`
+	Name         string   `json:"name"`
+	SecretHash   string   `json:"secretHash,omitempty"`
+	IsPublic     bool     `json:"isPublic"`
+	RedirectURIs []string `json:"redirectUris"`
+	GrantTypes   []string `json:"grantTypes"`
+	Scopes       []string `json:"scopes"`
+
+	// NOTE: Consent hook is skipped for trusted first party clients
+	IsTrusted bool `json:"isTrusted"`
+}
+
+type ClientRegistry interface {
+	GetClient(context.Context, string) (*Client, error)
+}
+
+type MemoryClientRegistry struct {
+	mx      sync.RWMutex
+	clients map[string]Client
+}
+
+func NewMemoryClientRegistry() *MemoryClientRegistry {
+	return &MemoryClientRegistry{
+		clients: map[string]Client{},
+	}
+}
+
+// NOTE: Generates id if empty and secret for confidential clients, the
+// secret is returned once and only its hash is kept
+func (r *MemoryClientRegistry) Register(ctx context.Context, c Client) (*Client, string, error) {
+	if len(c.RedirectURIs) == 0 && c.AllowsGrant(GrantAuthorizationCode) {
+		return nil, "", errors.New("client using authorization code grant must have redirect uris")
+	}
+
+	if c.IsPublic && c.AllowsGrant(GrantClientCredentials) {
+		return nil, "", errors.New("public client cannot use client credentials grant")
+	}
+
+	if len(c.Id) == 0 {
+		c.Id = crypto.RandomHex(16)
+	}
+
+	secret := ""
+	if !c.IsPublic {
+		secret = crypto.RandomHex(32)
+		c.SecretHash = HashSecret(secret)
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if _, exists := r.clients[c.Id]; exists {
+		return nil, "", errors.New("client with the same id is already registered")
+	}
+
+	r.clients[c.Id] = c
+	return &c, secret, nil
+}
+
+func (r *MemoryClientRegistry) GetClient(ctx context.Context, id string) (*Client, error) {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	c, exists := r.clients[id]
+	if !exists {
+		return nil, nil
+	}
+
+	return &c, nil
+}
+
+// NOTE: All grants except client credentials are allowed when GrantTypes
+// is empty
+func (c *Client) AllowsGrant(grant string) bool {
+	if len(c.GrantTypes) == 0 {
+		return grant != GrantClientCredentials
+	}
+
+	return slices.Contains(c.GrantTypes, grant)
+}
+
+// NOTE: Redirect uris are compared exactly, as required by OAuth 2.1
+func (c *Client) AllowsRedirect(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+func (c *Client) CheckSecret(secret string) bool {
+	if c.IsPublic || len(c.SecretHash) == 0 {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(c.SecretHash)) == 1
+}
+
+func HashSecret(secret string) string {
+	return crypto.Sha256Hex(secret)
+}
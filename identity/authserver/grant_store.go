@@ -0,0 +1,118 @@
+package authserver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const memoryStorePruneInterval = time.Minute
+
+// NOTE: Authorization granted by the user to the client, shared by codes
+// and refresh tokens issued for it
+type Grant struct {
+	ClientId  string    `json:"clientId"`
+	UserId    uuid.UUID `json:"userId"`
+	Scopes    []string  `json:"scopes"`
+	AuthTime  time.Time `json:"authTime"`
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// NOTE: Set for authorization codes only
+	RedirectURI   string `json:"redirectUri,omitempty"`
+	CodeChallenge string `json:"codeChallenge,omitempty"`
+	Nonce         string `json:"nonce,omitempty"`
+}
+
+// NOTE: Keys are SHA-256 hashes of codes and refresh tokens, so stored
+// values cannot be used if leaked. Take must atomically remove the entry,
+// nil is returned for unknown or expired entries
+type GrantStore interface {
+	SaveCode(context.Context, string, *Grant) error
+	TakeCode(context.Context, string) (*Grant, error)
+
+	SaveRefreshToken(context.Context, string, *Grant) error
+	GetRefreshToken(context.Context, string) (*Grant, error)
+	TakeRefreshToken(context.Context, string) (*Grant, error)
+}
+
+type MemoryGrantStore struct {
+	mx            sync.Mutex
+	codes         map[string]Grant
+	refreshTokens map[string]Grant
+	lastPrune     time.Time
+}
+
+func NewMemoryGrantStore() *MemoryGrantStore {
+	return &MemoryGrantStore{
+		codes:         map[string]Grant{},
+		refreshTokens: map[string]Grant{},
+	}
+}
+
+func (s *MemoryGrantStore) SaveCode(ctx context.Context, key string, g *Grant) error {
+	return s.save(s.codes, key, g)
+}
+
+func (s *MemoryGrantStore) TakeCode(ctx context.Context, key string) (*Grant, error) {
+	return s.get(s.codes, key, true), nil
+}
+
+func (s *MemoryGrantStore) SaveRefreshToken(ctx context.Context, key string, g *Grant) error {
+	return s.save(s.refreshTokens, key, g)
+}
+
+func (s *MemoryGrantStore) GetRefreshToken(ctx context.Context, key string) (*Grant, error) {
+	return s.get(s.refreshTokens, key, false), nil
+}
+
+func (s *MemoryGrantStore) TakeRefreshToken(ctx context.Context, key string) (*Grant, error) {
+	return s.get(s.refreshTokens, key, true), nil
+}
+
+func (s *MemoryGrantStore) save(entries map[string]Grant, key string, g *Grant) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.pruneExpired(time.Now())
+	entries[key] = *g
+
+	return nil
+}
+
+func (s *MemoryGrantStore) get(entries map[string]Grant, key string, remove bool) *Grant {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	g, exists := entries[key]
+	if !exists {
+		return nil
+	}
+
+	if remove {
+		delete(entries, key)
+	}
+
+	if time.Now().After(g.ExpiresAt) {
+		return nil
+	}
+
+	return &g
+}
+
+func (s *MemoryGrantStore) pruneExpired(now time.Time) {
+	if now.Sub(s.lastPrune) < memoryStorePruneInterval {
+		return
+	}
+
+	s.lastPrune = now
+
+	for _, entries := range []map[string]Grant{s.codes, s.refreshTokens} {
+		for key, g := range entries {
+			if now.After(g.ExpiresAt) {
+				delete(entries, key)
+			}
+		}
+	}
+}
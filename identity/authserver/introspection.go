@@ -0,0 +1,209 @@
+package authserver
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/router"
+)
+
+// NOTE: RFC 7662 response, inactive tokens are reported with Active only
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientId  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+}
+
+// NOTE: RFC 7662 introspection, available to confidential clients only
+func (s *Server[U]) Introspect() router.Handler {
+	logger := s.log()
+
+	return func(rctx *router.RequestContext) {
+		form, err := parseForm(rctx)
+		if err != nil {
+			respondError(rctx, invalidRequest("malformed form body"))
+			return
+		}
+
+		client, oauthErr := s.authenticateClient(rctx, form)
+		if oauthErr == nil && client.IsPublic {
+			oauthErr = &Error{Status: http.StatusUnauthorized, Code: "invalid_client"}
+		}
+
+		if oauthErr != nil {
+			respondError(rctx, oauthErr)
+			return
+		}
+
+		result, err := s.introspect(rctx.Context(), form.Get("token"))
+		if err != nil {
+			logger.Error("Introspect failure", "err", err.Error())
+			respondError(rctx, &Error{Status: http.StatusInternalServerError, Code: "server_error"})
+			return
+		}
+
+		noStore(rctx)
+		_, _ = rctx.Response.JSON(http.StatusOK, result)
+	}
+}
+
+// NOTE: RFC 7009 revocation, tokens of other clients and unknown tokens are
+// ignored, so the response is always successful
+func (s *Server[U]) Revoke() router.Handler {
+	logger := s.log()
+
+	return func(rctx *router.RequestContext) {
+		form, err := parseForm(rctx)
+		if err != nil {
+			respondError(rctx, invalidRequest("malformed form body"))
+			return
+		}
+
+		client, oauthErr := s.authenticateClient(rctx, form)
+		if oauthErr != nil {
+			respondError(rctx, oauthErr)
+			return
+		}
+
+		if err := s.revoke(rctx.Context(), client, form.Get("token")); err != nil {
+			logger.Error("Revoke failure", "err", err.Error())
+			respondError(rctx, &Error{Status: http.StatusServiceUnavailable, Code: "temporarily_unavailable"})
+			return
+		}
+
+		rctx.Response.String(http.StatusOK)
+	}
+}
+
+// NOTE: Requires access token with openid scope in Authorization header
+func (s *Server[U]) UserInfo() router.Handler {
+	logger := s.log()
+
+	return func(rctx *router.RequestContext) {
+		ctx := rctx.Context()
+
+		bearer, _ := strings.CutPrefix(rctx.Request.Headers().Get("Authorization"), "Bearer ")
+		token, scopes := s.accessTokenScopes(ctx, bearer)
+
+		var userId uuid.UUID
+		var err error
+
+		if token != nil {
+			userId, err = uuid.Parse(token.Claims().Subject)
+		}
+
+		if token == nil || err != nil || !slices.Contains(scopes, ScopeOpenId) {
+			rctx.Response.Headers().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			rctx.Response.String(http.StatusUnauthorized, "Unauthorized: invalid access token")
+			return
+		}
+
+		usr, err := s.Provider.Registry.GetUserById(ctx, &userId)
+		if err != nil {
+			logger.Error("UserInfo: user lookup failure", "err", err.Error())
+			rctx.Response.String(http.StatusInternalServerError, "UserInfo: user lookup failure")
+			return
+		}
+
+		if usr == nil {
+			rctx.Response.Headers().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			rctx.Response.String(http.StatusUnauthorized, "Unauthorized: user does not exist")
+			return
+		}
+
+		claims, err := s.userClaims(ctx, usr, scopes)
+		if err != nil {
+			logger.Error("UserInfo: claims failure", "err", err.Error())
+			rctx.Response.String(http.StatusInternalServerError, "UserInfo: claims failure")
+			return
+		}
+
+		claims["sub"] = userId.String()
+
+		noStore(rctx)
+		_, _ = rctx.Response.JSON(http.StatusOK, claims)
+	}
+}
+
+func (s *Server[U]) introspect(ctx context.Context, tokenStr string) (*Introspection, error) {
+	if token, scopes := s.accessTokenScopes(ctx, tokenStr); token != nil {
+		claims := token.Claims()
+		clientId, _ := claims.String(ClientIdClaim)
+
+		return &Introspection{
+			Active:    true,
+			Scope:     strings.Join(scopes, " "),
+			ClientId:  clientId,
+			Subject:   claims.Subject,
+			TokenType: "Bearer",
+			ExpiresAt: claims.ExpiresAt.Unix(),
+			IssuedAt:  claims.IssuedAt.Unix(),
+			Issuer:    claims.Issuer,
+		}, nil
+	}
+
+	grant, err := s.Grants.GetRefreshToken(ctx, hashToken(tokenStr))
+	if err != nil || grant == nil {
+		return &Introspection{Active: false}, err
+	}
+
+	return &Introspection{
+		Active:    true,
+		Scope:     strings.Join(grant.Scopes, " "),
+		ClientId:  grant.ClientId,
+		Subject:   grant.UserId.String(),
+		TokenType: "refresh_token",
+		ExpiresAt: grant.ExpiresAt.Unix(),
+		Issuer:    s.Issuer,
+	}, nil
+}
+
+func (s *Server[U]) revoke(ctx context.Context, client *Client, tokenStr string) error {
+	if token, _ := s.accessTokenScopes(ctx, tokenStr); token != nil {
+		if clientId, _ := token.Claims().String(ClientIdClaim); clientId != client.Id {
+			return nil
+		}
+
+		return s.Provider.RevokeToken(ctx, token)
+	}
+
+	key := hashToken(tokenStr)
+
+	grant, err := s.Grants.GetRefreshToken(ctx, key)
+	if err != nil || grant == nil || grant.ClientId != client.Id {
+		return err
+	}
+
+	_, err = s.Grants.TakeRefreshToken(ctx, key)
+	return err
+}
+
+// NOTE: Returns nil token if it is not a valid access token issued by the
+// server
+func (s *Server[U]) accessTokenScopes(ctx context.Context, tokenStr string) (*identity.Token, []string) {
+	if len(tokenStr) == 0 {
+		return nil, nil
+	}
+
+	token, err := s.Provider.VerifyToken(ctx, tokenStr)
+	if err != nil {
+		return nil, nil
+	}
+
+	claims := token.Claims()
+	if use, _ := claims.String(identity.TokenUseClaim); use != TokenUseOAuthAccess || claims.Issuer != s.Issuer {
+		return nil, nil
+	}
+
+	scope, _ := claims.String(ScopeClaim)
+	return token, parseScopes(scope)
+}
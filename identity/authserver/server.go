@@ -0,0 +1,225 @@
+// Package authserver implements OAuth2 authorization server on top of
+// identity.RegistryProvider, so other services can delegate signin to it
+package authserver
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yandzee/go-svc/crypto"
+	"github.com/yandzee/go-svc/identity"
+	idhttp "github.com/yandzee/go-svc/identity/http"
+	"github.com/yandzee/go-svc/log"
+	"github.com/yandzee/go-svc/router"
+)
+
+const (
+	ScopeOpenId        = "openid"
+	ScopeOfflineAccess = "offline_access"
+
+	// NOTE: Value of TokenUseClaim of access tokens issued to clients, so
+	// they are not accepted as session tokens of the IdentityEndpoint
+	TokenUseOAuthAccess = "oauth_access"
+
+	ScopeClaim    = "scope"
+	ClientIdClaim = "client_id"
+
+	DefaultAccessTokenDuration  = 10 * time.Minute
+	DefaultRefreshTokenDuration = 30 * 24 * time.Hour
+	DefaultCodeDuration         = time.Minute
+
+	KiloByte = 1024
+)
+
+type Paths struct {
+	Authorize  string
+	Token      string
+	Introspect string
+	Revoke     string
+	UserInfo   string
+	JWKS       string
+}
+
+var DefaultPaths = Paths{
+	Authorize:  "/oauth2/authorize",
+	Token:      "/oauth2/token",
+	Introspect: "/oauth2/introspect",
+	Revoke:     "/oauth2/revoke",
+	UserInfo:   "/oauth2/userinfo",
+	JWKS:       "/oauth2/jwks",
+}
+
+type ConsentRequest[U identity.User] struct {
+	User   *U
+	Client *Client
+	Scopes []string
+}
+
+type Server[U identity.User] struct {
+	Log      *slog.Logger
+	Provider *identity.RegistryProvider[U]
+
+	// NOTE: Authenticates users at the authorization endpoint, so the user
+	// has to be signed in by the endpoint before
+	Endpoint *idhttp.IdentityEndpoint[U]
+
+	Clients ClientRegistry
+	Grants  GrantStore
+
+	// NOTE: Absolute URL used as `iss` of issued tokens, Paths are relative
+	// to it in the discovery document
+	Issuer string
+	Paths  Paths
+
+	AccessTokenDuration  time.Duration
+	RefreshTokenDuration time.Duration
+	CodeDuration         time.Duration
+
+	ScopesSupported []string
+
+	// NOTE: Called for clients which are not trusted, returns scopes
+	// granted by the user, empty result means access is denied. All
+	// requested scopes are granted when nil
+	Consent func(context.Context, ConsentRequest[U]) ([]string, error)
+
+	// NOTE: Claims returned by userinfo and embedded into ID tokens
+	UserClaims func(context.Context, *U, []string) (map[string]any, error)
+
+	// NOTE: Users not signed in are redirected to the returned URL, which
+	// should bring them back to the authorization URL, 401 is responded
+	// when nil
+	LoginURL func(authorizeURL string) string
+}
+
+func New[U identity.User](
+	provider *identity.RegistryProvider[U],
+	endpoint *idhttp.IdentityEndpoint[U],
+	clients ClientRegistry,
+	issuer string,
+) *Server[U] {
+	return &Server[U]{
+		Provider:             provider,
+		Endpoint:             endpoint,
+		Clients:              clients,
+		Grants:               NewMemoryGrantStore(),
+		Issuer:               strings.TrimSuffix(issuer, "/"),
+		Paths:                DefaultPaths,
+		AccessTokenDuration:  DefaultAccessTokenDuration,
+		RefreshTokenDuration: DefaultRefreshTokenDuration,
+		CodeDuration:         DefaultCodeDuration,
+	}
+}
+
+// NOTE: Registers all endpoints at Paths and discovery document at
+// `/.well-known/openid-configuration`
+func (s *Server[U]) Routes(b *router.Builder) {
+	b.Get("/.well-known/openid-configuration", s.Discovery())
+	b.Get(s.Paths.Authorize, s.Authorize())
+	b.Post(s.Paths.Token, s.Token())
+	b.Post(s.Paths.Introspect, s.Introspect())
+	b.Post(s.Paths.Revoke, s.Revoke())
+	b.Get(s.Paths.UserInfo, s.UserInfo())
+	b.Get(s.Paths.JWKS, s.Endpoint.JWKS())
+}
+
+func (s *Server[U]) Discovery() router.Handler {
+	logger := s.log()
+
+	return func(rctx *router.RequestContext) {
+		algs := []string{}
+
+		method, err := s.Provider.SigningMethod()
+		if err != nil {
+			logger.Error("Discovery: signing method is unavailable", "err", err.Error())
+		} else {
+			algs = append(algs, method.Alg())
+		}
+
+		rctx.Response.Headers().Set("Cache-Control", "public, max-age=300")
+
+		_, _ = rctx.Response.JSON(http.StatusOK, map[string]any{
+			"issuer":                                s.Issuer,
+			"authorization_endpoint":                s.Issuer + s.Paths.Authorize,
+			"token_endpoint":                        s.Issuer + s.Paths.Token,
+			"introspection_endpoint":                s.Issuer + s.Paths.Introspect,
+			"revocation_endpoint":                   s.Issuer + s.Paths.Revoke,
+			"userinfo_endpoint":                     s.Issuer + s.Paths.UserInfo,
+			"jwks_uri":                              s.Issuer + s.Paths.JWKS,
+			"scopes_supported":                      s.scopesSupported(),
+			"response_types_supported":              []string{"code"},
+			"grant_types_supported":                 []string{GrantAuthorizationCode, GrantClientCredentials, GrantRefreshToken},
+			"code_challenge_methods_supported":      []string{"S256"},
+			"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": algs,
+		})
+	}
+}
+
+func (s *Server[U]) scopesSupported() []string {
+	scopes := []string{ScopeOpenId, ScopeOfflineAccess}
+
+	for _, scope := range s.ScopesSupported {
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes
+}
+
+// NOTE: Requested scopes are narrowed to the ones allowed for the client,
+// openid and offline_access are always allowed
+func (s *Server[U]) allowedScopes(client *Client, requested []string) []string {
+	allowed := []string{}
+
+	for _, scope := range requested {
+		switch {
+		case scope == ScopeOpenId, scope == ScopeOfflineAccess:
+		case slices.Contains(client.Scopes, scope):
+		default:
+			continue
+		}
+
+		if !slices.Contains(allowed, scope) {
+			allowed = append(allowed, scope)
+		}
+	}
+
+	return allowed
+}
+
+func (s *Server[U]) log() *slog.Logger {
+	return log.OrDiscard(s.Log)
+}
+
+func parseScopes(scope string) []string {
+	return strings.Fields(scope)
+}
+
+func hashToken(token string) string {
+	return crypto.Sha256Hex(token)
+}
+
+func parseForm(rctx *router.RequestContext) (url.Values, error) {
+	body, err := io.ReadAll(rctx.Request.LimitedBody(16 * KiloByte))
+	if err != nil {
+		return nil, err
+	}
+
+	return url.ParseQuery(string(body))
+}
+
+func durationOr(dur, fallback time.Duration) time.Duration {
+	if dur <= 0 {
+		return fallback
+	}
+
+	return dur
+}
@@ -0,0 +1,387 @@
+package authserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yandzee/go-svc/crypto"
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/identity/oidc"
+	"github.com/yandzee/go-svc/router"
+)
+
+// NOTE: Error of token, introspection and revocation endpoints, RFC 6749
+// section 5.2
+type Error struct {
+	Status      int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IdToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+func (s *Server[U]) Token() router.Handler {
+	logger := s.log()
+
+	return func(rctx *router.RequestContext) {
+		form, err := parseForm(rctx)
+		if err != nil {
+			respondError(rctx, invalidRequest("malformed form body"))
+			return
+		}
+
+		client, oauthErr := s.authenticateClient(rctx, form)
+		if oauthErr != nil {
+			respondError(rctx, oauthErr)
+			return
+		}
+
+		grantType := form.Get("grant_type")
+		if !client.AllowsGrant(grantType) {
+			respondError(rctx, &Error{
+				Status:      http.StatusBadRequest,
+				Code:        "unauthorized_client",
+				Description: "grant type is not allowed for the client",
+			})
+			return
+		}
+
+		var resp *TokenResponse
+
+		switch grantType {
+		case GrantAuthorizationCode:
+			resp, err = s.exchangeCode(rctx.Context(), client, form)
+		case GrantClientCredentials:
+			resp, err = s.clientCredentials(rctx.Context(), client, form)
+		case GrantRefreshToken:
+			resp, err = s.refresh(rctx.Context(), client, form)
+		default:
+			err = &Error{
+				Status: http.StatusBadRequest,
+				Code:   "unsupported_grant_type",
+			}
+		}
+
+		if errors.As(err, &oauthErr) {
+			respondError(rctx, oauthErr)
+			return
+		}
+
+		if err != nil {
+			logger.Error("Token: failed to issue tokens", "grant", grantType, "err", err.Error())
+			respondError(rctx, &Error{Status: http.StatusInternalServerError, Code: "server_error"})
+			return
+		}
+
+		noStore(rctx)
+		_, _ = rctx.Response.JSON(http.StatusOK, resp)
+	}
+}
+
+func (s *Server[U]) exchangeCode(ctx context.Context, client *Client, form url.Values) (*TokenResponse, error) {
+	grant, err := s.Grants.TakeCode(ctx, hashToken(form.Get("code")))
+	if err != nil {
+		return nil, err
+	}
+
+	verifier := form.Get("code_verifier")
+	challenge := oidc.CodeChallenge(verifier)
+
+	switch {
+	case grant == nil, grant.ClientId != client.Id:
+		return nil, invalidGrant("code is invalid, expired or already used")
+	case grant.RedirectURI != form.Get("redirect_uri"):
+		return nil, invalidGrant("redirect uri does not match")
+	case len(verifier) == 0 || subtle.ConstantTimeCompare([]byte(challenge), []byte(grant.CodeChallenge)) != 1:
+		return nil, invalidGrant("PKCE verification failed")
+	}
+
+	return s.issueUserTokens(ctx, client, grant)
+}
+
+func (s *Server[U]) refresh(ctx context.Context, client *Client, form url.Values) (*TokenResponse, error) {
+	grant, err := s.Grants.TakeRefreshToken(ctx, hashToken(form.Get("refresh_token")))
+	if err != nil {
+		return nil, err
+	}
+
+	if grant == nil || grant.ClientId != client.Id {
+		return nil, invalidGrant("refresh token is invalid, expired or revoked")
+	}
+
+	// NOTE: Scope can only be narrowed on refresh
+	if requested := parseScopes(form.Get("scope")); len(requested) > 0 {
+		for _, scope := range requested {
+			if !slices.Contains(grant.Scopes, scope) {
+				return nil, &Error{
+					Status:      http.StatusBadRequest,
+					Code:        "invalid_scope",
+					Description: "scope exceeds the original grant",
+				}
+			}
+		}
+
+		grant.Scopes = requested
+	}
+
+	grant.Nonce = ""
+	return s.issueUserTokens(ctx, client, grant)
+}
+
+func (s *Server[U]) clientCredentials(ctx context.Context, client *Client, form url.Values) (*TokenResponse, error) {
+	if client.IsPublic {
+		return nil, &Error{
+			Status:      http.StatusBadRequest,
+			Code:        "unauthorized_client",
+			Description: "public clients cannot use client credentials grant",
+		}
+	}
+
+	scopes := slices.DeleteFunc(s.allowedScopes(client, parseScopes(form.Get("scope"))), func(scope string) bool {
+		return scope == ScopeOpenId || scope == ScopeOfflineAccess
+	})
+
+	access, expiresIn, err := s.accessToken(client, client.Id, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   expiresIn,
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// NOTE: Refresh token is issued if the client may use refresh grant, ID
+// token is issued for openid scope
+func (s *Server[U]) issueUserTokens(ctx context.Context, client *Client, grant *Grant) (*TokenResponse, error) {
+	usr, err := s.Provider.Registry.GetUserById(ctx, &grant.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if usr == nil {
+		return nil, invalidGrant("user does not exist anymore")
+	}
+
+	access, expiresIn, err := s.accessToken(client, grant.UserId.String(), grant.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &TokenResponse{
+		AccessToken: access,
+		TokenType:   "Bearer",
+		ExpiresIn:   expiresIn,
+		Scope:       strings.Join(grant.Scopes, " "),
+	}
+
+	if client.AllowsGrant(GrantRefreshToken) {
+		resp.RefreshToken = crypto.RandomHex(32)
+
+		refreshGrant := *grant
+		refreshGrant.RedirectURI = ""
+		refreshGrant.CodeChallenge = ""
+		refreshGrant.Nonce = ""
+		refreshGrant.ExpiresAt = time.Now().Add(durationOr(s.RefreshTokenDuration, DefaultRefreshTokenDuration))
+
+		if err := s.Grants.SaveRefreshToken(ctx, hashToken(resp.RefreshToken), &refreshGrant); err != nil {
+			return nil, err
+		}
+	}
+
+	if slices.Contains(grant.Scopes, ScopeOpenId) {
+		resp.IdToken, err = s.idToken(ctx, client, usr, grant)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *Server[U]) accessToken(client *Client, subject string, scopes []string) (string, int64, error) {
+	now := time.Now()
+	dur := durationOr(s.AccessTokenDuration, DefaultAccessTokenDuration)
+
+	token, err := s.Provider.SignClaims(&identity.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.Issuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{client.Id},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(dur)),
+			ID:        "oa-" + crypto.RandomHex(16),
+		},
+		Custom: map[string]any{
+			identity.TokenUseClaim: TokenUseOAuthAccess,
+			ClientIdClaim:          client.Id,
+			ScopeClaim:             strings.Join(scopes, " "),
+		},
+	})
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	return token.JWTString, int64(dur.Seconds()), nil
+}
+
+func (s *Server[U]) idToken(ctx context.Context, client *Client, usr *U, grant *Grant) (string, error) {
+	now := time.Now()
+
+	custom, err := s.userClaims(ctx, usr, grant.Scopes)
+	if err != nil {
+		return "", err
+	}
+
+	custom["auth_time"] = grant.AuthTime.Unix()
+	if len(grant.Nonce) > 0 {
+		custom["nonce"] = grant.Nonce
+	}
+
+	token, err := s.Provider.SignClaims(&identity.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.Issuer,
+			Subject:   grant.UserId.String(),
+			Audience:  jwt.ClaimStrings{client.Id},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(durationOr(s.AccessTokenDuration, DefaultAccessTokenDuration))),
+			ID:        "oi-" + crypto.RandomHex(16),
+		},
+		Custom: custom,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return token.JWTString, nil
+}
+
+func (s *Server[U]) userClaims(ctx context.Context, usr *U, scopes []string) (map[string]any, error) {
+	claims := map[string]any{}
+
+	if s.UserClaims == nil {
+		return claims, nil
+	}
+
+	custom, err := s.UserClaims(ctx, usr, scopes)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("UserClaims failure"), err)
+	}
+
+	for name, val := range custom {
+		claims[name] = val
+	}
+
+	return claims, nil
+}
+
+// NOTE: Accepts client_secret_basic, client_secret_post and public clients
+// identified by client_id only
+func (s *Server[U]) authenticateClient(rctx *router.RequestContext, form url.Values) (*Client, *Error) {
+	id, secret, isBasic := basicAuth(rctx.Request.Headers().Get("Authorization"))
+	if !isBasic {
+		id, secret = form.Get("client_id"), form.Get("client_secret")
+	}
+
+	unauthorized := &Error{
+		Status:      http.StatusUnauthorized,
+		Code:        "invalid_client",
+		Description: "client authentication failed",
+	}
+
+	if isBasic {
+		rctx.Response.Headers().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+	}
+
+	if len(id) == 0 {
+		return nil, unauthorized
+	}
+
+	client, err := s.Clients.GetClient(rctx.Context(), id)
+	if err != nil {
+		s.log().Error("client lookup failure", "err", err.Error())
+		return nil, &Error{Status: http.StatusInternalServerError, Code: "server_error"}
+	}
+
+	switch {
+	case client == nil:
+		return nil, unauthorized
+	case client.IsPublic && len(secret) == 0:
+		return client, nil
+	case !client.CheckSecret(secret):
+		return nil, unauthorized
+	}
+
+	return client, nil
+}
+
+// NOTE: Credentials are form-urlencoded before base64 as RFC 6749 requires
+func basicAuth(header string) (string, string, bool) {
+	req := http.Request{Header: http.Header{"Authorization": {header}}}
+
+	id, secret, isOk := req.BasicAuth()
+	if !isOk {
+		return "", "", false
+	}
+
+	id, errId := url.QueryUnescape(id)
+	secret, errSecret := url.QueryUnescape(secret)
+
+	return id, secret, errId == nil && errSecret == nil
+}
+
+func respondError(rctx *router.RequestContext, err *Error) {
+	noStore(rctx)
+
+	status := err.Status
+	if status == 0 {
+		status = http.StatusBadRequest
+	}
+
+	_, _ = rctx.Response.JSON(status, err)
+}
+
+func noStore(rctx *router.RequestContext) {
+	rctx.Response.Headers().Set("Cache-Control", "no-store")
+	rctx.Response.Headers().Set("Pragma", "no-cache")
+}
+
+func invalidRequest(description string) *Error {
+	return &Error{
+		Status:      http.StatusBadRequest,
+		Code:        "invalid_request",
+		Description: description,
+	}
+}
+
+func invalidGrant(description string) *Error {
+	return &Error{
+		Status:      http.StatusBadRequest,
+		Code:        "invalid_grant",
+		Description: description,
+	}
+}
@@ -0,0 +1,141 @@
+package identity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+var registeredClaimNames = map[string]struct{}{
+	"iss": {},
+	"sub": {},
+	"aud": {},
+	"exp": {},
+	"nbf": {},
+	"iat": {},
+	"jti": {},
+}
+
+// NOTE: Custom claims are encoded next to registered ones, custom claims
+// named as registered ones are ignored
+type Claims struct {
+	jwt.RegisteredClaims
+
+	Custom map[string]any
+}
+
+func (c *Claims) Get(name string) (any, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	val, exists := c.Custom[name]
+	return val, exists
+}
+
+func (c *Claims) String(name string) (string, bool) {
+	val, _ := c.Get(name)
+
+	str, isOk := val.(string)
+	return str, isOk
+}
+
+// NOTE: Single string claim is returned as one element slice
+func (c *Claims) Strings(name string) ([]string, bool) {
+	val, exists := c.Get(name)
+	if !exists {
+		return nil, false
+	}
+
+	switch val := val.(type) {
+	case string:
+		return []string{val}, true
+	case []string:
+		return val, true
+	case []any:
+		strs := make([]string, 0, len(val))
+
+		for _, v := range val {
+			str, isOk := v.(string)
+			if !isOk {
+				return nil, false
+			}
+
+			strs = append(strs, str)
+		}
+
+		return strs, true
+	}
+
+	return nil, false
+}
+
+func (c *Claims) Has(name string) bool {
+	_, exists := c.Get(name)
+	return exists
+}
+
+// NOTE: Decodes custom claims into typed struct, using json tags
+func (c *Claims) Decode(dst any) error {
+	var custom map[string]any
+	if c != nil {
+		custom = c.Custom
+	}
+
+	encoded, err := json.Marshal(custom)
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to encode custom claims"), err)
+	}
+
+	if err := json.Unmarshal(encoded, dst); err != nil {
+		return errors.Join(fmt.Errorf("failed to decode custom claims"), err)
+	}
+
+	return nil
+}
+
+// Implements json.Marshaler
+func (c Claims) MarshalJSON() ([]byte, error) {
+	encoded, err := json.Marshal(c.RegisteredClaims)
+	if err != nil || len(c.Custom) == 0 {
+		return encoded, err
+	}
+
+	merged := map[string]any{}
+	if err := json.Unmarshal(encoded, &merged); err != nil {
+		return nil, err
+	}
+
+	for name, val := range c.Custom {
+		if _, isRegistered := registeredClaimNames[name]; !isRegistered {
+			merged[name] = val
+		}
+	}
+
+	return json.Marshal(merged)
+}
+
+// Implements json.Unmarshaler
+func (c *Claims) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &c.RegisteredClaims); err != nil {
+		return err
+	}
+
+	all := map[string]any{}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return err
+	}
+
+	for name := range registeredClaimNames {
+		delete(all, name)
+	}
+
+	c.Custom = nil
+	if len(all) > 0 {
+		c.Custom = all
+	}
+
+	return nil
+}
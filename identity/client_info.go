@@ -0,0 +1,19 @@
+package identity
+
+import "context"
+
+type ClientInfo struct {
+	Address   string `json:"address"`
+	UserAgent string `json:"userAgent"`
+}
+
+type clientInfoKey struct{}
+
+func WithClientInfo(ctx context.Context, ci ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, ci)
+}
+
+func ClientInfoFrom(ctx context.Context) (ClientInfo, bool) {
+	ci, isOk := ctx.Value(clientInfoKey{}).(ClientInfo)
+	return ci, isOk
+}
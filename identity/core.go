@@ -6,10 +6,14 @@ import (
 	"fmt"
 
 	"github.com/yandzee/go-svc/crypto"
+	"github.com/yandzee/go-svc/identity/password"
 )
 
 type Utils struct {
 	SaltBytes uint32
+
+	// NOTE: Hasher with default argon2id parameters is used when nil
+	Passwords *password.Hasher
 }
 
 func (dc *Utils) GenerateSalt() string {
@@ -21,6 +25,8 @@ func (dc *Utils) GenerateSalt() string {
 	return crypto.RandomSha256(nbytes)
 }
 
+// NOTE: Single round of SHA-256 is not suitable for password storage, use
+// HashPassword and CheckPassword instead
 func (dc *Utils) Salt(salt string, target string) string {
 	h := sha256.New()
 	_, _ = fmt.Fprintf(h, "%s.%s", salt, target)
@@ -28,3 +34,24 @@ func (dc *Utils) Salt(salt string, target string) string {
 	return hex.EncodeToString(h.Sum(nil))
 
 }
+
+func (dc *Utils) HashPassword(pwd string) (string, error) {
+	return dc.passwords().Hash(pwd)
+}
+
+// NOTE: Meant to be used in UsersRegistry.UserHasCredentials, onRehash is
+// called with the new hash to be stored when the stored one is outdated
+func (dc *Utils) CheckPassword(
+	pwd, encoded string,
+	onRehash func(string) error,
+) (bool, error) {
+	return dc.passwords().Check(pwd, encoded, onRehash)
+}
+
+func (dc *Utils) passwords() *password.Hasher {
+	if dc.Passwords == nil {
+		return password.NewHasher()
+	}
+
+	return dc.Passwords
+}
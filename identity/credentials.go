@@ -1,10 +1,16 @@
 package identity
 
+import (
+	"slices"
+	"strings"
+)
+
 type Credentials map[string]string
 
 type FieldCheck struct {
-	IsCorrect bool   `json:"isCorrect"`
-	Details   string `json:"details"`
+	IsCorrect bool     `json:"isCorrect"`
+	Details   string   `json:"details"`
+	Reasons   []string `json:"reasons,omitempty"`
 }
 
 type CredentialsCheck map[string]FieldCheck
@@ -19,6 +25,31 @@ func (fc CredentialsCheck) HasIncorrect() (*FieldCheck, bool) {
 	return nil, false
 }
 
+// NOTE: Field is correct only if it is correct in both checks, details and
+// reasons of incorrect ones are joined
+func (fc CredentialsCheck) Merge(other CredentialsCheck) CredentialsCheck {
+	merged := CredentialsCheck{}
+
+	for field, ch := range fc {
+		merged[field] = ch
+	}
+
+	for field, ch := range other {
+		existing, exists := merged[field]
+
+		switch {
+		case !exists, existing.IsCorrect && !ch.IsCorrect:
+			merged[field] = ch
+		case !existing.IsCorrect && !ch.IsCorrect:
+			existing.Details = strings.Join([]string{existing.Details, ch.Details}, "; ")
+			existing.Reasons = append(slices.Clone(existing.Reasons), ch.Reasons...)
+			merged[field] = existing
+		}
+	}
+
+	return merged
+}
+
 func (f Credentials) Get(key string) string {
 	return f[key]
 }
@@ -0,0 +1,354 @@
+package identity
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsList string
+
+var bundledCommonPasswords = sync.OnceValue(func() map[string]struct{} {
+	passwords := map[string]struct{}{}
+
+	for line := range strings.Lines(commonPasswordsList) {
+		if pwd := strings.TrimSpace(line); len(pwd) > 0 {
+			passwords[pwd] = struct{}{}
+		}
+	}
+
+	return passwords
+})
+
+// NOTE: Machine readable reasons reported in FieldCheck.Reasons
+const (
+	ReasonMissing           = "missing"
+	ReasonTooShort          = "too_short"
+	ReasonTooLong           = "too_long"
+	ReasonMissingLower      = "missing_lower"
+	ReasonMissingUpper      = "missing_upper"
+	ReasonMissingDigit      = "missing_digit"
+	ReasonMissingSymbol     = "missing_symbol"
+	ReasonTooFewClasses     = "too_few_classes"
+	ReasonCommon            = "common"
+	ReasonSimilarToUsername = "similar_to_username"
+	ReasonLowEntropy        = "low_entropy"
+)
+
+// NOTE: Lengths are counted in runes, zero limits are not enforced
+type CredentialsPolicy struct {
+	UsernameField string
+	PasswordField string
+
+	MinUsernameLength int
+	MaxUsernameLength int
+	MinPasswordLength int
+	MaxPasswordLength int
+
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+
+	// NOTE: Number of distinct classes out of lower, upper, digit, symbol
+	MinCharClasses int
+
+	// NOTE: Compared case-insensitively, bundled list is used when nil
+	CommonPasswords         map[string]struct{}
+	CommonPasswordsDisabled bool
+
+	UsernameSimilarityDisabled bool
+	MinEntropyBits             float64
+}
+
+func DefaultCredentialsPolicy() *CredentialsPolicy {
+	return &CredentialsPolicy{
+		MinUsernameLength: MinUsernameLength,
+		MaxUsernameLength: MaxUsernameLength,
+		MinPasswordLength: MinPasswordLength,
+		MaxPasswordLength: MaxPasswordLength,
+		MinEntropyBits:    36,
+	}
+}
+
+func (p *CredentialsPolicy) Check(creds Credentials) CredentialsCheck {
+	username := creds.Get(p.usernameField())
+	pwd := creds.Get(p.passwordField())
+
+	return CredentialsCheck{
+		p.usernameField(): p.CheckUsername(username),
+		p.passwordField(): p.CheckPassword(pwd, username),
+	}
+}
+
+func (p *CredentialsPolicy) CheckUsername(username string) FieldCheck {
+	fc := fieldCheckBuilder{}
+
+	n := utf8.RuneCountInString(username)
+
+	switch {
+	case n == 0:
+		fc.fail(ReasonMissing, "username is required")
+	case p.MinUsernameLength > 0 && n < p.MinUsernameLength:
+		fc.fail(ReasonTooShort, fmt.Sprintf("username min length is %d", p.MinUsernameLength))
+	case p.MaxUsernameLength > 0 && n > p.MaxUsernameLength:
+		fc.fail(ReasonTooLong, fmt.Sprintf("username max length is %d", p.MaxUsernameLength))
+	}
+
+	return fc.result()
+}
+
+// NOTE: Username is only used for similarity check and may be empty
+func (p *CredentialsPolicy) CheckPassword(pwd, username string) FieldCheck {
+	fc := fieldCheckBuilder{}
+
+	n := utf8.RuneCountInString(pwd)
+	if n == 0 {
+		fc.fail(ReasonMissing, "password is required")
+		return fc.result()
+	}
+
+	if p.MinPasswordLength > 0 && n < p.MinPasswordLength {
+		fc.fail(ReasonTooShort, fmt.Sprintf("password min length is %d", p.MinPasswordLength))
+	}
+
+	if p.MaxPasswordLength > 0 && n > p.MaxPasswordLength {
+		fc.fail(ReasonTooLong, fmt.Sprintf("password max length is %d", p.MaxPasswordLength))
+	}
+
+	classes := charClassesOf(pwd)
+
+	if p.RequireLower && !classes.Lower {
+		fc.fail(ReasonMissingLower, "password must contain a lowercase letter")
+	}
+
+	if p.RequireUpper && !classes.Upper {
+		fc.fail(ReasonMissingUpper, "password must contain an uppercase letter")
+	}
+
+	if p.RequireDigit && !classes.Digit {
+		fc.fail(ReasonMissingDigit, "password must contain a digit")
+	}
+
+	if p.RequireSymbol && !classes.Symbol {
+		fc.fail(ReasonMissingSymbol, "password must contain a symbol")
+	}
+
+	if p.MinCharClasses > 0 && classes.count() < p.MinCharClasses {
+		fc.fail(
+			ReasonTooFewClasses,
+			fmt.Sprintf("password must contain at least %d of lowercase, uppercase, digits and symbols", p.MinCharClasses),
+		)
+	}
+
+	if !p.CommonPasswordsDisabled && p.isCommon(pwd) {
+		fc.fail(ReasonCommon, "password is too common")
+	}
+
+	if !p.UsernameSimilarityDisabled && isSimilar(pwd, username) {
+		fc.fail(ReasonSimilarToUsername, "password is too similar to username")
+	}
+
+	if p.MinEntropyBits > 0 && PasswordEntropy(pwd) < p.MinEntropyBits {
+		fc.fail(ReasonLowEntropy, "password is too predictable")
+	}
+
+	return fc.result()
+}
+
+// NOTE: Rough estimate in bits: length times log2 of character pool size,
+// where runes repeating the previous one or continuing ascending/descending
+// sequence count as a quarter
+func PasswordEntropy(pwd string) float64 {
+	classes := charClassesOf(pwd)
+
+	pool := 0
+	if classes.Lower {
+		pool += 26
+	}
+
+	if classes.Upper {
+		pool += 26
+	}
+
+	if classes.Digit {
+		pool += 10
+	}
+
+	if classes.Symbol {
+		pool += 33
+	}
+
+	if classes.Other {
+		pool += 100
+	}
+
+	if pool == 0 {
+		return 0
+	}
+
+	effective := 0.0
+	prev, prevDelta := rune(-1), rune(0)
+
+	for _, r := range pwd {
+		delta := r - prev
+
+		switch {
+		case prev < 0:
+			effective += 1
+		case delta == 0, (delta == 1 || delta == -1) && delta == prevDelta:
+			effective += 0.25
+		default:
+			effective += 1
+		}
+
+		prev, prevDelta = r, delta
+	}
+
+	return effective * math.Log2(float64(pool))
+}
+
+func (p *CredentialsPolicy) isCommon(pwd string) bool {
+	list := p.CommonPasswords
+	if list == nil {
+		list = bundledCommonPasswords()
+	}
+
+	_, isCommon := list[strings.ToLower(pwd)]
+	return isCommon
+}
+
+func (p *CredentialsPolicy) usernameField() string {
+	if len(p.UsernameField) == 0 {
+		return "username"
+	}
+
+	return p.UsernameField
+}
+
+func (p *CredentialsPolicy) passwordField() string {
+	if len(p.PasswordField) == 0 {
+		return "password"
+	}
+
+	return p.PasswordField
+}
+
+type charClasses struct {
+	Lower, Upper, Digit, Symbol, Other bool
+}
+
+func (cc charClasses) count() int {
+	n := 0
+
+	for _, has := range []bool{cc.Lower, cc.Upper, cc.Digit, cc.Symbol} {
+		if has {
+			n += 1
+		}
+	}
+
+	return n
+}
+
+func charClassesOf(s string) charClasses {
+	cc := charClasses{}
+
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z':
+			cc.Lower = true
+		case r >= 'A' && r <= 'Z':
+			cc.Upper = true
+		case r >= '0' && r <= '9':
+			cc.Digit = true
+		case r < utf8.RuneSelf && unicode.IsPrint(r):
+			cc.Symbol = true
+		case unicode.IsLower(r):
+			cc.Lower, cc.Other = true, true
+		case unicode.IsUpper(r):
+			cc.Upper, cc.Other = true, true
+		default:
+			cc.Other = true
+		}
+	}
+
+	return cc
+}
+
+// NOTE: Password containing username (or reversed one) or being close to it
+// by edit distance is considered similar
+func isSimilar(pwd, username string) bool {
+	if utf8.RuneCountInString(username) < 3 {
+		return false
+	}
+
+	p, u := strings.ToLower(pwd), strings.ToLower(username)
+
+	if strings.Contains(p, u) || strings.Contains(u, p) || strings.Contains(p, reversed(u)) {
+		return true
+	}
+
+	longest := max(utf8.RuneCountInString(p), utf8.RuneCountInString(u))
+	return levenshtein(p, u)*3 <= longest
+}
+
+func reversed(s string) string {
+	runes := []rune(s)
+
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+
+	return string(runes)
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+type fieldCheckBuilder struct {
+	reasons []string
+	details []string
+}
+
+func (b *fieldCheckBuilder) fail(reason, details string) {
+	b.reasons = append(b.reasons, reason)
+	b.details = append(b.details, details)
+}
+
+func (b *fieldCheckBuilder) result() FieldCheck {
+	return FieldCheck{
+		IsCorrect: len(b.reasons) == 0,
+		Details:   strings.Join(b.details, "; "),
+		Reasons:   b.reasons,
+	}
+}
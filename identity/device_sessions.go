@@ -0,0 +1,131 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+// NOTE: Claim of access tokens holding id of the device session they are
+// issued within, i.e. server-side session or refresh token family
+const SessionIdClaim = "sid"
+
+var ErrDeviceSessionsNotSupported = errors.New("device sessions are not supported")
+
+// NOTE: Signed in device of the user, backed by server-side session or by
+// refresh token family depending on provider mode
+type DeviceSession struct {
+	Id         string     `json:"id"`
+	Client     ClientInfo `json:"client"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt time.Time  `json:"lastUsedAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	IsCurrent  bool       `json:"isCurrent"`
+}
+
+// NOTE: Token is the one of the current request, used to mark the current
+// device session
+type DeviceSessionProvider[U User] interface {
+	ListDeviceSessions(context.Context, *U, *Token) ([]*DeviceSession, error)
+	RevokeDeviceSession(context.Context, *U, string) (bool, error)
+}
+
+// NOTE: Returns ErrDeviceSessionsNotSupported unless sessions are enabled
+// or refresh token store implements RefreshTokenFamilyLister
+func (p *RegistryProvider[U]) ListDeviceSessions(
+	ctx context.Context,
+	usr *U,
+	current *Token,
+) ([]*DeviceSession, error) {
+	devices := []*DeviceSession{}
+
+	if p.Sessions != nil {
+		sessions, err := p.ListSessions(ctx, usr)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, sess := range sessions {
+			devices = append(devices, &DeviceSession{
+				Id:         sess.Id,
+				Client:     sess.Client,
+				CreatedAt:  sess.CreatedAt,
+				LastUsedAt: sess.LastSeenAt,
+				ExpiresAt:  sess.ExpiresAt,
+			})
+		}
+	} else {
+		families, err := p.refreshTokenFamilies(ctx, usr)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rec := range families {
+			devices = append(devices, &DeviceSession{
+				Id:         rec.FamilyId,
+				Client:     rec.Client,
+				CreatedAt:  rec.FamilyStartedAt(),
+				LastUsedAt: rec.IssuedAt,
+				ExpiresAt:  rec.ExpiresAt,
+			})
+		}
+	}
+
+	currentId := ""
+	if current != nil {
+		currentId, _ = current.Claims().String(SessionIdClaim)
+	}
+
+	for _, device := range devices {
+		device.IsCurrent = len(currentId) > 0 && device.Id == currentId
+	}
+
+	slices.SortFunc(devices, func(a, b *DeviceSession) int {
+		return b.LastUsedAt.Compare(a.LastUsedAt)
+	})
+
+	return devices, nil
+}
+
+// NOTE: Sessions of other users are reported as not found. Access tokens
+// issued within revoked refresh token family stay valid until they expire
+func (p *RegistryProvider[U]) RevokeDeviceSession(ctx context.Context, usr *U, id string) (bool, error) {
+	if p.Sessions != nil {
+		opts, err := p.sessions()
+		if err != nil {
+			return false, err
+		}
+
+		sess, err := opts.Store.GetSession(ctx, id)
+		if err != nil || sess == nil || sess.UserId != (*usr).GetId() {
+			return false, err
+		}
+
+		return opts.Store.DeleteSession(ctx, id)
+	}
+
+	families, err := p.refreshTokenFamilies(ctx, usr)
+	if err != nil {
+		return false, err
+	}
+
+	isOwned := slices.ContainsFunc(families, func(rec *RefreshTokenRecord) bool {
+		return rec.FamilyId == id
+	})
+
+	if !isOwned {
+		return false, nil
+	}
+
+	return true, p.RefreshTokens.RevokeFamily(ctx, id)
+}
+
+func (p *RegistryProvider[U]) refreshTokenFamilies(ctx context.Context, usr *U) ([]*RefreshTokenRecord, error) {
+	lister, isOk := p.RefreshTokens.(RefreshTokenFamilyLister)
+	if !isOk {
+		return nil, ErrDeviceSessionsNotSupported
+	}
+
+	return lister.ListFamilies(ctx, (*usr).GetId())
+}
@@ -0,0 +1,260 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NOTE: Keeps every session in its own JSON file named by session id,
+// suitable for single instance deployments surviving restarts
+type FileSessionStore struct {
+	Dir string
+
+	mx        sync.Mutex
+	lastPrune time.Time
+}
+
+// NOTE: Secret hash and claims are not exposed in Session JSON, so files
+// hold them next to it
+type fileSession struct {
+	*Session
+	SecretHash string         `json:"secretHash"`
+	Claims     map[string]any `json:"claims,omitempty"`
+}
+
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &FileSessionStore{
+		Dir: dir,
+	}, nil
+}
+
+func (s *FileSessionStore) SaveSession(ctx context.Context, sess *Session) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if err := s.pruneExpired(time.Now()); err != nil {
+		return err
+	}
+
+	path, err := s.path(sess.Id)
+	if err != nil {
+		return err
+	}
+
+	return writeSessionFile(path, sess)
+}
+
+func (s *FileSessionStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	path, err := s.path(id)
+	if err != nil {
+		return nil, nil
+	}
+
+	sess, err := readSessionFile(path)
+	if err != nil || sess == nil || sess.IsExpired(time.Now()) {
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+func (s *FileSessionStore) TouchSession(
+	ctx context.Context,
+	id string,
+	seenAt, expiresAt time.Time,
+) (bool, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	path, err := s.path(id)
+	if err != nil {
+		return false, nil
+	}
+
+	sess, err := readSessionFile(path)
+	if err != nil || sess == nil {
+		return false, err
+	}
+
+	sess.LastSeenAt = seenAt
+	sess.ExpiresAt = expiresAt
+
+	return true, writeSessionFile(path, sess)
+}
+
+func (s *FileSessionStore) ListSessions(ctx context.Context, userId uuid.UUID) ([]*Session, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := time.Now()
+	sessions := []*Session{}
+
+	err := s.each(func(path string, sess *Session) error {
+		if sess.UserId == userId && !sess.IsExpired(now) {
+			sessions = append(sessions, sess)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+func (s *FileSessionStore) DeleteSession(ctx context.Context, id string) (bool, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	path, err := s.path(id)
+	if err != nil {
+		return false, nil
+	}
+
+	return removeSessionFile(path)
+}
+
+func (s *FileSessionStore) DeleteUserSessions(ctx context.Context, userId uuid.UUID) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.each(func(path string, sess *Session) error {
+		if sess.UserId != userId {
+			return nil
+		}
+
+		_, err := removeSessionFile(path)
+		return err
+	})
+}
+
+func (s *FileSessionStore) pruneExpired(now time.Time) error {
+	if now.Sub(s.lastPrune) < memoryStorePruneInterval {
+		return nil
+	}
+
+	s.lastPrune = now
+
+	return s.each(func(path string, sess *Session) error {
+		if !sess.IsExpired(now) {
+			return nil
+		}
+
+		_, err := removeSessionFile(path)
+		return err
+	})
+}
+
+func (s *FileSessionStore) each(fn func(string, *Session) error) error {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		path := filepath.Join(s.Dir, entry.Name())
+
+		sess, err := readSessionFile(path)
+		if err != nil {
+			return err
+		}
+
+		if sess == nil {
+			continue
+		}
+
+		if err := fn(path, sess); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NOTE: Ids are checked to be hex, so they cannot point outside of Dir
+func (s *FileSessionStore) path(id string) (string, error) {
+	if len(id) != 2*sessionIdBytes || !isHex(id) {
+		return "", fmt.Errorf("invalid session id %q", id)
+	}
+
+	return filepath.Join(s.Dir, id+".json"), nil
+}
+
+func readSessionFile(path string) (*Session, error) {
+	content, err := os.ReadFile(path)
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	stored := fileSession{Session: &Session{}}
+	if err := json.Unmarshal(content, &stored); err != nil {
+		return nil, errors.Join(fmt.Errorf("malformed session file %s", path), err)
+	}
+
+	stored.Session.SecretHash = stored.SecretHash
+	stored.Session.Claims = stored.Claims
+
+	return stored.Session, nil
+}
+
+func writeSessionFile(path string, sess *Session) error {
+	encoded, err := json.Marshal(fileSession{
+		Session:    sess,
+		SecretHash: sess.SecretHash,
+		Claims:     sess.Claims,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// NOTE: Written to temporary file first, so readers never see partial
+	// session files
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, encoded, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func removeSessionFile(path string) (bool, error) {
+	err := os.Remove(path)
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	return true, nil
+}
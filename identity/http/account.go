@@ -0,0 +1,196 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/router"
+)
+
+type TokenBody struct {
+	Token string `json:"token"`
+}
+
+type PasswordResetRequestBody struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetBody struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// NOTE: Sends verification email to the current user again
+func (ep *IdentityEndpoint[U]) RequestEmailVerification() router.Handler {
+	log := ep.log()
+
+	return ep.Protect(func(rctx *router.RequestContext) {
+		accounts, isOk := ep.accountProvider(rctx)
+		if !isOk {
+			return
+		}
+
+		usr, _ := UserFrom[U](rctx)
+
+		err := accounts.RequestEmailVerification(rctx.Context(), usr)
+		switch {
+		case errors.Is(err, identity.ErrAccountsNotSupported):
+			rctx.Response.String(http.StatusNotImplemented, "Account flows are not supported by users registry")
+		case errors.Is(err, identity.ErrEmailVerified):
+			rctx.Response.String(http.StatusConflict, "Email is already verified")
+		case errors.Is(err, identity.ErrNoEmail):
+			rctx.Response.String(http.StatusConflict, "User has no email")
+		case err != nil:
+			log.Error("RequestEmailVerification failed", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "RequestEmailVerification: %s", err.Error())
+		default:
+			rctx.Response.String(http.StatusAccepted, "Verification email is sent")
+		}
+	})
+}
+
+func (ep *IdentityEndpoint[U]) VerifyEmail() router.Handler {
+	log := ep.log()
+
+	return func(rctx *router.RequestContext) {
+		accounts, isOk := ep.accountProvider(rctx)
+		if !isOk {
+			return
+		}
+
+		body := TokenBody{}
+		if !ep.decodeBody(rctx, &body) {
+			return
+		}
+
+		token, isOk := ep.oneTimeToken(rctx, body.Token, identity.TokenUseEmailVerification)
+		if !isOk {
+			return
+		}
+
+		isVerified, err := accounts.VerifyEmail(rctx.Context(), token)
+		switch {
+		case errors.Is(err, identity.ErrAccountsNotSupported):
+			rctx.Response.String(http.StatusNotImplemented, "Account flows are not supported by users registry")
+		case err != nil:
+			log.Error("VerifyEmail failed", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "VerifyEmail: %s", err.Error())
+		case !isVerified:
+			rctx.Response.String(http.StatusBadRequest, "Token is invalid or already used")
+		default:
+			rctx.Response.String(http.StatusOK, "Email is verified")
+		}
+	}
+}
+
+// NOTE: Responds the same way whether the account exists or not
+func (ep *IdentityEndpoint[U]) RequestPasswordReset() router.Handler {
+	log := ep.log()
+
+	return func(rctx *router.RequestContext) {
+		accounts, isOk := ep.accountProvider(rctx)
+		if !isOk {
+			return
+		}
+
+		body := PasswordResetRequestBody{}
+		if !ep.decodeBody(rctx, &body) {
+			return
+		}
+
+		if len(body.Email) == 0 {
+			rctx.Response.String(http.StatusBadRequest, "Email must be provided")
+			return
+		}
+
+		err := accounts.RequestPasswordReset(rctx.Context(), body.Email)
+		switch {
+		case errors.Is(err, identity.ErrAccountsNotSupported):
+			rctx.Response.String(http.StatusNotImplemented, "Account flows are not supported by users registry")
+		case err != nil:
+			log.Error("RequestPasswordReset failed", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "RequestPasswordReset: %s", err.Error())
+		default:
+			rctx.Response.String(http.StatusAccepted, "Password reset email is sent if the account exists")
+		}
+	}
+}
+
+func (ep *IdentityEndpoint[U]) ResetPassword() router.Handler {
+	log := ep.log()
+
+	return func(rctx *router.RequestContext) {
+		accounts, isOk := ep.accountProvider(rctx)
+		if !isOk {
+			return
+		}
+
+		body := PasswordResetBody{}
+		if !ep.decodeBody(rctx, &body) {
+			return
+		}
+
+		token, isOk := ep.oneTimeToken(rctx, body.Token, identity.TokenUsePasswordReset)
+		if !isOk {
+			return
+		}
+
+		result, err := accounts.ResetPassword(rctx.Context(), identity.ResetPasswordRequest{
+			Token:    token,
+			Password: body.Password,
+		})
+
+		switch {
+		case errors.Is(err, identity.ErrAccountsNotSupported):
+			rctx.Response.String(http.StatusNotImplemented, "Account flows are not supported by users registry")
+		case err != nil:
+			log.Error("ResetPassword failed", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "ResetPassword: %s", err.Error())
+		case result.InvalidCredentials:
+			_, _ = rctx.Response.JSON(http.StatusBadRequest, result)
+		case result.NotAuthorized:
+			rctx.Response.String(http.StatusBadRequest, "Token is invalid or already used")
+		default:
+			rctx.Response.String(http.StatusOK, "Password is updated")
+		}
+	}
+}
+
+func (ep *IdentityEndpoint[U]) oneTimeToken(
+	rctx *router.RequestContext,
+	tokenStr, use string,
+) (*identity.Token, bool) {
+	if len(tokenStr) == 0 {
+		rctx.Response.String(http.StatusBadRequest, "Token must be provided")
+		return nil, false
+	}
+
+	token, err := ep.parseToken(rctx.Context(), tokenStr, use)
+	if err != nil {
+		ep.log().Error("one-time token parse failure", "err", err.Error())
+		rctx.Response.Stringf(http.StatusInternalServerError, "Token parse failure: %s", err.Error())
+		return nil, false
+	}
+
+	if !token.IsValid() {
+		rctx.Response.String(http.StatusBadRequest, "Token is invalid or expired")
+		return nil, false
+	}
+
+	return token.Token, true
+}
+
+func (ep *IdentityEndpoint[U]) accountProvider(rctx *router.RequestContext) (identity.AccountProvider[U], bool) {
+	accounts, isOk := ep.Provider.(identity.AccountProvider[U])
+	if !isOk {
+		rctx.Response.String(http.StatusNotImplemented, "Account flows are not supported by identity provider")
+		return nil, false
+	}
+
+	if ep.isApiKeyRejected(rctx, "manage accounts") {
+		return nil, false
+	}
+
+	return accounts, true
+}
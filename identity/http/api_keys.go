@@ -0,0 +1,202 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/router"
+)
+
+type ApiKeyRevokeBody struct {
+	Id string `json:"id"`
+}
+
+// NOTE: Keys cannot be created by requests authenticated by API keys, so a
+// leaked key cannot be used to mint new ones
+func (ep *IdentityEndpoint[U]) CreateApiKey() router.Handler {
+	log := ep.log()
+
+	return ep.Protect(func(rctx *router.RequestContext) {
+		keys, isOk := ep.apiKeyManagement(rctx)
+		if !isOk {
+			return
+		}
+
+		req := identity.ApiKeyRequest{}
+		if !ep.decodeBody(rctx, &req) {
+			return
+		}
+
+		usr, _ := UserFrom[U](rctx)
+
+		created, err := keys.CreateApiKey(rctx.Context(), usr, req)
+		switch {
+		case errors.Is(err, identity.ErrApiKeysNotSupported):
+			rctx.Response.String(http.StatusNotImplemented, "API keys are not enabled")
+		case errors.Is(err, identity.ErrApiKeyScope), errors.Is(err, identity.ErrApiKeyExpiration):
+			rctx.Response.Stringf(http.StatusBadRequest, "CreateApiKey: %s", err.Error())
+		case err != nil:
+			log.Error("CreateApiKey failed", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "CreateApiKey: %s", err.Error())
+		default:
+			_, _ = rctx.Response.JSON(http.StatusCreated, created)
+		}
+	})
+}
+
+func (ep *IdentityEndpoint[U]) ListApiKeys() router.Handler {
+	log := ep.log()
+
+	return ep.Protect(func(rctx *router.RequestContext) {
+		keys, isOk := ep.apiKeyManagement(rctx)
+		if !isOk {
+			return
+		}
+
+		usr, _ := UserFrom[U](rctx)
+
+		list, err := keys.ListApiKeys(rctx.Context(), usr)
+		switch {
+		case errors.Is(err, identity.ErrApiKeysNotSupported):
+			rctx.Response.String(http.StatusNotImplemented, "API keys are not enabled")
+		case err != nil:
+			log.Error("ListApiKeys failed", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "ListApiKeys: %s", err.Error())
+		default:
+			_, _ = rctx.Response.JSON(http.StatusOK, list)
+		}
+	})
+}
+
+func (ep *IdentityEndpoint[U]) RevokeApiKey() router.Handler {
+	log := ep.log()
+
+	return ep.Protect(func(rctx *router.RequestContext) {
+		keys, isOk := ep.apiKeyManagement(rctx)
+		if !isOk {
+			return
+		}
+
+		body := ApiKeyRevokeBody{}
+		if !ep.decodeBody(rctx, &body) {
+			return
+		}
+
+		usr, _ := UserFrom[U](rctx)
+
+		revoked, err := keys.RevokeApiKey(rctx.Context(), usr, body.Id)
+		switch {
+		case errors.Is(err, identity.ErrApiKeysNotSupported):
+			rctx.Response.String(http.StatusNotImplemented, "API keys are not enabled")
+		case err != nil:
+			log.Error("RevokeApiKey failed", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "RevokeApiKey: %s", err.Error())
+		case !revoked:
+			rctx.Response.String(http.StatusNotFound, "API key is not found")
+		default:
+			rctx.Response.String(http.StatusOK)
+		}
+	})
+}
+
+// NOTE: Key is taken from API key header or from `Authorization: Bearer`
+// if it does not look like JWT
+func (ep *IdentityEndpoint[U]) apiKeyFromRequest(r router.Request) string {
+	headers := r.Headers()
+
+	if key := headers.Get(ep.apiKeyHeaderName()); len(key) > 0 {
+		return key
+	}
+
+	bearer, isOk := strings.CutPrefix(headers.Get("Authorization"), "Bearer ")
+	if !isOk || strings.Contains(bearer, ".") {
+		return ""
+	}
+
+	return strings.TrimSpace(bearer)
+}
+
+func (ep *IdentityEndpoint[U]) guardApiKey(
+	rctx *router.RequestContext,
+	plain string,
+	result GuardResult[U],
+) (GuardResult[U], error) {
+	log := ep.log().With("method", "Guard")
+	isRequired := !result.Options.IsOptional || len(result.Options.Policies) > 0
+
+	keys, isOk := ep.Provider.(identity.ApiKeyProvider[U])
+
+	var key *identity.ApiKey
+	var err error
+
+	if isOk {
+		key, err = keys.AuthenticateApiKey(rctx.Context(), plain)
+	}
+
+	if err != nil && !errors.Is(err, identity.ErrApiKeysNotSupported) {
+		log.Error("AuthenticateApiKey failure", "err", err.Error())
+		rctx.Response.Stringf(http.StatusInternalServerError, "Auth check has failed: %s", err.Error())
+
+		result.IsResponded = true
+		return result, err
+	}
+
+	if key == nil {
+		if isRequired {
+			ep.respondUnauthenticated(rctx, &result, "AuthGuard API key is invalid")
+		}
+
+		return result, nil
+	}
+
+	result.ApiKey = key
+
+	if !result.Options.IsUserFetchDisabled {
+		usr, err := keys.GetApiKeyUser(rctx.Context(), key)
+		if err != nil {
+			log.Error("GetApiKeyUser failure", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "GetApiKeyUser: %s", err.Error())
+
+			result.IsResponded = true
+			return result, err
+		}
+
+		result.User = usr
+	}
+
+	if len(result.Options.Policies) == 0 {
+		return result, nil
+	}
+
+	err = ep.authorize(rctx, &result)
+	return result, err
+}
+
+func (ep *IdentityEndpoint[U]) apiKeyManagement(
+	rctx *router.RequestContext,
+) (identity.ApiKeyProvider[U], bool) {
+	keys, isOk := ep.Provider.(identity.ApiKeyProvider[U])
+	if !isOk {
+		rctx.Response.String(http.StatusNotImplemented, "API keys are not supported by identity provider")
+		return nil, false
+	}
+
+	if ep.isApiKeyRejected(rctx, "manage API keys") {
+		return nil, false
+	}
+
+	return keys, true
+}
+
+// NOTE: Routes managing account itself are closed for API keys, so a leaked
+// key cannot be used to take the account over
+func (ep *IdentityEndpoint[U]) isApiKeyRejected(rctx *router.RequestContext, action string) bool {
+	if result, _ := GuardResultFrom[U](rctx); result == nil || result.ApiKey == nil {
+		return false
+	}
+
+	rctx.Response.String(http.StatusForbidden, "Forbidden: API keys cannot "+action)
+	return true
+}
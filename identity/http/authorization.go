@@ -0,0 +1,225 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/router"
+)
+
+const (
+	DefaultRolesClaim       = "roles"
+	DefaultPermissionsClaim = "permissions"
+)
+
+// NOTE: Authenticated party as seen by policies, User is nil when user
+// fetch is disabled in GuardOptions
+type Principal struct {
+	UserId      uuid.UUID
+	User        any
+	Claims      *identity.Claims
+	Roles       []string
+	Permissions []string
+
+	// NOTE: Set when request is authenticated by API key, see RequireScope
+	ApiKey *identity.ApiKey
+}
+
+type Policy struct {
+	Name  string
+	Allow func(context.Context, *Principal) (bool, error)
+}
+
+func PolicyFunc(name string, fn func(context.Context, *Principal) (bool, error)) Policy {
+	return Policy{
+		Name:  name,
+		Allow: fn,
+	}
+}
+
+// NOTE: Policy over typed user, denies if user is not fetched
+func UserPolicy[U identity.User](name string, fn func(context.Context, *U) (bool, error)) Policy {
+	return PolicyFunc(name, func(ctx context.Context, p *Principal) (bool, error) {
+		usr, isOk := p.User.(*U)
+		if !isOk || usr == nil {
+			return false, nil
+		}
+
+		return fn(ctx, usr)
+	})
+}
+
+func RequireRole(role string) Policy {
+	return RequireAnyRole(role)
+}
+
+func RequireAnyRole(roles ...string) Policy {
+	return PolicyFunc(fmt.Sprintf("any role of %v", roles), func(_ context.Context, p *Principal) (bool, error) {
+		return p.HasAnyRole(roles...), nil
+	})
+}
+
+func RequirePermission(permissions ...string) Policy {
+	name := fmt.Sprintf("all permissions of %v", permissions)
+
+	return PolicyFunc(name, func(_ context.Context, p *Principal) (bool, error) {
+		for _, perm := range permissions {
+			if !slices.Contains(p.Permissions, perm) {
+				return false, nil
+			}
+		}
+
+		return true, nil
+	})
+}
+
+func RequireAnyPermission(permissions ...string) Policy {
+	name := fmt.Sprintf("any permission of %v", permissions)
+
+	return PolicyFunc(name, func(_ context.Context, p *Principal) (bool, error) {
+		return p.HasAnyPermission(permissions...), nil
+	})
+}
+
+// NOTE: Restricts requests authenticated by API keys to ones having all the
+// scopes, requests authenticated by tokens are not restricted by it
+func RequireScope(scopes ...string) Policy {
+	name := fmt.Sprintf("all scopes of %v", scopes)
+
+	return PolicyFunc(name, func(_ context.Context, p *Principal) (bool, error) {
+		return p.ApiKey == nil || p.ApiKey.HasScopes(scopes...), nil
+	})
+}
+
+func (p *Principal) HasAnyRole(roles ...string) bool {
+	return slices.ContainsFunc(roles, func(role string) bool {
+		return slices.Contains(p.Roles, role)
+	})
+}
+
+func (p *Principal) HasAnyPermission(permissions ...string) bool {
+	return slices.ContainsFunc(permissions, func(perm string) bool {
+		return slices.Contains(p.Permissions, perm)
+	})
+}
+
+// NOTE: Route level form of Guard, requests are passed further only if
+// authenticated and allowed by all the policies
+func (ep *IdentityEndpoint[U]) Authorize(policies ...Policy) router.Middleware {
+	return ep.Middleware(GuardOptions{
+		Policies: policies,
+	})
+}
+
+// NOTE: Returns name of the first policy denying access, empty if all of
+// them allow it
+func (ep *IdentityEndpoint[U]) evaluatePolicies(
+	ctx context.Context,
+	principal *Principal,
+	policies []Policy,
+) (string, error) {
+	for _, policy := range policies {
+		if policy.Allow == nil {
+			return "", fmt.Errorf("policy %q has no Allow function", policy.Name)
+		}
+
+		allowed, err := policy.Allow(ctx, principal)
+		if err != nil {
+			return "", errors.Join(fmt.Errorf("policy %q failure", policy.Name), err)
+		}
+
+		if !allowed {
+			return policy.Name, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (ep *IdentityEndpoint[U]) principal(result *GuardResult[U]) *Principal {
+	p := &Principal{
+		Claims: result.Claims(),
+		ApiKey: result.ApiKey,
+	}
+
+	p.UserId, _ = result.GetUserId()
+
+	if result.User != nil {
+		p.User = result.User
+
+		if holder, isOk := any(*result.User).(identity.RolesHolder); isOk {
+			p.Roles = holder.GetRoles()
+		}
+
+		if holder, isOk := any(*result.User).(identity.PermissionsHolder); isOk {
+			p.Permissions = holder.GetPermissions()
+		}
+	}
+
+	if p.Roles == nil {
+		p.Roles, _ = p.Claims.Strings(ep.rolesClaim())
+	}
+
+	if p.Permissions == nil {
+		p.Permissions, _ = p.Claims.Strings(ep.permissionsClaim())
+	}
+
+	return p
+}
+
+func (ep *IdentityEndpoint[U]) authorize(
+	rctx *router.RequestContext,
+	result *GuardResult[U],
+) error {
+	log := ep.log().With("method", "Guard", "path", rctx.Request.URL().Path)
+
+	principal := ep.principal(result)
+	result.Principal = principal
+
+	denied, err := ep.evaluatePolicies(rctx.Context(), principal, result.Options.Policies)
+	if err != nil {
+		log.Error("policy evaluation failure", "err", err.Error())
+
+		rctx.Response.String(
+			http.StatusInternalServerError,
+			"Authorization has failed: "+err.Error(),
+		)
+
+		result.IsResponded = true
+		return err
+	}
+
+	if len(denied) > 0 {
+		log.Info("access denied", "userId", principal.UserId.String(), "policy", denied)
+
+		rctx.Response.String(http.StatusForbidden, "Forbidden: "+denied)
+
+		result.IsForbidden = true
+		result.IsResponded = true
+		return nil
+	}
+
+	log.Debug("access granted", "userId", principal.UserId.String())
+	return nil
+}
+
+func (ep *IdentityEndpoint[U]) rolesClaim() string {
+	if len(ep.RolesClaim) == 0 {
+		return DefaultRolesClaim
+	}
+
+	return ep.RolesClaim
+}
+
+func (ep *IdentityEndpoint[U]) permissionsClaim() string {
+	if len(ep.PermissionsClaim) == 0 {
+		return DefaultPermissionsClaim
+	}
+
+	return ep.PermissionsClaim
+}
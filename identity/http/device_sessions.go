@@ -0,0 +1,93 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/router"
+)
+
+type SessionRevokeBody struct {
+	Id string `json:"id"`
+}
+
+// NOTE: Lists signed in devices of the current user, the one of the request
+// is marked as current
+func (ep *IdentityEndpoint[U]) ListSessions() router.Handler {
+	log := ep.log()
+
+	return ep.Protect(func(rctx *router.RequestContext) {
+		devices, isOk := ep.deviceSessionProvider(rctx)
+		if !isOk {
+			return
+		}
+
+		result, _ := GuardResultFrom[U](rctx)
+
+		var current *identity.Token
+		if result.Tokens.HasValidAccess() {
+			current = result.Tokens.AccessToken.Token
+		}
+
+		sessions, err := devices.ListDeviceSessions(rctx.Context(), result.User, current)
+		switch {
+		case errors.Is(err, identity.ErrDeviceSessionsNotSupported):
+			rctx.Response.String(http.StatusNotImplemented, "Device sessions are not supported")
+		case err != nil:
+			log.Error("ListDeviceSessions failed", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "ListSessions: %s", err.Error())
+		default:
+			_, _ = rctx.Response.JSON(http.StatusOK, sessions)
+		}
+	})
+}
+
+// NOTE: Revoking the current session signs the request out as well, for
+// refresh token families it takes effect once access token expires
+func (ep *IdentityEndpoint[U]) RevokeSession() router.Handler {
+	log := ep.log()
+
+	return ep.Protect(func(rctx *router.RequestContext) {
+		devices, isOk := ep.deviceSessionProvider(rctx)
+		if !isOk {
+			return
+		}
+
+		body := SessionRevokeBody{}
+		if !ep.decodeBody(rctx, &body) {
+			return
+		}
+
+		usr, _ := UserFrom[U](rctx)
+
+		revoked, err := devices.RevokeDeviceSession(rctx.Context(), usr, body.Id)
+		switch {
+		case errors.Is(err, identity.ErrDeviceSessionsNotSupported):
+			rctx.Response.String(http.StatusNotImplemented, "Device sessions are not supported")
+		case err != nil:
+			log.Error("RevokeDeviceSession failed", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "RevokeSession: %s", err.Error())
+		case !revoked:
+			rctx.Response.String(http.StatusNotFound, "Session is not found")
+		default:
+			rctx.Response.String(http.StatusOK)
+		}
+	})
+}
+
+func (ep *IdentityEndpoint[U]) deviceSessionProvider(
+	rctx *router.RequestContext,
+) (identity.DeviceSessionProvider[U], bool) {
+	devices, isOk := ep.Provider.(identity.DeviceSessionProvider[U])
+	if !isOk {
+		rctx.Response.String(http.StatusNotImplemented, "Device sessions are not supported by identity provider")
+		return nil, false
+	}
+
+	if ep.isApiKeyRejected(rctx, "manage sessions") {
+		return nil, false
+	}
+
+	return devices, true
+}
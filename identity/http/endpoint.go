@@ -1,11 +1,15 @@
 package http
 
 import (
-	"crypto/ecdsa"
+	"context"
+	"crypto"
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/yandzee/go-svc/data/jsoner"
@@ -18,6 +22,7 @@ import (
 const (
 	AccessTokenHeader  = "X-Access-Token"
 	RefreshTokenHeader = "X-Refresh-Token"
+	ApiKeyHeader       = "X-Api-Key"
 
 	KiloByte = 1024
 )
@@ -27,7 +32,36 @@ type IdentityEndpoint[U identity.User] struct {
 	Log                *slog.Logger
 	AccessTokenHeader  string
 	RefreshTokenHeader string
-	TokenPrivateKey    *ecdsa.PrivateKey
+
+	// NOTE: Token headers and cookies, defaults are used when nil
+	Transport *TokenTransport
+
+	// NOTE: API keys are also accepted as `Authorization: Bearer` value,
+	// if identity provider implements identity.ApiKeyProvider
+	ApiKeyHeader string
+
+	TokenPrivateKey    crypto.PrivateKey
+	TokenSigningMethod jwt.SigningMethod
+
+	// NOTE: Tokens are verified by the key referenced in `kid` header,
+	// tokens without it are verified by TokenPrivateKey if set
+	Keys *identity.Keyring
+
+	// NOTE: Tokens found in denylist are reported as revoked
+	Denylist identity.TokenDenylist
+
+	// NOTE: Claims holding roles and permissions, "roles" and "permissions"
+	// are used when empty
+	RolesClaim       string
+	PermissionsClaim string
+
+	// NOTE: Client info passed to the provider at signin, remote address and
+	// User-Agent are used when nil, set it when running behind proxies
+	ClientInfo func(router.Request) identity.ClientInfo
+
+	fallbackKeyOnce sync.Once
+	fallbackKey     *identity.SigningKey
+	fallbackKeyErr  error
 }
 
 func Wrap[U identity.User](id identity.Provider[U]) *IdentityEndpoint[U] {
@@ -40,7 +74,7 @@ func (ep *IdentityEndpoint[U]) Check() router.Handler {
 	log := ep.log()
 
 	return func(rctx *router.RequestContext) {
-		pair, err := ep.tokensFromRequest(rctx.Request)
+		pair, err := ep.tokensFromRequest(rctx.Context(), rctx.Request)
 		if err != nil {
 			log.Error("tokensFromRequest failure", "err", err.Error())
 
@@ -56,6 +90,8 @@ func (ep *IdentityEndpoint[U]) Check() router.Handler {
 			rctx.Response.String(http.StatusUnauthorized, "Unauthorized: no access token")
 		case pair.AccessToken.Validation.IsExpired:
 			rctx.Response.String(http.StatusUnauthorized, "Unauthorized: token is expired")
+		case pair.AccessToken.Validation.IsRevoked:
+			rctx.Response.String(http.StatusUnauthorized, "Unauthorized: token is revoked")
 		case pair.AccessToken.Validation.IsMalformed:
 			rctx.Response.String(http.StatusUnauthorized, "Unauthorized: token is malformed")
 		case pair.AccessToken.Validation.IsParseError:
@@ -116,6 +152,11 @@ func (ep *IdentityEndpoint[U]) CurrentUser() router.Handler {
 			return
 		}
 
+		if result.ApiKey != nil {
+			rctx.Response.String(http.StatusForbidden, "Forbidden: API keys cannot get current user")
+			return
+		}
+
 		if _, err := rctx.Response.JSON(http.StatusOK, result.User); err != nil {
 			log.Error("Failed to respond with user's json", "err", err.Error())
 
@@ -148,7 +189,9 @@ func (ep *IdentityEndpoint[U]) Signup() router.Handler {
 
 		log.Debug("Signup", "request", signupRequest)
 
-		signupResult, err := ep.Provider.SignUp(rctx.Context(), signupRequest)
+		ctx := identity.WithClientInfo(rctx.Context(), ep.clientInfo(rctx.Request))
+
+		signupResult, err := ep.Provider.SignUp(ctx, signupRequest)
 		if err != nil {
 			log.Error("Signup failed", "err", err.Error())
 			rctx.Response.Stringf(http.StatusInternalServerError, "Signup failure: %s", err.Error())
@@ -184,7 +227,9 @@ func (ep *IdentityEndpoint[U]) Signin() router.Handler {
 
 		log.Debug("Signin", "signinRequest", signinRequest)
 
-		signinResult, err := ep.Provider.SignIn(rctx.Context(), signinRequest)
+		ctx := identity.WithClientInfo(rctx.Context(), ep.clientInfo(rctx.Request))
+
+		signinResult, err := ep.Provider.SignIn(ctx, signinRequest)
 		switch {
 		case errors.Is(err, identity.ErrNoCredentials):
 			rctx.Response.String(http.StatusBadRequest, "Signin failed: no credentials provided")
@@ -197,14 +242,7 @@ func (ep *IdentityEndpoint[U]) Signin() router.Handler {
 
 		log.Debug("Signin result", "result", signinResult)
 
-		st := http.StatusOK
-		if signinResult.NotAuthorized {
-			st = http.StatusUnauthorized
-		} else {
-			ep.respondTokens(rctx, signinResult.Tokens.AccessToken, signinResult.Tokens.RefreshToken)
-		}
-
-		_, _ = rctx.Response.JSON(st, signinResult)
+		ep.respondSigninResult(rctx, signinResult)
 	}
 }
 
@@ -212,7 +250,11 @@ func (ep *IdentityEndpoint[U]) Refresh() router.Handler {
 	log := ep.log()
 
 	return func(rctx *router.RequestContext) {
-		pair, err := ep.tokensFromRequest(rctx.Request)
+		pair, isOk, err := ep.tokensFromRequestBody(rctx)
+		if !isOk {
+			return
+		}
+
 		if err != nil {
 			log.Error("Refresh failure", "err", err.Error())
 			rctx.Response.Stringf(
@@ -228,6 +270,8 @@ func (ep *IdentityEndpoint[U]) Refresh() router.Handler {
 			rctx.Response.String(http.StatusBadRequest, "Refresh token must be attached")
 		case pair.RefreshToken.Validation.IsExpired:
 			rctx.Response.String(http.StatusUnauthorized, "Unauthorized: token is expired")
+		case pair.RefreshToken.Validation.IsRevoked:
+			rctx.Response.String(http.StatusUnauthorized, "Unauthorized: refresh token is revoked")
 		case pair.RefreshToken.Validation.IsMalformed:
 			rctx.Response.String(http.StatusUnauthorized, "Unauthorized: token is malformed")
 		case pair.RefreshToken.Validation.IsParseError:
@@ -242,14 +286,28 @@ func (ep *IdentityEndpoint[U]) Refresh() router.Handler {
 			return
 		}
 
-		tokenPair, err := ep.Provider.Refresh(rctx.Context(), pair.RefreshToken.Token)
-		if err != nil {
+		ctx := identity.WithClientInfo(rctx.Context(), ep.clientInfo(rctx.Request))
+
+		tokenPair, err := ep.Provider.Refresh(ctx, pair.RefreshToken.Token)
+		switch {
+		case errors.Is(err, identity.ErrRefreshTokenReused):
+			fallthrough
+		case errors.Is(err, identity.ErrRefreshTokenRevoked):
+			log.Warn("Refresh token is rejected", "err", err.Error())
+			rctx.Response.String(http.StatusUnauthorized, "Unauthorized: refresh token is revoked")
+			return
+		case err != nil:
 			rctx.Response.Stringf(http.StatusInternalServerError, "Refresh: %s", err.Error())
 			return
 		}
 
 		ep.respondTokens(rctx, tokenPair.AccessToken, tokenPair.RefreshToken)
 
+		if ep.transport().JSONBody {
+			_, _ = rctx.Response.JSON(http.StatusOK, tokenPair.AsStringPair())
+			return
+		}
+
 		_, err = fmt.Fprintf(
 			rctx.Response,
 			"Success: %d tokens, %s, have been placed to headers",
@@ -268,47 +326,175 @@ func (ep *IdentityEndpoint[U]) Refresh() router.Handler {
 	}
 }
 
-func (ep *IdentityEndpoint[U]) respondTokens(
-	rctx *router.RequestContext,
-	atoken *identity.Token,
-	rtoken *identity.Token,
-) {
-	headers := rctx.Response.Headers()
+// NOTE: Signout of all user sessions is requested with `?all=true`, access
+// tokens of other sessions are not denied and stay valid until they expire
+func (ep *IdentityEndpoint[U]) Signout() router.Handler {
+	log := ep.log()
+
+	return func(rctx *router.RequestContext) {
+		pair, isOk, err := ep.tokensFromRequestBody(rctx)
+		if !isOk {
+			return
+		}
+
+		if err != nil {
+			log.Error("Signout failure", "err", err.Error())
+			rctx.Response.Stringf(
+				http.StatusInternalServerError,
+				"Signout has failed: %s",
+				err.Error(),
+			)
+			return
+		}
+
+		signoutRequest := identity.SignoutRequest{
+			AllSessions: rctx.Request.URL().Query().Get("all") == "true",
+		}
+
+		if pair.AccessToken != nil && pair.AccessToken.Validation.IsOk() {
+			signoutRequest.AccessToken = pair.AccessToken.Token
+		}
+
+		if pair.RefreshToken != nil && pair.RefreshToken.Validation.IsOk() {
+			signoutRequest.RefreshToken = pair.RefreshToken.Token
+		}
+
+		if signoutRequest.AllSessions && !pair.HasValidAccess() {
+			rctx.Response.String(
+				http.StatusUnauthorized,
+				"Unauthorized: valid access token is required to signout all sessions",
+			)
+			return
+		}
+
+		signout, isOk := ep.Provider.(identity.SignoutProvider[U])
+		if isOk {
+			err = signout.SignOut(rctx.Context(), signoutRequest)
+		}
+
+		if errors.Is(err, identity.ErrRefreshTokensNotEnabled) || (!isOk && signoutRequest.AllSessions) {
+			rctx.Response.String(http.StatusNotImplemented, "Signout of all sessions is not supported")
+			return
+		}
+
+		if err != nil {
+			log.Error("Signout failed", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "Signout failure: %s", err.Error())
+			return
+		}
+
+		ep.clearTokenCookies(rctx)
+
+		rctx.Response.String(http.StatusOK, "Signed out")
+	}
+}
+
+// NOTE: Publishes public keys of the keyring, or the single key derived
+// from TokenPrivateKey, so other services can verify issued tokens
+func (ep *IdentityEndpoint[U]) JWKS() router.Handler {
+	log := ep.log()
+
+	return func(rctx *router.RequestContext) {
+		keys := ep.Keys
+
+		if keys == nil && ep.TokenPrivateKey != nil {
+			key, err := ep.tokenPrivateSigningKey()
+			if err != nil {
+				log.Error("JWKS failure", "err", err.Error())
+				rctx.Response.Stringf(http.StatusInternalServerError, "JWKS: %s", err.Error())
+				return
+			}
 
-	if atoken != nil {
-		hname := ep.accessTokenHeaderName()
-		headers.Set(hname, atoken.JWTString)
+			keys = identity.NewKeyring(key)
+		}
+
+		set := identity.JWKSet{
+			Keys: []identity.JWK{},
+		}
+
+		if keys != nil {
+			var err error
+
+			set, err = keys.JWKS()
+			if err != nil {
+				log.Error("JWKS failure", "err", err.Error())
+				rctx.Response.Stringf(http.StatusInternalServerError, "JWKS: %s", err.Error())
+				return
+			}
+		}
+
+		rctx.Response.Headers().Set("Cache-Control", "public, max-age=300")
+		_, _ = rctx.Response.JSON(http.StatusOK, set)
+	}
+}
 
-		cookie := atoken.AsCookie(hname)
-		rctx.Response.SetCookie(&cookie)
+func (ep *IdentityEndpoint[U]) respondSigninResult(
+	rctx *router.RequestContext,
+	result *identity.SigninResult[U],
+) {
+	st := http.StatusOK
+
+	switch {
+	case result.Locked:
+		st = http.StatusLocked
+	case result.Throttled:
+		st = http.StatusTooManyRequests
+	case result.EmailNotVerified:
+		st = http.StatusForbidden
+	case result.NotAuthorized:
+		st = http.StatusUnauthorized
+	case result.MFARequired:
+		st = http.StatusAccepted
+	default:
+		ep.respondTokens(rctx, result.Tokens.AccessToken, result.Tokens.RefreshToken)
 	}
 
-	if rtoken != nil {
-		headers.Set(ep.refreshTokenHeaderName(), rtoken.JWTString)
+	if result.RetryAfter > 0 {
+		secs := int(math.Ceil(result.RetryAfter.Seconds()))
+		rctx.Response.Headers().Set("Retry-After", strconv.Itoa(secs))
 	}
+
+	_, _ = rctx.Response.JSON(st, result)
 }
 
-func (ep *IdentityEndpoint[U]) tokensFromRequest(r router.Request) (identity.ValidatedTokenPair, error) {
-	headers := r.Headers()
+func (ep *IdentityEndpoint[U]) tokensFromRequest(
+	ctx context.Context,
+	r router.Request,
+) (identity.ValidatedTokenPair, error) {
+	access, refresh := ep.rawTokensFromRequest(r)
+	return ep.validateTokens(ctx, access, refresh)
+}
 
-	accessTokenHeaderName := ep.accessTokenHeaderName()
-	accessTokenHeader := headers.Get(accessTokenHeaderName)
+// NOTE: Form of tokensFromRequest used by Refresh and Signout, refresh token
+// is also looked up in JSON body in JSON body mode, false is returned if the
+// request is already responded
+func (ep *IdentityEndpoint[U]) tokensFromRequestBody(
+	rctx *router.RequestContext,
+) (identity.ValidatedTokenPair, bool, error) {
+	access, refresh := ep.rawTokensFromRequest(rctx.Request)
 
-	if len(accessTokenHeader) == 0 {
-		accessTokenCookie := r.Cookie(accessTokenHeaderName)
+	if len(refresh) == 0 {
+		var isOk bool
 
-		if accessTokenCookie != nil {
-			accessTokenHeader = accessTokenCookie.Value
+		refresh, isOk = ep.refreshTokenFromBody(rctx)
+		if !isOk {
+			return identity.ValidatedTokenPair{}, false, nil
 		}
 	}
 
-	refreshTokenHeader := headers.Get(ep.refreshTokenHeaderName())
+	pair, err := ep.validateTokens(rctx.Context(), access, refresh)
+	return pair, true, err
+}
 
+func (ep *IdentityEndpoint[U]) validateTokens(
+	ctx context.Context,
+	access, refresh string,
+) (identity.ValidatedTokenPair, error) {
 	pair := identity.ValidatedTokenPair{}
 	var err error
 
-	if len(accessTokenHeader) > 0 {
-		pair.AccessToken, err = ep.parseToken(accessTokenHeader)
+	if len(access) > 0 {
+		pair.AccessToken, err = ep.parseToken(ctx, access, "")
 		if err != nil {
 			return pair, errors.Join(
 				fmt.Errorf("access token error"),
@@ -317,8 +503,8 @@ func (ep *IdentityEndpoint[U]) tokensFromRequest(r router.Request) (identity.Val
 		}
 	}
 
-	if len(refreshTokenHeader) > 0 {
-		pair.RefreshToken, err = ep.parseToken(refreshTokenHeader)
+	if len(refresh) > 0 {
+		pair.RefreshToken, err = ep.parseToken(ctx, refresh, "")
 		if err != nil {
 			return pair, errors.Join(
 				fmt.Errorf("refresh token error"),
@@ -330,14 +516,24 @@ func (ep *IdentityEndpoint[U]) tokensFromRequest(r router.Request) (identity.Val
 	return pair, nil
 }
 
-func (ep *IdentityEndpoint[U]) parseToken(tokenStr string) (*identity.ValidatedToken, error) {
+// NOTE: Tokens with identity.TokenUseClaim different from the expected use
+// are reported as malformed, so special purpose tokens cannot be used as
+// access or refresh ones
+func (ep *IdentityEndpoint[U]) parseToken(
+	ctx context.Context,
+	tokenStr string,
+	use string,
+) (*identity.ValidatedToken, error) {
+	if len(use) == 0 && identity.IsSessionToken(tokenStr) {
+		if validated, err := ep.parseSessionToken(ctx, tokenStr); validated != nil || err != nil {
+			return validated, err
+		}
+	}
+
 	token, err := jwt.ParseWithClaims(
 		tokenStr,
-		&jwt.RegisteredClaims{},
-		func(token *jwt.Token) (any, error) {
-			return &ep.TokenPrivateKey.PublicKey, nil
-		},
-		jwt.WithValidMethods([]string{jwt.SigningMethodES256.Name}),
+		&identity.Claims{},
+		ep.verificationKey,
 	)
 
 	tokenValidation, err := jwtutils.ValidateTokenParseError(err)
@@ -345,13 +541,122 @@ func (ep *IdentityEndpoint[U]) parseToken(tokenStr string) (*identity.ValidatedT
 		return nil, err
 	}
 
-	return &identity.ValidatedToken{
+	validated := &identity.ValidatedToken{
 		Token: &identity.Token{
 			JWT:       token,
 			JWTString: tokenStr,
 		},
 		Validation: tokenValidation,
-	}, nil
+	}
+
+	if !tokenValidation.IsOk() {
+		return validated, nil
+	}
+
+	if tokenUse, _ := validated.Token.Claims().String(identity.TokenUseClaim); tokenUse != use {
+		validated.Validation.IsMalformed = true
+		return validated, nil
+	}
+
+	if ep.Denylist == nil {
+		return validated, nil
+	}
+
+	if tokenId, isOk := validated.Token.GetId(); isOk {
+		isDenied, err := ep.Denylist.IsDenied(ctx, tokenId)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("denylist lookup failure"), err)
+		}
+
+		validated.Validation.IsRevoked = isDenied
+	}
+
+	return validated, nil
+}
+
+// NOTE: Returns nil if identity provider does not issue sessions
+func (ep *IdentityEndpoint[U]) parseSessionToken(
+	ctx context.Context,
+	tokenStr string,
+) (*identity.ValidatedToken, error) {
+	sessions, isOk := ep.Provider.(identity.SessionProvider[U])
+	if !isOk {
+		return nil, nil
+	}
+
+	validated, err := sessions.ValidateSessionToken(ctx, tokenStr)
+	switch {
+	case errors.Is(err, identity.ErrSessionsNotEnabled):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Join(fmt.Errorf("session lookup failure"), err)
+	}
+
+	return validated, nil
+}
+
+// NOTE: Token signing method must match the one of the key, so a token
+// cannot pick the algorithm it is verified with
+func (ep *IdentityEndpoint[U]) verificationKey(token *jwt.Token) (any, error) {
+	key, err := ep.lookupSigningKey(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Method == nil || token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected token signing method %v", token.Header["alg"])
+	}
+
+	return key.VerificationKey(), nil
+}
+
+func (ep *IdentityEndpoint[U]) lookupSigningKey(token *jwt.Token) (*identity.SigningKey, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	switch {
+	case ep.Keys != nil && len(kid) > 0:
+		key, found := ep.Keys.Lookup(kid)
+		if !found {
+			return nil, identity.ErrUnknownSigningKey
+		}
+
+		return key, nil
+	case ep.TokenPrivateKey != nil:
+		return ep.tokenPrivateSigningKey()
+	case ep.Keys != nil:
+		if key := ep.Keys.Active(); key != nil {
+			return key, nil
+		}
+	}
+
+	return nil, identity.ErrUnknownSigningKey
+}
+
+func (ep *IdentityEndpoint[U]) tokenPrivateSigningKey() (*identity.SigningKey, error) {
+	ep.fallbackKeyOnce.Do(func() {
+		ep.fallbackKey, ep.fallbackKeyErr = identity.NewSigningKey(
+			ep.TokenPrivateKey,
+			ep.TokenSigningMethod,
+		)
+	})
+
+	return ep.fallbackKey, ep.fallbackKeyErr
+}
+
+func (ep *IdentityEndpoint[U]) clientInfo(r router.Request) identity.ClientInfo {
+	if ep.ClientInfo != nil {
+		return ep.ClientInfo(r)
+	}
+
+	ci := identity.ClientInfo{
+		UserAgent: r.Headers().Get("User-Agent"),
+	}
+
+	if addressed, isOk := r.(router.RemoteAddrRequest); isOk {
+		ci.Address = addressed.RemoteAddr()
+	}
+
+	return ci
 }
 
 func (ep *IdentityEndpoint[U]) accessTokenHeaderName() string {
@@ -370,6 +675,14 @@ func (ep *IdentityEndpoint[U]) refreshTokenHeaderName() string {
 	return ep.RefreshTokenHeader
 }
 
+func (ep *IdentityEndpoint[U]) apiKeyHeaderName() string {
+	if len(ep.ApiKeyHeader) == 0 {
+		return ApiKeyHeader
+	}
+
+	return ep.ApiKeyHeader
+}
+
 func (ep *IdentityEndpoint[U]) log() *slog.Logger {
 	return log.OrDiscard(ep.Log)
 }
@@ -2,6 +2,7 @@ package http
 
 import (
 	"net/http"
+	"slices"
 
 	"github.com/google/uuid"
 	"github.com/yandzee/go-svc/identity"
@@ -13,13 +14,24 @@ type GuardOptions struct {
 	RedirectCode        int
 	RedirectTo          string
 	IsUserFetchDisabled bool
+
+	// NOTE: Evaluated in order once the request is authenticated, denial
+	// is responded with 403, policies make IsOptional ineffective
+	Policies []Policy
 }
 
 type GuardResult[U identity.User] struct {
 	User        *U
 	Tokens      identity.ValidatedTokenPair
 	IsResponded bool
+	IsForbidden bool
 	Options     GuardOptions
+
+	// NOTE: Set only when policies are evaluated
+	Principal *Principal
+
+	// NOTE: Set when request is authenticated by API key instead of tokens
+	ApiKey *identity.ApiKey
 }
 
 func (ep *IdentityEndpoint[U]) Guard(
@@ -33,7 +45,11 @@ func (ep *IdentityEndpoint[U]) Guard(
 		result.Options = opts[0]
 	}
 
-	pair, err := ep.tokensFromRequest(rctx.Request)
+	if key := ep.apiKeyFromRequest(rctx.Request); len(key) > 0 {
+		return ep.guardApiKey(rctx, key, result)
+	}
+
+	pair, err := ep.tokensFromRequest(rctx.Context(), rctx.Request)
 	if err != nil {
 		log.Error("tokensFromRequest failure", "err", err.Error())
 
@@ -48,43 +64,69 @@ func (ep *IdentityEndpoint[U]) Guard(
 
 	result.Tokens = pair
 
-	if !result.Options.IsOptional && !pair.HasValidAccess() {
-		if code := result.Options.RedirectCode; code != 0 {
-			rctx.Response.Redirect(code, result.Options.RedirectTo)
-		} else {
+	isRequired := !result.Options.IsOptional || len(result.Options.Policies) > 0
+
+	if isRequired && !pair.HasValidAccess() {
+		ep.respondUnauthenticated(rctx, &result, "AuthGuard access token is either invalid or absent")
+		return result, nil
+	}
+
+	if !pair.HasValidAccess() {
+		return result, nil
+	}
+
+	if !result.Options.IsUserFetchDisabled {
+		usr, err := ep.Provider.GetTokenUser(rctx.Context(), pair.AccessToken.Token)
+		if err != nil {
+			log.Error("GetTokenUser failure", "err", err.Error())
+
 			rctx.Response.String(
-				http.StatusUnauthorized,
-				"AuthGuard access token is either invalid or absent",
+				http.StatusInternalServerError,
+				"GetTokenUser: "+err.Error(),
 			)
+
+			result.IsResponded = true
+			return result, err
 		}
 
-		result.IsResponded = true
-		return result, nil
+		result.User = usr
 	}
 
-	if result.Options.IsUserFetchDisabled || !pair.HasValidAccess() {
+	if len(result.Options.Policies) == 0 {
 		return result, nil
 	}
 
-	usr, err := ep.Provider.GetTokenUser(rctx.Context(), pair.AccessToken.Token)
-	if err != nil {
-		log.Error("GetTokenUser failure", "err", err.Error())
-
-		rctx.Response.String(
-			http.StatusInternalServerError,
-			"GetTokenUser: "+err.Error(),
-		)
+	err = ep.authorize(rctx, &result)
+	return result, err
+}
 
-		result.IsResponded = true
-		return result, err
+func (ep *IdentityEndpoint[U]) respondUnauthenticated(
+	rctx *router.RequestContext,
+	result *GuardResult[U],
+	msg string,
+) {
+	if code := result.Options.RedirectCode; code != 0 {
+		rctx.Response.Redirect(code, result.Options.RedirectTo)
+	} else {
+		rctx.Response.String(http.StatusUnauthorized, msg)
 	}
 
-	result.User = usr
-	return result, nil
+	result.IsResponded = true
 }
 
 func (gr *GuardResult[U]) IsAuthorized() bool {
-	return gr.Tokens.HasValidAccess() && (gr.Options.IsOptional || gr.User != nil)
+	if gr.IsForbidden {
+		return false
+	}
+
+	isAuthenticated := gr.Tokens.HasValidAccess() || gr.ApiKey != nil
+	return isAuthenticated && (gr.Options.IsOptional || gr.User != nil)
+}
+
+// NOTE: Returns copy of options with policies appended
+func (o GuardOptions) With(policies ...Policy) GuardOptions {
+	o.Policies = append(slices.Clone(o.Policies), policies...)
+	return o
 }
 
 func (gr *GuardResult[U]) GetUserId() (uuid.UUID, bool) {
@@ -92,5 +134,26 @@ func (gr *GuardResult[U]) GetUserId() (uuid.UUID, bool) {
 		return (*gr.User).GetId(), true
 	}
 
+	if gr.ApiKey != nil {
+		return gr.ApiKey.UserId, true
+	}
+
 	return gr.Tokens.UserId()
 }
+
+// NOTE: Claims of the access token, nil if it is absent or invalid
+func (gr *GuardResult[U]) Claims() *identity.Claims {
+	if !gr.Tokens.HasValidAccess() {
+		return nil
+	}
+
+	return gr.Tokens.AccessToken.Token.Claims()
+}
+
+func (gr *GuardResult[U]) Claim(name string) (any, bool) {
+	return gr.Claims().Get(name)
+}
+
+func (gr *GuardResult[U]) DecodeClaims(dst any) error {
+	return gr.Claims().Decode(dst)
+}
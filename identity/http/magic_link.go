@@ -0,0 +1,129 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/yandzee/go-svc/crypto"
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/router"
+)
+
+// NOTE: Cookie binding magic links to the device they were requested from
+const MagicLinkNonceCookie = "magic_link_nonce"
+
+type MagicLinkRequestBody struct {
+	Email string `json:"email"`
+}
+
+// NOTE: Responds the same way whether the account exists or not, nonce
+// cookie is a session one, link expiry is enforced by its token
+func (ep *IdentityEndpoint[U]) RequestMagicLink() router.Handler {
+	log := ep.log()
+
+	return func(rctx *router.RequestContext) {
+		links, isOk := ep.magicLinkProvider(rctx)
+		if !isOk {
+			return
+		}
+
+		body := MagicLinkRequestBody{}
+		if !ep.decodeBody(rctx, &body) {
+			return
+		}
+
+		if len(body.Email) == 0 {
+			rctx.Response.String(http.StatusBadRequest, "Email must be provided")
+			return
+		}
+
+		nonce := crypto.RandomHex(32)
+
+		err := links.RequestMagicLink(rctx.Context(), identity.MagicLinkRequest{
+			Email: body.Email,
+			Nonce: nonce,
+		})
+
+		switch {
+		case errors.Is(err, identity.ErrAccountsNotSupported):
+			rctx.Response.String(http.StatusNotImplemented, "Magic links are not supported by users registry")
+			return
+		case err != nil:
+			log.Error("RequestMagicLink failed", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "RequestMagicLink: %s", err.Error())
+			return
+		}
+
+		rctx.Response.SetCookie(ep.magicLinkCookie(nonce, 0))
+		rctx.Response.String(http.StatusAccepted, "Sign in link is sent if the account exists")
+	}
+}
+
+func (ep *IdentityEndpoint[U]) MagicLinkSignin() router.Handler {
+	log := ep.log()
+
+	return func(rctx *router.RequestContext) {
+		links, isOk := ep.magicLinkProvider(rctx)
+		if !isOk {
+			return
+		}
+
+		body := TokenBody{}
+		if !ep.decodeBody(rctx, &body) {
+			return
+		}
+
+		token, isOk := ep.oneTimeToken(rctx, body.Token, identity.TokenUseMagicLink)
+		if !isOk {
+			return
+		}
+
+		nonce := ""
+		if cookie := rctx.Request.Cookie(MagicLinkNonceCookie); cookie != nil {
+			nonce = cookie.Value
+		}
+
+		ctx := identity.WithClientInfo(rctx.Context(), ep.clientInfo(rctx.Request))
+
+		result, err := links.SignInWithMagicLink(ctx, identity.MagicLinkSigninRequest{
+			Token: token,
+			Nonce: nonce,
+		})
+
+		switch {
+		case errors.Is(err, identity.ErrAccountsNotSupported):
+			rctx.Response.String(http.StatusNotImplemented, "Magic links are not supported by users registry")
+			return
+		case err != nil:
+			log.Error("SignInWithMagicLink failed", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "MagicLinkSignin: %s", err.Error())
+			return
+		}
+
+		if !result.NotAuthorized {
+			rctx.Response.SetCookie(ep.magicLinkCookie("", -1))
+		}
+
+		ep.respondSigninResult(rctx, result)
+	}
+}
+
+func (ep *IdentityEndpoint[U]) magicLinkCookie(nonce string, maxAge int) *http.Cookie {
+	// NOTE: Lax, since the flow is completed by cross-site navigation
+	opts := ep.transport().Cookie
+	opts.SameSite = http.SameSiteLaxMode
+
+	cookie := opts.Cookie(MagicLinkNonceCookie, nonce, maxAge)
+	return &cookie
+}
+
+func (ep *IdentityEndpoint[U]) magicLinkProvider(
+	rctx *router.RequestContext,
+) (identity.MagicLinkProvider[U], bool) {
+	links, isOk := ep.Provider.(identity.MagicLinkProvider[U])
+	if !isOk {
+		rctx.Response.String(http.StatusNotImplemented, "Magic links are not supported by identity provider")
+	}
+
+	return links, isOk
+}
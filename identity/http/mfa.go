@@ -0,0 +1,160 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/yandzee/go-svc/data/jsoner"
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/router"
+)
+
+type MFAVerifyBody struct {
+	MFAToken string `json:"mfaToken"`
+	Code     string `json:"code"`
+}
+
+type MFACodeBody struct {
+	Code string `json:"code"`
+}
+
+// NOTE: Second step of signin, exchanges MFA token returned by Signin and
+// a TOTP or recovery code for token pair
+func (ep *IdentityEndpoint[U]) MFAVerify() router.Handler {
+	log := ep.log()
+
+	return func(rctx *router.RequestContext) {
+		mfa, isOk := ep.mfaProvider(rctx)
+		if !isOk {
+			return
+		}
+
+		body := MFAVerifyBody{}
+		if !ep.decodeBody(rctx, &body) {
+			return
+		}
+
+		token, err := ep.parseToken(rctx.Context(), body.MFAToken, identity.TokenUseMFA)
+		if err != nil {
+			log.Error("MFA token parse failure", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "MFAVerify: %s", err.Error())
+			return
+		}
+
+		if !token.IsValid() {
+			rctx.Response.String(http.StatusUnauthorized, "Unauthorized: MFA token is invalid or expired")
+			return
+		}
+
+		ctx := identity.WithClientInfo(rctx.Context(), ep.clientInfo(rctx.Request))
+
+		result, err := mfa.VerifyMFA(ctx, identity.MFAVerifyRequest{
+			Token: token.Token,
+			Code:  body.Code,
+		})
+
+		if err != nil {
+			log.Error("VerifyMFA failed", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "MFAVerify: %s", err.Error())
+			return
+		}
+
+		ep.respondSigninResult(rctx, result)
+	}
+}
+
+// NOTE: Enrollment has to be confirmed by MFAConfirm with the first code
+// before second factor is required at signin
+func (ep *IdentityEndpoint[U]) MFAEnroll() router.Handler {
+	log := ep.log()
+
+	return ep.Protect(func(rctx *router.RequestContext) {
+		mfa, isOk := ep.mfaProvider(rctx)
+		if !isOk {
+			return
+		}
+
+		usr, _ := UserFrom[U](rctx)
+
+		enrollment, err := mfa.EnrollMFA(rctx.Context(), usr)
+		switch {
+		case errors.Is(err, identity.ErrMFANotSupported):
+			rctx.Response.String(http.StatusNotImplemented, "MFA is not supported by users registry")
+		case errors.Is(err, identity.ErrMFAEnabled):
+			rctx.Response.String(http.StatusConflict, "MFA is already enabled")
+		case err != nil:
+			log.Error("EnrollMFA failed", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "MFAEnroll: %s", err.Error())
+		default:
+			_, _ = rctx.Response.JSON(http.StatusOK, enrollment)
+		}
+	})
+}
+
+func (ep *IdentityEndpoint[U]) MFAConfirm() router.Handler {
+	return ep.Protect(ep.mfaCodeHandler(identity.MFAProvider[U].ConfirmMFA))
+}
+
+func (ep *IdentityEndpoint[U]) MFADisable() router.Handler {
+	return ep.Protect(ep.mfaCodeHandler(identity.MFAProvider[U].DisableMFA))
+}
+
+func (ep *IdentityEndpoint[U]) mfaCodeHandler(
+	fn func(identity.MFAProvider[U], context.Context, *U, string) (bool, error),
+) router.Handler {
+	log := ep.log()
+
+	return func(rctx *router.RequestContext) {
+		mfa, isOk := ep.mfaProvider(rctx)
+		if !isOk {
+			return
+		}
+
+		body := MFACodeBody{}
+		if !ep.decodeBody(rctx, &body) {
+			return
+		}
+
+		usr, _ := UserFrom[U](rctx)
+
+		isAccepted, err := fn(mfa, rctx.Context(), usr, body.Code)
+		switch {
+		case errors.Is(err, identity.ErrMFANotSupported):
+			rctx.Response.String(http.StatusNotImplemented, "MFA is not supported by users registry")
+		case errors.Is(err, identity.ErrMFANotEnrolled):
+			rctx.Response.String(http.StatusConflict, "MFA is not enrolled")
+		case err != nil:
+			log.Error("MFA operation failed", "err", err.Error())
+			rctx.Response.Stringf(http.StatusInternalServerError, "MFA: %s", err.Error())
+		case !isAccepted:
+			rctx.Response.String(http.StatusBadRequest, "Invalid MFA code")
+		default:
+			rctx.Response.String(http.StatusOK, "Success")
+		}
+	}
+}
+
+func (ep *IdentityEndpoint[U]) mfaProvider(rctx *router.RequestContext) (identity.MFAProvider[U], bool) {
+	mfa, isOk := ep.Provider.(identity.MFAProvider[U])
+	if !isOk {
+		rctx.Response.String(http.StatusNotImplemented, "MFA is not supported by identity provider")
+		return nil, false
+	}
+
+	if ep.isApiKeyRejected(rctx, "manage MFA") {
+		return nil, false
+	}
+
+	return mfa, true
+}
+
+func (ep *IdentityEndpoint[U]) decodeBody(rctx *router.RequestContext, dst any) bool {
+	res := (&jsoner.Jsoner{}).Decode(rctx.Request.LimitedBody(16*KiloByte), dst)
+	if err := res.Err(); err != nil {
+		rctx.Response.Stringf(http.StatusBadRequest, "Failed to parse request body: %s", err.Error())
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,110 @@
+package http
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/identity/oidc"
+	"github.com/yandzee/go-svc/router"
+)
+
+// NOTE: Cookie binding pending OIDC authorization to the user agent
+const OIDCStateCookie = "oidc_state"
+
+// NOTE: Redirects to the authorization endpoint of the connector
+func (ep *IdentityEndpoint[U]) OIDCLogin(connector string) router.Handler {
+	log := ep.log()
+
+	return func(rctx *router.RequestContext) {
+		flow, isOk := ep.oidcFlow(rctx)
+		if !isOk {
+			return
+		}
+
+		auth, err := flow.Begin(rctx.Context(), connector)
+		switch {
+		case errors.Is(err, oidc.ErrUnknownConnector):
+			rctx.Response.Stringf(http.StatusNotFound, "Unknown OIDC connector: %s", connector)
+			return
+		case err != nil:
+			log.Error("OIDC login failed", "connector", connector, "err", err.Error())
+			rctx.Response.Stringf(http.StatusBadGateway, "OIDCLogin: %s", err.Error())
+			return
+		}
+
+		rctx.Response.SetCookie(ep.oidcStateCookie(auth.State, 0))
+		rctx.Response.Redirect(http.StatusFound, auth.URL)
+	}
+}
+
+// NOTE: Responds as Signin does, state from query must match the cookie set
+// by OIDCLogin
+func (ep *IdentityEndpoint[U]) OIDCCallback() router.Handler {
+	log := ep.log()
+
+	return func(rctx *router.RequestContext) {
+		flow, isOk := ep.oidcFlow(rctx)
+		if !isOk {
+			return
+		}
+
+		query := rctx.Request.URL().Query()
+		state := query.Get("state")
+
+		cookie := rctx.Request.Cookie(OIDCStateCookie)
+		if len(state) == 0 || cookie == nil ||
+			subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+			rctx.Response.String(http.StatusBadRequest, "OIDC state mismatch")
+			return
+		}
+
+		rctx.Response.SetCookie(ep.oidcStateCookie("", -1))
+
+		ctx := identity.WithClientInfo(rctx.Context(), ep.clientInfo(rctx.Request))
+
+		result, err := flow.Complete(ctx, oidc.Callback{
+			State:            state,
+			Code:             query.Get("code"),
+			Error:            query.Get("error"),
+			ErrorDescription: query.Get("error_description"),
+		})
+
+		authErr := &oidc.AuthError{}
+
+		switch {
+		case errors.Is(err, oidc.ErrInvalidState):
+			rctx.Response.String(http.StatusBadRequest, "OIDC state is invalid or expired")
+			return
+		case errors.As(err, &authErr):
+			log.Info("OIDC authorization is rejected", "err", err.Error())
+			rctx.Response.Stringf(http.StatusUnauthorized, "Unauthorized: %s", authErr.Error())
+			return
+		case err != nil:
+			log.Error("OIDC callback failed", "err", err.Error())
+			rctx.Response.String(http.StatusUnauthorized, "Unauthorized: OIDC signin failed")
+			return
+		}
+
+		ep.respondSigninResult(rctx, result)
+	}
+}
+
+func (ep *IdentityEndpoint[U]) oidcStateCookie(state string, maxAge int) *http.Cookie {
+	// NOTE: Lax, since the flow is completed by cross-site navigation
+	opts := ep.transport().Cookie
+	opts.SameSite = http.SameSiteLaxMode
+
+	cookie := opts.Cookie(OIDCStateCookie, state, maxAge)
+	return &cookie
+}
+
+func (ep *IdentityEndpoint[U]) oidcFlow(rctx *router.RequestContext) (oidc.Flow[U], bool) {
+	flow, isOk := ep.Provider.(oidc.Flow[U])
+	if !isOk {
+		rctx.Response.String(http.StatusNotImplemented, "OIDC is not supported by identity provider")
+	}
+
+	return flow, isOk
+}
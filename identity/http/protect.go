@@ -0,0 +1,56 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/router"
+)
+
+type guardResultKey struct{}
+
+// NOTE: Runs Guard once per request and stores its result in the request
+// context, see UserFrom and GuardResultFrom. Unless guard is optional,
+// requests of users that are not found are responded with 401
+func (ep *IdentityEndpoint[U]) Middleware(opts ...GuardOptions) router.Middleware {
+	return func(next router.Handler) router.Handler {
+		return func(rctx *router.RequestContext) {
+			result, err := ep.Guard(rctx, opts...)
+			if err != nil || result.IsResponded {
+				return
+			}
+
+			isUserRequired := !result.Options.IsOptional && !result.Options.IsUserFetchDisabled
+
+			if isUserRequired && result.User == nil {
+				rctx.Response.String(http.StatusUnauthorized, "Unauthorized: user is not found")
+				return
+			}
+
+			rctx.SetValue(guardResultKey{}, &result)
+			next(rctx)
+		}
+	}
+}
+
+func (ep *IdentityEndpoint[U]) Protect(h router.Handler, opts ...GuardOptions) router.Handler {
+	return ep.Middleware(opts...)(h)
+}
+
+func GuardResultFrom[U identity.User](rctx *router.RequestContext) (*GuardResult[U], bool) {
+	val, _ := rctx.Value(guardResultKey{})
+
+	result, isOk := val.(*GuardResult[U])
+	return result, isOk
+}
+
+// NOTE: Returns false if the route is not protected, guard is optional and
+// request is anonymous, or user fetch is disabled
+func UserFrom[U identity.User](rctx *router.RequestContext) (*U, bool) {
+	result, isOk := GuardResultFrom[U](rctx)
+	if !isOk || result.User == nil {
+		return nil, false
+	}
+
+	return result.User, true
+}
@@ -0,0 +1,166 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/yandzee/go-svc/data/jsoner"
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/router"
+)
+
+// NOTE: Ways tokens are read from requests and written to responses, zero
+// value matches the defaults: access and refresh headers, access cookie and
+// `Authorization: Bearer` for access tokens
+type TokenTransport struct {
+	HeadersDisabled      bool
+	BearerDisabled       bool
+	AccessCookieDisabled bool
+
+	// NOTE: Access cookie is named after access token header by default,
+	// refresh cookie is used only when its name is set
+	AccessCookie  string
+	RefreshCookie string
+
+	Cookie identity.CookieOptions
+
+	// NOTE: Options of refresh cookie, Cookie is used when nil, limiting
+	// its Path to the refresh endpoint keeps it out of other requests
+	RefreshCookieOptions *identity.CookieOptions
+
+	// NOTE: Refresh responds with tokens in JSON body, refresh token is
+	// also read from JSON body of Refresh and Signout requests
+	JSONBody bool
+}
+
+type RefreshTokenBody struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func (ep *IdentityEndpoint[U]) respondTokens(
+	rctx *router.RequestContext,
+	atoken *identity.Token,
+	rtoken *identity.Token,
+) {
+	tr := ep.transport()
+	headers := rctx.Response.Headers()
+
+	if atoken != nil {
+		if !tr.HeadersDisabled {
+			headers.Set(ep.accessTokenHeaderName(), atoken.JWTString)
+		}
+
+		if !tr.AccessCookieDisabled {
+			cookie := atoken.AsCookie(ep.accessCookieName(), tr.Cookie)
+			rctx.Response.SetCookie(&cookie)
+		}
+	}
+
+	if rtoken != nil {
+		if !tr.HeadersDisabled {
+			headers.Set(ep.refreshTokenHeaderName(), rtoken.JWTString)
+		}
+
+		if len(tr.RefreshCookie) > 0 {
+			cookie := rtoken.AsCookie(tr.RefreshCookie, tr.refreshCookieOptions())
+			rctx.Response.SetCookie(&cookie)
+		}
+	}
+}
+
+func (ep *IdentityEndpoint[U]) clearTokenCookies(rctx *router.RequestContext) {
+	tr := ep.transport()
+
+	if !tr.AccessCookieDisabled {
+		cookie := tr.Cookie.Cookie(ep.accessCookieName(), "", -1)
+		rctx.Response.SetCookie(&cookie)
+	}
+
+	if len(tr.RefreshCookie) > 0 {
+		cookie := tr.refreshCookieOptions().Cookie(tr.RefreshCookie, "", -1)
+		rctx.Response.SetCookie(&cookie)
+	}
+}
+
+// NOTE: Raw tokens found in request, access token is looked up in header,
+// bearer and cookie, refresh token in header and cookie
+func (ep *IdentityEndpoint[U]) rawTokensFromRequest(r router.Request) (string, string) {
+	tr := ep.transport()
+	headers := r.Headers()
+
+	access, refresh := "", ""
+
+	if !tr.HeadersDisabled {
+		access = headers.Get(ep.accessTokenHeaderName())
+		refresh = headers.Get(ep.refreshTokenHeaderName())
+	}
+
+	if len(access) == 0 && !tr.BearerDisabled {
+		bearer, isOk := strings.CutPrefix(headers.Get("Authorization"), "Bearer ")
+
+		// NOTE: Bearer values which are not JWTs are taken as API keys
+		if isOk && strings.Contains(bearer, ".") {
+			access = strings.TrimSpace(bearer)
+		}
+	}
+
+	if len(access) == 0 && !tr.AccessCookieDisabled {
+		if cookie := r.Cookie(ep.accessCookieName()); cookie != nil {
+			access = cookie.Value
+		}
+	}
+
+	if len(refresh) == 0 && len(tr.RefreshCookie) > 0 {
+		if cookie := r.Cookie(tr.RefreshCookie); cookie != nil {
+			refresh = cookie.Value
+		}
+	}
+
+	return access, refresh
+}
+
+// NOTE: Empty body is not an error, since refresh token may be passed other
+// ways
+func (ep *IdentityEndpoint[U]) refreshTokenFromBody(rctx *router.RequestContext) (string, bool) {
+	if !ep.transport().JSONBody {
+		return "", true
+	}
+
+	body := RefreshTokenBody{}
+
+	res := (&jsoner.Jsoner{}).Decode(rctx.Request.LimitedBody(16*KiloByte), &body)
+	if res.IsEmptyInput {
+		return "", true
+	}
+
+	if err := res.Err(); err != nil {
+		rctx.Response.Stringf(http.StatusBadRequest, "Failed to parse request body: %s", err.Error())
+		return "", false
+	}
+
+	return body.RefreshToken, true
+}
+
+func (ep *IdentityEndpoint[U]) transport() TokenTransport {
+	if ep.Transport == nil {
+		return TokenTransport{}
+	}
+
+	return *ep.Transport
+}
+
+func (ep *IdentityEndpoint[U]) accessCookieName() string {
+	if name := ep.transport().AccessCookie; len(name) > 0 {
+		return name
+	}
+
+	return ep.accessTokenHeaderName()
+}
+
+func (tr *TokenTransport) refreshCookieOptions() identity.CookieOptions {
+	if tr.RefreshCookieOptions == nil {
+		return tr.Cookie
+	}
+
+	return *tr.RefreshCookieOptions
+}
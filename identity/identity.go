@@ -16,6 +16,12 @@ type Provider[U User] interface {
 	GetTokenUser(context.Context, *Token) (*U, error)
 }
 
+// NOTE: Optional, providers without it only get token cookies cleared on
+// signout, since there is nothing to revoke on their side
+type SignoutProvider[U User] interface {
+	SignOut(context.Context, SignoutRequest) error
+}
+
 type UsersRegistry[U User] interface {
 	CreateUser(context.Context, *UserStub) (CreateUserResult[U], error)
 	GetUserById(context.Context, *uuid.UUID) (*U, error)
@@ -32,3 +38,13 @@ type IdentityUtils interface {
 type User interface {
 	GetId() uuid.UUID
 }
+
+// NOTE: Optional, roles and permissions of users implementing these are
+// preferred over ones embedded into token claims
+type RolesHolder interface {
+	GetRoles() []string
+}
+
+type PermissionsHolder interface {
+	GetPermissions() []string
+}
@@ -0,0 +1,200 @@
+package identity
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyId     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+
+	// NOTE: EC and OKP members
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+
+	// NOTE: RSA members
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+// NOTE: RFC 7638 thumbprint, only required members in lexicographic order
+func (k *JWK) Thumbprint() string {
+	var members any
+
+	switch k.KeyType {
+	case "RSA":
+		members = struct {
+			E       string `json:"e"`
+			KeyType string `json:"kty"`
+			N       string `json:"n"`
+		}{k.E, k.KeyType, k.N}
+	case "OKP":
+		members = struct {
+			Curve   string `json:"crv"`
+			KeyType string `json:"kty"`
+			X       string `json:"x"`
+		}{k.Curve, k.KeyType, k.X}
+	default:
+		members = struct {
+			Curve   string `json:"crv"`
+			KeyType string `json:"kty"`
+			X       string `json:"x"`
+			Y       string `json:"y"`
+		}{k.Curve, k.KeyType, k.X, k.Y}
+	}
+
+	encoded, _ := json.Marshal(members)
+	sum := sha256.Sum256(encoded)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (s *JWKSet) Lookup(kid string) (JWK, bool) {
+	for _, key := range s.Keys {
+		if key.KeyId == kid {
+			return key, true
+		}
+	}
+
+	return JWK{}, false
+}
+
+// NOTE: Parses public key of the JWK, EC points are checked to be on the
+// curve, RSA keys shorter than 2048 bits are rejected
+func (k *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "EC":
+		return k.ecPublicKey()
+	case "RSA":
+		n, err := b64BigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := b64BigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if n.BitLen() < 2048 || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("JWK: unsupported RSA key parameters")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || k.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("JWK: invalid Ed25519 key")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("JWK: unsupported key type %q", k.KeyType)
+}
+
+func (k *JWK) ecPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	var ecdhCurve ecdh.Curve
+
+	switch k.Curve {
+	case "P-256":
+		curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+	case "P-384":
+		curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+	case "P-521":
+		curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+	default:
+		return nil, fmt.Errorf("JWK: unsupported curve %q", k.Curve)
+	}
+
+	size := (curve.Params().BitSize + 7) / 8
+
+	x, errX := base64.RawURLEncoding.DecodeString(k.X)
+	y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+
+	if errX != nil || errY != nil || len(x) != size || len(y) != size {
+		return nil, errors.New("JWK: invalid EC coordinates")
+	}
+
+	uncompressed := append(append([]byte{4}, x...), y...)
+	if _, err := ecdhCurve.NewPublicKey(uncompressed); err != nil {
+		return nil, errors.New("JWK: EC point is not on the curve")
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+func publicJWK(pub any) (JWK, error) {
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		params := pub.Curve.Params()
+		size := (params.BitSize + 7) / 8
+
+		return JWK{
+			KeyType: "EC",
+			Use:     "sig",
+			Curve:   params.Name,
+			X:       b64Int(pub.X, size),
+			Y:       b64Int(pub.Y, size),
+		}, nil
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType: "RSA",
+			Use:     "sig",
+			N:       b64Int(pub.N, 0),
+			E:       b64Int(big.NewInt(int64(pub.E)), 0),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType: "OKP",
+			Use:     "sig",
+			Curve:   "Ed25519",
+			X:       base64.RawURLEncoding.EncodeToString(pub),
+		}, nil
+	}
+
+	return JWK{}, fmt.Errorf("unsupported public key type for JWK: %T", pub)
+}
+
+// NOTE: Zero size means minimal big-endian representation
+func b64Int(n *big.Int, size int) string {
+	b := n.Bytes()
+
+	if size > len(b) {
+		b = n.FillBytes(make([]byte, size))
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func b64BigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("JWK: invalid base64url integer")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
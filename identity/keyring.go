@@ -0,0 +1,214 @@
+package identity
+
+import (
+	"context"
+	"crypto"
+	"log/slog"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/yandzee/go-svc/log"
+)
+
+type Keyring struct {
+	Log *slog.Logger
+
+	// NOTE: Scheduled rotation is disabled when zero
+	RotationInterval time.Duration
+
+	// NOTE: Must not be less than the longest token duration, otherwise
+	// tokens signed by retired keys are rejected before they expire. Retired
+	// keys are kept forever when zero
+	RetiredKeyTTL time.Duration
+
+	// NOTE: GenerateSigningKey with the method of the active key is used
+	// when nil
+	GenerateKey func() (*SigningKey, error)
+
+	mx      sync.RWMutex
+	active  *SigningKey
+	retired []*SigningKey
+}
+
+func NewKeyring(active *SigningKey, retired ...*SigningKey) *Keyring {
+	kr := &Keyring{
+		active: active,
+	}
+
+	for _, key := range retired {
+		if key.RetiredAt.IsZero() {
+			key.RetiredAt = time.Now()
+		}
+
+		kr.retired = append(kr.retired, key)
+	}
+
+	return kr
+}
+
+func KeyringFromPrivateKey(
+	pk crypto.PrivateKey,
+	method ...jwt.SigningMethod,
+) (*Keyring, error) {
+	key, err := NewSigningKey(pk, method...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKeyring(key), nil
+}
+
+func (kr *Keyring) Active() *SigningKey {
+	kr.mx.RLock()
+	defer kr.mx.RUnlock()
+
+	return kr.active
+}
+
+func (kr *Keyring) Lookup(kid string) (*SigningKey, bool) {
+	kr.mx.RLock()
+	defer kr.mx.RUnlock()
+
+	if kr.active != nil && kr.active.Id == kid {
+		return kr.active, true
+	}
+
+	now := time.Now()
+
+	for _, key := range kr.retired {
+		if key.Id == kid && !kr.isExpired(key, now) {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+// NOTE: Active key goes first
+func (kr *Keyring) Keys() []*SigningKey {
+	kr.mx.RLock()
+	defer kr.mx.RUnlock()
+
+	keys := make([]*SigningKey, 0, len(kr.retired)+1)
+	if kr.active != nil {
+		keys = append(keys, kr.active)
+	}
+
+	now := time.Now()
+
+	for _, key := range kr.retired {
+		if !kr.isExpired(key, now) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func (kr *Keyring) Rotate() (*SigningKey, error) {
+	generate := kr.GenerateKey
+	if generate == nil {
+		generate = kr.generateKey
+	}
+
+	key, err := generate()
+	if err != nil {
+		return nil, err
+	}
+
+	kr.SetActive(key)
+	return key, nil
+}
+
+// NOTE: Previously active key is retired and still used for verification
+func (kr *Keyring) SetActive(key *SigningKey) {
+	kr.mx.Lock()
+	defer kr.mx.Unlock()
+
+	now := time.Now()
+	key.RetiredAt = time.Time{}
+
+	if kr.active != nil && kr.active.Id != key.Id {
+		kr.active.RetiredAt = now
+		kr.retired = append(kr.retired, kr.active)
+	}
+
+	kr.active = key
+	kr.pruneRetired(now)
+
+	kr.log().Info("signing key is activated", "kid", key.Id)
+}
+
+// Implements lifecycle.Runnable, rotates keys every RotationInterval
+func (kr *Keyring) Run(ctx context.Context) error {
+	if kr.RotationInterval <= 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ticker := time.NewTicker(kr.RotationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		if _, err := kr.Rotate(); err != nil {
+			kr.log().Error("scheduled key rotation failure", "err", err.Error())
+		}
+	}
+}
+
+func (kr *Keyring) JWKS() (JWKSet, error) {
+	set := JWKSet{
+		Keys: []JWK{},
+	}
+
+	for _, key := range kr.Keys() {
+		if key.IsSymmetric() {
+			continue
+		}
+
+		jwk, err := key.JWK()
+		if err != nil {
+			return set, err
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set, nil
+}
+
+func (kr *Keyring) generateKey() (*SigningKey, error) {
+	if active := kr.Active(); active != nil {
+		return GenerateSigningKey(active.Method)
+	}
+
+	return GenerateSigningKey()
+}
+
+func (kr *Keyring) pruneRetired(now time.Time) {
+	kept := kr.retired[:0]
+
+	for _, key := range kr.retired {
+		if !kr.isExpired(key, now) {
+			kept = append(kept, key)
+		}
+	}
+
+	clear(kr.retired[len(kept):])
+	kr.retired = kept
+}
+
+func (kr *Keyring) isExpired(key *SigningKey, now time.Time) bool {
+	return kr.RetiredKeyTTL > 0 && now.Sub(key.RetiredAt) > kr.RetiredKeyTTL
+}
+
+func (kr *Keyring) log() *slog.Logger {
+	return log.OrDiscard(kr.Log)
+}
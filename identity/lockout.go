@@ -0,0 +1,403 @@
+package identity
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yandzee/go-svc/log"
+)
+
+const (
+	DefaultLockoutFreeAttempts      = 3
+	DefaultLockoutMaxFailures       = 10
+	DefaultLockoutClientMaxFailures = 100
+	DefaultLockoutDuration          = 15 * time.Minute
+	DefaultLockoutFailureWindow     = time.Hour
+	DefaultLockoutBackoffBase       = time.Second
+	DefaultLockoutBackoffMax        = time.Minute
+)
+
+// NOTE: Attempts allowed by Check are pending until their failure is
+// recorded, LastFailure is stamped by them as well, so concurrent attempts
+// are subject to backoff and MaxFailures as if they have already failed
+type AttemptsState struct {
+	Failures    int       `json:"failures"`
+	Pending     int       `json:"pending"`
+	LastFailure time.Time `json:"lastFailure"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+// NOTE: Update must apply fn atomically, zero state is passed for unknown
+// keys and returned state equal to zero one may be dropped
+type LockoutStore interface {
+	Update(context.Context, string, func(*AttemptsState)) (AttemptsState, error)
+	Delete(context.Context, string) error
+}
+
+type LockoutStatus struct {
+	// NOTE: Account is locked after too many failures for its identifier
+	Locked bool
+
+	// NOTE: Attempt is delayed by backoff or client made too many failures
+	Throttled  bool
+	RetryAfter time.Duration
+}
+
+func (s LockoutStatus) IsBlocked() bool {
+	return s.Locked || s.Throttled
+}
+
+// NOTE: Failures are tracked per identifier (e.g. username) and per client
+// address. After FreeAttempts failures each next attempt for the identifier
+// is delayed exponentially starting from BackoffBase, MaxFailures lock the
+// account for LockDuration, ClientMaxFailures throttle the client for the
+// same time. Zero fields fall back to defaults
+type Lockout struct {
+	Store LockoutStore
+	Log   *slog.Logger
+
+	FreeAttempts      int
+	MaxFailures       int
+	ClientMaxFailures int
+	LockDuration      time.Duration
+	FailureWindow     time.Duration
+	BackoffBase       time.Duration
+	BackoffMax        time.Duration
+
+	OnLock   func(context.Context, string, time.Time)
+	OnUnlock func(context.Context, string)
+}
+
+func NewLockout() *Lockout {
+	return &Lockout{
+		Store: NewMemoryLockoutStore(),
+	}
+}
+
+// NOTE: Allowed attempt is reserved for the identifier, so it has to be
+// followed by RecordFailure, RecordSuccess or Release. Empty identifier is
+// not tracked, only the client is
+func (l *Lockout) Check(ctx context.Context, identifier, client string) (LockoutStatus, error) {
+	now := time.Now()
+	clientState := AttemptsState{}
+
+	if len(client) > 0 {
+		var err error
+
+		clientState, err = l.Store.Update(ctx, clientKey(client), l.expire(now))
+		if err != nil {
+			return LockoutStatus{}, err
+		}
+	}
+
+	isClientThrottled := now.Before(clientState.LockedUntil)
+	status := LockoutStatus{}
+
+	if len(identifier) > 0 {
+		_, err := l.Store.Update(ctx, identifierKey(identifier), func(st *AttemptsState) {
+			status = l.reserve(st, now, isClientThrottled)
+		})
+
+		if err != nil {
+			return LockoutStatus{}, err
+		}
+	}
+
+	if !status.Locked && isClientThrottled {
+		return LockoutStatus{
+			Throttled:  true,
+			RetryAfter: clientState.LockedUntil.Sub(now),
+		}, nil
+	}
+
+	return status, nil
+}
+
+func (l *Lockout) RecordFailure(ctx context.Context, identifier, client string) error {
+	now := time.Now()
+
+	if err := l.recordIdentifierFailure(ctx, identifier, now); err != nil {
+		return err
+	}
+
+	if len(client) == 0 {
+		return nil
+	}
+
+	isThrottled := false
+
+	clientState, err := l.Store.Update(ctx, clientKey(client), func(st *AttemptsState) {
+		isThrottled = l.fail(st, now, l.clientMaxFailures())
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if isThrottled {
+		l.log().Warn("client is throttled", "client", client, "until", clientState.LockedUntil)
+	}
+
+	return nil
+}
+
+func (l *Lockout) recordIdentifierFailure(ctx context.Context, identifier string, now time.Time) error {
+	if len(identifier) == 0 {
+		return nil
+	}
+
+	isLocked := false
+
+	idState, err := l.Store.Update(ctx, identifierKey(identifier), func(st *AttemptsState) {
+		st.Pending = max(st.Pending-1, 0)
+		isLocked = l.fail(st, now, l.maxFailures())
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if isLocked {
+		l.log().Warn("identifier is locked", "identifier", identifier, "until", idState.LockedUntil)
+
+		if l.OnLock != nil {
+			l.OnLock(ctx, identifier, idState.LockedUntil)
+		}
+	}
+
+	return nil
+}
+
+// NOTE: Failures of the client are kept, since they may belong to other
+// identifiers
+func (l *Lockout) RecordSuccess(ctx context.Context, identifier string) error {
+	if len(identifier) == 0 {
+		return nil
+	}
+
+	return l.Store.Delete(ctx, identifierKey(identifier))
+}
+
+// NOTE: Releases attempt reserved by Check which has no outcome, e.g. when
+// the user lookup fails. LastFailure stamped by the attempt is kept
+func (l *Lockout) Release(ctx context.Context, identifier string) error {
+	if len(identifier) == 0 {
+		return nil
+	}
+
+	_, err := l.Store.Update(ctx, identifierKey(identifier), func(st *AttemptsState) {
+		st.Pending = max(st.Pending-1, 0)
+	})
+
+	return err
+}
+
+func (l *Lockout) Unlock(ctx context.Context, identifier string) error {
+	if err := l.Store.Delete(ctx, identifierKey(identifier)); err != nil {
+		return err
+	}
+
+	l.log().Info("identifier is unlocked", "identifier", identifier)
+
+	if l.OnUnlock != nil {
+		l.OnUnlock(ctx, identifier)
+	}
+
+	return nil
+}
+
+func (l *Lockout) expire(now time.Time) func(*AttemptsState) {
+	return func(st *AttemptsState) {
+		isLocked := now.Before(st.LockedUntil)
+		isStale := now.Sub(st.LastFailure) > l.failureWindow()
+
+		if !isLocked && (isStale || !st.LockedUntil.IsZero()) {
+			*st = AttemptsState{}
+		}
+	}
+}
+
+// NOTE: Pending attempts count towards backoff and MaxFailures, so no more
+// attempts are allowed than could lock the identifier
+func (l *Lockout) reserve(st *AttemptsState, now time.Time, isClientThrottled bool) LockoutStatus {
+	l.expire(now)(st)
+
+	if now.Before(st.LockedUntil) {
+		return LockoutStatus{
+			Locked:     true,
+			RetryAfter: st.LockedUntil.Sub(now),
+		}
+	}
+
+	if isClientThrottled {
+		return LockoutStatus{}
+	}
+
+	attempts := st.Failures + st.Pending
+
+	if next := st.LastFailure.Add(l.backoff(attempts)); now.Before(next) {
+		return LockoutStatus{
+			Throttled:  true,
+			RetryAfter: next.Sub(now),
+		}
+	}
+
+	if attempts >= l.maxFailures() {
+		return LockoutStatus{
+			Throttled:  true,
+			RetryAfter: max(l.backoff(attempts), time.Second),
+		}
+	}
+
+	st.Pending += 1
+	st.LastFailure = now
+
+	return LockoutStatus{}
+}
+
+// NOTE: Returns true if this failure has caused the lock
+func (l *Lockout) fail(st *AttemptsState, now time.Time, maxFailures int) bool {
+	l.expire(now)(st)
+
+	if now.Before(st.LockedUntil) {
+		return false
+	}
+
+	st.Failures += 1
+	st.LastFailure = now
+
+	if st.Failures < maxFailures {
+		return false
+	}
+
+	st.LockedUntil = now.Add(l.lockDuration())
+	return true
+}
+
+func (l *Lockout) backoff(failures int) time.Duration {
+	exceeding := failures - l.freeAttempts()
+	if exceeding <= 0 {
+		return 0
+	}
+
+	base, maxBackoff := l.BackoffBase, l.BackoffMax
+	if base <= 0 {
+		base = DefaultLockoutBackoffBase
+	}
+
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultLockoutBackoffMax
+	}
+
+	delay := base
+	for range exceeding - 1 {
+		delay *= 2
+
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+
+	return min(delay, maxBackoff)
+}
+
+func (l *Lockout) freeAttempts() int {
+	return orDefault(l.FreeAttempts, DefaultLockoutFreeAttempts)
+}
+
+func (l *Lockout) maxFailures() int {
+	return orDefault(l.MaxFailures, DefaultLockoutMaxFailures)
+}
+
+func (l *Lockout) clientMaxFailures() int {
+	return orDefault(l.ClientMaxFailures, DefaultLockoutClientMaxFailures)
+}
+
+func (l *Lockout) lockDuration() time.Duration {
+	return orDefault(l.LockDuration, DefaultLockoutDuration)
+}
+
+func (l *Lockout) failureWindow() time.Duration {
+	return orDefault(l.FailureWindow, DefaultLockoutFailureWindow)
+}
+
+func (l *Lockout) log() *slog.Logger {
+	return log.OrDiscard(l.Log)
+}
+
+func identifierKey(identifier string) string {
+	return "id:" + strings.ToLower(identifier)
+}
+
+func clientKey(client string) string {
+	return "client:" + client
+}
+
+func orDefault[T int | time.Duration](v, def T) T {
+	if v <= 0 {
+		return def
+	}
+
+	return v
+}
+
+type MemoryLockoutStore struct {
+	mx        sync.Mutex
+	states    map[string]AttemptsState
+	lastPrune time.Time
+}
+
+func NewMemoryLockoutStore() *MemoryLockoutStore {
+	return &MemoryLockoutStore{
+		states: map[string]AttemptsState{},
+	}
+}
+
+func (s *MemoryLockoutStore) Update(
+	ctx context.Context,
+	key string,
+	fn func(*AttemptsState),
+) (AttemptsState, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.pruneStale(time.Now())
+
+	st := s.states[key]
+	fn(&st)
+
+	if st == (AttemptsState{}) {
+		delete(s.states, key)
+	} else {
+		s.states[key] = st
+	}
+
+	return st, nil
+}
+
+func (s *MemoryLockoutStore) Delete(ctx context.Context, key string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	delete(s.states, key)
+	return nil
+}
+
+// NOTE: States untouched for a day are dropped regardless of lockout
+// settings, which are not known to the store
+func (s *MemoryLockoutStore) pruneStale(now time.Time) {
+	if now.Sub(s.lastPrune) < memoryStorePruneInterval {
+		return
+	}
+
+	s.lastPrune = now
+
+	for key, st := range s.states {
+		if now.Sub(st.LastFailure) > 24*time.Hour && now.After(st.LockedUntil) {
+			delete(s.states, key)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package identity
+
+import (
+	"context"
+	"time"
+
+	"github.com/yandzee/go-svc/crypto"
+)
+
+const (
+	TokenUseMagicLink = "magic_link"
+
+	// NOTE: Claim holding hash of the nonce kept by the requesting device,
+	// so the link cannot be used from other devices
+	NonceClaim = "nonce"
+
+	DefaultMagicLinkDuration = 10 * time.Minute
+)
+
+type MagicLinkProvider[U User] interface {
+	RequestMagicLink(context.Context, MagicLinkRequest) error
+	SignInWithMagicLink(context.Context, MagicLinkSigninRequest) (*SigninResult[U], error)
+}
+
+type MagicLinkOptions struct {
+	Mailer   Mailer
+	Tokens   OneTimeTokenStore
+	Duration time.Duration
+
+	// NOTE: Builds link put into emails, usually pointing to frontend page
+	// submitting the token back, the token itself is sent when nil
+	Link func(token string) string
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email"`
+	Nonce string `json:"-"`
+}
+
+type MagicLinkSigninRequest struct {
+	Token *Token `json:"-"`
+	Nonce string `json:"-"`
+}
+
+func NewMagicLinkOptions(mailer Mailer) *MagicLinkOptions {
+	return &MagicLinkOptions{
+		Mailer:   mailer,
+		Tokens:   NewMemoryOneTimeTokenStore(),
+		Duration: DefaultMagicLinkDuration,
+	}
+}
+
+func hashNonce(nonce string) string {
+	return crypto.Sha256Hex(nonce)
+}
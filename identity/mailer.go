@@ -0,0 +1,89 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type MessageKind string
+
+const (
+	MessageEmailVerification MessageKind = "email_verification"
+	MessagePasswordReset     MessageKind = "password_reset"
+	MessageMagicLink         MessageKind = "magic_link"
+)
+
+// NOTE: Subject and Body are filled with plain defaults, mailers are free
+// to render their own templates using Kind, Link and Token
+type Message struct {
+	Kind    MessageKind
+	To      string
+	Subject string
+	Body    string
+	Link    string
+	Token   string
+}
+
+type Mailer interface {
+	Send(context.Context, *Message) error
+}
+
+// NOTE: Keeps sent messages in memory, intended for tests and development
+type MemoryMailer struct {
+	mx       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, msg *Message) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+func (m *MemoryMailer) Messages() []Message {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	return append([]Message{}, m.messages...)
+}
+
+// NOTE: Returns the last message sent to the address
+func (m *MemoryMailer) Last(to string) (Message, bool) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == to {
+			return m.messages[i], true
+		}
+	}
+
+	return Message{}, false
+}
+
+// NOTE: Writes each message into a separate file of Dir, intended for
+// development setups without mail delivery
+type FileMailer struct {
+	Dir string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	if err := os.MkdirAll(m.Dir, 0o700); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.txt", time.Now().UnixNano(), msg.Kind)
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Body)
+
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(content), 0o600)
+}
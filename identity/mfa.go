@@ -0,0 +1,137 @@
+package identity
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/yandzee/go-svc/crypto"
+	"github.com/yandzee/go-svc/identity/totp"
+)
+
+const (
+	// NOTE: Claim distinguishing special purpose tokens, tokens carrying it
+	// are never accepted as access or refresh ones
+	TokenUseClaim = "token_use"
+	TokenUseMFA   = "mfa"
+
+	DefaultMFAPendingDuration = 5 * time.Minute
+	DefaultMFAMaxAttempts     = 5
+	DefaultRecoveryCodesCount = 10
+)
+
+var (
+	ErrMFANotSupported = errors.New("users registry does not support MFA")
+	ErrMFANotEnrolled  = errors.New("MFA is not enrolled")
+	ErrMFAEnabled      = errors.New("MFA is already enabled")
+)
+
+// NOTE: Secret is stored as is, registries are free to encrypt it at rest
+type MFASettings struct {
+	TOTPSecret string `json:"totpSecret"`
+	IsEnabled  bool   `json:"isEnabled"`
+
+	// NOTE: Time step of the last accepted code, codes of the same or
+	// earlier steps are rejected to prevent replay
+	LastUsedStep       int64    `json:"lastUsedStep"`
+	RecoveryCodeHashes []string `json:"recoveryCodeHashes"`
+}
+
+// NOTE: Optional extension of UsersRegistry, nil settings mean MFA is not
+// enrolled for the user, saving nil settings removes them
+type MFARegistry[U User] interface {
+	GetMFA(context.Context, *U) (*MFASettings, error)
+	SaveMFA(context.Context, *U, *MFASettings) error
+}
+
+type MFAProvider[U User] interface {
+	VerifyMFA(context.Context, MFAVerifyRequest) (*SigninResult[U], error)
+	EnrollMFA(context.Context, *U) (*MFAEnrollment, error)
+	ConfirmMFA(context.Context, *U, string) (bool, error)
+	DisableMFA(context.Context, *U, string) (bool, error)
+}
+
+type MFAOptions struct {
+	Issuer          string
+	PendingDuration time.Duration
+	TOTP            totp.Options
+
+	// NOTE: Account label shown in authenticator apps, user id by default
+	AccountName func(User) string
+
+	RecoveryCodesCount int
+
+	// NOTE: Codes verified per pending token, which is not accepted after
+	// successful verification regardless of Denylist. Attempts are counted
+	// in memory of the provider unless Attempts store is set, e.g. to be
+	// shared by instances
+	MaxAttempts int
+	Attempts    LockoutStore
+}
+
+type MFAVerifyRequest struct {
+	Token *Token `json:"-"`
+	Code  string `json:"code"`
+}
+
+type MFAEnrollment struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"uri"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// NOTE: Accepts TOTP code or unused recovery code, settings are updated in
+// place and have to be saved on success
+func (s *MFASettings) Verify(code string, now time.Time, opts totp.Options) bool {
+	step, isOk := totp.Validate(s.TOTPSecret, code, now, opts)
+	if isOk && step > s.LastUsedStep {
+		s.LastUsedStep = step
+		return true
+	}
+
+	if isOk {
+		return false
+	}
+
+	return s.useRecoveryCode(code)
+}
+
+func (s *MFASettings) useRecoveryCode(code string) bool {
+	hashed := hashRecoveryCode(code)
+	found := -1
+
+	for idx, stored := range s.RecoveryCodeHashes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hashed)) == 1 {
+			found = idx
+		}
+	}
+
+	if found < 0 {
+		return false
+	}
+
+	s.RecoveryCodeHashes = append(s.RecoveryCodeHashes[:found], s.RecoveryCodeHashes[found+1:]...)
+	return true
+}
+
+// NOTE: Returns plain codes to be shown once and their hashes to be stored
+func GenerateRecoveryCodes(n int) ([]string, []string) {
+	codes := make([]string, 0, n)
+	hashes := make([]string, 0, n)
+
+	for range n {
+		raw := crypto.RandomHex(5)
+		code := raw[:5] + "-" + raw[5:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes
+}
+
+func hashRecoveryCode(code string) string {
+	return crypto.Sha256Hex(strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code)))
+}
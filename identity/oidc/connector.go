@@ -0,0 +1,371 @@
+// Package oidc implements signin with external OpenID Connect providers
+// using authorization code flow with PKCE
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yandzee/go-svc/identity"
+)
+
+const (
+	DiscoveryPath = "/.well-known/openid-configuration"
+
+	// NOTE: Unknown key ids trigger JWKS refetch at most once per interval
+	DefaultJWKSRefreshInterval = time.Minute
+
+	maxResponseSize = 1 << 20
+)
+
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// NOTE: Algorithms accepted for ID tokens, symmetric ones are never
+// accepted since JWKS keys are public
+var idTokenMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+type Config struct {
+	// NOTE: Name identifying the connector in callbacks and linked
+	// identities, e.g. "google"
+	Name         string
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectURL  string
+
+	// NOTE: DefaultScopes are used when empty
+	Scopes []string
+
+	HTTPClient          *http.Client
+	JWKSRefreshInterval time.Duration
+}
+
+type Discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint,omitempty"`
+	JWKSURI               string   `json:"jwks_uri"`
+	ScopesSupported       []string `json:"scopes_supported,omitempty"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported,omitempty"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	IdToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+}
+
+// NOTE: Error returned by the provider, either to the callback or by the
+// token endpoint
+type AuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+type IdTokenClaims struct {
+	jwt.RegisteredClaims
+
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+type Connector struct {
+	Config Config
+
+	mx            sync.Mutex
+	discovery     *Discovery
+	jwks          *identity.JWKSet
+	jwksFetchedAt time.Time
+}
+
+func NewConnector(cfg Config) *Connector {
+	return &Connector{
+		Config: cfg,
+	}
+}
+
+func (e *AuthError) Error() string {
+	if len(e.Description) == 0 {
+		return "oidc: " + e.Code
+	}
+
+	return fmt.Sprintf("oidc: %s: %s", e.Code, e.Description)
+}
+
+func (c *Connector) Name() string {
+	return c.Config.Name
+}
+
+// NOTE: Discovery document is fetched once and cached, its issuer must
+// match the configured one exactly
+func (c *Connector) Discover(ctx context.Context) (*Discovery, error) {
+	c.mx.Lock()
+	cached := c.discovery
+	c.mx.Unlock()
+
+	if cached != nil {
+		return cached, nil
+	}
+
+	issuer := strings.TrimSuffix(c.Config.Issuer, "/")
+	d := &Discovery{}
+
+	if err := c.getJSON(ctx, issuer+DiscoveryPath, d); err != nil {
+		return nil, errors.Join(fmt.Errorf("oidc: discovery of %s failed", issuer), err)
+	}
+
+	switch {
+	case strings.TrimSuffix(d.Issuer, "/") != issuer:
+		return nil, fmt.Errorf("oidc: discovery issuer %q does not match %q", d.Issuer, issuer)
+	case len(d.AuthorizationEndpoint) == 0, len(d.TokenEndpoint) == 0, len(d.JWKSURI) == 0:
+		return nil, errors.New("oidc: discovery document misses required endpoints")
+	}
+
+	c.mx.Lock()
+	c.discovery = d
+	c.mx.Unlock()
+
+	return d, nil
+}
+
+func (c *Connector) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := c.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	scopes := c.Config.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", c.Config.ClientId)
+	q.Set("redirect_uri", c.Config.RedirectURL)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", CodeChallenge(verifier))
+	q.Set("code_challenge_method", CodeChallengeMethodS256)
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+func (c *Connector) Exchange(ctx context.Context, code, verifier string) (*TokenResponse, error) {
+	d, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.Config.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", c.Config.ClientId)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if len(c.Config.ClientSecret) > 0 {
+		req.SetBasicAuth(url.QueryEscape(c.Config.ClientId), url.QueryEscape(c.Config.ClientSecret))
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("oidc: token request failed"), err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		authErr := &AuthError{}
+		if json.Unmarshal(body, authErr) == nil && len(authErr.Code) > 0 {
+			return nil, authErr
+		}
+
+		return nil, fmt.Errorf("oidc: token endpoint responded with %d", resp.StatusCode)
+	}
+
+	tokens := &TokenResponse{}
+	if err := json.Unmarshal(body, tokens); err != nil {
+		return nil, errors.Join(fmt.Errorf("oidc: malformed token response"), err)
+	}
+
+	if len(tokens.IdToken) == 0 {
+		return nil, errors.New("oidc: token response has no id_token")
+	}
+
+	return tokens, nil
+}
+
+// NOTE: Checks signature by provider JWKS, issuer, audience, expiration and
+// nonce of the ID token
+func (c *Connector) VerifyIdToken(ctx context.Context, raw, nonce string) (*IdTokenClaims, error) {
+	d, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &IdTokenClaims{}
+
+	_, err = jwt.ParseWithClaims(
+		raw,
+		claims,
+		func(token *jwt.Token) (any, error) {
+			return c.verificationKey(ctx, token)
+		},
+		jwt.WithValidMethods(idTokenMethods),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(c.Config.ClientId),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("oidc: invalid id token"), err)
+	}
+
+	if len(claims.Subject) == 0 {
+		return nil, errors.New("oidc: id token has no subject")
+	}
+
+	if len(nonce) == 0 || claims.Nonce != nonce {
+		return nil, errors.New("oidc: id token nonce mismatch")
+	}
+
+	return claims, nil
+}
+
+func (c *Connector) verificationKey(ctx context.Context, token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	jwk, err := c.lookupKey(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(jwk.Algorithm) > 0 && jwk.Algorithm != token.Method.Alg() {
+		return nil, fmt.Errorf("oidc: key %q does not allow %s", kid, token.Method.Alg())
+	}
+
+	return jwk.PublicKey()
+}
+
+// NOTE: Keys are refetched if the id is unknown, so provider key rotation
+// is picked up, tokens without kid are accepted only for single key sets
+func (c *Connector) lookupKey(ctx context.Context, kid string) (*identity.JWK, error) {
+	for attempt := range 2 {
+		jwks, err := c.keySet(ctx, attempt > 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(kid) == 0 && len(jwks.Keys) == 1 {
+			return &jwks.Keys[0], nil
+		}
+
+		if key, found := jwks.Lookup(kid); found && len(kid) > 0 {
+			return &key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("oidc: unknown signing key %q", kid)
+}
+
+func (c *Connector) keySet(ctx context.Context, isRefresh bool) (*identity.JWKSet, error) {
+	interval := c.Config.JWKSRefreshInterval
+	if interval <= 0 {
+		interval = DefaultJWKSRefreshInterval
+	}
+
+	c.mx.Lock()
+	cached, fetchedAt := c.jwks, c.jwksFetchedAt
+	c.mx.Unlock()
+
+	if cached != nil && (!isRefresh || time.Since(fetchedAt) < interval) {
+		return cached, nil
+	}
+
+	d, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	jwks := &identity.JWKSet{}
+	if err := c.getJSON(ctx, d.JWKSURI, jwks); err != nil {
+		return nil, errors.Join(fmt.Errorf("oidc: jwks fetch failed"), err)
+	}
+
+	c.mx.Lock()
+	c.jwks, c.jwksFetchedAt = jwks, time.Now()
+	c.mx.Unlock()
+
+	return jwks, nil
+}
+
+func (c *Connector) getJSON(ctx context.Context, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(dst)
+}
+
+func (c *Connector) httpClient() *http.Client {
+	if c.Config.HTTPClient != nil {
+		return c.Config.HTTPClient
+	}
+
+	return http.DefaultClient
+}
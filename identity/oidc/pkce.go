@@ -0,0 +1,20 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/yandzee/go-svc/crypto"
+)
+
+const CodeChallengeMethodS256 = "S256"
+
+// NOTE: 32 random bytes give 43 characters, the minimum allowed by RFC 7636
+func NewCodeVerifier() string {
+	return base64.RawURLEncoding.EncodeToString(crypto.RandomBytes(32))
+}
+
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,281 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yandzee/go-svc/crypto"
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/log"
+)
+
+const DefaultStateDuration = 10 * time.Minute
+
+var (
+	ErrUnknownConnector = errors.New("oidc: unknown connector")
+	ErrInvalidState     = errors.New("oidc: state is invalid, expired or already used")
+	ErrLinkNotSupported = errors.New("oidc: users registry does not support external identities")
+)
+
+// NOTE: Identity of the user at external provider, Provider is the name of
+// the connector and Subject is stable user id there
+type ExternalIdentity struct {
+	Provider      string         `json:"provider"`
+	Subject       string         `json:"subject"`
+	Email         string         `json:"email"`
+	EmailVerified bool           `json:"emailVerified"`
+	Name          string         `json:"name"`
+	Claims        *IdTokenClaims `json:"-"`
+}
+
+// NOTE: Extension of UsersRegistry required for OIDC signin, nil user is
+// returned if the identity is not linked
+type LinkRegistry[U identity.User] interface {
+	GetUserByExternalIdentity(context.Context, string, string) (*U, error)
+	LinkExternalIdentity(context.Context, *U, ExternalIdentity) error
+}
+
+// NOTE: Implemented by Provider, used by HTTP endpoints
+type Flow[U identity.User] interface {
+	Begin(context.Context, string) (*Authorization, error)
+	Complete(context.Context, Callback) (*identity.SigninResult[U], error)
+}
+
+type Authorization struct {
+	URL   string
+	State string
+}
+
+type Callback struct {
+	Connector        string
+	State            string
+	Code             string
+	Error            string
+	ErrorDescription string
+}
+
+// NOTE: Adapter around RegistryProvider, all its methods are available and
+// users signed in by OIDC get the same TokenPair as with credentials
+type Provider[U identity.User] struct {
+	*identity.RegistryProvider[U]
+
+	Connectors    []*Connector
+	States        StateStore
+	StateDuration time.Duration
+
+	// NOTE: Users not linked yet are looked up by verified email if
+	// Registry implements AccountRegistry
+	EmailLinkingDisabled bool
+
+	// NOTE: Users are created on the first signin unless disabled
+	SignupDisabled bool
+
+	// NOTE: Credentials of created users, email is used as username when
+	// nil. There is no password, so registries must not let such users
+	// signin with an empty one
+	CredentialsFor func(ExternalIdentity) identity.Credentials
+}
+
+func New[U identity.User](
+	base *identity.RegistryProvider[U],
+	connectors ...*Connector,
+) *Provider[U] {
+	return &Provider[U]{
+		RegistryProvider: base,
+		Connectors:       connectors,
+		States:           NewMemoryStateStore(),
+		StateDuration:    DefaultStateDuration,
+	}
+}
+
+// NOTE: Returns URL the user is redirected to, state has to be bound to
+// the user agent (e.g. by cookie) and checked at callback
+func (p *Provider[U]) Begin(ctx context.Context, connectorName string) (*Authorization, error) {
+	conn, err := p.connector(connectorName)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.States == nil {
+		return nil, errors.New("oidc: state store is not set")
+	}
+
+	dur := p.StateDuration
+	if dur <= 0 {
+		dur = DefaultStateDuration
+	}
+
+	state := crypto.RandomHex(32)
+	as := &AuthState{
+		Connector:    conn.Name(),
+		Nonce:        crypto.RandomHex(16),
+		CodeVerifier: NewCodeVerifier(),
+		ExpiresAt:    time.Now().Add(dur),
+	}
+
+	authURL, err := conn.AuthCodeURL(ctx, state, as.Nonce, as.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.States.Save(ctx, state, as); err != nil {
+		return nil, err
+	}
+
+	return &Authorization{
+		URL:   authURL,
+		State: state,
+	}, nil
+}
+
+// NOTE: Result is not authorized if the user cannot be linked or created,
+// provider errors are returned as *AuthError
+func (p *Provider[U]) Complete(ctx context.Context, cb Callback) (*identity.SigninResult[U], error) {
+	if len(cb.State) == 0 || p.States == nil {
+		return nil, ErrInvalidState
+	}
+
+	as, err := p.States.Take(ctx, cb.State)
+	if err != nil {
+		return nil, err
+	}
+
+	if as == nil || (len(cb.Connector) > 0 && cb.Connector != as.Connector) {
+		return nil, ErrInvalidState
+	}
+
+	if len(cb.Error) > 0 {
+		return nil, &AuthError{
+			Code:        cb.Error,
+			Description: cb.ErrorDescription,
+		}
+	}
+
+	conn, err := p.connector(as.Connector)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := conn.Exchange(ctx, cb.Code, as.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := conn.VerifyIdToken(ctx, tokens.IdToken, as.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	usr, err := p.link(ctx, ExternalIdentity{
+		Provider:      conn.Name(),
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+		Claims:        claims,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if usr == nil {
+		return &identity.SigninResult[U]{
+			NotAuthorized: true,
+			UserNotFound:  true,
+		}, nil
+	}
+
+	return p.SignInExternal(ctx, usr)
+}
+
+func (p *Provider[U]) link(ctx context.Context, ext ExternalIdentity) (*U, error) {
+	links, isOk := p.Registry.(LinkRegistry[U])
+	if !isOk {
+		return nil, ErrLinkNotSupported
+	}
+
+	usr, err := links.GetUserByExternalIdentity(ctx, ext.Provider, ext.Subject)
+	if err != nil || usr != nil {
+		return usr, err
+	}
+
+	log := p.log()
+
+	// NOTE: Only verified emails are trusted, otherwise anyone could take
+	// over a local account by registering its email at the provider
+	accounts, isAccounts := p.Registry.(identity.AccountRegistry[U])
+	if !p.EmailLinkingDisabled && isAccounts && ext.EmailVerified && len(ext.Email) > 0 {
+		usr, err := accounts.GetUserByEmail(ctx, ext.Email)
+		if err != nil {
+			return nil, err
+		}
+
+		if usr != nil {
+			log.Info("linking external identity by email", "provider", ext.Provider, "subject", ext.Subject)
+			return usr, links.LinkExternalIdentity(ctx, usr, ext)
+		}
+	}
+
+	if p.SignupDisabled {
+		return nil, nil
+	}
+
+	userId, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := p.Registry.CreateUser(ctx, &identity.UserStub{
+		Id:          userId,
+		Credentials: p.credentials(ext),
+	})
+
+	switch {
+	case err != nil:
+		return nil, err
+	case created.AlreadyExists:
+		log.Warn("cannot create user for external identity, user already exists", "provider", ext.Provider)
+		return nil, nil
+	}
+
+	if err := links.LinkExternalIdentity(ctx, created.User, ext); err != nil {
+		return nil, errors.Join(fmt.Errorf("oidc: failed to link created user"), err)
+	}
+
+	return created.User, nil
+}
+
+func (p *Provider[U]) credentials(ext ExternalIdentity) identity.Credentials {
+	if p.CredentialsFor != nil {
+		return p.CredentialsFor(ext)
+	}
+
+	username := ext.Email
+	if len(username) == 0 {
+		username = ext.Provider + ":" + ext.Subject
+	}
+
+	return identity.Credentials{
+		"username": username,
+		"email":    ext.Email,
+	}
+}
+
+func (p *Provider[U]) connector(name string) (*Connector, error) {
+	for _, conn := range p.Connectors {
+		if conn.Name() == name {
+			return conn, nil
+		}
+	}
+
+	return nil, ErrUnknownConnector
+}
+
+func (p *Provider[U]) log() *slog.Logger {
+	return log.OrDiscard(p.Log)
+}
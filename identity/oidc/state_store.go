@@ -0,0 +1,78 @@
+package oidc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const memoryStorePruneInterval = time.Minute
+
+// NOTE: Data of the pending authorization kept until the callback
+type AuthState struct {
+	Connector    string    `json:"connector"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"codeVerifier"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// NOTE: Take must atomically remove the state, so each state is used once,
+// nil is returned for unknown or expired states
+type StateStore interface {
+	Save(context.Context, string, *AuthState) error
+	Take(context.Context, string) (*AuthState, error)
+}
+
+type MemoryStateStore struct {
+	mx        sync.Mutex
+	states    map[string]AuthState
+	lastPrune time.Time
+}
+
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{
+		states: map[string]AuthState{},
+	}
+}
+
+func (s *MemoryStateStore) Save(ctx context.Context, state string, as *AuthState) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.pruneExpired(time.Now())
+	s.states[state] = *as
+
+	return nil
+}
+
+func (s *MemoryStateStore) Take(ctx context.Context, state string) (*AuthState, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	as, exists := s.states[state]
+	if !exists {
+		return nil, nil
+	}
+
+	delete(s.states, state)
+
+	if time.Now().After(as.ExpiresAt) {
+		return nil, nil
+	}
+
+	return &as, nil
+}
+
+func (s *MemoryStateStore) pruneExpired(now time.Time) {
+	if now.Sub(s.lastPrune) < memoryStorePruneInterval {
+		return
+	}
+
+	s.lastPrune = now
+
+	for state, as := range s.states {
+		if now.After(as.ExpiresAt) {
+			delete(s.states, state)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package identity
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// NOTE: Keyed by JWT id (jti), Consume reports whether the token is used
+// for the first time, entries are only needed until the token expires
+type OneTimeTokenStore interface {
+	Consume(context.Context, string, time.Time) (bool, error)
+}
+
+type MemoryOneTimeTokenStore struct {
+	mx        sync.Mutex
+	used      map[string]time.Time
+	lastPrune time.Time
+}
+
+func NewMemoryOneTimeTokenStore() *MemoryOneTimeTokenStore {
+	return &MemoryOneTimeTokenStore{
+		used: map[string]time.Time{},
+	}
+}
+
+func (s *MemoryOneTimeTokenStore) Consume(
+	ctx context.Context,
+	id string,
+	until time.Time,
+) (bool, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := time.Now()
+	s.pruneExpired(now)
+
+	if usedUntil, exists := s.used[id]; exists && now.Before(usedUntil) {
+		return false, nil
+	}
+
+	s.used[id] = until
+	return true, nil
+}
+
+func (s *MemoryOneTimeTokenStore) pruneExpired(now time.Time) {
+	if now.Sub(s.lastPrune) < memoryStorePruneInterval {
+		return
+	}
+
+	s.lastPrune = now
+
+	for id, until := range s.used {
+		if now.After(until) {
+			delete(s.used, id)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Package password implements password hashing for users registries.
+// New hashes are argon2id in PHC string format, bcrypt and scrypt hashes
+// are only verified, so they can be upgraded on next successful signin
+package password
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yandzee/go-svc/crypto"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown password hash format")
+	ErrMalformedHash = errors.New("malformed password hash")
+)
+
+// NOTE: PHC strings use standard base64 alphabet without padding
+var b64 = base64.RawStdEncoding
+
+type Argon2idParams struct {
+	// NOTE: In KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// NOTE: One of the configurations recommended by RFC 9106
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+type Verification struct {
+	IsMatch bool
+
+	// NOTE: Set when hash is produced by legacy algorithm or with parameters
+	// different from the current ones
+	NeedsRehash bool
+}
+
+type Hasher struct {
+	Params Argon2idParams
+}
+
+func NewHasher(params ...Argon2idParams) *Hasher {
+	h := &Hasher{
+		Params: DefaultArgon2idParams,
+	}
+
+	if len(params) > 0 {
+		h.Params = params[0]
+	}
+
+	return h
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	p := h.Params
+	if p.Iterations == 0 || p.Memory == 0 || p.Parallelism == 0 {
+		return "", errors.New("argon2id iterations, memory and parallelism must be positive")
+	}
+
+	if p.SaltLength < 8 || p.KeyLength < 16 {
+		return "", errors.New("argon2id salt must be at least 8 and key 16 bytes long")
+	}
+
+	salt := crypto.RandomBytes(p.SaltLength)
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		p.Memory, p.Iterations, p.Parallelism,
+		b64.EncodeToString(salt),
+		b64.EncodeToString(key),
+	), nil
+}
+
+func (h *Hasher) Verify(password, encoded string) (Verification, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return h.verifyArgon2id(password, encoded)
+	case strings.HasPrefix(encoded, "$2a$"),
+		strings.HasPrefix(encoded, "$2b$"),
+		strings.HasPrefix(encoded, "$2y$"):
+		return verifyBcrypt(password, encoded)
+	case strings.HasPrefix(encoded, "$scrypt$"):
+		return verifyScrypt(password, encoded)
+	}
+
+	return Verification{}, ErrUnknownFormat
+}
+
+// NOTE: Rehashes password on match if needed and passes new hash to
+// onRehash, which is expected to persist it
+func (h *Hasher) Check(
+	password, encoded string,
+	onRehash func(string) error,
+) (bool, error) {
+	v, err := h.Verify(password, encoded)
+	if err != nil || !v.IsMatch {
+		return false, err
+	}
+
+	if !v.NeedsRehash || onRehash == nil {
+		return true, nil
+	}
+
+	rehashed, err := h.Hash(password)
+	if err != nil {
+		return true, errors.Join(fmt.Errorf("password rehash failure"), err)
+	}
+
+	if err := onRehash(rehashed); err != nil {
+		return true, errors.Join(fmt.Errorf("rehashed password update failure"), err)
+	}
+
+	return true, nil
+}
+
+func (h *Hasher) verifyArgon2id(password, encoded string) (Verification, error) {
+	// NOTE: "", "argon2id", "v=19", "m=..,t=..,p=..", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return Verification{}, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Verification{}, ErrMalformedHash
+	}
+
+	if version != argon2.Version {
+		return Verification{}, fmt.Errorf("unsupported argon2 version: %d", version)
+	}
+
+	p := Argon2idParams{}
+
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism)
+	if err != nil || p.Memory == 0 || p.Iterations == 0 || p.Parallelism == 0 {
+		return Verification{}, ErrMalformedHash
+	}
+
+	salt, saltErr := b64.DecodeString(parts[4])
+	key, keyErr := b64.DecodeString(parts[5])
+
+	if saltErr != nil || keyErr != nil || len(salt) == 0 || len(key) == 0 {
+		return Verification{}, ErrMalformedHash
+	}
+
+	p.SaltLength, p.KeyLength = uint32(len(salt)), uint32(len(key))
+
+	computed := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return Verification{
+		IsMatch:     subtle.ConstantTimeCompare(computed, key) == 1,
+		NeedsRehash: p != h.Params,
+	}, nil
+}
+
+func verifyBcrypt(password, encoded string) (Verification, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+
+	switch {
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return Verification{}, nil
+	case err != nil:
+		return Verification{}, errors.Join(ErrMalformedHash, err)
+	}
+
+	return Verification{
+		IsMatch:     true,
+		NeedsRehash: true,
+	}, nil
+}
+
+// NOTE: Format is `$scrypt$ln=<log2 N>,r=<r>,p=<p>$<salt>$<hash>`
+func verifyScrypt(password, encoded string) (Verification, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 {
+		return Verification{}, ErrMalformedHash
+	}
+
+	var logN, r, p int
+
+	_, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &logN, &r, &p)
+	if err != nil || logN <= 0 || logN >= 32 || r <= 0 || p <= 0 {
+		return Verification{}, ErrMalformedHash
+	}
+
+	salt, saltErr := b64.DecodeString(parts[3])
+	key, keyErr := b64.DecodeString(parts[4])
+
+	if saltErr != nil || keyErr != nil || len(key) == 0 {
+		return Verification{}, ErrMalformedHash
+	}
+
+	computed, err := scrypt.Key([]byte(password), salt, 1<<logN, r, p, len(key))
+	if err != nil {
+		return Verification{}, errors.Join(ErrMalformedHash, err)
+	}
+
+	return Verification{
+		IsMatch:     subtle.ConstantTimeCompare(computed, key) == 1,
+		NeedsRehash: true,
+	}, nil
+}
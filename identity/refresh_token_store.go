@@ -0,0 +1,221 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRefreshTokenReused  = errors.New("refresh token is reused")
+	ErrRefreshTokenRevoked = errors.New("refresh token is revoked or unknown")
+
+	// NOTE: Signout of all sessions cannot be done without the store, as
+	// issued refresh tokens are not tracked otherwise
+	ErrRefreshTokensNotEnabled = errors.New("refresh token store is not enabled")
+)
+
+// NOTE: Every refresh token belongs to a family started at signin / signup,
+// each refresh produces next token of the same family
+type RefreshTokenRecord struct {
+	Id        string    `json:"id"`
+	FamilyId  string    `json:"familyId"`
+	UserId    uuid.UUID `json:"userId"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	UsedAt    time.Time `json:"usedAt"`
+
+	// NOTE: Device the family is used from, client info is updated on each
+	// refresh while StartedAt is kept since signin
+	Client    ClientInfo `json:"client"`
+	StartedAt time.Time  `json:"startedAt"`
+}
+
+type RefreshTokenUse struct {
+	// NOTE: Nil if token is unknown, expired or its family is revoked
+	Record   *RefreshTokenRecord
+	IsReused bool
+}
+
+type RefreshTokenStore interface {
+	Save(context.Context, *RefreshTokenRecord) error
+
+	// NOTE: Must atomically mark the token as used, so only the first
+	// consumption of the token is not reported as reuse
+	Consume(context.Context, string) (RefreshTokenUse, error)
+	RevokeFamily(context.Context, string) error
+	RevokeUser(context.Context, uuid.UUID) error
+}
+
+// NOTE: Optional extension of RefreshTokenStore listing signed in devices,
+// returns the latest record of each active token family of the user
+type RefreshTokenFamilyLister interface {
+	ListFamilies(context.Context, uuid.UUID) ([]*RefreshTokenRecord, error)
+}
+
+const memoryStorePruneInterval = time.Minute
+
+type MemoryRefreshTokenStore struct {
+	mx        sync.Mutex
+	records   map[string]*RefreshTokenRecord
+	families  map[string]map[string]struct{}
+	lastPrune time.Time
+}
+
+func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{
+		records:  map[string]*RefreshTokenRecord{},
+		families: map[string]map[string]struct{}{},
+	}
+}
+
+func (s *MemoryRefreshTokenStore) Save(ctx context.Context, rec *RefreshTokenRecord) error {
+	if rec == nil || len(rec.Id) == 0 || len(rec.FamilyId) == 0 {
+		return errors.New("refresh token record must have id and family id")
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.pruneExpired(time.Now())
+
+	stored := *rec
+	s.records[rec.Id] = &stored
+
+	family, exists := s.families[rec.FamilyId]
+	if !exists {
+		family = map[string]struct{}{}
+		s.families[rec.FamilyId] = family
+	}
+
+	family[rec.Id] = struct{}{}
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) Consume(ctx context.Context, id string) (RefreshTokenUse, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := time.Now()
+
+	rec, exists := s.records[id]
+	if !exists || now.After(rec.ExpiresAt) {
+		return RefreshTokenUse{}, nil
+	}
+
+	use := RefreshTokenUse{
+		IsReused: !rec.UsedAt.IsZero(),
+	}
+
+	if !use.IsReused {
+		rec.UsedAt = now
+	}
+
+	copied := *rec
+	use.Record = &copied
+
+	return use, nil
+}
+
+func (s *MemoryRefreshTokenStore) RevokeFamily(ctx context.Context, familyId string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for id := range s.families[familyId] {
+		delete(s.records, id)
+	}
+
+	delete(s.families, familyId)
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) RevokeUser(ctx context.Context, userId uuid.UUID) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for id, rec := range s.records {
+		if rec.UserId != userId {
+			continue
+		}
+
+		delete(s.records, id)
+		delete(s.families, rec.FamilyId)
+	}
+
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) ListFamilies(
+	ctx context.Context,
+	userId uuid.UUID,
+) ([]*RefreshTokenRecord, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := time.Now()
+	latest := map[string]*RefreshTokenRecord{}
+
+	for _, rec := range s.records {
+		if rec.UserId != userId || now.After(rec.ExpiresAt) {
+			continue
+		}
+
+		if known, exists := latest[rec.FamilyId]; !exists || rec.isNewerThan(known) {
+			latest[rec.FamilyId] = rec
+		}
+	}
+
+	families := make([]*RefreshTokenRecord, 0, len(latest))
+
+	for _, rec := range latest {
+		copied := *rec
+		families = append(families, &copied)
+	}
+
+	return families, nil
+}
+
+// NOTE: Issue times are truncated to seconds in JWTs, so the unused record
+// is considered the latest one regardless of them
+func (r *RefreshTokenRecord) isNewerThan(other *RefreshTokenRecord) bool {
+	if r.UsedAt.IsZero() != other.UsedAt.IsZero() {
+		return r.UsedAt.IsZero()
+	}
+
+	return r.IssuedAt.After(other.IssuedAt)
+}
+
+// NOTE: Family start for records saved without it is their issue time
+func (r *RefreshTokenRecord) FamilyStartedAt() time.Time {
+	if r.StartedAt.IsZero() {
+		return r.IssuedAt
+	}
+
+	return r.StartedAt
+}
+
+func (s *MemoryRefreshTokenStore) pruneExpired(now time.Time) {
+	if now.Sub(s.lastPrune) < memoryStorePruneInterval {
+		return
+	}
+
+	s.lastPrune = now
+
+	for id, rec := range s.records {
+		if !now.After(rec.ExpiresAt) {
+			continue
+		}
+
+		delete(s.records, id)
+
+		family := s.families[rec.FamilyId]
+		delete(family, id)
+
+		if len(family) == 0 {
+			delete(s.families, rec.FamilyId)
+		}
+	}
+}
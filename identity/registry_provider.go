@@ -2,10 +2,12 @@ package identity
 
 import (
 	"context"
-	"crypto/ecdsa"
+	"crypto"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"sync"
 	"time"
 
 	jwt "github.com/golang-jwt/jwt/v5"
@@ -18,9 +20,57 @@ type RegistryProvider[U User] struct {
 	Registry UsersRegistry[U]
 
 	BaseClaims           jwt.RegisteredClaims
-	TokenPrivateKey      *ecdsa.PrivateKey
+	TokenPrivateKey      crypto.PrivateKey
+	TokenSigningMethod   jwt.SigningMethod
 	AccessTokenDuration  time.Duration
 	RefreshTokenDuration time.Duration
+
+	// NOTE: Failed signins are tracked per value of LockoutIdentifierField
+	// ("username" by default) and per client address from ClientInfo
+	Lockout                *Lockout
+	LockoutIdentifierField string
+
+	// NOTE: Checked at signup in addition to UsersRegistry field checks
+	CredentialsPolicy *CredentialsPolicy
+
+	// NOTE: Second factor is required at signin for users having MFA
+	// enabled, if Registry implements MFARegistry
+	MFA *MFAOptions
+
+	// NOTE: Enables email verification and password reset flows, if
+	// Registry implements AccountRegistry
+	Accounts *AccountOptions
+
+	// NOTE: Enables passwordless signin by links sent to user email, if
+	// Registry implements AccountRegistry
+	MagicLinks *MagicLinkOptions
+
+	// NOTE: Opaque server-side sessions are issued instead of JWT pairs
+	// when set, session tokens are validated by the store on each request
+	Sessions *SessionOptions
+
+	// NOTE: Enables API keys as alternative credential of machine clients
+	ApiKeys *ApiKeyOptions
+
+	// NOTE: Custom claims embedded into access tokens, called at signin,
+	// signup and refresh, so changes are picked up on the next refresh
+	ClaimsFor func(context.Context, *U) (map[string]any, error)
+
+	// NOTE: Tokens are signed by the active key of the keyring and carry
+	// its id in `kid` header, TokenPrivateKey is used when not set
+	Keys *Keyring
+
+	// NOTE: Enables refresh token rotation when set, each refresh token can
+	// be used once and reuse of it revokes the whole token family
+	RefreshTokens       RefreshTokenStore
+	OnRefreshTokenReuse func(context.Context, *RefreshTokenRecord)
+
+	// NOTE: Tokens presented at signout are denied until they expire, the
+	// same denylist should be set on the endpoint consulting it
+	Denylist TokenDenylist
+
+	mfaAttemptsOnce sync.Once
+	mfaAttempts     LockoutStore
 }
 
 type CreateUserResult[U User] struct {
@@ -36,16 +86,39 @@ func (p *RegistryProvider[U]) SignIn(
 		return nil, ErrNoCredentials
 	}
 
+	identifier, client := p.lockoutSubjects(ctx, req.Credentials)
+	isSettled := false
+
+	if p.Lockout != nil {
+		status, err := p.Lockout.Check(ctx, identifier, client)
+		if err != nil {
+			return nil, err
+		}
+
+		if status.IsBlocked() {
+			return &SigninResult[U]{
+				NotAuthorized: true,
+				Locked:        status.Locked,
+				Throttled:     status.Throttled,
+				RetryAfter:    status.RetryAfter,
+			}, nil
+		}
+
+		defer p.releaseLockout(ctx, identifier, &isSettled)
+	}
+
 	usr, err := p.Registry.GetUserByCredentials(ctx, req.Credentials)
 	if err != nil {
 		return nil, err
 	}
 
 	if usr == nil {
-		return &SigninResult[U]{
+		isSettled = true
+
+		return p.signinFailure(ctx, identifier, client, &SigninResult[U]{
 			NotAuthorized: true,
 			UserNotFound:  true,
-		}, nil
+		})
 	}
 
 	has, err := p.Registry.UserHasCredentials(ctx, usr, req.Credentials)
@@ -53,18 +126,52 @@ func (p *RegistryProvider[U]) SignIn(
 		return nil, err
 	}
 
+	isSettled = true
+
 	if !has {
-		return &SigninResult[U]{
+		return p.signinFailure(ctx, identifier, client, &SigninResult[U]{
 			NotAuthorized:       true,
 			CredentialsMismatch: true,
-		}, nil
+		})
 	}
 
-	uid := (*usr).GetId()
+	if p.Lockout != nil {
+		if err := p.Lockout.RecordSuccess(ctx, identifier); err != nil {
+			return nil, err
+		}
+	}
+
+	if emailResult, err := p.requireVerifiedEmail(ctx, usr); err != nil || emailResult != nil {
+		return emailResult, err
+	}
+
+	return p.completeSignin(ctx, usr)
+}
+
+// NOTE: Signs in the user authenticated by external means (e.g. OIDC),
+// issuing the same tokens as SignIn, second factor is still required
+func (p *RegistryProvider[U]) SignInExternal(ctx context.Context, usr *U) (*SigninResult[U], error) {
+	if usr == nil {
+		return nil, errors.New("cannot signin nil user")
+	}
 
-	tokenPair, err := p.createSignedTokenPair(&uid)
+	return p.completeSignin(ctx, usr)
+}
+
+// NOTE: Final step of signin methods once the user is identified, second
+// factor is required here if enabled for the user
+func (p *RegistryProvider[U]) completeSignin(ctx context.Context, usr *U) (*SigninResult[U], error) {
+	if mfaResult, err := p.requireMFA(ctx, usr); err != nil || mfaResult != nil {
+		return mfaResult, err
+	}
+
+	return p.issueSigninTokens(ctx, usr)
+}
+
+func (p *RegistryProvider[U]) issueSigninTokens(ctx context.Context, usr *U) (*SigninResult[U], error) {
+	tokenPair, err := p.createTokenPair(ctx, usr)
 	if err != nil {
-		p.log().Error("createSignedTokenPair failure", "err", err.Error())
+		p.log().Error("createTokenPair failure", "err", err.Error())
 		return nil, err
 	}
 
@@ -74,6 +181,47 @@ func (p *RegistryProvider[U]) SignIn(
 	}, nil
 }
 
+func (p *RegistryProvider[U]) signinFailure(
+	ctx context.Context,
+	identifier, client string,
+	result *SigninResult[U],
+) (*SigninResult[U], error) {
+	if p.Lockout == nil {
+		return result, nil
+	}
+
+	if err := p.Lockout.RecordFailure(ctx, identifier, client); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// NOTE: Deferred after Lockout.Check, releases the reserved attempt unless
+// its outcome is recorded
+func (p *RegistryProvider[U]) releaseLockout(ctx context.Context, identifier string, isSettled *bool) {
+	if *isSettled {
+		return
+	}
+
+	if err := p.Lockout.Release(ctx, identifier); err != nil {
+		p.log().Warn("failed to release lockout attempt", "err", err.Error())
+	}
+}
+
+func (p *RegistryProvider[U]) lockoutSubjects(
+	ctx context.Context,
+	creds Credentials,
+) (string, string) {
+	field := p.LockoutIdentifierField
+	if len(field) == 0 {
+		field = "username"
+	}
+
+	ci, _ := ClientInfoFrom(ctx)
+	return creds.Get(field), ci.Address
+}
+
 func (p *RegistryProvider[U]) SignUp(
 	ctx context.Context,
 	req SignupRequest,
@@ -86,9 +234,16 @@ func (p *RegistryProvider[U]) SignUp(
 		return nil, errors.New("cannot signup using nil UsersRegistry")
 	}
 
-	if ch, err := p.Registry.CheckFieldsCorrectness(ctx, req.Credentials); err != nil {
+	ch, err := p.Registry.CheckFieldsCorrectness(ctx, req.Credentials)
+	if err != nil {
 		return nil, err
-	} else if _, has := ch.HasIncorrect(); has {
+	}
+
+	if p.CredentialsPolicy != nil {
+		ch = ch.Merge(p.CredentialsPolicy.Check(req.Credentials))
+	}
+
+	if _, has := ch.HasIncorrect(); has {
 		return &SignupResult[U]{
 			InvalidCredentials: true,
 			CredentialsCheck:   ch,
@@ -116,9 +271,18 @@ func (p *RegistryProvider[U]) SignUp(
 		}, nil
 	}
 
-	tokenPair, err := p.createSignedTokenPair(&userId)
+	// NOTE: User is created already, so failing to send verification is
+	// not fatal and it can be requested again
+	if p.Accounts != nil && !p.Accounts.SignupVerificationDisabled {
+		err := p.RequestEmailVerification(ctx, createResult.User)
+		if err != nil && !errors.Is(err, ErrNoEmail) && !errors.Is(err, ErrEmailVerified) {
+			p.log().Warn("failed to send verification email", "err", err.Error())
+		}
+	}
+
+	tokenPair, err := p.createTokenPair(ctx, createResult.User)
 	if err != nil {
-		p.log().Error("issueJWTString failure", "err", err.Error())
+		p.log().Error("createTokenPair failure", "err", err.Error())
 		return nil, err
 	}
 
@@ -142,7 +306,100 @@ func (p *RegistryProvider[U]) Refresh(
 		return TokenPair{}, errors.New("refresh token contains invalid user id")
 	}
 
-	return p.createSignedTokenPair(&userId)
+	// NOTE: Sessions are extended on use and have no refresh tokens, so
+	// ones issued before switching to sessions are rejected
+	if use, _ := refreshToken.Claims().String(TokenUseClaim); len(use) > 0 || p.Sessions != nil {
+		return TokenPair{}, ErrRefreshTokenRevoked
+	}
+
+	// NOTE: Refresh token is denied on signout, which is the only way to
+	// revoke it when RefreshTokens store is not set
+	isDenied, err := p.isTokenDenied(ctx, refreshToken)
+	switch {
+	case err != nil:
+		return TokenPair{}, err
+	case isDenied:
+		return TokenPair{}, ErrRefreshTokenRevoked
+	}
+
+	var family *RefreshTokenRecord
+
+	if p.RefreshTokens != nil {
+		family, err = p.consumeRefreshToken(ctx, refreshToken, &userId)
+		if err != nil {
+			return TokenPair{}, err
+		}
+	}
+
+	var custom map[string]any
+
+	if p.ClaimsFor != nil {
+		usr, err := p.Registry.GetUserById(ctx, &userId)
+		if err != nil {
+			return TokenPair{}, err
+		}
+
+		if usr == nil {
+			return TokenPair{}, errors.New("refresh token user is not found")
+		}
+
+		custom, err = p.customClaims(ctx, usr)
+		if err != nil {
+			return TokenPair{}, err
+		}
+	}
+
+	return p.createSignedTokenPair(ctx, &userId, family, custom)
+}
+
+func (p *RegistryProvider[U]) SignOut(
+	ctx context.Context,
+	req SignoutRequest,
+) error {
+	if p.Sessions != nil {
+		return p.signOutSessions(ctx, req)
+	}
+
+	// NOTE: Checked before any token is denied, so unsupported request
+	// has no side effects
+	if p.RefreshTokens == nil && req.AllSessions {
+		return ErrRefreshTokensNotEnabled
+	}
+
+	for _, token := range []*Token{req.AccessToken, req.RefreshToken} {
+		if err := p.denyToken(ctx, token); err != nil {
+			return err
+		}
+	}
+
+	if p.RefreshTokens == nil {
+		return nil
+	}
+
+	if req.AllSessions {
+		userId, isOk := req.userId()
+		if !isOk {
+			return errors.New("cannot signout all sessions: tokens contain no valid user id")
+		}
+
+		return p.RefreshTokens.RevokeUser(ctx, userId)
+	}
+
+	if req.RefreshToken == nil {
+		return nil
+	}
+
+	tokenId, isOk := req.RefreshToken.GetId()
+	if !isOk {
+		return nil
+	}
+
+	use, err := p.RefreshTokens.Consume(ctx, tokenId)
+	if err != nil || use.Record == nil {
+		return err
+	}
+
+	return p.RefreshTokens.RevokeFamily(ctx, use.Record.FamilyId)
 }
 
 func (p *RegistryProvider[U]) GetTokenUser(
@@ -161,20 +418,154 @@ func (p *RegistryProvider[U]) GetTokenUser(
 	return p.Registry.GetUserById(ctx, &userId)
 }
 
-func (p *RegistryProvider[U]) createSignedTokenPair(userId *uuid.UUID) (TokenPair, error) {
+func (p *RegistryProvider[U]) denyToken(ctx context.Context, token *Token) error {
+	if p.Denylist == nil || token == nil || token.JWT == nil {
+		return nil
+	}
+
+	tokenId, isOk := token.GetId()
+	if !isOk {
+		return nil
+	}
+
+	exp, err := token.JWT.Claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return errors.New("cannot deny token without expiration time")
+	}
+
+	return p.Denylist.Deny(ctx, tokenId, exp.Time)
+}
+
+// NOTE: Returns record of the consumed token
+func (p *RegistryProvider[U]) consumeRefreshToken(
+	ctx context.Context,
+	refreshToken *Token,
+	userId *uuid.UUID,
+) (*RefreshTokenRecord, error) {
+	tokenId, isOk := refreshToken.GetId()
+	if !isOk {
+		return nil, ErrRefreshTokenRevoked
+	}
+
+	use, err := p.RefreshTokens.Consume(ctx, tokenId)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := use.Record
+
+	switch {
+	case rec == nil:
+		return nil, ErrRefreshTokenRevoked
+	case rec.UserId != *userId:
+		return nil, ErrRefreshTokenRevoked
+	case use.IsReused:
+		p.log().Warn(
+			"refresh token reuse detected, revoking token family",
+			"userId", rec.UserId.String(),
+			"familyId", rec.FamilyId,
+		)
+
+		if err := p.RefreshTokens.RevokeFamily(ctx, rec.FamilyId); err != nil {
+			return nil, errors.Join(ErrRefreshTokenReused, err)
+		}
+
+		if p.OnRefreshTokenReuse != nil {
+			p.OnRefreshTokenReuse(ctx, rec)
+		}
+
+		return nil, ErrRefreshTokenReused
+	}
+
+	return rec, nil
+}
+
+func (p *RegistryProvider[U]) customClaims(
+	ctx context.Context,
+	usr *U,
+) (map[string]any, error) {
+	if p.ClaimsFor == nil || usr == nil {
+		return nil, nil
+	}
+
+	custom, err := p.ClaimsFor(ctx, usr)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("ClaimsFor failure"), err)
+	}
+
+	return custom, nil
+}
+
+func (p *RegistryProvider[U]) createTokenPair(ctx context.Context, usr *U) (TokenPair, error) {
+	if p.Sessions != nil {
+		return p.createSessionTokenPair(ctx, usr)
+	}
+
+	custom, err := p.customClaims(ctx, usr)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	uid := (*usr).GetId()
+	return p.createSignedTokenPair(ctx, &uid, nil, custom)
+}
+
+// NOTE: Starts new token family unless previous record of the family is
+// given, family id is embedded into access tokens as SessionIdClaim
+func (p *RegistryProvider[U]) createSignedTokenPair(
+	ctx context.Context,
+	userId *uuid.UUID,
+	prev *RefreshTokenRecord,
+	custom map[string]any,
+) (TokenPair, error) {
 	var pair TokenPair
 	var err error
 
-	pair.AccessToken, err = p.createSignedToken(userId, "at", p.AccessTokenDuration)
+	familyId, startedAt := uuid.NewString(), time.Now()
+	if prev != nil {
+		familyId, startedAt = prev.FamilyId, prev.FamilyStartedAt()
+	}
+
+	if p.RefreshTokens != nil {
+		custom = maps.Clone(custom)
+		if custom == nil {
+			custom = map[string]any{}
+		}
+
+		custom[SessionIdClaim] = familyId
+	}
+
+	pair.AccessToken, err = p.createSignedToken(userId, "at", p.AccessTokenDuration, custom)
 	if err != nil {
 		return pair, err
 	}
 
-	pair.RefreshToken, err = p.createSignedToken(userId, "rt", p.RefreshTokenDuration)
+	pair.RefreshToken, err = p.createSignedToken(userId, "rt", p.RefreshTokenDuration, nil)
 	if err != nil {
 		return pair, err
 	}
 
+	if p.RefreshTokens == nil {
+		return pair, nil
+	}
+
+	claims := pair.RefreshToken.Claims()
+
+	client, isOk := ClientInfoFrom(ctx)
+	if !isOk && prev != nil {
+		client = prev.Client
+	}
+
+	err = p.RefreshTokens.Save(ctx, &RefreshTokenRecord{
+		Id:        claims.ID,
+		FamilyId:  familyId,
+		UserId:    *userId,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+		Client:    client,
+		StartedAt: startedAt,
+	})
+
 	return pair, err
 }
 
@@ -182,9 +573,11 @@ func (p *RegistryProvider[U]) createSignedToken(
 	userId *uuid.UUID,
 	idPrefix string,
 	dur time.Duration,
+	custom map[string]any,
 ) (*Token, error) {
-	if p.TokenPrivateKey == nil {
-		return nil, errors.New("cannot create signed token: private key is nil")
+	key, err := p.signingKey()
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("cannot create signed token"), err)
 	}
 
 	if userId == nil {
@@ -194,16 +587,111 @@ func (p *RegistryProvider[U]) createSignedToken(
 	now := time.Now()
 	uid := userId.String()
 
-	claims := p.mergeClaims(jwt.RegisteredClaims{
-		Subject:   uid,
-		ExpiresAt: jwt.NewNumericDate(now.Add(dur)),
-		IssuedAt:  jwt.NewNumericDate(now),
-		ID:        fmt.Sprintf("%s-%s-%d", idPrefix, uid, now.UnixNano()),
-	})
+	claims := &Claims{
+		RegisteredClaims: p.mergeClaims(jwt.RegisteredClaims{
+			Subject:   uid,
+			ExpiresAt: jwt.NewNumericDate(now.Add(dur)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        fmt.Sprintf("%s-%s-%d", idPrefix, uid, now.UnixNano()),
+		}),
+		Custom: custom,
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	return p.signClaims(key, claims)
+}
 
-	signedTokenStr, err := token.SignedString(p.TokenPrivateKey)
+// NOTE: Signs arbitrary claims by the same key as the issued token pairs,
+// claims are not merged with BaseClaims
+func (p *RegistryProvider[U]) SignClaims(claims *Claims) (*Token, error) {
+	key, err := p.signingKey()
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("cannot create signed token"), err)
+	}
+
+	return p.signClaims(key, claims)
+}
+
+// NOTE: Verifies signature and expiration of the token issued by the
+// provider, tokens found in Denylist are rejected with ErrTokenRevoked
+func (p *RegistryProvider[U]) VerifyToken(ctx context.Context, tokenStr string) (*Token, error) {
+	parsed, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (any, error) {
+		key, err := p.verificationKey(token)
+		if err != nil {
+			return nil, err
+		}
+
+		if token.Method == nil || token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected token signing method %v", token.Header["alg"])
+		}
+
+		return key.VerificationKey(), nil
+	}, jwt.WithExpirationRequired())
+
+	if err != nil {
+		return nil, err
+	}
+
+	token := &Token{
+		JWT:       parsed,
+		JWTString: tokenStr,
+	}
+
+	isDenied, err := p.isTokenDenied(ctx, token)
+	switch {
+	case err != nil:
+		return nil, err
+	case isDenied:
+		return nil, ErrTokenRevoked
+	}
+
+	return token, nil
+}
+
+func (p *RegistryProvider[U]) isTokenDenied(ctx context.Context, token *Token) (bool, error) {
+	if p.Denylist == nil {
+		return false, nil
+	}
+
+	tokenId, isOk := token.GetId()
+	if !isOk {
+		return false, nil
+	}
+
+	isDenied, err := p.Denylist.IsDenied(ctx, tokenId)
+	if err != nil {
+		return false, errors.Join(fmt.Errorf("denylist lookup failure"), err)
+	}
+
+	return isDenied, nil
+}
+
+// NOTE: Denies the token until it expires, no-op if Denylist is not set
+func (p *RegistryProvider[U]) RevokeToken(ctx context.Context, token *Token) error {
+	return p.denyToken(ctx, token)
+}
+
+func (p *RegistryProvider[U]) verificationKey(token *jwt.Token) (*SigningKey, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	if p.Keys != nil && len(kid) > 0 {
+		key, found := p.Keys.Lookup(kid)
+		if !found {
+			return nil, ErrUnknownSigningKey
+		}
+
+		return key, nil
+	}
+
+	return p.signingKey()
+}
+
+func (p *RegistryProvider[U]) signClaims(key *SigningKey, claims *Claims) (*Token, error) {
+	token := jwt.NewWithClaims(key.Method, claims)
+	if len(key.Id) > 0 {
+		token.Header["kid"] = key.Id
+	}
+
+	signedTokenStr, err := token.SignedString(key.PrivateKey)
 	if err != nil {
 		return nil, errors.Join(
 			fmt.Errorf("failed to create signed token string"),
@@ -217,6 +705,51 @@ func (p *RegistryProvider[U]) createSignedToken(
 	}, nil
 }
 
+// NOTE: Method of the key tokens are currently signed with
+func (p *RegistryProvider[U]) SigningMethod() (jwt.SigningMethod, error) {
+	key, err := p.signingKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return key.Method, nil
+}
+
+// NOTE: Key built from TokenPrivateKey has no id, so issued tokens carry
+// no `kid` header
+func (p *RegistryProvider[U]) signingKey() (*SigningKey, error) {
+	if p.Keys != nil {
+		if key := p.Keys.Active(); key != nil {
+			return key, nil
+		}
+
+		return nil, errors.New("keyring has no active key")
+	}
+
+	if p.TokenPrivateKey == nil {
+		return nil, errors.New("private key is nil")
+	}
+
+	method := p.TokenSigningMethod
+	if method == nil {
+		m, err := defaultSigningMethod(p.TokenPrivateKey)
+		if err != nil {
+			return nil, err
+		}
+
+		method = m
+	}
+
+	if err := checkSigningMethod(p.TokenPrivateKey, method); err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		Method:     method,
+		PrivateKey: p.TokenPrivateKey,
+	}, nil
+}
+
 func (p *RegistryProvider[U]) mergeClaims(filler jwt.RegisteredClaims) jwt.RegisteredClaims {
 	if len(filler.Issuer) == 0 {
 		filler.Issuer = p.BaseClaims.Issuer
@@ -0,0 +1,339 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (p *RegistryProvider[U]) RequestEmailVerification(ctx context.Context, usr *U) error {
+	registry, opts, err := p.accounts()
+	if err != nil {
+		return err
+	}
+
+	email, err := registry.GetUserEmail(ctx, usr)
+	switch {
+	case err != nil:
+		return err
+	case len(email.Address) == 0:
+		return ErrNoEmail
+	case email.IsVerified:
+		return ErrEmailVerified
+	}
+
+	uid := (*usr).GetId()
+
+	token, err := p.createSignedToken(&uid, "ev", opts.VerificationTokenDuration, map[string]any{
+		TokenUseClaim: TokenUseEmailVerification,
+		EmailClaim:    email.Address,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return opts.Mailer.Send(ctx, &Message{
+		Kind:    MessageEmailVerification,
+		To:      email.Address,
+		Subject: "Verify your email",
+		Body:    messageBody("Use the link below to verify your email:", opts.VerificationLink, token),
+		Link:    messageLink(opts.VerificationLink, token),
+		Token:   token.JWTString,
+	})
+}
+
+// NOTE: Token is rejected if the user email has changed since it was sent
+func (p *RegistryProvider[U]) VerifyEmail(ctx context.Context, token *Token) (bool, error) {
+	registry, opts, err := p.accounts()
+	if err != nil {
+		return false, err
+	}
+
+	usr, err := p.oneTimeTokenUser(ctx, token, TokenUseEmailVerification, opts.Tokens)
+	if err != nil || usr == nil {
+		return false, err
+	}
+
+	email, err := registry.GetUserEmail(ctx, usr)
+	if err != nil {
+		return false, err
+	}
+
+	claimed, _ := token.Claims().String(EmailClaim)
+	if len(claimed) == 0 || !strings.EqualFold(claimed, email.Address) {
+		return false, nil
+	}
+
+	if err := registry.MarkEmailVerified(ctx, usr, email.Address); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// NOTE: Unknown emails are silently ignored, so the result does not reveal
+// whether an account exists
+func (p *RegistryProvider[U]) RequestPasswordReset(ctx context.Context, address string) error {
+	registry, opts, err := p.accounts()
+	if err != nil {
+		return err
+	}
+
+	usr, err := registry.GetUserByEmail(ctx, address)
+	if err != nil || usr == nil {
+		return err
+	}
+
+	email, err := registry.GetUserEmail(ctx, usr)
+	if err != nil || len(email.Address) == 0 {
+		return err
+	}
+
+	uid := (*usr).GetId()
+
+	token, err := p.createSignedToken(&uid, "pr", opts.ResetTokenDuration, map[string]any{
+		TokenUseClaim: TokenUsePasswordReset,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return opts.Mailer.Send(ctx, &Message{
+		Kind:    MessagePasswordReset,
+		To:      email.Address,
+		Subject: "Reset your password",
+		Body:    messageBody("Use the link below to set a new password:", opts.ResetLink, token),
+		Link:    messageLink(opts.ResetLink, token),
+		Token:   token.JWTString,
+	})
+}
+
+// NOTE: All refresh tokens of the user are revoked on success, so sessions
+// opened with the old password are closed
+func (p *RegistryProvider[U]) ResetPassword(
+	ctx context.Context,
+	req ResetPasswordRequest,
+) (*ResetPasswordResult, error) {
+	registry, opts, err := p.accounts()
+	if err != nil {
+		return nil, err
+	}
+
+	field := opts.PasswordField
+	if len(field) == 0 {
+		field = "password"
+	}
+
+	check := CredentialsCheck{
+		field: FieldCheck{
+			IsCorrect: len(req.Password) > 0,
+			Details:   fmt.Sprintf("`%s` should be non empty", field),
+		},
+	}
+
+	if _, has := check.HasIncorrect(); has {
+		return &ResetPasswordResult{
+			InvalidCredentials: true,
+			CredentialsCheck:   check,
+		}, nil
+	}
+
+	if req.Token == nil || req.Token.JWT == nil {
+		return nil, errors.New("one-time token is nil")
+	}
+
+	claims, isOk := oneTimeTokenClaims(req.Token, TokenUsePasswordReset)
+	if !isOk {
+		return &ResetPasswordResult{
+			NotAuthorized: true,
+		}, nil
+	}
+
+	// NOTE: Token is consumed only after the password is accepted, so the
+	// user can retry with another one. Username for similarity check is
+	// the email, since it is what identifies users in account flows
+	usr, err := p.Registry.GetUserById(ctx, &claims.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if usr == nil {
+		return &ResetPasswordResult{
+			NotAuthorized: true,
+		}, nil
+	}
+
+	if p.CredentialsPolicy != nil {
+		email, err := registry.GetUserEmail(ctx, usr)
+		if err != nil {
+			return nil, err
+		}
+
+		check[field] = p.CredentialsPolicy.CheckPassword(req.Password, email.Address)
+
+		if _, has := check.HasIncorrect(); has {
+			return &ResetPasswordResult{
+				InvalidCredentials: true,
+				CredentialsCheck:   check,
+			}, nil
+		}
+	}
+
+	isFirstUse, err := opts.Tokens.Consume(ctx, claims.Id, claims.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isFirstUse {
+		return &ResetPasswordResult{
+			NotAuthorized: true,
+		}, nil
+	}
+
+	err = registry.UpdateCredentials(ctx, usr, Credentials{
+		field: req.Password,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.revokeUserSessions(ctx, (*usr).GetId()); err != nil {
+		return nil, err
+	}
+
+	return &ResetPasswordResult{}, nil
+}
+
+// NOTE: Called at signin after credentials are checked, returns nil result
+// if the user is allowed to proceed
+func (p *RegistryProvider[U]) requireVerifiedEmail(ctx context.Context, usr *U) (*SigninResult[U], error) {
+	if p.Accounts == nil || !p.Accounts.EmailVerificationRequired {
+		return nil, nil
+	}
+
+	registry, isOk := p.Registry.(AccountRegistry[U])
+	if !isOk {
+		return nil, ErrAccountsNotSupported
+	}
+
+	email, err := registry.GetUserEmail(ctx, usr)
+	if err != nil {
+		return nil, err
+	}
+
+	if email.IsVerified {
+		return nil, nil
+	}
+
+	return &SigninResult[U]{
+		NotAuthorized:    true,
+		EmailNotVerified: true,
+	}, nil
+}
+
+// NOTE: Returns nil user if the token is not of the given use, is already
+// used or its user does not exist anymore
+func (p *RegistryProvider[U]) oneTimeTokenUser(
+	ctx context.Context,
+	token *Token,
+	use string,
+	store OneTimeTokenStore,
+) (*U, error) {
+	if token == nil || token.JWT == nil {
+		return nil, errors.New("one-time token is nil")
+	}
+
+	claims, isOk := oneTimeTokenClaims(token, use)
+	if !isOk {
+		return nil, nil
+	}
+
+	isFirstUse, err := store.Consume(ctx, claims.Id, claims.ExpiresAt)
+	if err != nil || !isFirstUse {
+		return nil, err
+	}
+
+	return p.Registry.GetUserById(ctx, &claims.UserId)
+}
+
+type oneTimeClaims struct {
+	Id        string
+	UserId    uuid.UUID
+	ExpiresAt time.Time
+}
+
+// NOTE: Token is not consumed here, false is returned if it has another
+// use or lacks claims needed to consume it. Token must be parsed
+func oneTimeTokenClaims(token *Token, use string) (oneTimeClaims, bool) {
+	tokenUse, _ := token.Claims().String(TokenUseClaim)
+	userId, isOk := token.GetUserId()
+
+	if tokenUse != use || !isOk {
+		return oneTimeClaims{}, false
+	}
+
+	tokenId, isOk := token.GetId()
+	if !isOk {
+		return oneTimeClaims{}, false
+	}
+
+	exp, err := token.JWT.Claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return oneTimeClaims{}, false
+	}
+
+	return oneTimeClaims{
+		Id:        tokenId,
+		UserId:    userId,
+		ExpiresAt: exp.Time,
+	}, true
+}
+
+func (p *RegistryProvider[U]) accounts() (AccountRegistry[U], AccountOptions, error) {
+	registry, isOk := p.Registry.(AccountRegistry[U])
+	if !isOk || p.Accounts == nil {
+		return nil, AccountOptions{}, ErrAccountsNotSupported
+	}
+
+	opts := *p.Accounts
+
+	switch {
+	case opts.Mailer == nil:
+		return nil, opts, errors.New("account options: mailer is not set")
+	case opts.Tokens == nil:
+		return nil, opts, errors.New("account options: one-time token store is not set")
+	}
+
+	if opts.VerificationTokenDuration <= 0 {
+		opts.VerificationTokenDuration = DefaultVerificationTokenDuration
+	}
+
+	if opts.ResetTokenDuration <= 0 {
+		opts.ResetTokenDuration = DefaultResetTokenDuration
+	}
+
+	return registry, opts, nil
+}
+
+func messageLink(build func(string) string, token *Token) string {
+	if build == nil {
+		return ""
+	}
+
+	return build(token.JWTString)
+}
+
+func messageBody(intro string, build func(string) string, token *Token) string {
+	if build == nil {
+		return strings.Replace(intro, "link", "token", 1) + "\n\n" + token.JWTString
+	}
+
+	return intro + "\n\n" + build(token.JWTString)
+}
@@ -0,0 +1,120 @@
+package identity
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+func (p *RegistryProvider[U]) CreateApiKey(
+	ctx context.Context,
+	usr *U,
+	req ApiKeyRequest,
+) (*CreatedApiKey, error) {
+	opts, err := p.apiKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.Scopes) > 0 {
+		for _, scope := range req.Scopes {
+			if !slices.Contains(opts.Scopes, scope) {
+				return nil, ErrApiKeyScope
+			}
+		}
+	}
+
+	now := time.Now()
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return nil, ErrApiKeyExpiration
+	}
+
+	if opts.MaxDuration > 0 {
+		if req.ExpiresAt == nil || req.ExpiresAt.Sub(now) > opts.MaxDuration {
+			return nil, ErrApiKeyExpiration
+		}
+	}
+
+	plain, key := GenerateApiKey(opts.Prefix, (*usr).GetId())
+	key.Name = req.Name
+	key.Scopes = slices.Clone(req.Scopes)
+	key.ExpiresAt = req.ExpiresAt
+
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+
+	if err := opts.Store.SaveApiKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	return &CreatedApiKey{
+		ApiKey: key,
+		Key:    plain,
+	}, nil
+}
+
+func (p *RegistryProvider[U]) ListApiKeys(ctx context.Context, usr *U) ([]*ApiKey, error) {
+	opts, err := p.apiKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	return opts.Store.ListApiKeys(ctx, (*usr).GetId())
+}
+
+// NOTE: Keys of other users are reported as not found
+func (p *RegistryProvider[U]) RevokeApiKey(ctx context.Context, usr *U, id string) (bool, error) {
+	opts, err := p.apiKeys()
+	if err != nil {
+		return false, err
+	}
+
+	key, err := opts.Store.GetApiKey(ctx, id)
+	if err != nil || key == nil || key.UserId != (*usr).GetId() {
+		return false, err
+	}
+
+	return opts.Store.DeleteApiKey(ctx, id)
+}
+
+func (p *RegistryProvider[U]) AuthenticateApiKey(ctx context.Context, plain string) (*ApiKey, error) {
+	opts, err := p.apiKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, id, secret, isOk := ParseApiKey(plain)
+	if !isOk || prefix != opts.Prefix {
+		return nil, nil
+	}
+
+	key, err := opts.Store.GetApiKey(ctx, id)
+	if err != nil || key == nil {
+		return nil, err
+	}
+
+	if !key.CheckSecret(secret) || key.IsExpired(time.Now()) {
+		return nil, nil
+	}
+
+	return key, nil
+}
+
+func (p *RegistryProvider[U]) GetApiKeyUser(ctx context.Context, key *ApiKey) (*U, error) {
+	return p.Registry.GetUserById(ctx, &key.UserId)
+}
+
+func (p *RegistryProvider[U]) apiKeys() (ApiKeyOptions, error) {
+	if p.ApiKeys == nil || p.ApiKeys.Store == nil {
+		return ApiKeyOptions{}, ErrApiKeysNotSupported
+	}
+
+	opts := *p.ApiKeys
+	if len(opts.Prefix) == 0 {
+		opts.Prefix = DefaultApiKeyPrefix
+	}
+
+	return opts, nil
+}
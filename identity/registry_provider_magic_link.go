@@ -0,0 +1,110 @@
+package identity
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+)
+
+// NOTE: Unknown emails are silently ignored, so the result does not reveal
+// whether an account exists
+func (p *RegistryProvider[U]) RequestMagicLink(ctx context.Context, req MagicLinkRequest) error {
+	registry, opts, err := p.magicLinks()
+	if err != nil {
+		return err
+	}
+
+	if len(req.Nonce) == 0 {
+		return errors.New("magic link nonce is empty")
+	}
+
+	usr, err := registry.GetUserByEmail(ctx, req.Email)
+	if err != nil || usr == nil {
+		return err
+	}
+
+	email, err := registry.GetUserEmail(ctx, usr)
+	if err != nil || len(email.Address) == 0 {
+		return err
+	}
+
+	uid := (*usr).GetId()
+
+	token, err := p.createSignedToken(&uid, "ml", opts.Duration, map[string]any{
+		TokenUseClaim: TokenUseMagicLink,
+		NonceClaim:    hashNonce(req.Nonce),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return opts.Mailer.Send(ctx, &Message{
+		Kind:    MessageMagicLink,
+		To:      email.Address,
+		Subject: "Sign in link",
+		Body:    messageBody("Use the link below to sign in:", opts.Link, token),
+		Link:    messageLink(opts.Link, token),
+		Token:   token.JWTString,
+	})
+}
+
+// NOTE: Nonce is checked before the token is consumed, so a link opened on
+// another device stays usable on the requesting one
+func (p *RegistryProvider[U]) SignInWithMagicLink(
+	ctx context.Context,
+	req MagicLinkSigninRequest,
+) (*SigninResult[U], error) {
+	_, opts, err := p.magicLinks()
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Token == nil || req.Token.JWT == nil {
+		return nil, errors.New("magic link token is nil")
+	}
+
+	notAuthorized := &SigninResult[U]{
+		NotAuthorized: true,
+	}
+
+	expected, _ := req.Token.Claims().String(NonceClaim)
+	actual := hashNonce(req.Nonce)
+
+	if len(req.Nonce) == 0 || subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) != 1 {
+		return notAuthorized, nil
+	}
+
+	usr, err := p.oneTimeTokenUser(ctx, req.Token, TokenUseMagicLink, opts.Tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	if usr == nil {
+		return notAuthorized, nil
+	}
+
+	return p.completeSignin(ctx, usr)
+}
+
+func (p *RegistryProvider[U]) magicLinks() (AccountRegistry[U], MagicLinkOptions, error) {
+	registry, isOk := p.Registry.(AccountRegistry[U])
+	if !isOk || p.MagicLinks == nil {
+		return nil, MagicLinkOptions{}, ErrAccountsNotSupported
+	}
+
+	opts := *p.MagicLinks
+
+	switch {
+	case opts.Mailer == nil:
+		return nil, opts, errors.New("magic link options: mailer is not set")
+	case opts.Tokens == nil:
+		return nil, opts, errors.New("magic link options: one-time token store is not set")
+	}
+
+	if opts.Duration <= 0 {
+		opts.Duration = DefaultMagicLinkDuration
+	}
+
+	return registry, opts, nil
+}
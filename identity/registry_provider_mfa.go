@@ -0,0 +1,320 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/yandzee/go-svc/identity/totp"
+)
+
+func (p *RegistryProvider[U]) VerifyMFA(
+	ctx context.Context,
+	req MFAVerifyRequest,
+) (*SigninResult[U], error) {
+	if req.Token == nil {
+		return nil, errors.New("MFA token is nil")
+	}
+
+	notAuthorized := &SigninResult[U]{
+		NotAuthorized: true,
+		MFARequired:   true,
+	}
+
+	use, _ := req.Token.Claims().String(TokenUseClaim)
+	userId, isOk := req.Token.GetUserId()
+
+	if use != TokenUseMFA || !isOk {
+		return notAuthorized, nil
+	}
+
+	registry, err := p.mfaRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	isAllowed, err := p.reserveMFAAttempt(ctx, req.Token)
+	if err != nil || !isAllowed {
+		return notAuthorized, err
+	}
+
+	// NOTE: Codes are short, so attempts are limited per user by Lockout
+	identifier := "mfa:" + userId.String()
+	_, client := p.lockoutSubjects(ctx, nil)
+	isSettled := false
+
+	if p.Lockout != nil {
+		status, err := p.Lockout.Check(ctx, identifier, client)
+		if err != nil {
+			return nil, err
+		}
+
+		if status.IsBlocked() {
+			notAuthorized.Locked = status.Locked
+			notAuthorized.Throttled = status.Throttled
+			notAuthorized.RetryAfter = status.RetryAfter
+
+			return notAuthorized, nil
+		}
+
+		defer p.releaseLockout(ctx, identifier, &isSettled)
+	}
+
+	usr, err := p.Registry.GetUserById(ctx, &userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if usr == nil {
+		return notAuthorized, nil
+	}
+
+	settings, err := registry.GetMFA(ctx, usr)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings == nil || !settings.IsEnabled {
+		return notAuthorized, nil
+	}
+
+	if !settings.Verify(req.Code, time.Now(), p.mfaOptions().TOTP) {
+		isSettled = true
+		notAuthorized.CredentialsMismatch = true
+
+		return p.signinFailure(ctx, identifier, client, notAuthorized)
+	}
+
+	isClaimed, err := p.claimMFAToken(ctx, req.Token)
+	if err != nil || !isClaimed {
+		return notAuthorized, err
+	}
+
+	if err := registry.SaveMFA(ctx, usr, settings); err != nil {
+		return nil, err
+	}
+
+	isSettled = true
+
+	if p.Lockout != nil {
+		if err := p.Lockout.RecordSuccess(ctx, identifier); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.denyToken(ctx, req.Token); err != nil {
+		return nil, err
+	}
+
+	return p.issueSigninTokens(ctx, usr)
+}
+
+// NOTE: Counts the attempt against the pending token, tokens without id
+// are not accepted as attempts can not be counted for them
+func (p *RegistryProvider[U]) reserveMFAAttempt(ctx context.Context, token *Token) (bool, error) {
+	tokenId, isOk := token.GetId()
+	if !isOk {
+		return false, nil
+	}
+
+	opts := p.mfaOptions()
+	isAllowed := false
+
+	_, err := opts.Attempts.Update(ctx, mfaAttemptsKey(tokenId), func(st *AttemptsState) {
+		if st.Failures >= opts.MaxAttempts || !st.LockedUntil.IsZero() {
+			return
+		}
+
+		isAllowed = true
+		st.Failures += 1
+		st.LastFailure = time.Now()
+	})
+
+	return isAllowed, err
+}
+
+// NOTE: Marks the pending token as used by setting LockedUntil, so only
+// one of concurrent verifications with correct codes gets the token pair
+func (p *RegistryProvider[U]) claimMFAToken(ctx context.Context, token *Token) (bool, error) {
+	tokenId, _ := token.GetId()
+	isClaimed := false
+
+	_, err := p.mfaOptions().Attempts.Update(ctx, mfaAttemptsKey(tokenId), func(st *AttemptsState) {
+		if !st.LockedUntil.IsZero() {
+			return
+		}
+
+		isClaimed = true
+		st.LockedUntil = time.Now()
+	})
+
+	return isClaimed, err
+}
+
+func mfaAttemptsKey(tokenId string) string {
+	return "mfa-token:" + tokenId
+}
+
+// NOTE: MFA is enabled only after the first code is confirmed by ConfirmMFA,
+// enrollment of a user with enabled MFA is rejected
+func (p *RegistryProvider[U]) EnrollMFA(ctx context.Context, usr *U) (*MFAEnrollment, error) {
+	registry, err := p.mfaRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := registry.GetMFA(ctx, usr)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil && existing.IsEnabled {
+		return nil, ErrMFAEnabled
+	}
+
+	opts := p.mfaOptions()
+	secret := totp.GenerateSecret()
+	codes, hashes := GenerateRecoveryCodes(opts.RecoveryCodesCount)
+
+	err = registry.SaveMFA(ctx, usr, &MFASettings{
+		TOTPSecret:         secret,
+		RecoveryCodeHashes: hashes,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	account := (*usr).GetId().String()
+	if opts.AccountName != nil {
+		account = opts.AccountName(*usr)
+	}
+
+	return &MFAEnrollment{
+		Secret:        secret,
+		URI:           totp.URI(secret, opts.Issuer, account, opts.TOTP),
+		RecoveryCodes: codes,
+	}, nil
+}
+
+// NOTE: Only TOTP codes are accepted, so the user proves the authenticator
+// app is set up
+func (p *RegistryProvider[U]) ConfirmMFA(ctx context.Context, usr *U, code string) (bool, error) {
+	registry, err := p.mfaRegistry()
+	if err != nil {
+		return false, err
+	}
+
+	settings, err := registry.GetMFA(ctx, usr)
+	if err != nil {
+		return false, err
+	}
+
+	if settings == nil {
+		return false, ErrMFANotEnrolled
+	}
+
+	step, isOk := totp.Validate(settings.TOTPSecret, code, time.Now(), p.mfaOptions().TOTP)
+	if !isOk || step <= settings.LastUsedStep {
+		return false, nil
+	}
+
+	settings.LastUsedStep = step
+	settings.IsEnabled = true
+
+	return true, registry.SaveMFA(ctx, usr, settings)
+}
+
+// NOTE: Requires a valid TOTP or recovery code, settings are removed by
+// saving nil ones
+func (p *RegistryProvider[U]) DisableMFA(ctx context.Context, usr *U, code string) (bool, error) {
+	registry, err := p.mfaRegistry()
+	if err != nil {
+		return false, err
+	}
+
+	settings, err := registry.GetMFA(ctx, usr)
+	if err != nil {
+		return false, err
+	}
+
+	if settings == nil || !settings.IsEnabled {
+		return false, ErrMFANotEnrolled
+	}
+
+	if !settings.Verify(code, time.Now(), p.mfaOptions().TOTP) {
+		return false, nil
+	}
+
+	return true, registry.SaveMFA(ctx, usr, nil)
+}
+
+// NOTE: Returns nil result if second factor is not required for the user
+func (p *RegistryProvider[U]) requireMFA(ctx context.Context, usr *U) (*SigninResult[U], error) {
+	registry, isOk := p.Registry.(MFARegistry[U])
+	if !isOk {
+		return nil, nil
+	}
+
+	settings, err := registry.GetMFA(ctx, usr)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings == nil || !settings.IsEnabled {
+		return nil, nil
+	}
+
+	uid := (*usr).GetId()
+
+	token, err := p.createSignedToken(&uid, "mfa", p.mfaOptions().PendingDuration, map[string]any{
+		TokenUseClaim: TokenUseMFA,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigninResult[U]{
+		MFARequired: true,
+		MFAToken:    token,
+	}, nil
+}
+
+func (p *RegistryProvider[U]) mfaRegistry() (MFARegistry[U], error) {
+	registry, isOk := p.Registry.(MFARegistry[U])
+	if !isOk {
+		return nil, ErrMFANotSupported
+	}
+
+	return registry, nil
+}
+
+func (p *RegistryProvider[U]) mfaOptions() MFAOptions {
+	opts := MFAOptions{}
+	if p.MFA != nil {
+		opts = *p.MFA
+	}
+
+	if opts.PendingDuration <= 0 {
+		opts.PendingDuration = DefaultMFAPendingDuration
+	}
+
+	if opts.RecoveryCodesCount <= 0 {
+		opts.RecoveryCodesCount = DefaultRecoveryCodesCount
+	}
+
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMFAMaxAttempts
+	}
+
+	if opts.Attempts == nil {
+		p.mfaAttemptsOnce.Do(func() {
+			p.mfaAttempts = NewMemoryLockoutStore()
+		})
+
+		opts.Attempts = p.mfaAttempts
+	}
+
+	return opts
+}
@@ -0,0 +1,180 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NOTE: Validates opaque session token and extends the session, unknown
+// sessions are reported as revoked tokens
+func (p *RegistryProvider[U]) ValidateSessionToken(ctx context.Context, raw string) (*ValidatedToken, error) {
+	opts, err := p.sessions()
+	if err != nil {
+		return nil, err
+	}
+
+	validated := &ValidatedToken{
+		Token: &Token{JWTString: raw},
+	}
+
+	id, secret, isOk := ParseSessionToken(raw)
+	if !isOk {
+		validated.Validation.IsMalformed = true
+		return validated, nil
+	}
+
+	sess, err := opts.Store.GetSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if sess == nil || !sess.CheckSecret(secret) {
+		validated.Validation.IsRevoked = true
+		return validated, nil
+	}
+
+	now := time.Now()
+
+	if sess.IsExpired(now) {
+		validated.Validation.IsExpired = true
+
+		_, err := opts.Store.DeleteSession(ctx, id)
+		return validated, err
+	}
+
+	if now.Sub(sess.LastSeenAt) >= opts.TouchInterval {
+		sess.LastSeenAt = now
+		sess.ExpiresAt = p.sessionExpiration(opts, sess, now)
+
+		isTouched, err := opts.Store.TouchSession(ctx, id, sess.LastSeenAt, sess.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+
+		// NOTE: Session is revoked after it was read
+		if !isTouched {
+			validated.Validation.IsRevoked = true
+			return validated, nil
+		}
+	}
+
+	validated.Token = sess.Token(raw)
+	return validated, nil
+}
+
+func (p *RegistryProvider[U]) ListSessions(ctx context.Context, usr *U) ([]*Session, error) {
+	opts, err := p.sessions()
+	if err != nil {
+		return nil, err
+	}
+
+	return opts.Store.ListSessions(ctx, (*usr).GetId())
+}
+
+// NOTE: Session token is returned as access token, there are no refresh
+// tokens since sessions are extended on use
+func (p *RegistryProvider[U]) createSessionTokenPair(ctx context.Context, usr *U) (TokenPair, error) {
+	opts, err := p.sessions()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	custom, err := p.customClaims(ctx, usr)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	now := time.Now()
+
+	raw, sess := NewSession((*usr).GetId(), now)
+	sess.Claims = custom
+	sess.Client, _ = ClientInfoFrom(ctx)
+	sess.ExpiresAt = p.sessionExpiration(opts, sess, now)
+
+	if err := opts.Store.SaveSession(ctx, sess); err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken: sess.Token(raw),
+	}, nil
+}
+
+func (p *RegistryProvider[U]) signOutSessions(ctx context.Context, req SignoutRequest) error {
+	opts, err := p.sessions()
+	if err != nil {
+		return err
+	}
+
+	if req.AllSessions {
+		userId, isOk := req.userId()
+		if !isOk {
+			return errors.New("cannot signout all sessions: tokens contain no valid user id")
+		}
+
+		return opts.Store.DeleteUserSessions(ctx, userId)
+	}
+
+	if req.AccessToken == nil {
+		return nil
+	}
+
+	if id, _, isOk := ParseSessionToken(req.AccessToken.RawString()); isOk {
+		_, err = opts.Store.DeleteSession(ctx, id)
+	}
+
+	return err
+}
+
+// NOTE: Closes server-side sessions and refresh token families of the user,
+// access tokens issued within the latter stay valid until they expire
+func (p *RegistryProvider[U]) revokeUserSessions(ctx context.Context, userId uuid.UUID) error {
+	if p.Sessions != nil {
+		opts, err := p.sessions()
+		if err != nil {
+			return err
+		}
+
+		if err := opts.Store.DeleteUserSessions(ctx, userId); err != nil {
+			return err
+		}
+	}
+
+	if p.RefreshTokens != nil {
+		return p.RefreshTokens.RevokeUser(ctx, userId)
+	}
+
+	return nil
+}
+
+func (p *RegistryProvider[U]) sessionExpiration(opts SessionOptions, sess *Session, now time.Time) time.Time {
+	expiresAt := now.Add(opts.IdleTimeout)
+
+	if opts.MaxLifetime > 0 {
+		if deadline := sess.CreatedAt.Add(opts.MaxLifetime); deadline.Before(expiresAt) {
+			return deadline
+		}
+	}
+
+	return expiresAt
+}
+
+func (p *RegistryProvider[U]) sessions() (SessionOptions, error) {
+	if p.Sessions == nil || p.Sessions.Store == nil {
+		return SessionOptions{}, ErrSessionsNotEnabled
+	}
+
+	opts := *p.Sessions
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultSessionIdleTimeout
+	}
+
+	if opts.TouchInterval <= 0 {
+		opts.TouchInterval = DefaultSessionTouchInterval
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,281 @@
+package identity
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/yandzee/go-svc/crypto"
+)
+
+const (
+	DefaultSessionIdleTimeout   = 24 * time.Hour
+	DefaultSessionTouchInterval = time.Minute
+
+	sessionIdBytes     = 16
+	sessionSecretBytes = 32
+)
+
+var ErrSessionsNotEnabled = errors.New("sessions are not enabled")
+
+// NOTE: Only hash of the secret part of session token is stored, Id is
+// safe to show to the user, e.g. to revoke the session
+type Session struct {
+	Id         string         `json:"id"`
+	UserId     uuid.UUID      `json:"userId"`
+	SecretHash string         `json:"-"`
+	Client     ClientInfo     `json:"client"`
+	Claims     map[string]any `json:"-"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	LastSeenAt time.Time      `json:"lastSeenAt"`
+	ExpiresAt  time.Time      `json:"expiresAt"`
+}
+
+// NOTE: Get and List should not return expired sessions, though they are
+// checked by provider anyway. Touch only updates a session that is still
+// stored and returns false otherwise, so concurrent revocation is not undone
+type SessionStore interface {
+	SaveSession(context.Context, *Session) error
+	GetSession(context.Context, string) (*Session, error)
+	TouchSession(ctx context.Context, id string, seenAt, expiresAt time.Time) (bool, error)
+	ListSessions(context.Context, uuid.UUID) ([]*Session, error)
+	DeleteSession(context.Context, string) (bool, error)
+	DeleteUserSessions(context.Context, uuid.UUID) error
+}
+
+// NOTE: ValidateSessionToken returns ErrSessionsNotEnabled if the provider
+// issues JWTs, so endpoints fall back to verifying them
+type SessionProvider[U User] interface {
+	ValidateSessionToken(context.Context, string) (*ValidatedToken, error)
+	ListSessions(context.Context, *U) ([]*Session, error)
+}
+
+type SessionOptions struct {
+	Store SessionStore
+
+	// NOTE: Sessions expire after IdleTimeout without requests, every
+	// validated request extends the session up to MaxLifetime since its
+	// creation, which is unlimited when zero
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
+
+	// NOTE: Minimal interval between extensions of a session, so the store
+	// is not written on each request
+	TouchInterval time.Duration
+}
+
+func NewSessionOptions(store SessionStore) *SessionOptions {
+	return &SessionOptions{
+		Store:         store,
+		IdleTimeout:   DefaultSessionIdleTimeout,
+		TouchInterval: DefaultSessionTouchInterval,
+	}
+}
+
+// NOTE: Session tokens are "<id>.<secret>", single dot tells them apart
+// from JWTs and API keys
+func NewSession(userId uuid.UUID, now time.Time) (string, *Session) {
+	id := crypto.RandomHex(sessionIdBytes)
+	secret := crypto.RandomHex(sessionSecretBytes)
+
+	return id + "." + secret, &Session{
+		Id:         id,
+		UserId:     userId,
+		SecretHash: hashSessionSecret(secret),
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+}
+
+func ParseSessionToken(token string) (string, string, bool) {
+	id, secret, isOk := strings.Cut(token, ".")
+	if !isOk || len(id) != 2*sessionIdBytes || len(secret) != 2*sessionSecretBytes {
+		return "", "", false
+	}
+
+	if !isHex(id) || !isHex(secret) {
+		return "", "", false
+	}
+
+	return id, secret, true
+}
+
+func IsSessionToken(token string) bool {
+	_, _, isOk := ParseSessionToken(token)
+	return isOk
+}
+
+func (s *Session) CheckSecret(secret string) bool {
+	hashed := hashSessionSecret(secret)
+	return subtle.ConstantTimeCompare([]byte(hashed), []byte(s.SecretHash)) == 1
+}
+
+func (s *Session) IsExpired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// NOTE: Session is represented as unsigned token carrying its attributes as
+// claims, so it is handled the same way as JWTs once validated
+func (s *Session) Token(raw string) *Token {
+	custom := maps.Clone(s.Claims)
+	if custom == nil {
+		custom = map[string]any{}
+	}
+
+	custom[SessionIdClaim] = s.Id
+
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        s.Id,
+			Subject:   s.UserId.String(),
+			IssuedAt:  jwt.NewNumericDate(s.CreatedAt),
+			ExpiresAt: jwt.NewNumericDate(s.ExpiresAt),
+		},
+		Custom: custom,
+	}
+
+	return &Token{
+		JWT: &jwt.Token{
+			Raw:    raw,
+			Header: map[string]any{},
+			Claims: claims,
+			Valid:  true,
+		},
+		JWTString: raw,
+	}
+}
+
+func hashSessionSecret(secret string) string {
+	return crypto.Sha256Hex(secret)
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+type MemorySessionStore struct {
+	mx        sync.Mutex
+	sessions  map[string]*Session
+	lastPrune time.Time
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: map[string]*Session{},
+	}
+}
+
+func (s *MemorySessionStore) SaveSession(ctx context.Context, sess *Session) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.pruneExpired(time.Now())
+
+	stored := *sess
+	s.sessions[sess.Id] = &stored
+
+	return nil
+}
+
+func (s *MemorySessionStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	sess, exists := s.sessions[id]
+	if !exists || sess.IsExpired(time.Now()) {
+		return nil, nil
+	}
+
+	stored := *sess
+	return &stored, nil
+}
+
+func (s *MemorySessionStore) TouchSession(
+	ctx context.Context,
+	id string,
+	seenAt, expiresAt time.Time,
+) (bool, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	sess, exists := s.sessions[id]
+	if !exists {
+		return false, nil
+	}
+
+	sess.LastSeenAt = seenAt
+	sess.ExpiresAt = expiresAt
+
+	return true, nil
+}
+
+func (s *MemorySessionStore) ListSessions(ctx context.Context, userId uuid.UUID) ([]*Session, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := time.Now()
+	sessions := []*Session{}
+
+	for _, sess := range s.sessions {
+		if sess.UserId == userId && !sess.IsExpired(now) {
+			stored := *sess
+			sessions = append(sessions, &stored)
+		}
+	}
+
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+func (s *MemorySessionStore) DeleteSession(ctx context.Context, id string) (bool, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	_, exists := s.sessions[id]
+	delete(s.sessions, id)
+
+	return exists, nil
+}
+
+func (s *MemorySessionStore) DeleteUserSessions(ctx context.Context, userId uuid.UUID) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for id, sess := range s.sessions {
+		if sess.UserId == userId {
+			delete(s.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemorySessionStore) pruneExpired(now time.Time) {
+	if now.Sub(s.lastPrune) < memoryStorePruneInterval {
+		return
+	}
+
+	s.lastPrune = now
+
+	for id, sess := range s.sessions {
+		if sess.IsExpired(now) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// NOTE: Most recently used sessions go first
+func sortSessions(sessions []*Session) {
+	slices.SortFunc(sessions, func(a, b *Session) int {
+		return b.LastSeenAt.Compare(a.LastSeenAt)
+	})
+}
@@ -0,0 +1,221 @@
+package identity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	svccrypto "github.com/yandzee/go-svc/crypto"
+)
+
+const rsaMinKeyBits = 2048
+
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// NOTE: PrivateKey is one of *ecdsa.PrivateKey, *rsa.PrivateKey,
+// ed25519.PrivateKey or []byte secret for HMAC methods
+type SigningKey struct {
+	Id         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.PrivateKey
+	CreatedAt  time.Time
+
+	// NOTE: Zero for the active key, retired keys are only used to verify
+	// tokens issued before rotation
+	RetiredAt time.Time
+}
+
+// NOTE: Method defaults to ES256/ES384/ES512 depending on the curve, RS256,
+// EdDSA or HS256. Asymmetric keys get RFC 7638 thumbprint as id, so keys with
+// the same public part get the same id, HMAC keys get a random one
+func NewSigningKey(pk crypto.PrivateKey, method ...jwt.SigningMethod) (*SigningKey, error) {
+	key := &SigningKey{
+		PrivateKey: pk,
+		CreatedAt:  time.Now(),
+	}
+
+	if len(method) > 0 && method[0] != nil {
+		key.Method = method[0]
+	} else {
+		m, err := defaultSigningMethod(pk)
+		if err != nil {
+			return nil, err
+		}
+
+		key.Method = m
+	}
+
+	if err := checkSigningMethod(pk, key.Method); err != nil {
+		return nil, err
+	}
+
+	if key.IsSymmetric() {
+		key.Id = svccrypto.RandomHex(16)
+		return key, nil
+	}
+
+	jwk, err := key.JWK()
+	if err != nil {
+		return nil, err
+	}
+
+	key.Id = jwk.Thumbprint()
+	return key, nil
+}
+
+// NOTE: Generates ES256 key by default
+func GenerateSigningKey(method ...jwt.SigningMethod) (*SigningKey, error) {
+	var m jwt.SigningMethod = jwt.SigningMethodES256
+	if len(method) > 0 && method[0] != nil {
+		m = method[0]
+	}
+
+	var pk crypto.PrivateKey
+	var err error
+
+	switch m := m.(type) {
+	case *jwt.SigningMethodECDSA:
+		var curve elliptic.Curve
+
+		switch m.CurveBits {
+		case 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported ECDSA curve size: %d", m.CurveBits)
+		}
+
+		pk, err = ecdsa.GenerateKey(curve, rand.Reader)
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		pk, err = rsa.GenerateKey(rand.Reader, rsaMinKeyBits)
+	case *jwt.SigningMethodEd25519:
+		_, pk, err = ed25519.GenerateKey(rand.Reader)
+	case *jwt.SigningMethodHMAC:
+		pk = svccrypto.RandomBytes(uint32(m.Hash.Size()))
+	default:
+		return nil, fmt.Errorf("unsupported signing method: %s", m.Alg())
+	}
+
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to generate signing key"), err)
+	}
+
+	return NewSigningKey(pk, m)
+}
+
+func (k *SigningKey) IsRetired() bool {
+	return !k.RetiredAt.IsZero()
+}
+
+func (k *SigningKey) IsSymmetric() bool {
+	_, isHMAC := k.Method.(*jwt.SigningMethodHMAC)
+	return isHMAC
+}
+
+// NOTE: Returns the secret itself for HMAC keys
+func (k *SigningKey) VerificationKey() any {
+	return verificationKey(k.PrivateKey)
+}
+
+func (k *SigningKey) JWK() (JWK, error) {
+	if k.IsSymmetric() {
+		return JWK{}, errors.New("symmetric keys cannot be published as JWK")
+	}
+
+	jwk, err := publicJWK(k.VerificationKey())
+	if err != nil {
+		return jwk, err
+	}
+
+	jwk.KeyId = k.Id
+	jwk.Algorithm = k.Method.Alg()
+
+	return jwk, nil
+}
+
+func defaultSigningMethod(pk crypto.PrivateKey) (jwt.SigningMethod, error) {
+	switch pk := pk.(type) {
+	case *ecdsa.PrivateKey:
+		switch pk.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512, nil
+		}
+
+		return nil, fmt.Errorf("unsupported ECDSA curve: %s", pk.Curve.Params().Name)
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PrivateKey:
+		return jwt.SigningMethodEdDSA, nil
+	case []byte:
+		return jwt.SigningMethodHS256, nil
+	case nil:
+		return nil, errors.New("signing key is nil")
+	}
+
+	return nil, fmt.Errorf("unsupported signing key type: %T", pk)
+}
+
+func checkSigningMethod(pk crypto.PrivateKey, method jwt.SigningMethod) error {
+	mismatch := fmt.Errorf("signing method %s cannot be used with %T key", method.Alg(), pk)
+
+	switch m := method.(type) {
+	case *jwt.SigningMethodECDSA:
+		ecKey, ok := pk.(*ecdsa.PrivateKey)
+		if !ok || ecKey.Curve.Params().BitSize != m.CurveBits {
+			return mismatch
+		}
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		rsaKey, ok := pk.(*rsa.PrivateKey)
+		if !ok {
+			return mismatch
+		}
+
+		if rsaKey.N.BitLen() < rsaMinKeyBits {
+			return fmt.Errorf("RSA key must be at least %d bits", rsaMinKeyBits)
+		}
+	case *jwt.SigningMethodEd25519:
+		if _, ok := pk.(ed25519.PrivateKey); !ok {
+			return mismatch
+		}
+	case *jwt.SigningMethodHMAC:
+		secret, ok := pk.([]byte)
+		if !ok {
+			return mismatch
+		}
+
+		if len(secret) < m.Hash.Size() {
+			return fmt.Errorf("HMAC secret for %s must be at least %d bytes", m.Alg(), m.Hash.Size())
+		}
+	default:
+		return fmt.Errorf("unsupported signing method: %s", method.Alg())
+	}
+
+	return nil
+}
+
+func verificationKey(pk crypto.PrivateKey) any {
+	switch pk := pk.(type) {
+	case *ecdsa.PrivateKey:
+		return &pk.PublicKey
+	case *rsa.PrivateKey:
+		return &pk.PublicKey
+	case ed25519.PrivateKey:
+		return pk.Public()
+	}
+
+	return pk
+}
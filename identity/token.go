@@ -14,7 +14,16 @@ type Token struct {
 	JWTString string
 }
 
-func (t *Token) AsCookie(name string) http.Cookie {
+// NOTE: Zero value yields HttpOnly cookie of "/" path with strict SameSite
+type CookieOptions struct {
+	Path             string
+	Domain           string
+	Secure           bool
+	SameSite         http.SameSite
+	HttpOnlyDisabled bool
+}
+
+func (t *Token) AsCookie(name string, opts ...CookieOptions) http.Cookie {
 	val := t.JWTString
 	if len(val) == 0 {
 		val = t.JWT.Raw
@@ -33,13 +42,33 @@ func (t *Token) AsCookie(name string) http.Cookie {
 		maxAge = -1
 	}
 
+	o := CookieOptions{}
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	return o.Cookie(name, val, maxAge)
+}
+
+func (o CookieOptions) Cookie(name, value string, maxAge int) http.Cookie {
+	path := o.Path
+	if len(path) == 0 {
+		path = "/"
+	}
+
+	sameSite := o.SameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteStrictMode
+	}
+
 	return http.Cookie{
 		Name:     name,
-		Value:    val,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   false,
-		SameSite: http.SameSiteStrictMode,
+		Value:    value,
+		Path:     path,
+		Domain:   o.Domain,
+		HttpOnly: !o.HttpOnlyDisabled,
+		Secure:   o.Secure,
+		SameSite: sameSite,
 		MaxAge:   maxAge,
 	}
 }
@@ -83,6 +112,44 @@ func (t *Token) GetUserId() (uuid.UUID, bool) {
 	return uid, true
 }
 
+func (t *Token) GetId() (string, bool) {
+	if t.JWT == nil {
+		return "", false
+	}
+
+	switch claims := t.JWT.Claims.(type) {
+	case *Claims:
+		return claims.ID, len(claims.ID) > 0
+	case *jwt.RegisteredClaims:
+		return claims.ID, len(claims.ID) > 0
+	case jwt.RegisteredClaims:
+		return claims.ID, len(claims.ID) > 0
+	case jwt.MapClaims:
+		id, ok := claims["jti"].(string)
+		return id, ok && len(id) > 0
+	}
+
+	return "", false
+}
+
+// NOTE: Returns nil if token is not parsed or issued by this package
+func (t *Token) Claims() *Claims {
+	if t.JWT == nil {
+		return nil
+	}
+
+	claims, _ := t.JWT.Claims.(*Claims)
+	return claims
+}
+
+func (t *Token) Claim(name string) (any, bool) {
+	return t.Claims().Get(name)
+}
+
+func (t *Token) DecodeClaims(dst any) error {
+	return t.Claims().Decode(dst)
+}
+
 // Implements json.Marshaler
 func (t *Token) MarshalJSON() ([]byte, error) {
 	str := fmt.Sprintf("\"%s\"", t.RawString())
@@ -0,0 +1,61 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrTokenRevoked = errors.New("token is revoked")
+
+// NOTE: Keyed by JWT id (jti), entries are only needed until the token
+// expires on its own
+type TokenDenylist interface {
+	Deny(context.Context, string, time.Time) error
+	IsDenied(context.Context, string) (bool, error)
+}
+
+type MemoryTokenDenylist struct {
+	mx        sync.Mutex
+	entries   map[string]time.Time
+	lastPrune time.Time
+}
+
+func NewMemoryTokenDenylist() *MemoryTokenDenylist {
+	return &MemoryTokenDenylist{
+		entries: map[string]time.Time{},
+	}
+}
+
+func (dl *MemoryTokenDenylist) Deny(ctx context.Context, id string, until time.Time) error {
+	dl.mx.Lock()
+	defer dl.mx.Unlock()
+
+	dl.pruneExpired(time.Now())
+	dl.entries[id] = until
+
+	return nil
+}
+
+func (dl *MemoryTokenDenylist) IsDenied(ctx context.Context, id string) (bool, error) {
+	dl.mx.Lock()
+	defer dl.mx.Unlock()
+
+	until, exists := dl.entries[id]
+	return exists && time.Now().Before(until), nil
+}
+
+func (dl *MemoryTokenDenylist) pruneExpired(now time.Time) {
+	if now.Sub(dl.lastPrune) < memoryStorePruneInterval {
+		return
+	}
+
+	dl.lastPrune = now
+
+	for id, until := range dl.entries {
+		if now.After(until) {
+			delete(dl.entries, id)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Package totp implements time-based one-time passwords (RFC 6238) on top
+// of HOTP (RFC 4226), compatible with common authenticator apps
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/yandzee/go-svc/crypto"
+)
+
+type Algorithm string
+
+const (
+	AlgorithmSHA1   Algorithm = "SHA1"
+	AlgorithmSHA256 Algorithm = "SHA256"
+	AlgorithmSHA512 Algorithm = "SHA512"
+
+	DefaultDigits     = 6
+	DefaultPeriod     = 30 * time.Second
+	DefaultSkew       = 1
+	DefaultSecretSize = 20
+)
+
+var ErrInvalidSecret = errors.New("invalid TOTP secret")
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NOTE: Zero fields fall back to defaults, Skew is the number of periods
+// accepted before and after the current one
+type Options struct {
+	Digits    int
+	Period    time.Duration
+	Skew      uint
+	Algorithm Algorithm
+}
+
+// NOTE: Returns base32 encoded secret without padding
+func GenerateSecret() string {
+	return b32.EncodeToString(crypto.RandomBytes(DefaultSecretSize))
+}
+
+func DecodeSecret(secret string) ([]byte, error) {
+	normalized := strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	normalized = strings.TrimRight(normalized, "=")
+
+	key, err := b32.DecodeString(normalized)
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+
+	return key, nil
+}
+
+// NOTE: Key URI format understood by authenticator apps, see
+// https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func URI(secret, issuer, account string, opts ...Options) string {
+	o := options(opts)
+
+	label := url.PathEscape(account)
+	if len(issuer) > 0 {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("algorithm", string(o.Algorithm))
+	q.Set("digits", fmt.Sprint(o.Digits))
+	q.Set("period", fmt.Sprint(int(o.Period.Seconds())))
+
+	if len(issuer) > 0 {
+		q.Set("issuer", issuer)
+	}
+
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+func Code(secret string, t time.Time, opts ...Options) (string, error) {
+	key, err := DecodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	o := options(opts)
+	return hotp(key, Step(t, o.Period), o), nil
+}
+
+// NOTE: Returns time step the code matches, so callers can reject reuse of
+// the same or earlier step
+func Validate(secret, code string, t time.Time, opts ...Options) (int64, bool) {
+	key, err := DecodeSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+
+	o := options(opts)
+	code = strings.ReplaceAll(code, " ", "")
+
+	if len(code) != o.Digits {
+		return 0, false
+	}
+
+	current := Step(t, o.Period)
+
+	for delta := -int64(o.Skew); delta <= int64(o.Skew); delta++ {
+		step := current + delta
+		expected := hotp(key, step, o)
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+func Step(t time.Time, period time.Duration) int64 {
+	if period <= 0 {
+		period = DefaultPeriod
+	}
+
+	return t.Unix() / int64(period.Seconds())
+}
+
+func hotp(key []byte, counter int64, o Options) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+
+	mac := hmac.New(o.Algorithm.hash(), key)
+	_, _ = mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	truncated := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range o.Digits {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", o.Digits, truncated%mod)
+}
+
+func (a Algorithm) hash() func() hash.Hash {
+	switch a {
+	case AlgorithmSHA256:
+		return sha256.New
+	case AlgorithmSHA512:
+		return sha512.New
+	}
+
+	return sha1.New
+}
+
+func options(opts []Options) Options {
+	o := Options{}
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if o.Digits <= 0 || o.Digits > 9 {
+		o.Digits = DefaultDigits
+	}
+
+	if o.Period <= 0 {
+		o.Period = DefaultPeriod
+	}
+
+	if o.Skew == 0 {
+		o.Skew = DefaultSkew
+	}
+
+	if len(o.Algorithm) == 0 {
+		o.Algorithm = AlgorithmSHA1
+	}
+
+	return o
+}
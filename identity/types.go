@@ -1,6 +1,8 @@
 package identity
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -26,6 +28,44 @@ type SigninResult[U User] struct {
 	InvalidCredentials  bool             `json:"invalidCredentials"`
 	CredentialsCheck    CredentialsCheck `json:"credentialsCheck"`
 	Tokens              TokenPair        `json:"tokens"`
+
+	// NOTE: Set when attempt is rejected by Lockout before checking
+	// credentials
+	Locked     bool          `json:"locked"`
+	Throttled  bool          `json:"throttled"`
+	RetryAfter time.Duration `json:"-"`
+
+	// NOTE: Set instead of Tokens when second factor is required, the token
+	// is exchanged for TokenPair by MFAProvider.VerifyMFA
+	MFARequired bool   `json:"mfaRequired"`
+	MFAToken    *Token `json:"mfaToken,omitempty"`
+
+	// NOTE: Set when AccountOptions.EmailVerificationRequired is enabled
+	// and the user email is not verified yet
+	EmailNotVerified bool `json:"emailNotVerified"`
+}
+
+type SignoutRequest struct {
+	AccessToken  *Token
+	RefreshToken *Token
+
+	// NOTE: Revokes refresh tokens of all user sessions, access tokens of
+	// other sessions stay valid until they expire
+	AllSessions bool
+}
+
+func (r *SignoutRequest) userId() (uuid.UUID, bool) {
+	for _, token := range []*Token{r.AccessToken, r.RefreshToken} {
+		if token == nil {
+			continue
+		}
+
+		if uid, isOk := token.GetUserId(); isOk {
+			return uid, true
+		}
+	}
+
+	return uuid.Nil, false
 }
 
 type UserStub struct {
@@ -0,0 +1,155 @@
+package users
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/yandzee/go-svc/identity"
+)
+
+// NOTE: Returned users are copies, changes to them are not stored
+type MemoryRegistry struct {
+	Options
+
+	mx         sync.RWMutex
+	users      map[uuid.UUID]*User
+	byUsername map[string]uuid.UUID
+}
+
+func NewMemoryRegistry(opts ...Options) *MemoryRegistry {
+	r := &MemoryRegistry{
+		users:      map[uuid.UUID]*User{},
+		byUsername: map[string]uuid.UUID{},
+	}
+
+	if len(opts) > 0 {
+		r.Options = opts[0]
+	}
+
+	return r
+}
+
+func (r *MemoryRegistry) CreateUser(
+	ctx context.Context,
+	stub *identity.UserStub,
+) (identity.CreateUserResult[User], error) {
+	usr, err := r.newUser(stub)
+	if err != nil {
+		return identity.CreateUserResult[User]{}, err
+	}
+
+	key := r.usernameKey(usr.Username)
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if id, exists := r.byUsername[key]; exists {
+		return identity.CreateUserResult[User]{
+			User:          cloneUser(r.users[id]),
+			AlreadyExists: true,
+		}, nil
+	}
+
+	if existing, exists := r.users[usr.Id]; exists {
+		return identity.CreateUserResult[User]{
+			User:          cloneUser(existing),
+			AlreadyExists: true,
+		}, nil
+	}
+
+	r.users[usr.Id] = usr
+	r.byUsername[key] = usr.Id
+
+	return identity.CreateUserResult[User]{
+		User: cloneUser(usr),
+	}, nil
+}
+
+func (r *MemoryRegistry) GetUserById(ctx context.Context, id *uuid.UUID) (*User, error) {
+	if id == nil {
+		return nil, nil
+	}
+
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	usr, exists := r.users[*id]
+	if !exists {
+		return nil, nil
+	}
+
+	return cloneUser(usr), nil
+}
+
+func (r *MemoryRegistry) GetUserByCredentials(
+	ctx context.Context,
+	creds identity.Credentials,
+) (*User, error) {
+	username, _ := r.credentials(creds)
+
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	id, exists := r.byUsername[r.usernameKey(username)]
+	if !exists {
+		return nil, nil
+	}
+
+	return cloneUser(r.users[id]), nil
+}
+
+// NOTE: Outdated password hashes are replaced on successful check
+func (r *MemoryRegistry) UserHasCredentials(
+	ctx context.Context,
+	usr *User,
+	creds identity.Credentials,
+) (bool, error) {
+	stored, err := r.GetUserById(ctx, &usr.Id)
+	if err != nil {
+		return false, err
+	}
+
+	return r.checkPassword(stored, creds, func(hash string) error {
+		r.update(usr.Id, func(u *User) {
+			u.PasswordHash = hash
+		})
+
+		return nil
+	})
+}
+
+// NOTE: Reports false if user is not found
+func (r *MemoryRegistry) SetRoles(ctx context.Context, id uuid.UUID, roles []string) (bool, error) {
+	return r.update(id, func(u *User) {
+		u.Roles = slices.Clone(roles)
+	}), nil
+}
+
+func (r *MemoryRegistry) DeleteUser(ctx context.Context, id uuid.UUID) (bool, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	usr, exists := r.users[id]
+	if !exists {
+		return false, nil
+	}
+
+	delete(r.users, id)
+	delete(r.byUsername, r.usernameKey(usr.Username))
+
+	return true, nil
+}
+
+func (r *MemoryRegistry) update(id uuid.UUID, fn func(*User)) bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	usr, exists := r.users[id]
+	if exists {
+		fn(usr)
+	}
+
+	return exists
+}
@@ -0,0 +1,112 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// NOTE: Migrations are formatted with the table name, versions are their
+// positions starting from 1, so new ones are only appended
+type Dialect struct {
+	Name string
+
+	placeholder func(int) string
+	migrations  []string
+}
+
+var SQLite = &Dialect{
+	Name: "sqlite",
+	placeholder: func(int) string {
+		return "?"
+	},
+	migrations: []string{
+		`CREATE TABLE %[1]s (
+			id TEXT PRIMARY KEY,
+			username TEXT NOT NULL,
+			username_key TEXT NOT NULL UNIQUE,
+			password_hash TEXT NOT NULL,
+			roles TEXT NOT NULL DEFAULT '[]',
+			created_at TIMESTAMP NOT NULL
+		)`,
+	},
+}
+
+var Postgres = &Dialect{
+	Name: "postgres",
+	placeholder: func(n int) string {
+		return "$" + strconv.Itoa(n)
+	},
+	migrations: []string{
+		`CREATE TABLE %[1]s (
+			id UUID PRIMARY KEY,
+			username TEXT NOT NULL,
+			username_key TEXT NOT NULL UNIQUE,
+			password_hash TEXT NOT NULL,
+			roles TEXT NOT NULL DEFAULT '[]',
+			created_at TIMESTAMPTZ NOT NULL
+		)`,
+	},
+}
+
+// NOTE: Applies pending migrations, each in its own transaction. Instances
+// starting concurrently may race on the first run, in which case the
+// loser fails on duplicate version and can be restarted
+func (r *SQLRegistry) Migrate(ctx context.Context) error {
+	migrations := r.table + "_migrations"
+
+	_, err := r.db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version INTEGER PRIMARY KEY, applied_at TIMESTAMP NOT NULL)",
+		migrations,
+	))
+	if err != nil {
+		return errors.Join(fmt.Errorf("migrations table creation failure"), err)
+	}
+
+	current := 0
+
+	row := r.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COALESCE(MAX(version), 0) FROM %s", migrations))
+	if err := row.Scan(&current); err != nil {
+		return errors.Join(fmt.Errorf("migrations version query failure"), err)
+	}
+
+	for idx, migration := range r.dialect.migrations {
+		version := idx + 1
+		if version <= current {
+			continue
+		}
+
+		if err := r.applyMigration(ctx, migrations, version, fmt.Sprintf(migration, r.table)); err != nil {
+			return errors.Join(fmt.Errorf("migration %d failure", version), err)
+		}
+	}
+
+	return nil
+}
+
+func (r *SQLRegistry) applyMigration(ctx context.Context, migrations string, version int, stmt string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (version, applied_at) VALUES (%s, %s)",
+		migrations, r.dialect.placeholder(1), r.dialect.placeholder(2),
+	), version, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
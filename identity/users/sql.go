@@ -0,0 +1,219 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/yandzee/go-svc/identity"
+)
+
+const DefaultTable = "users"
+
+var tableNameRx = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type SQLOptions struct {
+	Options
+
+	// NOTE: Migrations are tracked in "<Table>_migrations" table
+	Table string
+}
+
+// NOTE: Works with any driver of supported dialects, Migrate is expected
+// to be called once at startup before the registry is used
+type SQLRegistry struct {
+	Options
+
+	db      *sql.DB
+	dialect *Dialect
+	table   string
+}
+
+func NewSQLRegistry(db *sql.DB, dialect *Dialect, opts ...SQLOptions) (*SQLRegistry, error) {
+	if db == nil || dialect == nil {
+		return nil, errors.New("sql registry requires db and dialect")
+	}
+
+	r := &SQLRegistry{
+		db:      db,
+		dialect: dialect,
+		table:   DefaultTable,
+	}
+
+	if len(opts) > 0 {
+		r.Options = opts[0].Options
+
+		if len(opts[0].Table) > 0 {
+			r.table = opts[0].Table
+		}
+	}
+
+	if !tableNameRx.MatchString(r.table) {
+		return nil, fmt.Errorf("invalid users table name %q", r.table)
+	}
+
+	return r, nil
+}
+
+func (r *SQLRegistry) CreateUser(
+	ctx context.Context,
+	stub *identity.UserStub,
+) (identity.CreateUserResult[User], error) {
+	result := identity.CreateUserResult[User]{}
+
+	usr, err := r.newUser(stub)
+	if err != nil {
+		return result, err
+	}
+
+	roles, err := json.Marshal(usr.Roles)
+	if err != nil {
+		return result, err
+	}
+
+	// NOTE: Conflicts on either id or username key are reported as existing
+	// user, so concurrent signups of the same username are safe
+	res, err := r.db.ExecContext(ctx, r.query(
+		"INSERT INTO %[1]s (id, username, username_key, password_hash, roles, created_at) "+
+			"VALUES (%[2]s, %[3]s, %[4]s, %[5]s, %[6]s, %[7]s) ON CONFLICT DO NOTHING",
+		6,
+	), usr.Id.String(), usr.Username, r.usernameKey(usr.Username), usr.PasswordHash, string(roles), usr.CreatedAt)
+	if err != nil {
+		return result, errors.Join(fmt.Errorf("user insert failure"), err)
+	}
+
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return result, err
+	}
+
+	if inserted > 0 {
+		result.User = usr
+		return result, nil
+	}
+
+	existing, err := r.getUserByUsername(ctx, usr.Username)
+	if err == nil && existing == nil {
+		existing, err = r.GetUserById(ctx, &usr.Id)
+	}
+
+	result.User, result.AlreadyExists = existing, existing != nil
+	return result, err
+}
+
+func (r *SQLRegistry) GetUserById(ctx context.Context, id *uuid.UUID) (*User, error) {
+	if id == nil {
+		return nil, nil
+	}
+
+	return r.getUser(ctx, "id", id.String())
+}
+
+func (r *SQLRegistry) GetUserByCredentials(
+	ctx context.Context,
+	creds identity.Credentials,
+) (*User, error) {
+	username, _ := r.credentials(creds)
+	return r.getUserByUsername(ctx, username)
+}
+
+// NOTE: Outdated password hashes are replaced on successful check
+func (r *SQLRegistry) UserHasCredentials(
+	ctx context.Context,
+	usr *User,
+	creds identity.Credentials,
+) (bool, error) {
+	stored, err := r.GetUserById(ctx, &usr.Id)
+	if err != nil {
+		return false, err
+	}
+
+	return r.checkPassword(stored, creds, func(hash string) error {
+		_, err := r.update(ctx, usr.Id, "password_hash", hash)
+		return err
+	})
+}
+
+// NOTE: Reports false if user is not found
+func (r *SQLRegistry) SetRoles(ctx context.Context, id uuid.UUID, roles []string) (bool, error) {
+	if roles == nil {
+		roles = []string{}
+	}
+
+	encoded, err := json.Marshal(roles)
+	if err != nil {
+		return false, err
+	}
+
+	return r.update(ctx, id, "roles", string(encoded))
+}
+
+func (r *SQLRegistry) DeleteUser(ctx context.Context, id uuid.UUID) (bool, error) {
+	res, err := r.db.ExecContext(ctx, r.query("DELETE FROM %[1]s WHERE id = %[2]s", 1), id.String())
+	if err != nil {
+		return false, err
+	}
+
+	deleted, err := res.RowsAffected()
+	return deleted > 0, err
+}
+
+func (r *SQLRegistry) getUserByUsername(ctx context.Context, username string) (*User, error) {
+	return r.getUser(ctx, "username_key", r.usernameKey(username))
+}
+
+// NOTE: Column is never user input, only values are
+func (r *SQLRegistry) getUser(ctx context.Context, column string, value any) (*User, error) {
+	row := r.db.QueryRowContext(ctx, r.query(
+		"SELECT id, username, password_hash, roles, created_at FROM %[1]s WHERE "+column+" = %[2]s",
+		1,
+	), value)
+
+	usr := &User{}
+	roles := ""
+
+	err := row.Scan(&usr.Id, &usr.Username, &usr.PasswordHash, &roles, &usr.CreatedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Join(fmt.Errorf("user select failure"), err)
+	}
+
+	if err := json.Unmarshal([]byte(roles), &usr.Roles); err != nil {
+		return nil, errors.Join(fmt.Errorf("malformed user roles"), err)
+	}
+
+	usr.Roles = slices.Clip(usr.Roles)
+	return usr, nil
+}
+
+func (r *SQLRegistry) update(ctx context.Context, id uuid.UUID, column string, value any) (bool, error) {
+	res, err := r.db.ExecContext(ctx, r.query(
+		"UPDATE %[1]s SET "+column+" = %[2]s WHERE id = %[3]s",
+		2,
+	), value, id.String())
+	if err != nil {
+		return false, errors.Join(fmt.Errorf("user update failure"), err)
+	}
+
+	updated, err := res.RowsAffected()
+	return updated > 0, err
+}
+
+// NOTE: Formats query with table name as the first argument followed by
+// nargs placeholders of the dialect
+func (r *SQLRegistry) query(format string, nargs int) string {
+	args := []any{r.table}
+
+	for i := range nargs {
+		args = append(args, r.dialect.placeholder(i+1))
+	}
+
+	return fmt.Sprintf(format, args...)
+}
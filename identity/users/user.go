@@ -0,0 +1,142 @@
+// Package users implements identity.UsersRegistry backed by memory or by
+// database/sql. Usernames are unique, passwords are stored as hashes only
+package users
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/identity/password"
+)
+
+type User struct {
+	Id           uuid.UUID `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	Roles        []string  `json:"roles"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+func (u User) GetId() uuid.UUID {
+	return u.Id
+}
+
+func (u User) GetRoles() []string {
+	return u.Roles
+}
+
+type Options struct {
+	// NOTE: Credentials fields, "username" and "password" by default
+	UsernameField string
+	PasswordField string
+
+	// NOTE: Usernames are unique case-insensitively unless set, the
+	// username is stored as given anyway
+	CaseSensitiveUsernames bool
+
+	// NOTE: Hasher with default argon2id parameters is used when nil
+	Passwords *password.Hasher
+}
+
+func (o *Options) CheckFieldsCorrectness(
+	ctx context.Context,
+	creds identity.Credentials,
+) (identity.CredentialsCheck, error) {
+	username, pwd := o.credentials(creds)
+
+	return identity.CredentialsCheck{
+		o.usernameField(): identity.FieldCheck{
+			IsCorrect: len(strings.TrimSpace(username)) > 0,
+			Details:   "`" + o.usernameField() + "` should be non empty",
+		},
+		o.passwordField(): identity.FieldCheck{
+			IsCorrect: len(pwd) > 0,
+			Details:   "`" + o.passwordField() + "` should be non empty",
+		},
+	}, nil
+}
+
+// NOTE: Builds the user to be stored, password is hashed before any lock
+// is taken by the registry as hashing is slow by design
+func (o *Options) newUser(stub *identity.UserStub) (*User, error) {
+	username, pwd := o.credentials(stub.Credentials)
+
+	hash, err := o.passwords().Hash(pwd)
+	if err != nil {
+		return nil, err
+	}
+
+	id := stub.Id
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+
+	return &User{
+		Id:           id,
+		Username:     strings.TrimSpace(username),
+		PasswordHash: hash,
+		Roles:        []string{},
+		CreatedAt:    time.Now().UTC(),
+	}, nil
+}
+
+func (o *Options) checkPassword(
+	usr *User,
+	creds identity.Credentials,
+	onRehash func(string) error,
+) (bool, error) {
+	if usr == nil {
+		return false, nil
+	}
+
+	_, pwd := o.credentials(creds)
+	return o.passwords().Check(pwd, usr.PasswordHash, onRehash)
+}
+
+func (o *Options) credentials(creds identity.Credentials) (string, string) {
+	return creds.Get(o.usernameField()), creds.Get(o.passwordField())
+}
+
+func (o *Options) usernameKey(username string) string {
+	username = strings.TrimSpace(username)
+	if o.CaseSensitiveUsernames {
+		return username
+	}
+
+	return strings.ToLower(username)
+}
+
+func (o *Options) usernameField() string {
+	if len(o.UsernameField) == 0 {
+		return "username"
+	}
+
+	return o.UsernameField
+}
+
+func (o *Options) passwordField() string {
+	if len(o.PasswordField) == 0 {
+		return "password"
+	}
+
+	return o.PasswordField
+}
+
+func (o *Options) passwords() *password.Hasher {
+	if o.Passwords == nil {
+		return password.NewHasher()
+	}
+
+	return o.Passwords
+}
+
+func cloneUser(usr *User) *User {
+	cloned := *usr
+	cloned.Roles = slices.Clone(usr.Roles)
+
+	return &cloned
+}
@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"net/http"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/yandzee/go-svc/log"
@@ -20,6 +21,7 @@ type Builder struct {
 	CORSEnabled        bool
 	CORSOptions        *CORSOptions
 	CompressionOptions *CompressionOptions
+	Middlewares        []Middleware
 }
 
 type CORSOptions struct {
@@ -40,43 +42,43 @@ func NewBuilder() Builder {
 }
 
 func (b *Builder) Get(p string, h Handler) *Route {
-	return b.ensureRoute(http.MethodGet, p, h)
+	return b.ensureRoute("", http.MethodGet, p, h)
 }
 
 func (b *Builder) Post(p string, h Handler) *Route {
-	return b.ensureRoute(http.MethodPost, p, h)
+	return b.ensureRoute("", http.MethodPost, p, h)
 }
 
 func (b *Builder) Put(p string, h Handler) *Route {
-	return b.ensureRoute(http.MethodPut, p, h)
+	return b.ensureRoute("", http.MethodPut, p, h)
 }
 
 func (b *Builder) Head(p string, h Handler) *Route {
-	return b.ensureRoute(http.MethodHead, p, h)
+	return b.ensureRoute("", http.MethodHead, p, h)
 }
 
 func (b *Builder) Options(p string, h Handler) *Route {
-	return b.ensureRoute(http.MethodOptions, p, h)
+	return b.ensureRoute("", http.MethodOptions, p, h)
 }
 
 func (b *Builder) Delete(p string, h Handler) *Route {
-	return b.ensureRoute(http.MethodDelete, p, h)
+	return b.ensureRoute("", http.MethodDelete, p, h)
 }
 
 func (b *Builder) Connect(p string, h Handler) *Route {
-	return b.ensureRoute(http.MethodConnect, p, h)
+	return b.ensureRoute("", http.MethodConnect, p, h)
 }
 
 func (b *Builder) Patch(p string, h Handler) *Route {
-	return b.ensureRoute(http.MethodPatch, p, h)
+	return b.ensureRoute("", http.MethodPatch, p, h)
 }
 
 func (b *Builder) Trace(p string, h Handler) *Route {
-	return b.ensureRoute(http.MethodTrace, p, h)
+	return b.ensureRoute("", http.MethodTrace, p, h)
 }
 
 func (b *Builder) All(p string, h Handler) *Route {
-	return b.ensureRoute(MethodAll, p, h)
+	return b.ensureRoute("", MethodAll, p, h)
 }
 
 func (b *Builder) Method(method, path string, handler Handler) *Route {
@@ -151,8 +153,12 @@ func (b *Builder) CORS(enabled bool, maybeOpts ...CORSOptions) {
 	b.CORSOptions = opts
 }
 
+func (b *Builder) Use(mws ...Middleware) {
+	b.Middlewares = append(b.Middlewares, mws...)
+}
+
 func (b *Builder) Files(p string, fs fs.FS) *Route {
-	return b.ensureFiles(p, fs)
+	return b.ensureFiles("", p, fs)
 }
 
 func (b *Builder) File(p string, fs fs.FS, fileName ...string) *Route {
@@ -165,7 +171,41 @@ func (b *Builder) File(p string, fs fs.FS, fileName ...string) *Route {
 		fname = filepath.Base(p)
 	}
 
-	return b.ensureFiles(p, fs, fname)
+	return b.ensureFiles("", p, fs, fname)
+}
+
+// NOTE: Prefix is stripped from request path by default, use
+// Route.StripPrefix(false) for handlers relying on full path (e.g. pprof)
+func (b *Builder) Mount(p string, h http.Handler) *Route {
+	return b.ensureMount("", p, h, nil)
+}
+
+// NOTE: Routes of mounted builder are resolved when router is being built,
+// so they can be added after the builder is mounted
+func (b *Builder) MountBuilder(p string, sub *Builder) *Route {
+	return b.ensureMount("", p, nil, sub)
+}
+
+// NOTE: Routes of sub builder are served only for requests to matching
+// host, wildcards of host pattern are available as path params
+func (b *Builder) Host(host string, sub *Builder) *Route {
+	return b.ensureMount(host, "/", nil, sub)
+}
+
+func (b *Builder) Proxy(p string, target string, opts ...*ProxyOptions) *Route {
+	return b.ProxyUpstreams(p, MustUpstreams(target), opts...)
+}
+
+func (b *Builder) ProxyUpstreams(p string, ups *Upstreams, opts ...*ProxyOptions) *Route {
+	proxyOpts := &ProxyOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		o := *opts[0]
+		proxyOpts = &o
+	}
+
+	proxyOpts.Upstreams = ups
+
+	return b.ensureProxy("", p, proxyOpts)
 }
 
 func (b *Builder) IterRoutes() iter.Seq[*Route] {
@@ -178,6 +218,15 @@ func (b *Builder) IterRoutes() iter.Seq[*Route] {
 	}
 }
 
+// NOTE: Same as IterRoutes, but routes of mounted builders are expanded.
+// Expanded routes get mount path as prefix, mount and builder middlewares,
+// mount host and mount compression options unless they have their own.
+func (b *Builder) IterResolvedRoutes() iter.Seq[*Route] {
+	return func(yield func(*Route) bool) {
+		b.resolveRoutes(yield)
+	}
+}
+
 func (b *Builder) Extend(routes iter.Seq[*Route], prefixes ...string) error {
 	for route := range routes {
 		path := route.Path
@@ -190,22 +239,62 @@ func (b *Builder) Extend(routes iter.Seq[*Route], prefixes ...string) error {
 		var r *Route
 
 		switch {
-		case route.FileSystem != nil && len(route.FileName) > 0:
-			r = b.File(path, route.FileSystem, route.FileName)
 		case route.FileSystem != nil:
-			r = b.Files(path, route.FileSystem)
+			r = b.ensureFiles(route.Host, path, route.FileSystem, route.FileName)
+		case route.Proxy != nil:
+			r = b.ensureProxy(route.Host, path, route.Proxy)
+		case route.IsMount():
+			r = b.ensureMount(route.Host, path, route.HTTPHandler, route.Builder)
+			r.PrefixStripped = route.PrefixStripped
 		case route.Handler != nil:
-			r = b.Method(route.Method, path, route.Handler)
+			r = b.ensureRoute(route.Host, route.Method, path, route.Handler)
 		}
 
 		if r != nil {
 			r.CompressionOptions = route.CompressionOptions
+			r.Middlewares = slices.Clone(route.Middlewares)
 		}
 	}
 
 	return nil
 }
 
+func (b *Builder) resolveRoutes(yield func(*Route) bool) bool {
+	for route := range b.IterRoutes() {
+		if route.Builder == nil {
+			if !yield(route) {
+				return false
+			}
+
+			continue
+		}
+
+		for sub := range route.Builder.IterResolvedRoutes() {
+			r := *sub
+			r.Path = b.joinPathParts(route.Path, sub.Path)
+			r.Middlewares = slices.Concat(
+				route.Middlewares,
+				route.Builder.Middlewares,
+				sub.Middlewares,
+			)
+
+			if r.CompressionOptions == nil {
+				r.CompressionOptions = route.CompressionOptions
+			}
+
+			if len(route.Host) > 0 {
+				r.Host = route.Host
+			}
+
+			if !yield(&r) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
 func (b *Builder) joinPathParts(p, q string) string {
 	switch {
 	case strings.HasSuffix(p, "/"):
@@ -221,21 +310,22 @@ func (b *Builder) joinPathParts(p, q string) string {
 	}
 }
 
-func (b *Builder) ensureRoute(method, path string, h Handler) *Route {
+func (b *Builder) ensureRoute(host, method, path string, h Handler) *Route {
 	for i := range b.Routes {
 		route := &b.Routes[i]
 
-		if route.Method != method || route.Path != path {
+		if route.Host != host || route.Method != method || route.Path != path {
 			continue
 		}
 
-		route.FileSystem = nil
+		route.resetKind()
 		route.Handler = h
 
 		return route
 	}
 
 	b.Routes = append(b.Routes, Route{
+		Host:               host,
 		Method:             method,
 		Path:               path,
 		Handler:            h,
@@ -245,7 +335,7 @@ func (b *Builder) ensureRoute(method, path string, h Handler) *Route {
 	return &b.Routes[len(b.Routes)-1]
 }
 
-func (b *Builder) ensureFiles(path string, f fs.FS, fname ...string) *Route {
+func (b *Builder) ensureFiles(host, path string, f fs.FS, fname ...string) *Route {
 	fileName := ""
 	if len(fname) > 0 {
 		fileName = fname[0]
@@ -254,11 +344,11 @@ func (b *Builder) ensureFiles(path string, f fs.FS, fname ...string) *Route {
 	for i := range b.Routes {
 		route := &b.Routes[i]
 
-		if route.Path != path {
+		if route.Host != host || route.Path != path {
 			continue
 		}
 
-		route.Handler = nil
+		route.resetKind()
 		route.FileSystem = f
 		route.FileName = fileName
 
@@ -266,6 +356,7 @@ func (b *Builder) ensureFiles(path string, f fs.FS, fname ...string) *Route {
 	}
 
 	b.Routes = append(b.Routes, Route{
+		Host:               host,
 		Method:             http.MethodGet,
 		Path:               path,
 		FileSystem:         f,
@@ -275,3 +366,59 @@ func (b *Builder) ensureFiles(path string, f fs.FS, fname ...string) *Route {
 
 	return &b.Routes[len(b.Routes)-1]
 }
+
+func (b *Builder) ensureProxy(host, path string, opts *ProxyOptions) *Route {
+	for i := range b.Routes {
+		route := &b.Routes[i]
+
+		if route.Host != host || route.Path != path {
+			continue
+		}
+
+		route.resetKind()
+		route.Method = MethodAll
+		route.Proxy = opts
+
+		return route
+	}
+
+	b.Routes = append(b.Routes, Route{
+		Host:               host,
+		Method:             MethodAll,
+		Path:               path,
+		Proxy:              opts,
+		CompressionOptions: b.CompressionOptions,
+	})
+
+	return &b.Routes[len(b.Routes)-1]
+}
+
+func (b *Builder) ensureMount(host, path string, h http.Handler, sub *Builder) *Route {
+	for i := range b.Routes {
+		route := &b.Routes[i]
+
+		if route.Host != host || route.Path != path {
+			continue
+		}
+
+		route.resetKind()
+		route.Method = MethodAll
+		route.HTTPHandler = h
+		route.Builder = sub
+		route.PrefixStripped = h != nil
+
+		return route
+	}
+
+	b.Routes = append(b.Routes, Route{
+		Host:               host,
+		Method:             MethodAll,
+		Path:               path,
+		HTTPHandler:        h,
+		Builder:            sub,
+		PrefixStripped:     h != nil,
+		CompressionOptions: b.CompressionOptions,
+	})
+
+	return &b.Routes[len(b.Routes)-1]
+}
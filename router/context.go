@@ -19,6 +19,12 @@ type Request interface {
 	Revalidates(string) bool
 }
 
+// NOTE: Optional extension of Request, address of the immediate peer
+// without port, forwarding headers are not taken into account
+type RemoteAddrRequest interface {
+	RemoteAddr() string
+}
+
 type Response interface {
 	io.Writer
 	StringResponder
@@ -46,8 +52,25 @@ type JSONResponder interface {
 type RequestContext struct {
 	Request  Request
 	Response Response
+
+	values map[any]any
 }
 
 func (rctx *RequestContext) Context() context.Context {
 	return rctx.Request.Context()
 }
+
+// NOTE: Values live as long as the request context, so middlewares can pass
+// data to handlers they wrap. Keys follow context.WithValue conventions
+func (rctx *RequestContext) SetValue(key, val any) {
+	if rctx.values == nil {
+		rctx.values = map[any]any{}
+	}
+
+	rctx.values[key] = val
+}
+
+func (rctx *RequestContext) Value(key any) (any, bool) {
+	val, exists := rctx.values[key]
+	return val, exists
+}
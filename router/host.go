@@ -0,0 +1,124 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// NOTE: Host pattern consists of dot-separated labels, each being either
+// literal or `{name}` wildcard matching exactly one label, e.g.
+// `{tenant}.example.com`. Matching is case-insensitive.
+type HostPattern struct {
+	Pattern string
+	labels  []hostLabel
+}
+
+type hostLabel struct {
+	Text       string
+	ParamName  string
+	IsWildcard bool
+}
+
+type HostParam struct {
+	Name  string
+	Value string
+}
+
+func ParseHostPattern(pattern string) (*HostPattern, error) {
+	hp := &HostPattern{
+		Pattern: strings.ToLower(pattern),
+	}
+
+	if len(pattern) == 0 {
+		return nil, fmt.Errorf("host pattern is empty")
+	}
+
+	if strings.ContainsAny(pattern, "/ ") {
+		return nil, fmt.Errorf("host pattern '%s' contains invalid characters", pattern)
+	}
+
+	for label := range strings.SplitSeq(hp.Pattern, ".") {
+		switch {
+		case len(label) == 0:
+			return nil, fmt.Errorf("host pattern '%s' has empty label", pattern)
+		case strings.HasPrefix(label, "{") && strings.HasSuffix(label, "}"):
+			name := label[1 : len(label)-1]
+			if len(name) == 0 || strings.ContainsAny(name, "{}") {
+				return nil, fmt.Errorf("host pattern '%s' has invalid wildcard", pattern)
+			}
+
+			hp.labels = append(hp.labels, hostLabel{
+				ParamName:  name,
+				IsWildcard: true,
+			})
+		case strings.ContainsAny(label, "{}"):
+			return nil, fmt.Errorf("host pattern '%s': wildcard must be a whole label", pattern)
+		default:
+			hp.labels = append(hp.labels, hostLabel{
+				Text: label,
+			})
+		}
+	}
+
+	return hp, nil
+}
+
+func MustHostPattern(pattern string) *HostPattern {
+	hp, err := ParseHostPattern(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("Router: %s", err.Error()))
+	}
+
+	return hp
+}
+
+func (hp *HostPattern) IsLiteral() bool {
+	for _, l := range hp.labels {
+		if l.IsWildcard {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NOTE: Host is expected to be without port, see RequestHost
+func (hp *HostPattern) Match(host string) ([]HostParam, bool) {
+	labels := strings.Split(strings.ToLower(host), ".")
+	if len(labels) != len(hp.labels) {
+		return nil, false
+	}
+
+	params := []HostParam{}
+
+	for i, l := range hp.labels {
+		switch {
+		case l.IsWildcard && len(labels[i]) > 0:
+			params = append(params, HostParam{
+				Name:  l.ParamName,
+				Value: labels[i],
+			})
+		case l.IsWildcard:
+			return nil, false
+		case l.Text != labels[i]:
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+func RequestHost(r *http.Request) string {
+	host := r.Host
+	if len(host) == 0 && r.URL != nil {
+		host = r.URL.Host
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
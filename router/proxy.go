@@ -0,0 +1,260 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yandzee/go-svc/log"
+)
+
+const (
+	DefaultHealthCheckInterval = 10 * time.Second
+	DefaultHealthCheckTimeout  = 2 * time.Second
+)
+
+var ErrNoHealthyUpstream = errors.New("no healthy upstream")
+
+type ProxyOptions struct {
+	Upstreams *Upstreams
+
+	// NOTE: Route path is removed from request path before it is joined
+	// with upstream url path
+	PrefixStripped bool
+	RewritePath    func(string) string
+
+	// NOTE: Host header of incoming request is passed as is when set,
+	// otherwise upstream host is used
+	HostPreserved bool
+
+	RequestHeaders  HeaderRules
+	ResponseHeaders HeaderRules
+
+	XForwardedDisabled       bool
+	ForwardedEnabled         bool
+	IncomingForwardedTrusted bool
+
+	DialTimeout           time.Duration
+	ResponseHeaderTimeout time.Duration
+
+	// NOTE: Negative value means flushing after each write, which is what
+	// streaming responses (SSE, chunked) usually want
+	FlushInterval time.Duration
+
+	Transport http.RoundTripper
+	Log       *slog.Logger
+}
+
+type HeaderRules struct {
+	Set    http.Header
+	Add    http.Header
+	Remove []string
+}
+
+type Upstreams struct {
+	Targets     []*Upstream
+	HealthCheck *HealthCheckOptions
+
+	next atomic.Uint64
+}
+
+type Upstream struct {
+	URL *url.URL
+
+	unhealthy atomic.Bool
+}
+
+type HealthCheckOptions struct {
+	Path     string
+	Interval time.Duration
+	Timeout  time.Duration
+	Client   *http.Client
+	Log      *slog.Logger
+
+	// NOTE: Any 2xx or 3xx status is considered healthy if not set
+	IsHealthy func(*http.Response) bool
+}
+
+func NewUpstreams(targets ...string) (*Upstreams, error) {
+	ups := &Upstreams{
+		Targets: make([]*Upstream, 0, len(targets)),
+	}
+
+	for _, target := range targets {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, errors.Join(
+				fmt.Errorf("invalid upstream url '%s'", target),
+				err,
+			)
+		}
+
+		if len(u.Scheme) == 0 || len(u.Host) == 0 {
+			return nil, fmt.Errorf("upstream url '%s' must be absolute", target)
+		}
+
+		ups.Targets = append(ups.Targets, &Upstream{
+			URL: u,
+		})
+	}
+
+	if len(ups.Targets) == 0 {
+		return nil, errors.New("at least one upstream target is required")
+	}
+
+	return ups, nil
+}
+
+func MustUpstreams(targets ...string) *Upstreams {
+	ups, err := NewUpstreams(targets...)
+	if err != nil {
+		panic(fmt.Sprintf("Router: %s", err.Error()))
+	}
+
+	return ups
+}
+
+// NOTE: Round robin over healthy targets
+func (u *Upstreams) Next() (*Upstream, error) {
+	n := uint64(len(u.Targets))
+	if n == 0 {
+		return nil, ErrNoHealthyUpstream
+	}
+
+	start := u.next.Add(1) - 1
+
+	for i := range n {
+		target := u.Targets[(start+i)%n]
+
+		if target.IsHealthy() {
+			return target, nil
+		}
+	}
+
+	return nil, ErrNoHealthyUpstream
+}
+
+// Implements lifecycle.Runnable, performs periodic health checks of all
+// targets until context is done
+func (u *Upstreams) Run(ctx context.Context) error {
+	if u.HealthCheck == nil {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	interval := u.HealthCheck.Interval
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		u.CheckHealth(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (u *Upstreams) CheckHealth(ctx context.Context) {
+	if u.HealthCheck == nil {
+		return
+	}
+
+	wg := sync.WaitGroup{}
+
+	for _, target := range u.Targets {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			healthy := u.HealthCheck.check(ctx, target.URL)
+			wasHealthy := !target.unhealthy.Swap(!healthy)
+
+			if wasHealthy != healthy {
+				u.HealthCheck.log().Warn(
+					"upstream health changed",
+					"upstream", target.URL.String(),
+					"healthy", healthy,
+				)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (u *Upstream) IsHealthy() bool {
+	return !u.unhealthy.Load()
+}
+
+func (u *Upstream) SetHealthy(healthy bool) {
+	u.unhealthy.Store(!healthy)
+}
+
+func (hc *HealthCheckOptions) check(ctx context.Context, target *url.URL) bool {
+	timeout := hc.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	checkURL := target.JoinPath(hc.Path)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkURL.String(), nil)
+	if err != nil {
+		return false
+	}
+
+	client := hc.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+
+	defer resp.Body.Close()
+
+	if hc.IsHealthy != nil {
+		return hc.IsHealthy(resp)
+	}
+
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
+
+func (hc *HealthCheckOptions) log() *slog.Logger {
+	return log.OrDiscard(hc.Log)
+}
+
+func (hr *HeaderRules) Apply(h http.Header) {
+	for _, name := range hr.Remove {
+		h.Del(name)
+	}
+
+	for name, values := range hr.Set {
+		h[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+	}
+
+	for name, values := range hr.Add {
+		for _, v := range values {
+			h.Add(name, v)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package radixrouter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type ConstraintFn func(string) bool
+
+// NOTE: Constraints referenced by name in patterns, e.g. `{id:uuid}`,
+// anything else after the colon is treated as regular expression
+var Constraints = map[string]ConstraintFn{
+	"int": func(s string) bool {
+		_, err := strconv.ParseInt(s, 10, 64)
+		return err == nil
+	},
+	"uint": func(s string) bool {
+		_, err := strconv.ParseUint(s, 10, 64)
+		return err == nil
+	},
+	"uuid": func(s string) bool {
+		return uuidRegexp.MatchString(s)
+	},
+	"alpha": func(s string) bool {
+		return isEvery(s, unicode.IsLetter)
+	},
+	"alnum": func(s string) bool {
+		return isEvery(s, func(r rune) bool {
+			return unicode.IsLetter(r) || unicode.IsDigit(r)
+		})
+	},
+}
+
+var uuidRegexp = regexp.MustCompile(
+	`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`,
+)
+
+type partKind int
+
+const (
+	staticPart partKind = iota
+	paramPart
+	catchAllPart
+)
+
+type patternPart struct {
+	Kind       partKind
+	Text       string
+	Name       string
+	Constraint string
+	Match      ConstraintFn
+}
+
+// NOTE: Syntax follows http.ServeMux patterns: `{name}` matches a whole
+// segment, `{name...}` matches the remainder, trailing slash matches a
+// subtree and `{$}` anchors it. Constraints are added with a colon.
+func parsePattern(pattern string) ([]patternPart, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("pattern '%s' must start with '/'", pattern)
+	}
+
+	parts := []patternPart{}
+	static := strings.Builder{}
+
+	flushStatic := func() {
+		if static.Len() > 0 {
+			parts = append(parts, patternPart{
+				Kind: staticPart,
+				Text: static.String(),
+			})
+
+			static.Reset()
+		}
+	}
+
+	for i := 0; i < len(pattern); {
+		if pattern[i] != '{' {
+			static.WriteByte(pattern[i])
+			i += 1
+			continue
+		}
+
+		end := closingBrace(pattern, i)
+		if end < 0 {
+			return nil, fmt.Errorf("pattern '%s' has unclosed '{'", pattern)
+		}
+
+		if pattern[i-1] != '/' || (end+1 < len(pattern) && pattern[end+1] != '/') {
+			return nil, fmt.Errorf("pattern '%s': wildcard must be a whole segment", pattern)
+		}
+
+		part, err := parseWildcard(pattern[i+1 : end])
+		if err != nil {
+			return nil, fmt.Errorf("pattern '%s': %w", pattern, err)
+		}
+
+		i = end + 1
+
+		if part == nil {
+			// NOTE: `{$}` anchor
+			if i != len(pattern) {
+				return nil, fmt.Errorf("pattern '%s': {$} must be at the end", pattern)
+			}
+
+			flushStatic()
+			return parts, nil
+		}
+
+		if part.Kind == catchAllPart && i != len(pattern) {
+			return nil, fmt.Errorf("pattern '%s': catch-all must be at the end", pattern)
+		}
+
+		flushStatic()
+		parts = append(parts, *part)
+	}
+
+	flushStatic()
+
+	if strings.HasSuffix(pattern, "/") {
+		parts = append(parts, patternPart{
+			Kind: catchAllPart,
+		})
+	}
+
+	return parts, nil
+}
+
+func parseWildcard(inner string) (*patternPart, error) {
+	if inner == "$" {
+		return nil, nil
+	}
+
+	name, constraint, hasConstraint := strings.Cut(inner, ":")
+
+	if strings.HasSuffix(name, "...") && !hasConstraint {
+		return &patternPart{
+			Kind: catchAllPart,
+			Name: strings.TrimSuffix(name, "..."),
+		}, nil
+	}
+
+	if len(name) == 0 {
+		return nil, fmt.Errorf("wildcard '{%s}' has no name", inner)
+	}
+
+	part := &patternPart{
+		Kind:       paramPart,
+		Name:       name,
+		Constraint: constraint,
+	}
+
+	if !hasConstraint {
+		return part, nil
+	}
+
+	if fn, ok := Constraints[constraint]; ok {
+		part.Match = fn
+		return part, nil
+	}
+
+	re, err := regexp.Compile("^(?:" + constraint + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid constraint of '{%s}': %w", inner, err)
+	}
+
+	part.Match = re.MatchString
+	return part, nil
+}
+
+// NOTE: Regular expression constraints may contain braces themselves
+func closingBrace(s string, open int) int {
+	depth := 0
+
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth += 1
+		case '}':
+			depth -= 1
+
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+func isEvery(s string, fn func(rune) bool) bool {
+	for _, r := range s {
+		if !fn(r) {
+			return false
+		}
+	}
+
+	return len(s) > 0
+}
+
+// NOTE: Byte length is preserved, so offsets in lowered string are valid
+// for the original one
+func lowerASCII(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= 'A' && c <= 'Z' {
+			b := []byte(s)
+
+			for j := i; j < len(b); j++ {
+				if c := b[j]; c >= 'A' && c <= 'Z' {
+					b[j] = c + ('a' - 'A')
+				}
+			}
+
+			return string(b)
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,255 @@
+package radixrouter
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/yandzee/go-svc/router"
+	stdrouter "github.com/yandzee/go-svc/router/std"
+)
+
+type TrailingSlashPolicy int
+
+const (
+	// NOTE: Request is redirected to the path with trailing slash added or
+	// removed if only that one matches
+	TrailingSlashRedirect TrailingSlashPolicy = iota
+	TrailingSlashStrict
+	TrailingSlashIgnore
+)
+
+type Options struct {
+	TrailingSlash     TrailingSlashPolicy
+	IsCaseInsensitive bool
+
+	NotFound         router.Handler
+	MethodNotAllowed router.Handler
+}
+
+type radixRouter struct {
+	root          node
+	hosts         map[string]*node
+	wildcardHosts []*hostTree
+	options       Options
+
+	notFound         http.Handler
+	methodNotAllowed http.Handler
+}
+
+type hostTree struct {
+	Pattern *router.HostPattern
+	Root    *node
+}
+
+func Build(b *router.Builder, opts ...Options) http.Handler {
+	h, err := TryBuild(b, opts...)
+	if err != nil {
+		panic(fmt.Sprintf("Router: %s", err.Error()))
+	}
+
+	return h
+}
+
+func TryBuild(b *router.Builder, opts ...Options) (http.Handler, error) {
+	rr := &radixRouter{
+		hosts:            map[string]*node{},
+		notFound:         http.NotFoundHandler(),
+		methodNotAllowed: http.HandlerFunc(methodNotAllowed),
+	}
+
+	if len(opts) > 0 {
+		rr.options = opts[0]
+	}
+
+	if h := rr.options.NotFound; h != nil {
+		rr.notFound = stdrouter.WrapHandler(h)
+	}
+
+	if h := rr.options.MethodNotAllowed; h != nil {
+		rr.methodNotAllowed = stdrouter.WrapHandler(h)
+	}
+
+	for route := range b.IterResolvedRoutes() {
+		root, err := rr.hostRoot(route.Host)
+		if err != nil {
+			return nil, err
+		}
+
+		h := stdrouter.RouteHandler(b, route)
+
+		err = root.insert(route.Path, route.Method, h, rr.options.IsCaseInsensitive)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stdrouter.WrapCORS(b, rr), nil
+}
+
+func (rr *radixRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Path
+
+	if r.Method != http.MethodConnect {
+		if cleaned := cleanPath(p); cleaned != p {
+			rr.redirect(w, r, cleaned)
+			return
+		}
+	}
+
+	host := router.RequestHost(r)
+	ep, params := rr.lookup(host, p)
+
+	if ep == nil && rr.options.TrailingSlash != TrailingSlashStrict && p != "/" {
+		toggled := toggleTrailingSlash(p)
+
+		if alt, altParams := rr.lookup(host, toggled); alt != nil {
+			if rr.options.TrailingSlash == TrailingSlashRedirect {
+				rr.redirect(w, r, toggled)
+				return
+			}
+
+			ep, params = alt, altParams
+		}
+	}
+
+	if ep == nil {
+		rr.notFound.ServeHTTP(w, r)
+		return
+	}
+
+	h, ok := ep.handler(r.Method)
+	if !ok {
+		w.Header().Set("Allow", ep.allowed())
+		rr.methodNotAllowed.ServeHTTP(w, r)
+		return
+	}
+
+	for _, param := range params {
+		r.SetPathValue(param.Name, param.Value)
+	}
+
+	r.Pattern = ep.Pattern
+	h.ServeHTTP(w, r)
+}
+
+// NOTE: Literal host routes have priority over wildcard host ones, which
+// in turn have priority over routes without host
+func (rr *radixRouter) lookup(host, p string) (*endpoint, []pathParam) {
+	st := matchState{
+		Lowered:  p,
+		Original: p,
+	}
+
+	if rr.options.IsCaseInsensitive {
+		st.Lowered = lowerASCII(p)
+	}
+
+	if root, ok := rr.hosts[host]; ok {
+		if ep := root.match(&st, 0); ep != nil {
+			return ep, st.Params
+		}
+	}
+
+	for _, ht := range rr.wildcardHosts {
+		hostParams, ok := ht.Pattern.Match(host)
+		if !ok {
+			continue
+		}
+
+		st.Params = st.Params[:0]
+		for _, hp := range hostParams {
+			st.Params = append(st.Params, pathParam{
+				Name:  hp.Name,
+				Value: hp.Value,
+			})
+		}
+
+		if ep := ht.Root.match(&st, 0); ep != nil {
+			return ep, st.Params
+		}
+	}
+
+	st.Params = st.Params[:0]
+
+	ep := rr.root.match(&st, 0)
+	return ep, st.Params
+}
+
+func (rr *radixRouter) hostRoot(host string) (*node, error) {
+	if len(host) == 0 {
+		return &rr.root, nil
+	}
+
+	hp, err := router.ParseHostPattern(host)
+	if err != nil {
+		return nil, err
+	}
+
+	if hp.IsLiteral() {
+		root, ok := rr.hosts[hp.Pattern]
+		if !ok {
+			root = &node{}
+			rr.hosts[hp.Pattern] = root
+		}
+
+		return root, nil
+	}
+
+	for _, ht := range rr.wildcardHosts {
+		if ht.Pattern.Pattern == hp.Pattern {
+			return ht.Root, nil
+		}
+	}
+
+	ht := &hostTree{
+		Pattern: hp,
+		Root:    &node{},
+	}
+
+	rr.wildcardHosts = append(rr.wildcardHosts, ht)
+	return ht.Root, nil
+}
+
+func (rr *radixRouter) redirect(w http.ResponseWriter, r *http.Request, to string) {
+	code := http.StatusMovedPermanently
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		code = http.StatusPermanentRedirect
+	}
+
+	u := *r.URL
+	u.Path = to
+	u.RawPath = ""
+
+	http.Redirect(w, r, u.String(), code)
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+func cleanPath(p string) string {
+	if len(p) == 0 {
+		return "/"
+	}
+
+	if p[0] != '/' {
+		p = "/" + p
+	}
+
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+
+	return cleaned
+}
+
+func toggleTrailingSlash(p string) string {
+	if strings.HasSuffix(p, "/") {
+		return strings.TrimSuffix(p, "/")
+	}
+
+	return p + "/"
+}
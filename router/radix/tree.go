@@ -0,0 +1,273 @@
+package radixrouter
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/yandzee/go-svc/router"
+)
+
+type node struct {
+	prefix   string
+	children []*node
+	params   []*paramEdge
+	catchAll *catchAllEdge
+	endpoint *endpoint
+}
+
+type paramEdge struct {
+	Name       string
+	Constraint string
+	Match      ConstraintFn
+	Child      *node
+}
+
+type catchAllEdge struct {
+	Name     string
+	Endpoint *endpoint
+}
+
+type endpoint struct {
+	Pattern  string
+	Handlers map[string]http.Handler
+}
+
+type pathParam struct {
+	Name  string
+	Value string
+}
+
+type matchState struct {
+	Lowered  string
+	Original string
+	Params   []pathParam
+}
+
+func (n *node) insert(pattern, method string, h http.Handler, isCaseInsensitive bool) error {
+	parts, err := parsePattern(pattern)
+	if err != nil {
+		return err
+	}
+
+	current := n
+
+	for _, part := range parts {
+		switch part.Kind {
+		case staticPart:
+			text := part.Text
+			if isCaseInsensitive {
+				text = lowerASCII(text)
+			}
+
+			current = current.insertStatic(text)
+		case paramPart:
+			current = current.insertParam(&part)
+		case catchAllPart:
+			if current.catchAll == nil {
+				current.catchAll = &catchAllEdge{
+					Name:     part.Name,
+					Endpoint: &endpoint{Pattern: pattern},
+				}
+			} else if current.catchAll.Name != part.Name {
+				return fmt.Errorf(
+					"pattern '%s' conflicts with '%s'",
+					pattern,
+					current.catchAll.Endpoint.Pattern,
+				)
+			}
+
+			return current.catchAll.Endpoint.add(method, h)
+		}
+	}
+
+	if current.endpoint == nil {
+		current.endpoint = &endpoint{Pattern: pattern}
+	}
+
+	return current.endpoint.add(method, h)
+}
+
+func (n *node) insertStatic(text string) *node {
+	if len(text) == 0 {
+		return n
+	}
+
+	for _, child := range n.children {
+		common := commonPrefixLen(child.prefix, text)
+		if common == 0 {
+			continue
+		}
+
+		if common < len(child.prefix) {
+			child.split(common)
+		}
+
+		return child.insertStatic(text[common:])
+	}
+
+	child := &node{
+		prefix: text,
+	}
+
+	n.children = append(n.children, child)
+	return child
+}
+
+func (n *node) split(at int) {
+	tail := &node{
+		prefix:   n.prefix[at:],
+		children: n.children,
+		params:   n.params,
+		catchAll: n.catchAll,
+		endpoint: n.endpoint,
+	}
+
+	n.prefix = n.prefix[:at]
+	n.children = []*node{tail}
+	n.params = nil
+	n.catchAll = nil
+	n.endpoint = nil
+}
+
+func (n *node) insertParam(part *patternPart) *node {
+	for _, edge := range n.params {
+		if edge.Name == part.Name && edge.Constraint == part.Constraint {
+			return edge.Child
+		}
+	}
+
+	edge := &paramEdge{
+		Name:       part.Name,
+		Constraint: part.Constraint,
+		Match:      part.Match,
+		Child:      &node{},
+	}
+
+	n.params = append(n.params, edge)
+
+	// NOTE: Constrained params are tried before unconstrained ones
+	sort.SliceStable(n.params, func(i, j int) bool {
+		return n.params[i].Match != nil && n.params[j].Match == nil
+	})
+
+	return edge.Child
+}
+
+// NOTE: Static edges have priority over params, params over catch-alls.
+// Offset is a position in the path right after the prefix of the node.
+func (n *node) match(st *matchState, offset int) *endpoint {
+	rest := st.Lowered[offset:]
+
+	if len(rest) == 0 && n.endpoint != nil {
+		return n.endpoint
+	}
+
+	for _, child := range n.children {
+		if !strings.HasPrefix(rest, child.prefix) {
+			continue
+		}
+
+		if ep := child.match(st, offset+len(child.prefix)); ep != nil {
+			return ep
+		}
+	}
+
+	if seglen := strings.IndexByte(rest, '/'); seglen != 0 && len(rest) > 0 {
+		if seglen < 0 {
+			seglen = len(rest)
+		}
+
+		segment := st.Original[offset : offset+seglen]
+
+		for _, edge := range n.params {
+			if edge.Match != nil && !edge.Match(segment) {
+				continue
+			}
+
+			st.Params = append(st.Params, pathParam{
+				Name:  edge.Name,
+				Value: segment,
+			})
+
+			if ep := edge.Child.match(st, offset+seglen); ep != nil {
+				return ep
+			}
+
+			st.Params = st.Params[:len(st.Params)-1]
+		}
+	}
+
+	if n.catchAll != nil {
+		if len(n.catchAll.Name) > 0 {
+			st.Params = append(st.Params, pathParam{
+				Name:  n.catchAll.Name,
+				Value: st.Original[offset:],
+			})
+		}
+
+		return n.catchAll.Endpoint
+	}
+
+	return nil
+}
+
+func (ep *endpoint) add(method string, h http.Handler) error {
+	if ep.Handlers == nil {
+		ep.Handlers = map[string]http.Handler{}
+	}
+
+	if _, exists := ep.Handlers[method]; exists {
+		return fmt.Errorf("pattern '%s' is registered twice for method '%s'", ep.Pattern, method)
+	}
+
+	ep.Handlers[method] = h
+	return nil
+}
+
+// NOTE: HEAD requests are served by GET handlers unless registered explicitly
+func (ep *endpoint) handler(method string) (http.Handler, bool) {
+	if h, ok := ep.Handlers[method]; ok {
+		return h, true
+	}
+
+	if method == http.MethodHead {
+		if h, ok := ep.Handlers[http.MethodGet]; ok {
+			return h, true
+		}
+	}
+
+	h, ok := ep.Handlers[router.MethodAll]
+	return h, ok
+}
+
+func (ep *endpoint) allowed() string {
+	methods := []string{}
+
+	for method := range ep.Handlers {
+		if method != router.MethodAll {
+			methods = append(methods, method)
+		}
+	}
+
+	if slices.Contains(methods, http.MethodGet) && !slices.Contains(methods, http.MethodHead) {
+		methods = append(methods, http.MethodHead)
+	}
+
+	slices.Sort(methods)
+	return strings.Join(methods, ", ")
+}
+
+func commonPrefixLen(a, b string) int {
+	n := min(len(a), len(b))
+
+	for i := range n {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+
+	return n
+}
@@ -2,10 +2,13 @@ package router
 
 import (
 	"io/fs"
+	"net/http"
 )
 
 type Handler func(*RequestContext)
 
+type Middleware func(Handler) Handler
+
 type ZstdCompressionLevel int
 
 const (
@@ -16,12 +19,23 @@ const (
 )
 
 type Route struct {
+	// NOTE: Optional host pattern, see HostPattern
+	Host string
+
 	Method     string
 	Path       string
 	Handler    Handler
 	FileSystem fs.FS
 	FileName   string
+	Proxy      *ProxyOptions
+
+	// NOTE: Mounted http.Handler or Builder, the latter is resolved lazily
+	// when router is being built
+	HTTPHandler    http.Handler
+	Builder        *Builder
+	PrefixStripped bool
 
+	Middlewares        []Middleware
 	CompressionOptions *CompressionOptions
 }
 
@@ -45,3 +59,43 @@ func (r *Route) Compression(enabled bool, opts ...*CompressionOptions) *Route {
 
 	return r
 }
+
+// NOTE: Routes are identified by host too, so routes with the same path
+// but different hosts should be registered via Builder.Host
+func (r *Route) ForHost(host string) *Route {
+	r.Host = host
+	return r
+}
+
+func (r *Route) StripPrefix(enabled bool) *Route {
+	r.PrefixStripped = enabled
+	return r
+}
+
+func (r *Route) Use(mws ...Middleware) *Route {
+	r.Middlewares = append(r.Middlewares, mws...)
+	return r
+}
+
+func (r *Route) IsMount() bool {
+	return r.HTTPHandler != nil || r.Builder != nil
+}
+
+func (r *Route) resetKind() {
+	r.Handler = nil
+	r.FileSystem = nil
+	r.FileName = ""
+	r.Proxy = nil
+	r.HTTPHandler = nil
+	r.Builder = nil
+	r.PrefixStripped = false
+}
+
+// NOTE: First middleware is the outermost one
+func Chain(h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+
+	return h
+}
@@ -0,0 +1,72 @@
+package routertest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yandzee/go-svc/router"
+)
+
+const allowedOrigin = "http://allowed.example.com"
+
+func testCORS(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	r.CORS(true, router.CORSOptions{
+		AllowedOrigins: []string{allowedOrigin},
+		AllowedMethods: []string{http.MethodGet, http.MethodPut},
+		AllowedHeaders: []string{"X-Custom"},
+	})
+
+	r.Put("/cors", func(rctx *router.RequestContext) {
+		rctx.Response.String(http.StatusOK)
+	})
+
+	handler := build(&r)
+
+	preflight := httptest.NewRequest(http.MethodOptions, "/cors", nil)
+	preflight.Header.Set("Origin", allowedOrigin)
+	preflight.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	preflight.Header.Set("Access-Control-Request-Headers", "x-custom")
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, preflight)
+
+	if resp.Code >= 300 {
+		t.Fatalf("expected successful preflight, got %d", resp.Code)
+	}
+
+	if o := resp.Header().Get("Access-Control-Allow-Origin"); o != allowedOrigin {
+		t.Fatalf("expected preflight to allow origin, got %q", o)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/cors", nil)
+	req.Header.Set("Origin", "http://denied.example.com")
+	resp = httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	if o := resp.Header().Get("Access-Control-Allow-Origin"); o != "" {
+		t.Fatalf("expected no CORS headers for denied origin, got %q", o)
+	}
+}
+
+func testCORSDisabled(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	r.CORS(true)
+	r.CORS(false)
+
+	r.Get("/cors", func(rctx *router.RequestContext) {
+		rctx.Response.String(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/cors", nil)
+	req.Header.Set("Origin", allowedOrigin)
+	resp := httptest.NewRecorder()
+
+	build(&r).ServeHTTP(resp, req)
+
+	if o := resp.Header().Get("Access-Control-Allow-Origin"); o != "" {
+		t.Fatalf("expected no CORS headers when disabled, got %q", o)
+	}
+}
@@ -0,0 +1,103 @@
+package routertest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/yandzee/go-svc/router"
+)
+
+func testNotFound(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	r.Get("/exists", func(rctx *router.RequestContext) {
+		rctx.Response.String(http.StatusOK)
+	})
+
+	handler := build(&r)
+
+	for _, path := range []string{"/missing", "/exists/more", "/"} {
+		if resp := serve(handler, http.MethodGet, path); resp.Code != http.StatusNotFound {
+			t.Fatalf("%s: expected status 404, got %d", path, resp.Code)
+		}
+	}
+}
+
+func testMethodNotAllowed(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	r.Get("/resource", func(rctx *router.RequestContext) {
+		rctx.Response.String(http.StatusOK)
+	})
+
+	resp := serve(build(&r), http.MethodDelete, "/resource")
+
+	if resp.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", resp.Code)
+	}
+
+	if allow := resp.Header().Get("Allow"); !strings.Contains(allow, http.MethodGet) {
+		t.Fatalf("expected Allow header to contain GET, got %q", allow)
+	}
+}
+
+func testErrorResponses(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	r.Get("/string", func(rctx *router.RequestContext) {
+		rctx.Response.String(http.StatusBadRequest, "bad input")
+	})
+
+	r.Get("/stringf", func(rctx *router.RequestContext) {
+		rctx.Response.Stringf(http.StatusConflict, "conflict on %s", "item")
+	})
+
+	handler := build(&r)
+
+	for path, expected := range map[string]struct {
+		Status int
+		Body   string
+	}{
+		"/string":  {http.StatusBadRequest, "bad input\n"},
+		"/stringf": {http.StatusConflict, "conflict on item\n"},
+	} {
+		resp := serve(handler, http.MethodGet, path)
+
+		if resp.Code != expected.Status {
+			t.Fatalf("%s: expected status %d, got %d", path, expected.Status, resp.Code)
+		}
+
+		if body := resp.Body.String(); body != expected.Body {
+			t.Fatalf("%s: expected body %q, got %q", path, expected.Body, body)
+		}
+
+		if ct := resp.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Fatalf("%s: expected text/plain error, got %q", path, ct)
+		}
+	}
+}
+
+func testJSONResponse(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	r.Get("/json", func(rctx *router.RequestContext) {
+		_, _ = rctx.Response.JSON(http.StatusAccepted, map[string]int{"n": 1})
+	})
+
+	resp := serve(build(&r), http.MethodGet, "/json")
+
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d", resp.Code)
+	}
+
+	if ct := resp.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected application/json, got %q", ct)
+	}
+
+	body := resp.Body.String()
+	if body != "{\"n\":1}\n" {
+		t.Fatalf("unexpected JSON body %q", body)
+	}
+
+	if cl := resp.Header().Get("Content-Length"); cl != strconv.Itoa(len(body)) {
+		t.Fatalf("expected Content-Length %d, got %q", len(body), cl)
+	}
+}
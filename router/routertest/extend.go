@@ -0,0 +1,64 @@
+package routertest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/yandzee/go-svc/router"
+)
+
+func testExtendPrefixJoining(t *testing.T, build BuildFn) {
+	for _, tc := range []struct {
+		Prefix string
+		Path   string
+		URL    string
+	}{
+		{Prefix: "/p", Path: "/x", URL: "/p/x"},
+		{Prefix: "/p/", Path: "/x", URL: "/p/x"},
+		{Prefix: "/p/", Path: "x", URL: "/p/x"},
+		{Prefix: "/p", Path: "x", URL: "/p/x"},
+	} {
+		r := router.NewBuilder()
+		ext := router.NewBuilder()
+
+		ext.Get(tc.Path, func(rctx *router.RequestContext) {
+			rctx.Response.String(http.StatusOK)
+		})
+
+		if err := r.Extend(ext.IterRoutes(), tc.Prefix); err != nil {
+			t.Fatalf("Failed to extend routes: %s", err.Error())
+		}
+
+		if resp := serve(build(&r), http.MethodGet, tc.URL); resp.Code != http.StatusOK {
+			t.Fatalf(
+				"prefix %q and path %q: expected %q to be served, got %d",
+				tc.Prefix, tc.Path, tc.URL, resp.Code,
+			)
+		}
+	}
+}
+
+func testRouteOverride(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	ext := router.NewBuilder()
+
+	r.Get("/route", func(rctx *router.RequestContext) {
+		rctx.Response.String(http.StatusOK, "first")
+	})
+
+	ext.Get("/route", func(rctx *router.RequestContext) {
+		rctx.Response.String(http.StatusOK, "second")
+	})
+
+	if err := r.Extend(ext.IterRoutes()); err != nil {
+		t.Fatalf("Failed to extend routes: %s", err.Error())
+	}
+
+	if n := len(r.Routes); n != 1 {
+		t.Fatalf("expected route to be replaced, got %d routes", n)
+	}
+
+	if body := serve(build(&r), http.MethodGet, "/route").Body.String(); body != "second\n" {
+		t.Fatalf("expected overriding handler to be served, got %q", body)
+	}
+}
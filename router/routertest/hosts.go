@@ -0,0 +1,73 @@
+package routertest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yandzee/go-svc/router"
+)
+
+func testHostRouting(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+
+	r.Get("/whoami", func(rctx *router.RequestContext) {
+		rctx.Response.Stringf(http.StatusOK, "default")
+	})
+
+	api := router.NewBuilder()
+	api.Get("/whoami", func(rctx *router.RequestContext) {
+		rctx.Response.Stringf(http.StatusOK, "api")
+	})
+
+	r.Host("api.example.com", &api)
+
+	r.Get("/status", func(rctx *router.RequestContext) {
+		rctx.Response.Stringf(http.StatusOK, "status")
+	}).ForHost("status.example.com")
+
+	tenants := router.NewBuilder()
+	tenants.Get("/whoami", func(rctx *router.RequestContext) {
+		tenant, _ := rctx.Request.PathParam("tenant")
+		rctx.Response.Stringf(http.StatusOK, "tenant:%s", tenant)
+	})
+
+	tenants.Get("/only-tenants", func(rctx *router.RequestContext) {
+		rctx.Response.Stringf(http.StatusOK, "tenants only")
+	})
+
+	r.Host("{tenant}.example.com", &tenants)
+
+	handler := build(&r)
+
+	for _, tc := range []struct {
+		Host     string
+		Path     string
+		Status   int
+		Expected string
+	}{
+		{"api.example.com", "/whoami", http.StatusOK, "api"},
+		{"API.example.com:8080", "/whoami", http.StatusOK, "api"},
+		{"acme.example.com", "/whoami", http.StatusOK, "tenant:acme"},
+		{"acme.example.com:8443", "/only-tenants", http.StatusOK, "tenants only"},
+		{"other.org", "/whoami", http.StatusOK, "default"},
+		{"a.b.example.com", "/whoami", http.StatusOK, "default"},
+		{"other.org", "/only-tenants", http.StatusNotFound, ""},
+		{"status.example.com", "/status", http.StatusOK, "status"},
+		{"other.org", "/status", http.StatusNotFound, ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.Path, nil)
+		req.Host = tc.Host
+		resp := httptest.NewRecorder()
+
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != tc.Status {
+			t.Fatalf("%s%s: expected status %d, got %d", tc.Host, tc.Path, tc.Status, resp.Code)
+		}
+
+		if body := resp.Body.String(); len(tc.Expected) > 0 && body != tc.Expected {
+			t.Fatalf("%s%s: expected %q, got %q", tc.Host, tc.Path, tc.Expected, body)
+		}
+	}
+}
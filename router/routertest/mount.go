@@ -0,0 +1,214 @@
+package routertest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yandzee/go-svc/router"
+)
+
+const (
+	mountURL    = "/mounted/"
+	subBuilder  = "/sub"
+	traceHeader = "X-Trace"
+)
+
+func testMountHTTPHandler(t *testing.T, build BuildFn) {
+	for _, tc := range []struct {
+		PrefixStripped bool
+		ExpectedPath   string
+	}{
+		{PrefixStripped: true, ExpectedPath: "/a/b"},
+		{PrefixStripped: false, ExpectedPath: mountURL + "a/b"},
+	} {
+		r := router.NewBuilder()
+		r.Mount(mountURL, pathEchoHandler()).StripPrefix(tc.PrefixStripped)
+
+		resp := serve(build(&r), http.MethodGet, mountURL+"a/b")
+
+		if s := resp.Body.String(); s != tc.ExpectedPath {
+			t.Fatalf("expected mounted handler to see path %q, got %q", tc.ExpectedPath, s)
+		}
+	}
+}
+
+func testMountBuilderLazily(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	sub := router.NewBuilder()
+
+	r.MountBuilder(subBuilder, &sub)
+
+	// NOTE: Routes added after mount must still be resolved
+	sub.Get("/late", func(rctx *router.RequestContext) {
+		rctx.Response.String(http.StatusOK, "late")
+	})
+
+	nested := router.NewBuilder()
+	nested.Post("/deep", func(rctx *router.RequestContext) {
+		rctx.Response.String(http.StatusCreated)
+	})
+
+	sub.MountBuilder("/nested", &nested)
+
+	handler := build(&r)
+
+	if resp := serve(handler, http.MethodGet, subBuilder+"/late"); resp.Code != http.StatusOK {
+		t.Fatalf("expected 200 for route of mounted builder, got %d", resp.Code)
+	}
+
+	if resp := serve(handler, http.MethodPost, subBuilder+"/nested/deep"); resp.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for route of nested builder, got %d", resp.Code)
+	}
+
+	if resp := serve(handler, http.MethodGet, subBuilder+"/nested/deep"); resp.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for wrong method of nested route, got %d", resp.Code)
+	}
+}
+
+func testMountMiddlewares(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	r.Use(traceMiddleware("builder"))
+
+	r.Get(baseURL, func(rctx *router.RequestContext) {
+		rctx.Response.String(http.StatusOK)
+	}).Use(traceMiddleware("route"))
+
+	r.Mount(mountURL, pathEchoHandler())
+
+	sub := router.NewBuilder()
+	sub.Use(traceMiddleware("sub"))
+	sub.Get("/x", func(rctx *router.RequestContext) {
+		rctx.Response.String(http.StatusOK)
+	})
+
+	r.MountBuilder(subBuilder, &sub).Use(traceMiddleware("mount"))
+
+	handler := build(&r)
+
+	for path, expected := range map[string][]string{
+		baseURL:           {"builder", "route"},
+		mountURL + "a":    {"builder"},
+		subBuilder + "/x": {"builder", "mount", "sub"},
+	} {
+		resp := serve(handler, http.MethodGet, path)
+		trace := resp.Header().Values(traceHeader)
+
+		if len(trace) != len(expected) {
+			t.Fatalf("path %q: expected middlewares %v, got %v", path, expected, trace)
+		}
+
+		for i := range expected {
+			if trace[i] != expected[i] {
+				t.Fatalf("path %q: expected middlewares %v, got %v", path, expected, trace)
+			}
+		}
+	}
+}
+
+// NOTE: Middleware replacing the request must not break mounted handlers
+func testMountRequestReplaced(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	r.Use(func(next router.Handler) router.Handler {
+		return func(rctx *router.RequestContext) {
+			rctx.Request = &replacedRequest{Request: rctx.Request}
+			next(rctx)
+		}
+	})
+
+	r.Mount(mountURL, pathEchoHandler())
+
+	resp := serve(build(&r), http.MethodGet, mountURL+"a")
+	if resp.Code != http.StatusOK || resp.Body.String() != "/a" {
+		t.Fatalf("expected mounted handler to be served, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+type replacedRequest struct {
+	router.Request
+}
+
+// NOTE: Context values and headers set by middlewares reach mounted handlers
+func testMountMiddlewareContext(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	r.Use(func(next router.Handler) router.Handler {
+		return func(rctx *router.RequestContext) {
+			rctx.Request = &contextRequest{
+				Request: rctx.Request,
+				ctx:     context.WithValue(rctx.Context(), mountContextKey{}, "from-middleware"),
+			}
+
+			rctx.Request.Headers().Set("X-Middleware", "yes")
+			next(rctx)
+		}
+	})
+
+	r.Mount(mountURL, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		val, _ := r.Context().Value(mountContextKey{}).(string)
+		_, _ = io.WriteString(w, val+","+r.Header.Get("X-Middleware"))
+	}))
+
+	resp := serve(build(&r), http.MethodGet, mountURL+"a")
+	if resp.Code != http.StatusOK || resp.Body.String() != "from-middleware,yes" {
+		t.Fatalf("expected middleware context in mounted handler, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+type mountContextKey struct{}
+
+type contextRequest struct {
+	router.Request
+
+	ctx context.Context
+}
+
+func (r *contextRequest) Context() context.Context {
+	return r.ctx
+}
+
+func testMountCompressionAndCORS(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	r.Compression(true)
+	r.CORS(true, router.CORSOptions{
+		AllowedOrigins: []string{"http://example.com"},
+		AllowedMethods: []string{http.MethodGet},
+	})
+
+	r.Mount(mountURL, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, largeBody)
+	}))
+
+	handler := build(&r)
+
+	req := httptest.NewRequest(http.MethodGet, mountURL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Origin", "http://example.com")
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	if ce := resp.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("expected Content-Encoding %q, got %q", "gzip", ce)
+	}
+
+	if o := resp.Header().Get("Access-Control-Allow-Origin"); o != "http://example.com" {
+		t.Fatalf("expected CORS headers on mounted handler, got %q", o)
+	}
+}
+
+func traceMiddleware(name string) router.Middleware {
+	return func(next router.Handler) router.Handler {
+		return func(rctx *router.RequestContext) {
+			rctx.Response.Headers().Add(traceHeader, name)
+			next(rctx)
+		}
+	}
+}
+
+func pathEchoHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.Path)
+	})
+}
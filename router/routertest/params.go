@@ -0,0 +1,79 @@
+package routertest
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/yandzee/go-svc/router"
+)
+
+func testPathParams(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	r.Get("/users/{id}", paramsHandler("id", "missing"))
+	r.Get("/users/{id}/posts/{postId}", paramsHandler("id", "postId"))
+	r.Get("/blobs/{path...}", paramsHandler("path"))
+
+	handler := build(&r)
+
+	for path, expected := range map[string]string{
+		"/users/42":          "42,",
+		"/users/42/posts/7":  "42,7",
+		"/blobs/a/b/c.txt":   "a/b/c.txt",
+		"/users/abc/posts/x": "abc,x",
+	} {
+		resp := serve(handler, http.MethodGet, path)
+
+		if resp.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", path, resp.Code)
+		}
+
+		if body := resp.Body.String(); body != expected {
+			t.Fatalf("%s: expected params %q, got %q", path, expected, body)
+		}
+	}
+}
+
+func testPrefixedPathParams(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	ext := router.NewBuilder()
+	sub := router.NewBuilder()
+
+	ext.Get("/{id}", paramsHandler("id"))
+	sub.Get("/{name}/info", paramsHandler("name"))
+
+	if err := r.Extend(ext.IterRoutes(), "/extended"); err != nil {
+		t.Fatalf("Failed to extend routes: %s", err.Error())
+	}
+
+	r.MountBuilder("/mounted", &sub)
+
+	handler := build(&r)
+
+	for path, expected := range map[string]string{
+		"/extended/12":      "12",
+		"/mounted/bob/info": "bob",
+	} {
+		if body := serve(handler, http.MethodGet, path).Body.String(); body != expected {
+			t.Fatalf("%s: expected params %q, got %q", path, expected, body)
+		}
+	}
+}
+
+func paramsHandler(names ...string) router.Handler {
+	return func(rctx *router.RequestContext) {
+		values := make([]string, 0, len(names))
+
+		for _, name := range names {
+			v, ok := rctx.Request.PathParam(name)
+			if ok != (len(v) > 0) {
+				rctx.Response.String(http.StatusInternalServerError, "inconsistent PathParam result")
+				return
+			}
+
+			values = append(values, v)
+		}
+
+		rctx.Response.Stringf(http.StatusOK, "%s", strings.Join(values, ","))
+	}
+}
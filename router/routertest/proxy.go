@@ -0,0 +1,261 @@
+package routertest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yandzee/go-svc/router"
+)
+
+const proxyURL = "/legacy/"
+
+func testProxyPathRewriting(t *testing.T, build BuildFn) {
+	upstream := newEchoUpstream(t, "upstream")
+
+	for _, tc := range []struct {
+		Opts         *router.ProxyOptions
+		RequestPath  string
+		ExpectedPath string
+	}{
+		{
+			Opts:         nil,
+			RequestPath:  proxyURL + "users",
+			ExpectedPath: "/base" + proxyURL + "users",
+		},
+		{
+			Opts:         &router.ProxyOptions{PrefixStripped: true},
+			RequestPath:  proxyURL + "users",
+			ExpectedPath: "/base/users",
+		},
+		{
+			Opts: &router.ProxyOptions{
+				PrefixStripped: true,
+				RewritePath: func(p string) string {
+					return "/v2" + p
+				},
+			},
+			RequestPath:  proxyURL + "users",
+			ExpectedPath: "/base/v2/users",
+		},
+	} {
+		r := router.NewBuilder()
+		r.Proxy(proxyURL, upstream.URL+"/base", tc.Opts)
+		handler := build(&r)
+
+		req := httptest.NewRequest(http.MethodGet, tc.RequestPath, nil)
+		resp := httptest.NewRecorder()
+
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", resp.Code)
+		}
+
+		if p := resp.Header().Get("X-Echo-Path"); p != tc.ExpectedPath {
+			t.Fatalf("expected upstream path %q, got %q", tc.ExpectedPath, p)
+		}
+	}
+}
+
+func testProxyHeaders(t *testing.T, build BuildFn) {
+	upstream := newEchoUpstream(t, "upstream")
+
+	r := router.NewBuilder()
+	r.Proxy(proxyURL, upstream.URL, &router.ProxyOptions{
+		ForwardedEnabled: true,
+		RequestHeaders: router.HeaderRules{
+			Set:    http.Header{"X-Injected": []string{"yes"}},
+			Remove: []string{"X-Secret"},
+		},
+		ResponseHeaders: router.HeaderRules{
+			Remove: []string{"X-Upstream-Internal"},
+		},
+	})
+
+	handler := build(&r)
+
+	req := httptest.NewRequest(http.MethodGet, proxyURL+"h", nil)
+	req.Header.Set("X-Secret", "secret")
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	hs := resp.Header()
+	if v := hs.Get("X-Echo-X-Injected"); v != "yes" {
+		t.Fatalf("expected injected request header, got %q", v)
+	}
+
+	if v := hs.Get("X-Echo-X-Secret"); v != "" {
+		t.Fatalf("expected removed request header, got %q", v)
+	}
+
+	if v := hs.Get("X-Echo-X-Forwarded-For"); v == "" {
+		t.Fatal("expected X-Forwarded-For to be set")
+	}
+
+	if v := hs.Get("X-Echo-Forwarded"); !strings.Contains(v, "proto=http") {
+		t.Fatalf("expected Forwarded header, got %q", v)
+	}
+
+	if v := hs.Get("X-Upstream-Internal"); v != "" {
+		t.Fatalf("expected removed response header, got %q", v)
+	}
+}
+
+func testProxyUntrustedForwarded(t *testing.T, build BuildFn) {
+	upstream := newEchoUpstream(t, "upstream")
+
+	r := router.NewBuilder()
+	r.Proxy(proxyURL, upstream.URL, nil)
+	handler := build(&r)
+
+	req := httptest.NewRequest(http.MethodGet, proxyURL+"h", nil)
+	req.Header.Set("Forwarded", "for=198.51.100.1;host=evil.example.com")
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	if v := resp.Header().Get("X-Echo-Forwarded"); v != "" {
+		t.Fatalf("expected untrusted Forwarded header to be dropped, got %q", v)
+	}
+}
+
+func testProxyHostPreserved(t *testing.T, build BuildFn) {
+	upstream := newEchoUpstream(t, "upstream")
+
+	api := router.NewBuilder()
+	api.Proxy(proxyURL, upstream.URL, &router.ProxyOptions{HostPreserved: true})
+
+	r := router.NewBuilder()
+	r.Host("api.example.com", &api)
+	handler := build(&r)
+
+	const host = "API.example.com:8080"
+
+	req := httptest.NewRequest(http.MethodGet, proxyURL+"h", nil)
+	req.Host = host
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+
+	if v := resp.Header().Get("X-Echo-Host"); v != host {
+		t.Fatalf("expected upstream host %q, got %q", host, v)
+
+	}
+}
+
+func testProxyLoadBalancing(t *testing.T, build BuildFn) {
+	up1 := newEchoUpstream(t, "up1")
+	up2 := newEchoUpstream(t, "up2")
+
+	ups := router.MustUpstreams(up1.URL, up2.URL)
+
+	r := router.NewBuilder()
+	r.ProxyUpstreams(proxyURL, ups)
+	handler := build(&r)
+
+	counts := map[string]int{}
+	for range 4 {
+		counts[proxyGet(t, handler)] += 1
+	}
+
+	if counts["up1"] != 2 || counts["up2"] != 2 {
+		t.Fatalf("expected even distribution, got %v", counts)
+	}
+
+	ups.Targets[0].SetHealthy(false)
+
+	for range 2 {
+		if name := proxyGet(t, handler); name != "up2" {
+			t.Fatalf("expected only healthy upstream to be used, got %q", name)
+		}
+	}
+
+	ups.Targets[1].SetHealthy(false)
+
+	req := httptest.NewRequest(http.MethodGet, proxyURL, nil)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 with no healthy upstreams, got %d", resp.Code)
+	}
+}
+
+func testProxyHealthCheck(t *testing.T, build BuildFn) {
+	up1 := newEchoUpstream(t, "up1")
+	up2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(up2.Close)
+
+	ups := router.MustUpstreams(up1.URL, up2.URL)
+	ups.HealthCheck = &router.HealthCheckOptions{
+		Path: "/healthz",
+	}
+
+	ups.CheckHealth(t.Context())
+
+	if !ups.Targets[0].IsHealthy() {
+		t.Fatal("expected first upstream to be healthy")
+	}
+
+	if ups.Targets[1].IsHealthy() {
+		t.Fatal("expected second upstream to be unhealthy")
+	}
+}
+
+func testProxyUpstreamDown(t *testing.T, build BuildFn) {
+	upstream := newEchoUpstream(t, "upstream")
+	upstream.Close()
+
+	r := router.NewBuilder()
+	r.Proxy(proxyURL, upstream.URL)
+	handler := build(&r)
+
+	req := httptest.NewRequest(http.MethodGet, proxyURL, nil)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502 for unavailable upstream, got %d", resp.Code)
+	}
+}
+
+func proxyGet(t *testing.T, handler http.Handler) string {
+	req := httptest.NewRequest(http.MethodGet, proxyURL, nil)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+
+	return resp.Body.String()
+}
+
+func newEchoUpstream(t *testing.T, name string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hs := w.Header()
+		hs.Set("X-Echo-Path", r.URL.Path)
+		hs.Set("X-Echo-Host", r.Host)
+		hs.Set("X-Upstream-Internal", "internal")
+
+		for name, values := range r.Header {
+			hs["X-Echo-"+name] = values
+		}
+
+		_, _ = io.WriteString(w, name)
+	}))
+
+	t.Cleanup(srv.Close)
+	return srv
+}
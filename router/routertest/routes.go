@@ -0,0 +1,338 @@
+package routertest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"testing/fstest"
+
+	"github.com/yandzee/go-svc/router"
+	httputils "github.com/yandzee/go-svc/utils/http"
+)
+
+const (
+	baseURL         = "/test"
+	extendBaseURL   = "/extended"
+	attachedBaseURL = "/attached"
+	filesURL        = "/files/"
+	singleFileURL   = "/single-file"
+	missingFileURL  = "/missing-file"
+
+	testFilename1     = "testfile1.dat"
+	testFilename2     = "testfile2.dat"
+	testFileContent1  = "test file content 1"
+	testFileContent2  = "test file content 2"
+	singleFileName    = "data.txt"
+	singleFileContent = "single file content"
+
+	compressURL = "/compress"
+)
+
+// Large enough to trigger gzhttp compression (min ~1400 bytes)
+var largeBody = strings.Repeat("hello world ", 200)
+
+type testOutputs struct {
+	// Mapping from route path to number of times handler was called
+	Counter map[string]int
+}
+
+func testMethods(t *testing.T, build BuildFn) {
+	handler, outs := buildRouter(t, build)
+
+	for _, method := range httputils.AllMethods {
+		for _, baseUrl := range baseUrls() {
+			path := baseUrl + "/" + strings.ToLower(method)
+			req := httptest.NewRequest(method, path, nil)
+			resp := httptest.NewRecorder()
+
+			handler.ServeHTTP(resp, req)
+
+			if num := outs.Counter[path]; num != 1 {
+				t.Fatalf(
+					"%s request to '%s' is handled wrong number of times: %d\n%v",
+					method,
+					path,
+					num,
+					outs,
+				)
+			}
+		}
+	}
+}
+
+func testFiles(t *testing.T, build BuildFn) {
+	req1 := httptest.NewRequest(http.MethodGet, filesURL+testFilename1, nil)
+	req2 := httptest.NewRequest(http.MethodGet, attachedBaseURL+filesURL+testFilename2, nil)
+	expectedContent := []string{testFileContent1, testFileContent2}
+
+	for i, req := range []*http.Request{req1, req2} {
+		handler, _ := buildRouter(t, build)
+		resp := httptest.NewRecorder()
+
+		handler.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("wrong response code %d for file '%s'", resp.Code, req.URL.Path)
+			return
+		}
+
+		if s := resp.Body.String(); s != expectedContent[i] {
+			t.Fatalf("wrong response '%s' for file '%s'", s, req.URL.Path)
+			return
+		}
+	}
+}
+
+func testFile(t *testing.T, build BuildFn) {
+	handler, _ := buildRouter(t, build)
+
+	req := httptest.NewRequest(http.MethodGet, singleFileURL, nil)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("wrong response code %d for file '%s'", resp.Code, req.URL.Path)
+	}
+
+	if s := resp.Body.String(); s != singleFileContent {
+		t.Fatalf("wrong response '%s' for file '%s'", s, req.URL.Path)
+	}
+}
+
+func testFileMissing(t *testing.T, build BuildFn) {
+	handler, _ := buildRouter(t, build)
+
+	req := httptest.NewRequest(http.MethodGet, missingFileURL, nil)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for missing file, got %d", resp.Code)
+	}
+}
+
+func testCompressionInherited(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	r.Compression(true)
+	r.Get(compressURL, largeResponseHandler)
+	handler := build(&r)
+
+	for _, enc := range []string{"gzip", "zstd"} {
+		req := httptest.NewRequest(http.MethodGet, compressURL, nil)
+		req.Header.Set("Accept-Encoding", enc)
+		resp := httptest.NewRecorder()
+
+		handler.ServeHTTP(resp, req)
+
+		if ce := resp.Header().Get("Content-Encoding"); ce != enc {
+			t.Fatalf("expected Content-Encoding %q, got %q", enc, ce)
+		}
+	}
+}
+
+func testCompressionZstdDisabled(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	r.Compression(true, &router.CompressionOptions{ZstdDisabled: true})
+	r.Get(compressURL, largeResponseHandler)
+	handler := build(&r)
+
+	// gzip should still work
+	req := httptest.NewRequest(http.MethodGet, compressURL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	if ce := resp.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("expected Content-Encoding %q, got %q", "gzip", ce)
+	}
+
+	// zstd should not be applied
+	req = httptest.NewRequest(http.MethodGet, compressURL, nil)
+	req.Header.Set("Accept-Encoding", "zstd")
+	resp = httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+
+	if ce := resp.Header().Get("Content-Encoding"); ce == "zstd" {
+		t.Fatal("expected zstd compression to be disabled, but got Content-Encoding: zstd")
+	}
+}
+
+func testCompressionRouterEnabledRouteDisabled(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	r.Compression(true)
+	r.Get(compressURL, largeResponseHandler).Compression(false)
+	handler := build(&r)
+
+	for _, enc := range []string{"gzip", "zstd"} {
+		req := httptest.NewRequest(http.MethodGet, compressURL, nil)
+		req.Header.Set("Accept-Encoding", enc)
+		resp := httptest.NewRecorder()
+
+		handler.ServeHTTP(resp, req)
+
+		if ce := resp.Header().Get("Content-Encoding"); ce != "" {
+			t.Fatalf("expected no compression, got Content-Encoding %q", ce)
+		}
+	}
+}
+
+func testCompressionRouterDisabledRouteEnabled(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	r.Get(compressURL, largeResponseHandler).Compression(true)
+	handler := build(&r)
+
+	for _, enc := range []string{"gzip", "zstd"} {
+		req := httptest.NewRequest(http.MethodGet, compressURL, nil)
+		req.Header.Set("Accept-Encoding", enc)
+		resp := httptest.NewRecorder()
+
+		handler.ServeHTTP(resp, req)
+
+		if ce := resp.Header().Get("Content-Encoding"); ce != enc {
+			t.Fatalf("expected Content-Encoding %q, got %q", enc, ce)
+		}
+	}
+}
+
+func testCompressionExtendedRoute(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+
+	ext := router.NewBuilder()
+	ext.Get(compressURL, largeResponseHandler).Compression(true)
+
+	if err := r.Extend(ext.IterRoutes()); err != nil {
+		t.Fatalf("Failed to extend routes: %s", err.Error())
+	}
+
+	handler := build(&r)
+
+	for _, enc := range []string{"gzip", "zstd"} {
+		req := httptest.NewRequest(http.MethodGet, compressURL, nil)
+		req.Header.Set("Accept-Encoding", enc)
+		resp := httptest.NewRecorder()
+
+		handler.ServeHTTP(resp, req)
+
+		if ce := resp.Header().Get("Content-Encoding"); ce != enc {
+			t.Fatalf("expected Content-Encoding %q, got %q", enc, ce)
+		}
+	}
+}
+
+func largeResponseHandler(rctx *router.RequestContext) {
+	rctx.Response.String(http.StatusOK, largeBody)
+}
+
+func buildRouter(t *testing.T, build BuildFn) (http.Handler, *testOutputs) {
+	r := router.NewBuilder()
+	ext := router.NewBuilder()
+	att := router.NewBuilder()
+
+	outs := &testOutputs{
+		Counter: make(map[string]int),
+	}
+
+	for _, method := range httputils.AllMethods {
+		methodStr := strings.ToLower(method)
+		path := baseURL + "/" + methodStr
+
+		r.Method(method, path, func(rctx *router.RequestContext) {
+			outs.Counter[path] += 1
+		})
+
+		extPath := extendBaseURL + "/" + methodStr
+		ext.Method(method, extPath, func(rctx *router.RequestContext) {
+			outs.Counter[extPath] += 1
+		})
+
+		att.Method(method, "/"+methodStr, func(ctx *router.RequestContext) {
+			path := attachedBaseURL + "/" + methodStr
+			outs.Counter[path] += 1
+		})
+	}
+
+	r.Files(filesURL, fstest.MapFS{
+		testFilename1: {
+			Data: []byte(testFileContent1),
+		},
+	})
+
+	r.File(singleFileURL, fstest.MapFS{
+		singleFileName: {
+			Data: []byte(singleFileContent),
+		},
+	}, singleFileName)
+
+	r.File(missingFileURL, fstest.MapFS{}, "nonexistent.txt")
+
+	att.Files(filesURL, fstest.MapFS{
+		testFilename2: {
+			Data: []byte(testFileContent2),
+		},
+	})
+
+	if err := r.Extend(ext.IterRoutes()); err != nil {
+		t.Fatalf("Failed to extend routes: %s", err.Error())
+	}
+
+	if err := r.Extend(att.IterRoutes(), attachedBaseURL); err != nil {
+		t.Fatalf("Failed to attach routes: %s", err.Error())
+	}
+
+	return build(&r), outs
+}
+
+func baseUrls() []string {
+	return []string{
+		baseURL,
+		extendBaseURL,
+		attachedBaseURL,
+	}
+}
+
+func testCompressionNegotiation(t *testing.T, build BuildFn) {
+	r := router.NewBuilder()
+	r.Compression(true)
+	r.Get(compressURL, largeResponseHandler)
+	r.Get(compressURL+"/small", func(rctx *router.RequestContext) {
+		rctx.Response.String(http.StatusOK, "small")
+	})
+
+	handler := build(&r)
+
+	for _, tc := range []struct {
+		Path           string
+		AcceptEncoding string
+		Expected       string
+	}{
+		{Path: compressURL, AcceptEncoding: "", Expected: ""},
+		{Path: compressURL, AcceptEncoding: "identity", Expected: ""},
+		{Path: compressURL, AcceptEncoding: "br", Expected: ""},
+		{Path: compressURL, AcceptEncoding: "gzip;q=1, br;q=0.5", Expected: "gzip"},
+		{Path: compressURL + "/small", AcceptEncoding: "gzip", Expected: ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.Path, nil)
+		if len(tc.AcceptEncoding) > 0 {
+			req.Header.Set("Accept-Encoding", tc.AcceptEncoding)
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if ce := resp.Header().Get("Content-Encoding"); ce != tc.Expected {
+			t.Fatalf(
+				"%s with Accept-Encoding %q: expected Content-Encoding %q, got %q",
+				tc.Path, tc.AcceptEncoding, tc.Expected, ce,
+			)
+		}
+
+		if len(tc.Expected) > 0 && resp.Header().Get("Vary") == "" {
+			t.Fatalf("%s: expected Vary header on compressed response", tc.Path)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Package routertest provides conformance suite for router backends, i.e.
+// functions turning router.Builder into http.Handler. Every backend shipped
+// with this module runs it, custom backends are expected to do the same:
+//
+//	func TestConformance(t *testing.T) {
+//		routertest.Run(t, mybackend.Build)
+//	}
+package routertest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yandzee/go-svc/router"
+)
+
+type BuildFn func(*router.Builder) http.Handler
+
+type Scenario struct {
+	Name string
+	Test func(*testing.T, BuildFn)
+}
+
+func Scenarios() []Scenario {
+	return []Scenario{
+		{"Methods", testMethods},
+		{"PathParams", testPathParams},
+		{"PrefixedPathParams", testPrefixedPathParams},
+		{"Files", testFiles},
+		{"File", testFile},
+		{"FileMissing", testFileMissing},
+		{"ExtendPrefixJoining", testExtendPrefixJoining},
+		{"RouteOverride", testRouteOverride},
+		{"NotFound", testNotFound},
+		{"MethodNotAllowed", testMethodNotAllowed},
+		{"ErrorResponses", testErrorResponses},
+		{"JSONResponse", testJSONResponse},
+		{"CompressionNegotiation", testCompressionNegotiation},
+		{"CompressionInherited", testCompressionInherited},
+		{"CompressionZstdDisabled", testCompressionZstdDisabled},
+		{"CompressionRouterEnabledRouteDisabled", testCompressionRouterEnabledRouteDisabled},
+		{"CompressionRouterDisabledRouteEnabled", testCompressionRouterDisabledRouteEnabled},
+		{"CompressionExtendedRoute", testCompressionExtendedRoute},
+		{"HostRouting", testHostRouting},
+		{"CORS", testCORS},
+		{"CORSDisabled", testCORSDisabled},
+		{"MountHTTPHandler", testMountHTTPHandler},
+		{"MountBuilderLazily", testMountBuilderLazily},
+		{"MountMiddlewares", testMountMiddlewares},
+		{"MountRequestReplaced", testMountRequestReplaced},
+		{"MountMiddlewareContext", testMountMiddlewareContext},
+		{"MountCompressionAndCORS", testMountCompressionAndCORS},
+		{"ProxyPathRewriting", testProxyPathRewriting},
+		{"ProxyHeaders", testProxyHeaders},
+		{"ProxyUntrustedForwarded", testProxyUntrustedForwarded},
+		{"ProxyHostPreserved", testProxyHostPreserved},
+		{"ProxyLoadBalancing", testProxyLoadBalancing},
+		{"ProxyHealthCheck", testProxyHealthCheck},
+		{"ProxyUpstreamDown", testProxyUpstreamDown},
+	}
+}
+
+// NOTE: Runs every scenario as a subtest, so particular ones can be
+// skipped with `go test -skip`
+func Run(t *testing.T, build BuildFn) {
+	for _, sc := range Scenarios() {
+		t.Run(sc.Name, func(t *testing.T) {
+			sc.Test(t, build)
+		})
+	}
+}
+
+func serve(handler http.Handler, method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+	return resp
+}
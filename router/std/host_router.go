@@ -0,0 +1,122 @@
+package stdrouter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/yandzee/go-svc/router"
+)
+
+// NOTE: Literal hosts are handled by ServeMux host patterns, while each
+// wildcard host pattern gets its own ServeMux since they are not supported
+type hostRouter struct {
+	Default      *http.ServeMux
+	LiteralHosts map[string]struct{}
+	Wildcards    []*wildcardHostMux
+}
+
+type originalHostKey struct{}
+
+type wildcardHostMux struct {
+	Pattern *router.HostPattern
+	Mux     *http.ServeMux
+}
+
+func newHostRouter() *hostRouter {
+	return &hostRouter{
+		Default:      http.NewServeMux(),
+		LiteralHosts: map[string]struct{}{},
+	}
+}
+
+func (hr *hostRouter) Handle(host, p string, h http.Handler) {
+	if len(host) == 0 {
+		hr.Default.Handle(p, h)
+		return
+	}
+
+	hp, err := router.ParseHostPattern(host)
+	if err != nil {
+		panic(fmt.Sprintf("Router: %s", err.Error()))
+	}
+
+	if hp.IsLiteral() {
+		hr.LiteralHosts[hp.Pattern] = struct{}{}
+
+		idx := strings.Index(p, "/")
+		hr.Default.Handle(p[:idx]+hp.Pattern+p[idx:], restoreHost(h))
+
+		return
+	}
+
+	for _, wc := range hr.Wildcards {
+		if wc.Pattern.Pattern == hp.Pattern {
+			wc.Mux.Handle(p, h)
+			return
+		}
+	}
+
+	wc := &wildcardHostMux{
+		Pattern: hp,
+		Mux:     http.NewServeMux(),
+	}
+
+	wc.Mux.Handle(p, h)
+	hr.Wildcards = append(hr.Wildcards, wc)
+}
+
+func (hr *hostRouter) Handler() http.Handler {
+	if len(hr.Wildcards) == 0 && len(hr.LiteralHosts) == 0 {
+		return hr.Default
+	}
+
+	return hr
+}
+
+func (hr *hostRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := router.RequestHost(r)
+
+	if _, isLiteral := hr.LiteralHosts[host]; isLiteral {
+		// NOTE: ServeMux matches hosts case-sensitively, so lowercased host
+		// is used for matching only and handlers get the original one back
+		lr := r.WithContext(context.WithValue(r.Context(), originalHostKey{}, r.Host))
+		lr.Host = strings.ToLower(r.Host)
+
+		if _, pattern := hr.Default.Handler(lr); len(pattern) > 0 {
+			hr.Default.ServeHTTP(w, lr)
+			return
+		}
+	}
+
+	for _, wc := range hr.Wildcards {
+		params, ok := wc.Pattern.Match(host)
+		if !ok {
+			continue
+		}
+
+		if _, pattern := wc.Mux.Handler(r); len(pattern) == 0 {
+			continue
+		}
+
+		for _, param := range params {
+			r.SetPathValue(param.Name, param.Value)
+		}
+
+		wc.Mux.ServeHTTP(w, r)
+		return
+	}
+
+	hr.Default.ServeHTTP(w, r)
+}
+
+func restoreHost(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if host, ok := r.Context().Value(originalHostKey{}).(string); ok {
+			r.Host = host
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,152 @@
+package stdrouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+
+	"github.com/yandzee/go-svc/log"
+	"github.com/yandzee/go-svc/router"
+)
+
+type upstreamKey struct{}
+
+func (b *stdBuilder) proxyHandler(route *router.Route) http.Handler {
+	opts := route.Proxy
+	log := log.OrDiscard(opts.Log).With("proxy", route.Path)
+	prefix := strings.TrimSuffix(route.Path, "/")
+
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			upstream := pr.In.Context().Value(upstreamKey{}).(*router.Upstream)
+
+			path := pr.Out.URL.Path
+			if opts.PrefixStripped {
+				path = "/" + strings.TrimLeft(strings.TrimPrefix(path, prefix), "/")
+			}
+
+			if opts.RewritePath != nil {
+				path = opts.RewritePath(path)
+			}
+
+			if path != pr.Out.URL.Path {
+				pr.Out.URL.Path = path
+				pr.Out.URL.RawPath = ""
+			}
+
+			pr.SetURL(upstream.URL)
+
+			if opts.HostPreserved {
+				pr.Out.Host = pr.In.Host
+			}
+
+			if !opts.IncomingForwardedTrusted {
+				pr.Out.Header.Del("Forwarded")
+			}
+
+			if !opts.XForwardedDisabled {
+				if opts.IncomingForwardedTrusted {
+					if prior := pr.In.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+						pr.Out.Header["X-Forwarded-For"] = prior
+					}
+				}
+
+				pr.SetXForwarded()
+			}
+
+			if opts.ForwardedEnabled {
+				setForwarded(pr, opts.IncomingForwardedTrusted)
+			}
+
+			opts.RequestHeaders.Apply(pr.Out.Header)
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			opts.ResponseHeaders.Apply(resp.Header)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			st := http.StatusBadGateway
+
+			var netErr net.Error
+			if errors.Is(err, context.DeadlineExceeded) ||
+				(errors.As(err, &netErr) && netErr.Timeout()) {
+				st = http.StatusGatewayTimeout
+			}
+
+			log.Warn("upstream request failure",
+				"path", r.URL.Path,
+				"status", st,
+				"err", err.Error(),
+			)
+
+			w.WriteHeader(st)
+		},
+		Transport:     b.proxyTransport(opts),
+		FlushInterval: opts.FlushInterval,
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream, err := opts.Upstreams.Next()
+		if err != nil {
+			log.Warn("no upstream to proxy to", "path", r.URL.Path, "err", err.Error())
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), upstreamKey{}, upstream)
+		rp.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (b *stdBuilder) proxyTransport(opts *router.ProxyOptions) http.RoundTripper {
+	if opts.Transport != nil {
+		return opts.Transport
+	}
+
+	if opts.DialTimeout <= 0 && opts.ResponseHeaderTimeout <= 0 {
+		return http.DefaultTransport
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = opts.ResponseHeaderTimeout
+
+	if opts.DialTimeout > 0 {
+		dialer := &net.Dialer{
+			Timeout: opts.DialTimeout,
+		}
+
+		transport.DialContext = dialer.DialContext
+	}
+
+	return transport
+}
+
+// NOTE: RFC 7239
+func setForwarded(pr *httputil.ProxyRequest, isIncomingTrusted bool) {
+	proto := "http"
+	if pr.In.TLS != nil {
+		proto = "https"
+	}
+
+	elem := fmt.Sprintf("host=%q;proto=%s", pr.In.Host, proto)
+
+	if ip, _, err := net.SplitHostPort(pr.In.RemoteAddr); err == nil {
+		if strings.Contains(ip, ":") {
+			ip = fmt.Sprintf("\"[%s]\"", ip)
+		}
+
+		elem = fmt.Sprintf("for=%s;%s", ip, elem)
+	}
+
+	values := []string{}
+	if isIncomingTrusted {
+		values = append(values, pr.In.Header.Values("Forwarded")...)
+	}
+
+	values = append(values, elem)
+	pr.Out.Header.Set("Forwarded", strings.Join(values, ", "))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
@@ -22,6 +23,15 @@ func (r *Request) URL() *url.URL {
 	return r.Original.URL
 }
 
+func (r *Request) RemoteAddr() string {
+	host, _, err := net.SplitHostPort(r.Original.RemoteAddr)
+	if err != nil {
+		return r.Original.RemoteAddr
+	}
+
+	return host
+}
+
 func (r *Request) PathParam(key string) (string, bool) {
 	p := r.Original.PathValue(key)
 
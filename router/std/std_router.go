@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/klauspost/compress/gzhttp"
 	"github.com/klauspost/compress/zstd"
@@ -30,43 +32,66 @@ func Build(b *router.Builder) http.Handler {
 	return builder.Build(b)
 }
 
-func (sb *stdBuilder) Build(b *router.Builder) http.Handler {
-	mux := http.NewServeMux()
-	handler := http.Handler(mux)
+// NOTE: Prepares complete handler of the route (middlewares and compression
+// included), so that alternative backends only need to implement matching
+func RouteHandler(b *router.Builder, route *router.Route) http.Handler {
+	builder := stdBuilder{}
 
-	for route := range b.IterRoutes() {
-		p, h := sb.PreparePathAndInnerHandler(route)
-		h = sb.wrapCompression(h, route.CompressionOptions, b.CompressionOptions)
+	_, h := builder.PreparePathAndInnerHandler(route, b.Middlewares...)
+	return builder.wrapCompression(h, route.CompressionOptions, b.CompressionOptions)
+}
+
+func WrapHandler(h router.Handler) http.Handler {
+	builder := stdBuilder{}
+
+	return builder.wrapHandler(h)
+}
 
-		mux.Handle(p, h)
+func WrapCORS(b *router.Builder, h http.Handler) http.Handler {
+	if !b.CORSEnabled {
+		return h
 	}
 
-	if b.CORSEnabled {
-		opts := cors.Options{
-			AllowedOrigins:   b.CORSOptions.AllowedOrigins,
-			AllowCredentials: b.CORSOptions.AllowCredentials,
-			AllowedHeaders:   b.CORSOptions.AllowedHeaders,
-			AllowedMethods:   b.CORSOptions.AllowedMethods,
-			ExposedHeaders:   b.CORSOptions.ExposedHeaders,
-			Debug:            b.CORSOptions.DebugEnabled,
-			Logger:           nil,
-		}
+	opts := cors.Options{
+		AllowedOrigins:   b.CORSOptions.AllowedOrigins,
+		AllowCredentials: b.CORSOptions.AllowCredentials,
+		AllowedHeaders:   b.CORSOptions.AllowedHeaders,
+		AllowedMethods:   b.CORSOptions.AllowedMethods,
+		ExposedHeaders:   b.CORSOptions.ExposedHeaders,
+		Debug:            b.CORSOptions.DebugEnabled,
+		Logger:           nil,
+	}
 
-		if opts.Debug {
-			opts.Logger = &corsLogger{
-				Log: b.CORSOptions.Logger,
-			}
+	if opts.Debug {
+		opts.Logger = &corsLogger{
+			Log: b.CORSOptions.Logger,
 		}
+	}
+
+	corsServer := cors.New(opts)
+	return corsServer.Handler(h)
+}
+
+func (sb *stdBuilder) Build(b *router.Builder) http.Handler {
+	hr := newHostRouter()
+
+	for route := range b.IterResolvedRoutes() {
+		p, h := sb.PreparePathAndInnerHandler(route, b.Middlewares...)
+		h = sb.wrapCompression(h, route.CompressionOptions, b.CompressionOptions)
 
-		corsServer := cors.New(opts)
-		handler = corsServer.Handler(handler)
+		hr.Handle(route.Host, p, h)
 	}
 
-	return handler
+	return WrapCORS(b, hr.Handler())
 }
 
-func (b *stdBuilder) PreparePathAndInnerHandler(route *router.Route) (string, http.Handler) {
+func (b *stdBuilder) PreparePathAndInnerHandler(
+	route *router.Route,
+	mws ...router.Middleware,
+) (string, http.Handler) {
 	p := route.Path
+	mws = slices.Concat(mws, route.Middlewares)
+
 	var h http.Handler
 
 	switch {
@@ -82,14 +107,46 @@ func (b *stdBuilder) PreparePathAndInnerHandler(route *router.Route) (string, ht
 			route.Path,
 			http.FileServerFS(route.FileSystem),
 		)
+	case route.Proxy != nil:
+		h = b.proxyHandler(route)
+	case route.HTTPHandler != nil && route.PrefixStripped:
+		h = http.StripPrefix(strings.TrimSuffix(route.Path, "/"), route.HTTPHandler)
+	case route.HTTPHandler != nil:
+		h = route.HTTPHandler
 	case route.Method == router.MethodAll:
-		h = b.wrapHandler(route.Handler)
+		return p, b.wrapHandler(router.Chain(route.Handler, mws...))
 	default:
 		p = fmt.Sprintf("%s %s", route.Method, route.Path)
-		h = b.wrapHandler(route.Handler)
+		return p, b.wrapHandler(router.Chain(route.Handler, mws...))
+	}
+
+	return p, b.wrapMiddlewares(h, mws...)
+}
+
+// NOTE: Middlewares operate on router.Handler, so http.Handler is adapted
+// to be called from within the chain with the original request and writer
+func (b *stdBuilder) wrapMiddlewares(h http.Handler, mws ...router.Middleware) http.Handler {
+	if len(mws) == 0 {
+		return h
+	}
+
+	// NOTE: Middlewares may replace rctx.Request with their own
+	// implementation, original request is kept aside for this case
+	inner := func(rctx *router.RequestContext) {
+		original, _ := rctx.Value(originalRequestKey{})
+		req := original.(*Request)
+
+		h.ServeHTTP(req.Response, handlerRequest(req.Original, rctx.Request))
 	}
 
-	return p, h
+	chained := router.Chain(inner, mws...)
+
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		rctx := b.requestContext(res, req)
+		rctx.SetValue(originalRequestKey{}, rctx.Request)
+
+		chained(rctx)
+	})
 }
 
 func (b *stdBuilder) wrapCompression(
@@ -145,16 +202,37 @@ func (b *stdBuilder) ensureZstdCompressionLevel(lvl router.ZstdCompressionLevel)
 
 func (b *stdBuilder) wrapHandler(h router.Handler) http.Handler {
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
-		h(&router.RequestContext{
-			Request: &Request{
-				Original: req,
-				Response: res,
-			},
-			Response: &Response{
-				Original: res,
-				Request:  req,
-				Jsoner:   &b.Jsoner,
-			},
-		})
+		h(b.requestContext(res, req))
 	})
 }
+
+func (b *stdBuilder) requestContext(res http.ResponseWriter, req *http.Request) *router.RequestContext {
+	return &router.RequestContext{
+		Request: &Request{
+			Original: req,
+			Response: res,
+		},
+		Response: &Response{
+			Original: res,
+			Request:  req,
+			Jsoner:   &b.Jsoner,
+		},
+	}
+}
+
+type originalRequestKey struct{}
+
+// NOTE: Request replaced by middlewares is carried over to http.Request
+// through its context, headers and URL, so handler sees the same request
+// as the last middleware produced
+func handlerRequest(original *http.Request, r router.Request) *http.Request {
+	if req, isOk := r.(*Request); isOk {
+		return req.Original
+	}
+
+	out := original.WithContext(r.Context())
+	out.Header = r.Headers()
+	out.URL = r.URL()
+
+	return out
+}
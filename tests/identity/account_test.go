@@ -0,0 +1,286 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/yandzee/go-svc/identity"
+	id_http "github.com/yandzee/go-svc/identity/http"
+)
+
+// NOTE: Usernames are used as email addresses
+type MockAccountRegistry struct {
+	*MockUserRegistry
+
+	Verified map[uuid.UUID]string
+}
+
+func (mr *MockAccountRegistry) GetUserByEmail(ctx context.Context, email string) (*TestUser, error) {
+	return mr.Users[strings.ToLower(email)], nil
+}
+
+func (mr *MockAccountRegistry) GetUserEmail(ctx context.Context, usr *TestUser) (identity.UserEmail, error) {
+	return identity.UserEmail{
+		Address:    usr.Username,
+		IsVerified: mr.Verified[usr.Id] == usr.Username,
+	}, nil
+}
+
+func (mr *MockAccountRegistry) MarkEmailVerified(ctx context.Context, usr *TestUser, email string) error {
+	mr.Verified[usr.Id] = email
+	return nil
+}
+
+func (mr *MockAccountRegistry) UpdateCredentials(
+	ctx context.Context,
+	usr *TestUser,
+	creds identity.Credentials,
+) error {
+	usr.Password = creds.Get("password")
+	return nil
+}
+
+func withAccountRegistry(mr *MockUserRegistry) identity.UsersRegistry[TestUser] {
+	return &MockAccountRegistry{
+		MockUserRegistry: mr,
+		Verified:         map[uuid.UUID]string{},
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	mailer := identity.NewMemoryMailer()
+	te := setupEndpoint(t, accountDescriptor(mailer))
+	te.Provider.Accounts.EmailVerificationRequired = true
+
+	handler, provider := te.Handler, te.Provider
+
+	resp := serveJSON(t, handler, SignupURL, identity.TokenPair{}, identity.SignupRequest{
+		Credentials: identity.Credentials{
+			"username": "bob@example.com",
+			"password": "Correct-Horse-Battery-9",
+		},
+	})
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("signup: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	msg, sent := mailer.Last("bob@example.com")
+	if !sent || msg.Kind != identity.MessageEmailVerification {
+		t.Fatalf("expected verification email to be sent at signup, got %+v", mailer.Messages())
+	}
+
+	if msg.Link != "https://example.com/verify?token="+msg.Token {
+		t.Fatalf("unexpected verification link: %s", msg.Link)
+	}
+
+	attemptSignin(t, handler, SigninAttempt{Username: "bob@example.com", Password: "Correct-Horse-Battery-9", Expected: http.StatusForbidden})
+
+	// NOTE: Verification token is not accepted for password reset
+	resp = serveJSON(t, handler, PasswordResetURL, identity.TokenPair{}, id_http.PasswordResetBody{
+		Token:    msg.Token,
+		Password: "new-password",
+	})
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("reset with verification token: expected 400, got %d", resp.Code)
+	}
+
+	resp = serveJSON(t, handler, VerifyEmailURL, identity.TokenPair{}, id_http.TokenBody{Token: msg.Token})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("verify: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	resp = serveJSON(t, handler, VerifyEmailURL, identity.TokenPair{}, id_http.TokenBody{Token: msg.Token})
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("verify with used token: expected 400, got %d", resp.Code)
+	}
+
+	attemptSignin(t, handler, SigninAttempt{Username: "bob@example.com", Password: "Correct-Horse-Battery-9"})
+
+	signin := signinTestUser(t, provider, "bob@example.com", "Correct-Horse-Battery-9")
+	resp = serveWithTokens(handler, http.MethodPost, EmailVerificationURL, signin.Tokens)
+
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("request verification of verified email: expected 409, got %d", resp.Code)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	mailer := identity.NewMemoryMailer()
+	te := setupEndpoint(t, accountDescriptor(mailer))
+
+	handler, provider, ctx := te.Handler, te.Provider, t.Context()
+
+	signin := signinTestUser(t, provider, "alice@example.com", "password")
+
+	resp := serveJSON(t, handler, PasswordResetRequestURL, identity.TokenPair{}, id_http.PasswordResetRequestBody{
+		Email: "nobody@example.com",
+	})
+
+	if resp.Code != http.StatusAccepted || len(mailer.Messages()) != 0 {
+		t.Fatalf("reset of unknown email: expected 202 without emails, got %d", resp.Code)
+	}
+
+	resp = serveJSON(t, handler, PasswordResetRequestURL, identity.TokenPair{}, id_http.PasswordResetRequestBody{
+		Email: "alice@example.com",
+	})
+
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("reset request: expected 202, got %d", resp.Code)
+	}
+
+	msg, sent := mailer.Last("alice@example.com")
+	if !sent || msg.Kind != identity.MessagePasswordReset {
+		t.Fatalf("expected password reset email to be sent")
+	}
+
+	resp = serveJSON(t, handler, PasswordResetURL, identity.TokenPair{}, id_http.PasswordResetBody{
+		Token:    msg.Token,
+		Password: "qwerty",
+	})
+
+	if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), "invalidCredentials") {
+		t.Fatalf("reset with weak password: expected 400 with check, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	resp = serveJSON(t, handler, PasswordResetURL, identity.TokenPair{}, id_http.PasswordResetBody{
+		Token:    msg.Token,
+		Password: "Correct-Horse-Battery-9",
+	})
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("reset: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	resp = serveJSON(t, handler, PasswordResetURL, identity.TokenPair{}, id_http.PasswordResetBody{
+		Token:    msg.Token,
+		Password: "Another-Horse-Battery-7",
+	})
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("reset with used token: expected 400, got %d", resp.Code)
+	}
+
+	attemptSignin(t, handler, SigninAttempt{Username: "alice@example.com", Password: "password", Expected: http.StatusUnauthorized})
+	attemptSignin(t, handler, SigninAttempt{Username: "alice@example.com", Password: "Correct-Horse-Battery-9"})
+
+	if _, err := provider.Refresh(ctx, signin.Tokens.RefreshToken); !errors.Is(err, identity.ErrRefreshTokenRevoked) {
+		t.Fatalf("expected sessions to be revoked after reset, got %v", err)
+	}
+}
+
+func TestPasswordResetSimilarToUsername(t *testing.T) {
+	mailer := identity.NewMemoryMailer()
+	te := setupEndpoint(t, accountDescriptor(mailer))
+
+	serveJSON(t, te.Handler, PasswordResetRequestURL, identity.TokenPair{}, id_http.PasswordResetRequestBody{
+		Email: "alice@example.com",
+	})
+
+	msg, _ := mailer.Last("alice@example.com")
+
+	resp := serveJSON(t, te.Handler, PasswordResetURL, identity.TokenPair{}, id_http.PasswordResetBody{
+		Token:    msg.Token,
+		Password: "Alice@Example.com-9",
+	})
+
+	if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), identity.ReasonSimilarToUsername) {
+		t.Fatalf("reset with password similar to username: expected 400, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	// NOTE: Rejected password does not consume the token
+	resp = serveJSON(t, te.Handler, PasswordResetURL, identity.TokenPair{}, id_http.PasswordResetBody{
+		Token:    msg.Token,
+		Password: "Correct-Horse-Battery-9",
+	})
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("reset: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestPasswordResetClosesSessions(t *testing.T) {
+	mailer := identity.NewMemoryMailer()
+
+	td := accountDescriptor(mailer)
+	td.Sessions = identity.NewSessionOptions(identity.NewMemorySessionStore())
+
+	te := setupEndpoint(t, td)
+	handler, provider := te.Handler, te.Provider
+
+	session := signinTestUser(t, provider, "alice@example.com", "password").Tokens.AccessToken
+
+	serveJSON(t, handler, PasswordResetRequestURL, identity.TokenPair{}, id_http.PasswordResetRequestBody{
+		Email: "alice@example.com",
+	})
+
+	msg, _ := mailer.Last("alice@example.com")
+
+	resp := serveJSON(t, handler, PasswordResetURL, identity.TokenPair{}, id_http.PasswordResetBody{
+		Token:    msg.Token,
+		Password: "Correct-Horse-Battery-9",
+	})
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("reset: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	validated, err := provider.ValidateSessionToken(t.Context(), session.RawString())
+	if err != nil || validated.IsValid() {
+		t.Fatalf("expected session opened with old password to be closed, got %v", err)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer := &identity.FileMailer{Dir: dir}
+
+	err := mailer.Send(t.Context(), &identity.Message{
+		Kind:    identity.MessagePasswordReset,
+		To:      "alice@example.com",
+		Subject: "Reset your password",
+		Body:    "token",
+	})
+
+	if err != nil {
+		t.Fatalf("send failed: %s", err.Error())
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one message file, got %v (%v)", entries, err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	if err != nil {
+		t.Fatalf("failed to read message: %s", err.Error())
+	}
+
+	if !strings.HasPrefix(string(content), "To: alice@example.com\nSubject: Reset your password\n") {
+		t.Fatalf("unexpected message content: %q", content)
+	}
+}
+
+func accountDescriptor(mailer identity.Mailer) TestDescriptor {
+	accounts := identity.NewAccountOptions(mailer)
+	accounts.VerificationLink = func(token string) string {
+		return "https://example.com/verify?token=" + token
+	}
+
+	return TestDescriptor{
+		RefreshTokens:     identity.NewMemoryRefreshTokenStore(),
+		Registry:          withAccountRegistry,
+		CredentialsPolicy: identity.DefaultCredentialsPolicy(),
+		Accounts:          accounts,
+		Users: []TestUser{
+			{Username: "alice@example.com", Password: "password"},
+		},
+	}
+}
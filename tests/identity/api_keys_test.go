@@ -0,0 +1,254 @@
+package identity
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yandzee/go-svc/identity"
+	id_http "github.com/yandzee/go-svc/identity/http"
+	"github.com/yandzee/go-svc/router"
+)
+
+func TestApiKeyAuthentication(t *testing.T) {
+	te := setupEndpoint(t, apiKeysDescriptor())
+	handler, provider := te.Handler, te.Provider
+	tokens := signinTestUser(t, provider, TestUsername, TestPassword).Tokens
+
+	readKey := createApiKey(t, handler, tokens, identity.ApiKeyRequest{
+		Name:   "reader",
+		Scopes: []string{"data:read"},
+	})
+
+	plainKey := createApiKey(t, handler, tokens, identity.ApiKeyRequest{Name: "plain"})
+
+	if !strings.HasPrefix(readKey.Key, readKey.Prefix+"_") || !strings.HasPrefix(readKey.Prefix, "sk_") {
+		t.Fatalf("unexpected key format: %s (prefix %s)", readKey.Key, readKey.Prefix)
+	}
+
+	cases := []struct {
+		Name     string
+		Path     string
+		Header   string
+		Value    string
+		Expected int
+	}{
+		{"api key header", "/me", id_http.ApiKeyHeader, readKey.Key, http.StatusOK},
+		{"bearer", "/me", "Authorization", "Bearer " + readKey.Key, http.StatusOK},
+		{"wrong secret", "/me", id_http.ApiKeyHeader, readKey.Key[:len(readKey.Key)-4] + "0000", http.StatusUnauthorized},
+		{"garbage", "/me", "Authorization", "Bearer garbage", http.StatusUnauthorized},
+		{"scoped key", "/data", id_http.ApiKeyHeader, readKey.Key, http.StatusOK},
+		{"key without scope", "/data", id_http.ApiKeyHeader, plainKey.Key, http.StatusForbidden},
+		{"session token", "/data", AccessHeaderName, tokens.AccessToken.JWTString, http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.Path, nil)
+		req.Header.Set(tc.Header, tc.Value)
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != tc.Expected {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.Name, tc.Expected, resp.Code, resp.Body.String())
+		}
+
+		if resp.Code == http.StatusOK && tc.Path == "/me" && strings.TrimSpace(resp.Body.String()) != "alice" {
+			t.Fatalf("%s: expected key to resolve to its user, got %q", tc.Name, resp.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, ApiKeysURL, strings.NewReader(`{"name":"minted"}`))
+	req.Header.Set(id_http.ApiKeyHeader, readKey.Key)
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("key creation by API key: expected 403, got %d", resp.Code)
+	}
+}
+
+func TestApiKeyListAndRevoke(t *testing.T) {
+	te := setupEndpoint(t, apiKeysDescriptor())
+	handler, provider := te.Handler, te.Provider
+	tokens := signinTestUser(t, provider, TestUsername, TestPassword).Tokens
+
+	created := createApiKey(t, handler, tokens, identity.ApiKeyRequest{Name: "ci"})
+
+	req := httptest.NewRequest(http.MethodGet, ApiKeysListURL, nil)
+	req.Header.Set(AccessHeaderName, tokens.AccessToken.JWTString)
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK || strings.Contains(resp.Body.String(), created.Key) {
+		t.Fatalf("list: expected 200 without secrets, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	keys := []identity.ApiKey{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &keys); err != nil || len(keys) != 1 || keys[0].Id != created.Id {
+		t.Fatalf("list: unexpected keys: %s", resp.Body.String())
+	}
+
+	revoke := serveJSON(t, handler, ApiKeyRevokeURL, tokens, id_http.ApiKeyRevokeBody{Id: created.Id})
+	if revoke.Code != http.StatusOK {
+		t.Fatalf("revoke: expected 200, got %d", revoke.Code)
+	}
+
+	revoke = serveJSON(t, handler, ApiKeyRevokeURL, tokens, id_http.ApiKeyRevokeBody{Id: created.Id})
+	if revoke.Code != http.StatusNotFound {
+		t.Fatalf("second revoke: expected 404, got %d", revoke.Code)
+	}
+
+	key, err := provider.AuthenticateApiKey(t.Context(), created.Key)
+	if err != nil || key != nil {
+		t.Fatalf("expected revoked key to be rejected")
+	}
+}
+
+func TestApiKeyAccountRoutesForbidden(t *testing.T) {
+	te := setupEndpoint(t, apiKeysDescriptor())
+	handler, provider := te.Handler, te.Provider
+	tokens := signinTestUser(t, provider, TestUsername, TestPassword).Tokens
+
+	key := createApiKey(t, handler, tokens, identity.ApiKeyRequest{Name: "ci"})
+
+	routes := []struct {
+		Method string
+		Path   string
+	}{
+		{http.MethodGet, UserURL},
+		{http.MethodPost, MFAEnrollURL},
+		{http.MethodPost, MFAConfirmURL},
+		{http.MethodPost, MFADisableURL},
+		{http.MethodPost, EmailVerificationURL},
+		{http.MethodGet, SessionsURL},
+		{http.MethodPost, SessionRevokeURL},
+	}
+
+	for _, route := range routes {
+		req := httptest.NewRequest(route.Method, route.Path, strings.NewReader("{}"))
+		req.Header.Set(id_http.ApiKeyHeader, key.Key)
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusForbidden {
+			t.Fatalf("%s %s by API key: expected 403, got %d: %s", route.Method, route.Path, resp.Code, resp.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, UserURL, nil)
+	req.Header.Set(AccessHeaderName, tokens.AccessToken.JWTString)
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("current user by session token: expected 200, got %d", resp.Code)
+	}
+}
+
+func TestApiKeyScopesAndExpiration(t *testing.T) {
+	td := apiKeysDescriptor()
+	td.ApiKeys.Scopes = []string{"data:read"}
+	td.ApiKeys.MaxDuration = time.Hour
+
+	te := setupEndpoint(t, td)
+	provider, usr := te.Provider, te.User(t, TestUsername)
+	soon := time.Now().Add(time.Minute)
+	late := time.Now().Add(2 * time.Hour)
+	past := time.Now().Add(-time.Minute)
+
+	cases := []struct {
+		Name     string
+		Request  identity.ApiKeyRequest
+		Expected error
+	}{
+		{"allowed", identity.ApiKeyRequest{Scopes: []string{"data:read"}, ExpiresAt: &soon}, nil},
+		{"unknown scope", identity.ApiKeyRequest{Scopes: []string{"data:write"}, ExpiresAt: &soon}, identity.ErrApiKeyScope},
+		{"no expiration", identity.ApiKeyRequest{}, identity.ErrApiKeyExpiration},
+		{"beyond max duration", identity.ApiKeyRequest{ExpiresAt: &late}, identity.ErrApiKeyExpiration},
+		{"already expired", identity.ApiKeyRequest{ExpiresAt: &past}, identity.ErrApiKeyExpiration},
+	}
+
+	for _, tc := range cases {
+		_, err := provider.CreateApiKey(t.Context(), usr, tc.Request)
+		if err != tc.Expected {
+			t.Fatalf("%s: expected %v, got %v", tc.Name, tc.Expected, err)
+		}
+	}
+
+	plain, key := identity.GenerateApiKey(identity.DefaultApiKeyPrefix, usr.Id)
+	key.ExpiresAt = &past
+
+	if err := provider.ApiKeys.Store.SaveApiKey(t.Context(), key); err != nil {
+		t.Fatalf("failed to save key: %s", err.Error())
+	}
+
+	if key, _ := provider.AuthenticateApiKey(t.Context(), plain); key != nil {
+		t.Fatalf("expected expired key to be rejected")
+	}
+
+	otherPrefix, _ := identity.GenerateApiKey("pk", usr.Id)
+	if key, _ := provider.AuthenticateApiKey(t.Context(), otherPrefix); key != nil {
+		t.Fatalf("expected key of other prefix to be rejected")
+	}
+}
+
+func TestParseApiKey(t *testing.T) {
+	plain, key := identity.GenerateApiKey("live_sk", [16]byte{})
+
+	prefix, id, secret, isOk := identity.ParseApiKey(plain)
+	if !isOk || prefix != "live_sk" || id != key.Id || !key.CheckSecret(secret) {
+		t.Fatalf("failed to parse generated key %s", plain)
+	}
+
+	for _, malformed := range []string{"", "sk", "sk_abc_def", "_" + id + "_" + secret} {
+		if _, _, _, isOk := identity.ParseApiKey(malformed); isOk {
+			t.Fatalf("expected %q to be malformed", malformed)
+		}
+	}
+}
+
+// NOTE: /me responds with username, /data requires data:read scope
+func apiKeysDescriptor() TestDescriptor {
+	return TestDescriptor{
+		ApiKeys: identity.NewApiKeyOptions(),
+		Routes: func(b *router.Builder, ep *id_http.IdentityEndpoint[TestUser]) {
+			b.Get("/me", ep.Protect(func(rctx *router.RequestContext) {
+				usr, _ := id_http.UserFrom[TestUser](rctx)
+				rctx.Response.String(http.StatusOK, usr.Username)
+			}))
+
+			b.Get("/data", ep.Protect(func(rctx *router.RequestContext) {
+				rctx.Response.String(http.StatusOK)
+			}, id_http.GuardOptions{}.With(id_http.RequireScope("data:read"))))
+		},
+	}
+}
+
+func createApiKey(
+	t *testing.T,
+	handler http.Handler,
+	tokens identity.TokenPair,
+	req identity.ApiKeyRequest,
+) identity.CreatedApiKey {
+	t.Helper()
+
+	resp := serveJSON(t, handler, ApiKeysURL, tokens, req)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create key: expected 201, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	created := identity.CreatedApiKey{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to decode created key: %s", err.Error())
+	}
+
+	return created
+}
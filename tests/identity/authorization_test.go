@@ -0,0 +1,115 @@
+package identity
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/yandzee/go-svc/identity"
+	id_http "github.com/yandzee/go-svc/identity/http"
+	"github.com/yandzee/go-svc/router"
+)
+
+// NOTE: alice has admin role on user object, bob has viewer role and
+// reports:read permission in token claims
+var authorizationUsers = []TestUser{
+	{Username: "alice", Password: "password", Roles: []string{"admin"}},
+	{Username: "bob", Password: "password"},
+}
+
+func TestAuthorizationPolicies(t *testing.T) {
+	isAlice := id_http.UserPolicy("is alice", func(ctx context.Context, usr *TestUser) (bool, error) {
+		return usr.Username == "alice", nil
+	})
+
+	ok := func(rctx *router.RequestContext) {
+		rctx.Response.String(http.StatusOK, "ok")
+	}
+
+	te := setupEndpoint(t, TestDescriptor{
+		Users:     authorizationUsers,
+		ClaimsFor: bobClaims,
+		Routes: func(b *router.Builder, ep *id_http.IdentityEndpoint[TestUser]) {
+			b.Get("/admin", ok).Use(ep.Authorize(id_http.RequireRole("admin")))
+			b.Get("/reports", ok).Use(ep.Authorize(id_http.RequireAnyPermission("reports:read", "reports:write")))
+			b.Get("/custom", ok).Use(ep.Authorize(isAlice))
+			b.Get("/composed", ok).Use(ep.Middleware(
+				id_http.GuardOptions{}.With(id_http.RequireRole("admin"), id_http.RequirePermission("reports:read")),
+			))
+		},
+	})
+
+	tokens := map[string]identity.TokenPair{
+		"":      {},
+		"alice": signinTestUser(t, te.Provider, "alice", "password").Tokens,
+		"bob":   signinTestUser(t, te.Provider, "bob", "password").Tokens,
+	}
+
+	cases := []struct {
+		Path     string
+		User     string
+		Expected int
+	}{
+		{"/admin", "", http.StatusUnauthorized},
+		{"/admin", "alice", http.StatusOK},
+		{"/admin", "bob", http.StatusForbidden},
+		{"/reports", "alice", http.StatusForbidden},
+		{"/reports", "bob", http.StatusOK},
+		{"/custom", "alice", http.StatusOK},
+		{"/custom", "bob", http.StatusForbidden},
+		{"/composed", "alice", http.StatusForbidden},
+		{"/composed", "bob", http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		resp := serveWithTokens(te.Handler, http.MethodGet, tc.Path, tokens[tc.User])
+
+		if resp.Code != tc.Expected {
+			t.Fatalf(
+				"%s as %q: expected %d, got %d: %s",
+				tc.Path, tc.User, tc.Expected, resp.Code, resp.Body.String(),
+			)
+		}
+	}
+}
+
+func TestGuardResultForbidden(t *testing.T) {
+	te := setupEndpoint(t, TestDescriptor{
+		Users:     authorizationUsers,
+		ClaimsFor: bobClaims,
+		Routes: func(b *router.Builder, ep *id_http.IdentityEndpoint[TestUser]) {
+			b.Get("/check", func(rctx *router.RequestContext) {
+				result, err := ep.Guard(rctx, id_http.GuardOptions{}.With(id_http.RequireRole("admin")))
+				if err != nil {
+					t.Fatalf("unexpected guard error: %s", err.Error())
+				}
+
+				if !result.IsForbidden || !result.IsResponded || result.IsAuthorized() {
+					t.Fatalf("expected forbidden guard result: %+v", result)
+				}
+
+				if result.Principal == nil || !result.Principal.HasAnyRole("viewer") {
+					t.Fatalf("expected principal with claim roles: %+v", result.Principal)
+				}
+			})
+		},
+	})
+
+	tokens := signinTestUser(t, te.Provider, "bob", "password").Tokens
+
+	resp := serveWithTokens(te.Handler, http.MethodGet, "/check", tokens)
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", resp.Code)
+	}
+}
+
+func bobClaims(ctx context.Context, usr *TestUser) (map[string]any, error) {
+	if usr.Username != "bob" {
+		return nil, nil
+	}
+
+	return map[string]any{
+		"roles":       []string{"viewer"},
+		"permissions": []string{"reports:read"},
+	}, nil
+}
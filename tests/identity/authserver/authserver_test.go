@@ -0,0 +1,528 @@
+package authserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/identity/authserver"
+	id_http "github.com/yandzee/go-svc/identity/http"
+	"github.com/yandzee/go-svc/identity/oidc"
+	"github.com/yandzee/go-svc/router"
+	stdrouter "github.com/yandzee/go-svc/router/std"
+	idtest "github.com/yandzee/go-svc/tests/identity"
+)
+
+const (
+	Issuer      = "http://auth.test"
+	RedirectURI = "http://tool.test/callback"
+)
+
+type testServer struct {
+	t        *testing.T
+	handler  http.Handler
+	server   *authserver.Server[idtest.TestUser]
+	provider *identity.RegistryProvider[idtest.TestUser]
+	clients  *authserver.MemoryClientRegistry
+	session  string
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	ts := setupServer(t)
+	client, _ := ts.register(authserver.Client{
+		IsPublic:     true,
+		RedirectURIs: []string{RedirectURI},
+		Scopes:       []string{"tools:read"},
+	})
+
+	verifier := oidc.NewCodeVerifier()
+	redirect := ts.authorize(client.Id, verifier, "openid tools:read tools:write", ts.session)
+
+	if redirect.Get("state") != "xyz" || redirect.Get("iss") != Issuer {
+		t.Fatalf("unexpected authorization redirect: %v", redirect)
+	}
+
+	code := redirect.Get("code")
+	resp := ts.token(url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {client.Id},
+		"code":          {code},
+		"redirect_uri":  {RedirectURI},
+		"code_verifier": {verifier},
+	}, "")
+
+	tokens := expectTokens(t, resp)
+
+	if tokens.Scope != "openid tools:read" {
+		t.Fatalf("expected scopes to be narrowed to allowed ones, got %q", tokens.Scope)
+	}
+
+	if len(tokens.RefreshToken) == 0 || len(tokens.IdToken) == 0 {
+		t.Fatalf("expected refresh and id tokens to be issued: %+v", tokens)
+	}
+
+	idToken, err := ts.provider.VerifyToken(t.Context(), tokens.IdToken)
+	if err != nil {
+		t.Fatalf("id token verification failed: %s", err.Error())
+	}
+
+	if nonce, _ := idToken.Claims().String("nonce"); nonce != "n-1" {
+		t.Fatalf("expected nonce in id token, got %q", nonce)
+	}
+
+	if email, _ := idToken.Claims().String("email"); email != "user@example.com" {
+		t.Fatalf("expected user claims in id token, got %q", email)
+	}
+
+	resp = ts.token(url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {client.Id},
+		"code":          {code},
+		"redirect_uri":  {RedirectURI},
+		"code_verifier": {verifier},
+	}, "")
+
+	expectError(t, resp, http.StatusBadRequest, "invalid_grant")
+
+	userinfo := ts.serve(http.MethodGet, authserver.DefaultPaths.UserInfo, nil, "Bearer "+tokens.AccessToken)
+	if userinfo.Code != http.StatusOK || !strings.Contains(userinfo.Body.String(), "user@example.com") {
+		t.Fatalf("userinfo: expected 200 with claims, got %d: %s", userinfo.Code, userinfo.Body.String())
+	}
+
+	// NOTE: Tokens issued to clients are not session tokens
+	req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+	req.Header.Set(idtest.AccessHeaderName, tokens.AccessToken)
+	check := httptest.NewRecorder()
+	ts.handler.ServeHTTP(check, req)
+
+	if check.Code != http.StatusUnauthorized {
+		t.Fatalf("client access token as session token: expected 401, got %d", check.Code)
+	}
+}
+
+func TestAuthorizationRequestValidation(t *testing.T) {
+	ts := setupServer(t)
+	client, _ := ts.register(authserver.Client{
+		IsPublic:     true,
+		RedirectURIs: []string{RedirectURI},
+	})
+
+	q := url.Values{
+		"response_type": {"code"},
+		"client_id":     {client.Id},
+		"redirect_uri":  {"http://evil.test/callback"},
+	}
+
+	resp := ts.serveAuthorize(q, ts.session)
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("unregistered redirect uri: expected 400, got %d", resp.Code)
+	}
+
+	q.Set("redirect_uri", RedirectURI)
+
+	redirect := expectRedirect(t, ts.serveAuthorize(q, ts.session))
+	if redirect.Get("error") != "invalid_request" {
+		t.Fatalf("missing PKCE: expected invalid_request, got %v", redirect)
+	}
+
+	q.Set("code_challenge", oidc.CodeChallenge(oidc.NewCodeVerifier()))
+	q.Set("code_challenge_method", "S256")
+
+	if resp := ts.serveAuthorize(q, ""); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("no session: expected 401, got %d", resp.Code)
+	}
+
+	ts.server.LoginURL = func(authorizeURL string) string {
+		return "/login?next=" + url.QueryEscape(authorizeURL)
+	}
+
+	resp = ts.serveAuthorize(q, "")
+	if resp.Code != http.StatusFound || !strings.HasPrefix(resp.Header().Get("Location"), "/login?next=") {
+		t.Fatalf("no session: expected redirect to login, got %d", resp.Code)
+	}
+}
+
+func TestAuthorizationConsent(t *testing.T) {
+	ts := setupServer(t)
+	client, _ := ts.register(authserver.Client{
+		IsPublic:     true,
+		RedirectURIs: []string{RedirectURI},
+		Scopes:       []string{"tools:read", "tools:write"},
+	})
+
+	consents := 0
+	ts.server.Consent = func(
+		ctx context.Context,
+		req authserver.ConsentRequest[idtest.TestUser],
+	) ([]string, error) {
+		consents += 1
+
+		if consents > 1 {
+			return nil, nil
+		}
+
+		return slices.DeleteFunc(req.Scopes, func(s string) bool { return s == "tools:write" }), nil
+	}
+
+	verifier := oidc.NewCodeVerifier()
+	redirect := ts.authorize(client.Id, verifier, "tools:read tools:write", ts.session)
+
+	tokens := expectTokens(t, ts.token(url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {client.Id},
+		"code":          {redirect.Get("code")},
+		"redirect_uri":  {RedirectURI},
+		"code_verifier": {verifier},
+	}, ""))
+
+	if tokens.Scope != "tools:read" {
+		t.Fatalf("expected consented scopes only, got %q", tokens.Scope)
+	}
+
+	redirect = ts.authorize(client.Id, verifier, "tools:read", ts.session)
+	if redirect.Get("error") != "access_denied" {
+		t.Fatalf("expected access to be denied, got %v", redirect)
+	}
+}
+
+func TestPKCEVerifierMismatch(t *testing.T) {
+	ts := setupServer(t)
+	client, _ := ts.register(authserver.Client{
+		IsPublic:     true,
+		RedirectURIs: []string{RedirectURI},
+	})
+
+	redirect := ts.authorize(client.Id, oidc.NewCodeVerifier(), "", ts.session)
+
+	resp := ts.token(url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {client.Id},
+		"code":          {redirect.Get("code")},
+		"redirect_uri":  {RedirectURI},
+		"code_verifier": {oidc.NewCodeVerifier()},
+	}, "")
+
+	expectError(t, resp, http.StatusBadRequest, "invalid_grant")
+}
+
+func TestRefreshTokenGrant(t *testing.T) {
+	ts := setupServer(t)
+	client, secret := ts.register(authserver.Client{
+		RedirectURIs: []string{RedirectURI},
+		Scopes:       []string{"tools:read", "tools:write"},
+	})
+
+	basic := basicAuth(client.Id, secret)
+	verifier := oidc.NewCodeVerifier()
+	redirect := ts.authorize(client.Id, verifier, "tools:read tools:write", ts.session)
+
+	first := expectTokens(t, ts.token(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {redirect.Get("code")},
+		"redirect_uri":  {RedirectURI},
+		"code_verifier": {verifier},
+	}, basic))
+
+	second := expectTokens(t, ts.token(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {first.RefreshToken},
+		"scope":         {"tools:read"},
+	}, basic))
+
+	if second.Scope != "tools:read" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("expected narrowed scope and rotated refresh token: %+v", second)
+	}
+
+	expectError(t, ts.token(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {first.RefreshToken},
+	}, basic), http.StatusBadRequest, "invalid_grant")
+
+	expectError(t, ts.token(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {second.RefreshToken},
+		"scope":         {"tools:read tools:write"},
+	}, basic), http.StatusBadRequest, "invalid_scope")
+
+	expectError(t, ts.token(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {second.RefreshToken},
+	}, basicAuth(client.Id, "wrong")), http.StatusUnauthorized, "invalid_client")
+}
+
+func TestClientCredentialsIntrospectionAndRevocation(t *testing.T) {
+	ts := setupServer(t)
+	client, secret := ts.register(authserver.Client{
+		GrantTypes: []string{authserver.GrantClientCredentials},
+		Scopes:     []string{"metrics:read"},
+	})
+
+	basic := basicAuth(client.Id, secret)
+
+	tokens := expectTokens(t, ts.token(url.Values{
+		"grant_type": {"client_credentials"},
+		"scope":      {"metrics:read openid admin"},
+	}, basic))
+
+	if tokens.Scope != "metrics:read" || len(tokens.RefreshToken) > 0 || len(tokens.IdToken) > 0 {
+		t.Fatalf("unexpected client credentials response: %+v", tokens)
+	}
+
+	introspection := ts.introspect(tokens.AccessToken, basic)
+	if !introspection.Active || introspection.ClientId != client.Id || introspection.Subject != client.Id {
+		t.Fatalf("expected active token of the client: %+v", introspection)
+	}
+
+	if resp := ts.serve(http.MethodPost, authserver.DefaultPaths.Revoke, url.Values{
+		"token": {tokens.AccessToken},
+	}, basic); resp.Code != http.StatusOK {
+		t.Fatalf("revoke: expected 200, got %d", resp.Code)
+	}
+
+	if introspection := ts.introspect(tokens.AccessToken, basic); introspection.Active {
+		t.Fatalf("expected revoked token to be inactive")
+	}
+
+	if introspection := ts.introspect("garbage", basic); introspection.Active {
+		t.Fatalf("expected unknown token to be inactive")
+	}
+
+	expectError(t, ts.token(url.Values{
+		"grant_type": {"client_credentials"},
+	}, basicAuth(client.Id, "wrong")), http.StatusUnauthorized, "invalid_client")
+
+	expectError(t, ts.token(url.Values{
+		"grant_type": {"authorization_code"},
+	}, basic), http.StatusBadRequest, "unauthorized_client")
+}
+
+func TestDiscovery(t *testing.T) {
+	ts := setupServer(t)
+
+	resp := ts.serve(http.MethodGet, "/.well-known/openid-configuration", nil, "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("discovery: expected 200, got %d", resp.Code)
+	}
+
+	doc := map[string]any{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to decode discovery: %s", err.Error())
+	}
+
+	expected := map[string]string{
+		"issuer":                 Issuer,
+		"token_endpoint":         Issuer + authserver.DefaultPaths.Token,
+		"introspection_endpoint": Issuer + authserver.DefaultPaths.Introspect,
+		"revocation_endpoint":    Issuer + authserver.DefaultPaths.Revoke,
+		"jwks_uri":               Issuer + authserver.DefaultPaths.JWKS,
+	}
+
+	for key, val := range expected {
+		if doc[key] != val {
+			t.Fatalf("discovery: expected %s=%s, got %v", key, val, doc[key])
+		}
+	}
+
+	if jwks := ts.serve(http.MethodGet, authserver.DefaultPaths.JWKS, nil, ""); jwks.Code != http.StatusOK {
+		t.Fatalf("jwks: expected 200, got %d", jwks.Code)
+	}
+}
+
+func setupServer(t *testing.T) *testServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err.Error())
+	}
+
+	registry := &idtest.MockUserRegistry{
+		Users: map[string]*idtest.TestUser{
+			"user@example.com": {
+				Id:       uuid.New(),
+				Username: "user@example.com",
+				Password: "password",
+			},
+		},
+	}
+
+	provider := &identity.RegistryProvider[idtest.TestUser]{
+		Registry:             registry,
+		TokenPrivateKey:      key,
+		AccessTokenDuration:  time.Minute,
+		RefreshTokenDuration: time.Hour,
+		Denylist:             identity.NewMemoryTokenDenylist(),
+	}
+
+	ep := &id_http.IdentityEndpoint[idtest.TestUser]{
+		Provider:           provider,
+		AccessTokenHeader:  idtest.AccessHeaderName,
+		RefreshTokenHeader: idtest.RefreshHeaderName,
+		TokenPrivateKey:    key,
+		Denylist:           provider.Denylist,
+	}
+
+	clients := authserver.NewMemoryClientRegistry()
+	server := authserver.New(provider, ep, clients, Issuer)
+	server.UserClaims = func(ctx context.Context, usr *idtest.TestUser, scopes []string) (map[string]any, error) {
+		return map[string]any{"email": usr.Username}, nil
+	}
+
+	b := router.NewBuilder()
+	b.Get("/auth", ep.Check())
+	server.Routes(&b)
+
+	signin, err := provider.SignIn(t.Context(), identity.SigninRequest{
+		Credentials: identity.Credentials{
+			"username": "user@example.com",
+			"password": "password",
+		},
+	})
+
+	if err != nil || signin.NotAuthorized {
+		t.Fatalf("signin failed: %v", err)
+	}
+
+	return &testServer{
+		t:        t,
+		handler:  stdrouter.Build(&b),
+		server:   server,
+		provider: provider,
+		clients:  clients,
+		session:  signin.Tokens.AccessToken.JWTString,
+	}
+}
+
+func (ts *testServer) register(c authserver.Client) (*authserver.Client, string) {
+	client, secret, err := ts.clients.Register(ts.t.Context(), c)
+	if err != nil {
+		ts.t.Fatalf("client registration failed: %s", err.Error())
+	}
+
+	return client, secret
+}
+
+func (ts *testServer) authorize(clientId, verifier, scope, session string) url.Values {
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientId},
+		"redirect_uri":          {RedirectURI},
+		"scope":                 {scope},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-1"},
+		"code_challenge":        {oidc.CodeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	return expectRedirect(ts.t, ts.serveAuthorize(q, session))
+}
+
+func (ts *testServer) serveAuthorize(q url.Values, session string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, authserver.DefaultPaths.Authorize+"?"+q.Encode(), nil)
+	if len(session) > 0 {
+		req.AddCookie(&http.Cookie{Name: idtest.AccessHeaderName, Value: session})
+	}
+
+	resp := httptest.NewRecorder()
+	ts.handler.ServeHTTP(resp, req)
+
+	return resp
+}
+
+func (ts *testServer) token(form url.Values, authorization string) *httptest.ResponseRecorder {
+	return ts.serve(http.MethodPost, authserver.DefaultPaths.Token, form, authorization)
+}
+
+func (ts *testServer) introspect(token, authorization string) authserver.Introspection {
+	resp := ts.serve(http.MethodPost, authserver.DefaultPaths.Introspect, url.Values{
+		"token": {token},
+	}, authorization)
+
+	if resp.Code != http.StatusOK {
+		ts.t.Fatalf("introspect: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	result := authserver.Introspection{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+		ts.t.Fatalf("failed to decode introspection: %s", err.Error())
+	}
+
+	return result
+}
+
+func (ts *testServer) serve(method, path string, form url.Values, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if len(authorization) > 0 {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp := httptest.NewRecorder()
+	ts.handler.ServeHTTP(resp, req)
+
+	return resp
+}
+
+func expectRedirect(t *testing.T, resp *httptest.ResponseRecorder) url.Values {
+	t.Helper()
+
+	if resp.Code != http.StatusFound {
+		t.Fatalf("expected redirect, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	location, err := url.Parse(resp.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), RedirectURI) {
+		t.Fatalf("unexpected redirect location: %s", resp.Header().Get("Location"))
+	}
+
+	return location.Query()
+}
+
+func expectTokens(t *testing.T, resp *httptest.ResponseRecorder) authserver.TokenResponse {
+	t.Helper()
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("token: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if resp.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("token: expected no-store cache control")
+	}
+
+	tokens := authserver.TokenResponse{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &tokens); err != nil {
+		t.Fatalf("failed to decode tokens: %s", err.Error())
+	}
+
+	return tokens
+}
+
+func expectError(t *testing.T, resp *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+
+	if resp.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, resp.Code, resp.Body.String())
+	}
+
+	oauthErr := authserver.Error{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &oauthErr); err != nil || oauthErr.Code != code {
+		t.Fatalf("expected error %q, got %s", code, resp.Body.String())
+	}
+}
+
+func basicAuth(id, secret string) string {
+	req := http.Request{Header: http.Header{}}
+	req.SetBasicAuth(url.QueryEscape(id), url.QueryEscape(secret))
+
+	return req.Header.Get("Authorization")
+}
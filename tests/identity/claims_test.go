@@ -0,0 +1,124 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yandzee/go-svc/identity"
+	id_http "github.com/yandzee/go-svc/identity/http"
+	"github.com/yandzee/go-svc/router"
+)
+
+type testClaims struct {
+	Roles  []string `json:"roles"`
+	Tenant string   `json:"tenant"`
+}
+
+func TestCustomClaimsIssued(t *testing.T) {
+	provider := setupEndpoint(t, TestDescriptor{
+		ClaimsFor: func(ctx context.Context, usr *TestUser) (map[string]any, error) {
+			return map[string]any{
+				"roles":  []string{"admin", "editor"},
+				"tenant": "acme",
+				"sub":    "must-be-ignored",
+			}, nil
+		},
+	}).Provider
+
+	signin := signinTestUser(t, provider, TestUsername, TestPassword)
+
+	if _, exists := signin.Tokens.RefreshToken.Claim("roles"); exists {
+		t.Fatalf("custom claims must not be embedded into refresh token")
+	}
+
+	// NOTE: Re-parse issued token to ensure claims survive encoding
+	parsed := identity.Claims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(signin.Tokens.AccessToken.JWTString, &parsed); err != nil {
+		t.Fatalf("failed to parse issued token: %s", err.Error())
+	}
+
+	if parsed.Subject != signin.User.Id.String() {
+		t.Fatalf("custom claim overrode registered one: %q", parsed.Subject)
+	}
+
+	roles, _ := parsed.Strings("roles")
+	tenant, _ := parsed.String("tenant")
+
+	if !slices.Equal(roles, []string{"admin", "editor"}) || tenant != "acme" {
+		t.Fatalf("unexpected custom claims: %+v", parsed.Custom)
+	}
+
+	typed := testClaims{}
+	if err := parsed.Decode(&typed); err != nil {
+		t.Fatalf("failed to decode claims: %s", err.Error())
+	}
+
+	if typed.Tenant != "acme" || len(typed.Roles) != 2 {
+		t.Fatalf("unexpected typed claims: %+v", typed)
+	}
+}
+
+func TestCustomClaimsRefreshed(t *testing.T) {
+	version := 0
+	provider := setupEndpoint(t, TestDescriptor{
+		ClaimsFor: func(ctx context.Context, usr *TestUser) (map[string]any, error) {
+			version += 1
+			return map[string]any{"version": version}, nil
+		},
+	}).Provider
+
+	signin := signinTestUser(t, provider, TestUsername, TestPassword)
+
+	refreshed, err := provider.Refresh(t.Context(), signin.Tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh failed: %s", err.Error())
+	}
+
+	if v, _ := refreshed.AccessToken.Claim("version"); v != 2 {
+		t.Fatalf("expected claims to be recomputed on refresh, got %v", v)
+	}
+}
+
+func TestGuardResultClaims(t *testing.T) {
+	te := setupEndpoint(t, TestDescriptor{
+		ClaimsFor: func(ctx context.Context, usr *TestUser) (map[string]any, error) {
+			return map[string]any{"tenant": "acme", "roles": []string{"viewer"}}, nil
+		},
+		Routes: func(b *router.Builder, ep *id_http.IdentityEndpoint[TestUser]) {
+			b.Get("/claims", func(rctx *router.RequestContext) {
+				result, err := ep.Guard(rctx)
+				if err != nil || result.IsResponded {
+					return
+				}
+
+				typed := testClaims{}
+				if err := result.DecodeClaims(&typed); err != nil {
+					rctx.Response.String(http.StatusInternalServerError, err.Error())
+					return
+				}
+
+				_, _ = rctx.Response.JSON(http.StatusOK, typed)
+			})
+		},
+	})
+
+	signin := signinTestUser(t, te.Provider, TestUsername, TestPassword)
+
+	resp := serveWithTokens(te.Handler, http.MethodGet, "/claims", signin.Tokens)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	typed := testClaims{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &typed); err != nil {
+		t.Fatalf("failed to decode response: %s", err.Error())
+	}
+
+	if typed.Tenant != "acme" || !slices.Equal(typed.Roles, []string{"viewer"}) {
+		t.Fatalf("unexpected claims from guard: %+v", typed)
+	}
+}
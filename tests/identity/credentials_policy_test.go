@@ -0,0 +1,126 @@
+package identity
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/yandzee/go-svc/identity"
+)
+
+func TestCredentialsPolicyPassword(t *testing.T) {
+	policy := identity.DefaultCredentialsPolicy()
+	policy.RequireUpper = true
+	policy.RequireDigit = true
+
+	cases := []struct {
+		Password string
+		Username string
+		Reasons  []string
+	}{
+		{"", "john", []string{identity.ReasonMissing}},
+		{"Ab1", "john", []string{identity.ReasonTooShort, identity.ReasonLowEntropy}},
+		{"correcthorsebattery", "john", []string{identity.ReasonMissingUpper, identity.ReasonMissingDigit}},
+		{"Password1", "john", []string{identity.ReasonCommon}},
+		{"Johnathan9Smith", "johnathan", []string{identity.ReasonSimilarToUsername}},
+		{"Nahtanoj7!xQ", "jonathan", []string{identity.ReasonSimilarToUsername}},
+		{"Aaaaaaaaaaaa1", "john", []string{identity.ReasonLowEntropy}},
+		{"Tr0ub4dor&3xyz", "john", nil},
+	}
+
+	for _, tc := range cases {
+		ch := policy.CheckPassword(tc.Password, tc.Username)
+
+		if ch.IsCorrect != (len(tc.Reasons) == 0) || !slices.Equal(ch.Reasons, tc.Reasons) {
+			t.Fatalf("%q: expected reasons %v, got %+v", tc.Password, tc.Reasons, ch)
+		}
+	}
+}
+
+func TestCredentialsPolicyClassesAndLists(t *testing.T) {
+	policy := &identity.CredentialsPolicy{
+		MinCharClasses:  3,
+		CommonPasswords: map[string]struct{}{"companyname2024": {}},
+	}
+
+	if ch := policy.CheckPassword("onlylowercase", ""); !slices.Equal(ch.Reasons, []string{identity.ReasonTooFewClasses}) {
+		t.Fatalf("expected too few classes, got %+v", ch)
+	}
+
+	if ch := policy.CheckPassword("CompanyName2024", ""); !slices.Contains(ch.Reasons, identity.ReasonCommon) {
+		t.Fatalf("expected custom common password list to be used, got %+v", ch)
+	}
+
+	// NOTE: Bundled list is replaced by the custom one
+	if ch := policy.CheckPassword("Qwerty123", ""); !ch.IsCorrect {
+		t.Fatalf("expected password to pass, got %+v", ch)
+	}
+}
+
+func TestCredentialsPolicyUsername(t *testing.T) {
+	policy := identity.DefaultCredentialsPolicy()
+
+	for username, reason := range map[string]string{
+		"":    identity.ReasonMissing,
+		"jo":  identity.ReasonTooShort,
+		"жан": "",
+	} {
+		ch := policy.CheckUsername(username)
+
+		if (len(reason) == 0) != ch.IsCorrect || (len(reason) > 0 && ch.Reasons[0] != reason) {
+			t.Fatalf("%q: expected reason %q, got %+v", username, reason, ch)
+		}
+	}
+}
+
+func TestPasswordEntropy(t *testing.T) {
+	weak := identity.PasswordEntropy("abcdefgh")
+	strong := identity.PasswordEntropy("x7#Kq2!m")
+
+	if weak >= strong {
+		t.Fatalf("expected sequence to have lower entropy: %f >= %f", weak, strong)
+	}
+
+	if identity.PasswordEntropy("") != 0 {
+		t.Fatalf("expected zero entropy for empty password")
+	}
+}
+
+func TestSignupReportsPolicyReasons(t *testing.T) {
+	provider := setupEndpoint(t, TestDescriptor{
+		CredentialsPolicy: identity.DefaultCredentialsPolicy(),
+	}).Provider
+
+	result, err := provider.SignUp(t.Context(), identity.SignupRequest{
+		Credentials: identity.Credentials{
+			"username": "newuser",
+			"password": "password",
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("signup failed: %s", err.Error())
+	}
+
+	if !result.InvalidCredentials {
+		t.Fatalf("expected credentials to be rejected: %+v", result)
+	}
+
+	if ch := result.CredentialsCheck["password"]; !slices.Contains(ch.Reasons, identity.ReasonCommon) {
+		t.Fatalf("expected common password reason, got %+v", ch)
+	}
+
+	if !result.CredentialsCheck["username"].IsCorrect {
+		t.Fatalf("expected username to be correct: %+v", result.CredentialsCheck)
+	}
+
+	result, err = provider.SignUp(t.Context(), identity.SignupRequest{
+		Credentials: identity.Credentials{
+			"username": "newuser",
+			"password": "Vq8#mLp2zR",
+		},
+	})
+
+	if err != nil || !result.IsSuccess() {
+		t.Fatalf("expected signup to succeed: %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,153 @@
+package identity
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/yandzee/go-svc/identity"
+	id_http "github.com/yandzee/go-svc/identity/http"
+)
+
+func TestRefreshTokenDeviceSessions(t *testing.T) {
+	handler := setupEndpoint(t, TestDescriptor{
+		RefreshTokens: identity.NewMemoryRefreshTokenStore(),
+	}).Handler
+
+	laptop := responseTokens(attemptSignin(t, handler, SigninAttempt{UserAgent: "laptop"}))
+	time.Sleep(time.Millisecond)
+	phone := responseTokens(attemptSignin(t, handler, SigninAttempt{UserAgent: "phone"}))
+
+	sessions := listDeviceSessions(t, handler, laptop)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	byAgent := map[string]*identity.DeviceSession{}
+	for _, sess := range sessions {
+		byAgent[sess.Client.UserAgent] = sess
+	}
+
+	if byAgent["laptop"] == nil || !byAgent["laptop"].IsCurrent || byAgent["phone"].IsCurrent {
+		t.Fatalf("expected laptop session to be current: %+v", sessions)
+	}
+
+	if byAgent["laptop"].Client.Address != "192.0.2.1" {
+		t.Fatalf("expected client address of request, got %q", byAgent["laptop"].Client.Address)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, RefreshURL, nil)
+	req.Header.Set(RefreshHeaderName, laptop.RefreshToken.JWTString)
+	req.Header.Set("User-Agent", "laptop-updated")
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("refresh: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	refreshed := identity.TokenPair{
+		AccessToken: &identity.Token{JWTString: resp.Header().Get(AccessHeaderName)},
+	}
+
+	sessions = listDeviceSessions(t, handler, refreshed)
+	current := sessions[slices.IndexFunc(sessions, func(sess *identity.DeviceSession) bool {
+		return sess.IsCurrent
+	})]
+
+	if len(sessions) != 2 || current.Id != byAgent["laptop"].Id || current.Client.UserAgent != "laptop-updated" {
+		t.Fatalf("expected refreshed session to be updated: %+v", current)
+	}
+
+	if !current.CreatedAt.Equal(byAgent["laptop"].CreatedAt) {
+		t.Fatalf("expected session creation time to be kept across refreshes")
+	}
+
+	revoke := serveJSON(t, handler, SessionRevokeURL, refreshed, id_http.SessionRevokeBody{Id: byAgent["phone"].Id})
+	if revoke.Code != http.StatusOK {
+		t.Fatalf("revoke: expected 200, got %d", revoke.Code)
+	}
+
+	if resp := serveWithTokens(handler, http.MethodPost, RefreshURL, identity.TokenPair{
+		RefreshToken: phone.RefreshToken,
+	}); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh of revoked session: expected 401, got %d", resp.Code)
+	}
+
+	for _, id := range []string{byAgent["phone"].Id, "unknown"} {
+		revoke := serveJSON(t, handler, SessionRevokeURL, refreshed, id_http.SessionRevokeBody{Id: id})
+		if revoke.Code != http.StatusNotFound {
+			t.Fatalf("revoke of %s: expected 404, got %d", id, revoke.Code)
+		}
+	}
+}
+
+func TestServerSideDeviceSessions(t *testing.T) {
+	te := setupEndpoint(t, TestDescriptor{
+		Sessions: identity.NewSessionOptions(identity.NewMemorySessionStore()),
+	})
+
+	handler := te.Handler
+
+	laptop := responseTokens(attemptSignin(t, handler, SigninAttempt{UserAgent: "laptop"}))
+	phone := responseTokens(attemptSignin(t, handler, SigninAttempt{UserAgent: "phone"}))
+
+	sessions := listDeviceSessions(t, handler, phone)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	var laptopId string
+
+	for _, sess := range sessions {
+		if sess.IsCurrent != (sess.Client.UserAgent == "phone") {
+			t.Fatalf("expected only phone session to be current: %+v", sess)
+		}
+
+		if sess.Client.UserAgent == "laptop" {
+			laptopId = sess.Id
+		}
+	}
+
+	revoke := serveJSON(t, handler, SessionRevokeURL, phone, id_http.SessionRevokeBody{Id: laptopId})
+	if revoke.Code != http.StatusOK {
+		t.Fatalf("revoke: expected 200, got %d", revoke.Code)
+	}
+
+	if resp := serveWithTokens(handler, http.MethodGet, AuthCheckURL, laptop); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("check of revoked session: expected 401, got %d", resp.Code)
+	}
+
+	if sessions, _ := te.Provider.ListSessions(t.Context(), te.User(t, TestUsername)); len(sessions) != 1 {
+		t.Fatalf("expected 1 session left, got %d", len(sessions))
+	}
+}
+
+func TestDeviceSessionsNotSupported(t *testing.T) {
+	handler := setupEndpoint(t, TestDescriptor{}).Handler
+	tokens := responseTokens(attemptSignin(t, handler, SigninAttempt{}))
+
+	if resp := serveWithTokens(handler, http.MethodGet, SessionsURL, tokens); resp.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501 without refresh token store, got %d", resp.Code)
+	}
+}
+
+func listDeviceSessions(t *testing.T, handler http.Handler, tokens identity.TokenPair) []*identity.DeviceSession {
+	t.Helper()
+
+	resp := serveWithTokens(handler, http.MethodGet, SessionsURL, tokens)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("list sessions: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	sessions := []*identity.DeviceSession{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &sessions); err != nil {
+		t.Fatalf("failed to decode sessions: %s", err.Error())
+	}
+
+	return sessions
+}
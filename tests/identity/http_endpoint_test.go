@@ -1,15 +1,20 @@
 package identity
 
 import (
+	"bytes"
+	"context"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/yandzee/go-svc/identity"
 	id_http "github.com/yandzee/go-svc/identity/http"
 	"github.com/yandzee/go-svc/router"
@@ -17,18 +22,46 @@ import (
 )
 
 const (
-	AccessHeaderName  = "X-Test-Access-Token"
-	RefreshHeaderName = "X-Test-Refresh-Token"
-
-	AuthCheckURL = "/auth"
-	SigninURL    = "/auth/signin"
+	TestUsername = "alice"
+	TestPassword = "password"
 )
 
+// NOTE: Token durations default to a minute and an hour, Users default to
+// the single TestUsername user
 type TestDescriptor struct {
 	AccessTokenDuration  time.Duration
 	RefreshTokenDuration time.Duration
+	RefreshTokens        identity.RefreshTokenStore
+	Denylist             identity.TokenDenylist
+	Keys                 *identity.Keyring
+	PrivateKey           crypto.PrivateKey
+	SigningMethod        jwt.SigningMethod
 	Users                []TestUser
-	Steps                func(h *StepsHandle)
+
+	Lockout                *identity.Lockout
+	LockoutIdentifierField string
+	CredentialsPolicy      *identity.CredentialsPolicy
+	ClaimsFor              func(context.Context, *TestUser) (map[string]any, error)
+	MFA                    *identity.MFAOptions
+	Accounts               *identity.AccountOptions
+	MagicLinks             *identity.MagicLinkOptions
+	Sessions               *identity.SessionOptions
+	ApiKeys                *identity.ApiKeyOptions
+	Transport              *id_http.TokenTransport
+
+	// NOTE: Wraps mock registry to give it optional capabilities
+	Registry func(*MockUserRegistry) identity.UsersRegistry[TestUser]
+
+	// NOTE: Registers routes in addition to the endpoint ones
+	Routes func(*router.Builder, *id_http.IdentityEndpoint[TestUser])
+
+	Steps func(h *StepsHandle)
+}
+
+type TestEndpoint struct {
+	Endpoint *id_http.IdentityEndpoint[TestUser]
+	Provider *identity.RegistryProvider[TestUser]
+	Handler  http.Handler
 }
 
 func TestAuthCheckRoute(t *testing.T) {
@@ -63,8 +96,7 @@ func TestSigninRoute(t *testing.T) {
 
 func runTests(t *testing.T, tests []TestDescriptor) {
 	for _, td := range tests {
-		ep := buildEndpoint(t, &td)
-		router := buildEndpointRouter(ep)
+		handler := setupEndpoint(t, td).Handler
 
 		stepsHandle := &StepsHandle{
 			t: t,
@@ -75,44 +107,140 @@ func runTests(t *testing.T, tests []TestDescriptor) {
 		for _, step := range stepsHandle.steps {
 			resp := httptest.NewRecorder()
 
-			router.ServeHTTP(resp, step.Request)
+			handler.ServeHTTP(resp, step.Request)
 			step.ResponseCheckFn(t, resp)
 		}
 	}
 }
 
-func buildEndpointRouter(ep *id_http.IdentityEndpoint[TestUser]) http.Handler {
+func setupEndpoint(t *testing.T, td TestDescriptor) *TestEndpoint {
+	ep := buildEndpoint(t, &td)
+
+	return &TestEndpoint{
+		Endpoint: ep,
+		Provider: ep.Provider.(*identity.RegistryProvider[TestUser]),
+		Handler:  buildEndpointRouter(ep, td.Routes),
+	}
+}
+
+func (te *TestEndpoint) User(t *testing.T, username string) *TestUser {
+	t.Helper()
+
+	usr, err := te.Provider.Registry.GetUserByCredentials(t.Context(), identity.Credentials{
+		"username": username,
+	})
+
+	if err != nil || usr == nil {
+		t.Fatalf("user %s is not found: %v", username, err)
+	}
+
+	return usr
+}
+
+func buildEndpointRouter(
+	ep *id_http.IdentityEndpoint[TestUser],
+	routes func(*router.Builder, *id_http.IdentityEndpoint[TestUser]),
+) http.Handler {
 	r := router.NewBuilder()
 
 	r.Get(AuthCheckURL, ep.Check())
-	r.Get("/auth/user", ep.CurrentUser())
-	r.Post("/auth/signup", ep.Signup())
+	r.Get(UserURL, ep.CurrentUser())
+	r.Post(SignupURL, ep.Signup())
 	r.Post(SigninURL, ep.Signin())
-	r.Post("/auth/refresh", ep.Refresh())
+	r.Post(RefreshURL, ep.Refresh())
+	r.Post(SignoutURL, ep.Signout())
+	r.Get(JWKSURL, ep.JWKS())
+
+	r.Post(MFAVerifyURL, ep.MFAVerify())
+	r.Post(MFAEnrollURL, ep.MFAEnroll())
+	r.Post(MFAConfirmURL, ep.MFAConfirm())
+	r.Post(MFADisableURL, ep.MFADisable())
+
+	r.Post(VerifyEmailURL, ep.VerifyEmail())
+	r.Post(EmailVerificationURL, ep.RequestEmailVerification())
+	r.Post(PasswordResetRequestURL, ep.RequestPasswordReset())
+	r.Post(PasswordResetURL, ep.ResetPassword())
+
+	r.Post(MagicLinkRequestURL, ep.RequestMagicLink())
+	r.Post(MagicLinkSigninURL, ep.MagicLinkSignin())
+
+	r.Post(ApiKeysURL, ep.CreateApiKey())
+	r.Get(ApiKeysListURL, ep.ListApiKeys())
+	r.Post(ApiKeyRevokeURL, ep.RevokeApiKey())
+
+	r.Get(SessionsURL, ep.ListSessions())
+	r.Post(SessionRevokeURL, ep.RevokeSession())
+
+	if routes != nil {
+		routes(&r, ep)
+	}
 
 	return stdrouter.Build(&r)
 }
 
 func buildEndpoint(t *testing.T, td *TestDescriptor) *id_http.IdentityEndpoint[TestUser] {
-	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		t.Fatalf("Failed to generate private key for IdentityEndpoint: %s", err.Error())
+	var key crypto.PrivateKey = td.PrivateKey
+	if key == nil {
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate private key for IdentityEndpoint: %s", err.Error())
+		}
+
+		key = ecKey
 	}
 
 	inMemRegistry := &MockUserRegistry{
 		Users: map[string]*TestUser{},
 	}
 
-	for _, usr := range td.Users {
+	users := td.Users
+	if users == nil {
+		users = []TestUser{
+			{Username: TestUsername, Password: TestPassword},
+		}
+	}
+
+	for _, usr := range users {
+		if usr.Id == uuid.Nil {
+			usr.Id = uuid.New()
+		}
+
 		inMemRegistry.Users[usr.Username] = &usr
 	}
 
+	var registry identity.UsersRegistry[TestUser] = inMemRegistry
+	if td.Registry != nil {
+		registry = td.Registry(inMemRegistry)
+	}
+
+	accessDuration, refreshDuration := td.AccessTokenDuration, td.RefreshTokenDuration
+	if accessDuration == 0 {
+		accessDuration = time.Minute
+	}
+
+	if refreshDuration == 0 {
+		refreshDuration = time.Hour
+	}
+
 	provider := identity.RegistryProvider[TestUser]{
-		Registry:             inMemRegistry,
-		BaseClaims:           jwt.RegisteredClaims{},
-		TokenPrivateKey:      key,
-		AccessTokenDuration:  td.AccessTokenDuration,
-		RefreshTokenDuration: td.RefreshTokenDuration,
+		Registry:               registry,
+		BaseClaims:             jwt.RegisteredClaims{},
+		TokenPrivateKey:        key,
+		TokenSigningMethod:     td.SigningMethod,
+		AccessTokenDuration:    accessDuration,
+		RefreshTokenDuration:   refreshDuration,
+		Lockout:                td.Lockout,
+		LockoutIdentifierField: td.LockoutIdentifierField,
+		CredentialsPolicy:      td.CredentialsPolicy,
+		MFA:                    td.MFA,
+		Accounts:               td.Accounts,
+		MagicLinks:             td.MagicLinks,
+		Sessions:               td.Sessions,
+		ApiKeys:                td.ApiKeys,
+		ClaimsFor:              td.ClaimsFor,
+		RefreshTokens:          td.RefreshTokens,
+		Denylist:               td.Denylist,
+		Keys:                   td.Keys,
 	}
 
 	return &id_http.IdentityEndpoint[TestUser]{
@@ -121,5 +249,158 @@ func buildEndpoint(t *testing.T, td *TestDescriptor) *id_http.IdentityEndpoint[T
 		AccessTokenHeader:  AccessHeaderName,
 		RefreshTokenHeader: RefreshHeaderName,
 		TokenPrivateKey:    key,
+		TokenSigningMethod: td.SigningMethod,
+		Denylist:           td.Denylist,
+		Keys:               td.Keys,
+		Transport:          td.Transport,
+	}
+}
+
+func signinTestUser(
+	t *testing.T,
+	provider *identity.RegistryProvider[TestUser],
+	username, password string,
+) *identity.SigninResult[TestUser] {
+	t.Helper()
+
+	result, err := provider.SignIn(t.Context(), identity.SigninRequest{
+		Credentials: identity.Credentials{
+			"username": username,
+			"password": password,
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("signin failed: %s", err.Error())
+	}
+
+	if result.NotAuthorized {
+		t.Fatalf("signin is not authorized: %+v", result)
+	}
+
+	return result
+}
+
+// NOTE: Zero fields mean TestUsername with TestPassword signing in from
+// default address and expecting 200 without Retry-After
+type SigninAttempt struct {
+	Username   string
+	Password   string
+	UserAgent  string
+	RemoteAddr string
+	Expected   int
+	RetryAfter string
+}
+
+func attemptSignin(t *testing.T, handler http.Handler, attempt SigninAttempt) *httptest.ResponseRecorder {
+	t.Helper()
+
+	username, password := attempt.Username, attempt.Password
+	if len(username) == 0 {
+		username = TestUsername
+	}
+
+	if len(password) == 0 {
+		password = TestPassword
+	}
+
+	expected := attempt.Expected
+	if expected == 0 {
+		expected = http.StatusOK
+	}
+
+	req := signinRequest(username, password)
+
+	if len(attempt.UserAgent) > 0 {
+		req.Header.Set("User-Agent", attempt.UserAgent)
+	}
+
+	if len(attempt.RemoteAddr) > 0 {
+		req.RemoteAddr = attempt.RemoteAddr
+	}
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != expected {
+		t.Fatalf("signin of %s: expected %d, got %d: %s", username, expected, resp.Code, resp.Body.String())
+	}
+
+	if got := resp.Header().Get("Retry-After"); got != attempt.RetryAfter {
+		t.Fatalf("signin of %s: expected Retry-After %q, got %q", username, attempt.RetryAfter, got)
+	}
+
+	return resp
+}
+
+// NOTE: Tokens are taken from response headers, absent ones are nil
+func responseTokens(resp *httptest.ResponseRecorder) identity.TokenPair {
+	pair := identity.TokenPair{}
+
+	if access := resp.Header().Get(AccessHeaderName); len(access) > 0 {
+		pair.AccessToken = &identity.Token{JWTString: access}
 	}
+
+	if refresh := resp.Header().Get(RefreshHeaderName); len(refresh) > 0 {
+		pair.RefreshToken = &identity.Token{JWTString: refresh}
+	}
+
+	return pair
+}
+
+func signinRequest(username, password string) *http.Request {
+	body, _ := json.Marshal(identity.SigninRequest{
+		Credentials: identity.Credentials{
+			"username": username,
+			"password": password,
+		},
+	})
+
+	return httptest.NewRequest(http.MethodPost, SigninURL, bytes.NewReader(body))
+}
+
+func serveWithTokens(
+	handler http.Handler,
+	method, url string,
+	tokens identity.TokenPair,
+) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, nil)
+
+	if tokens.AccessToken != nil {
+		req.Header.Set(AccessHeaderName, tokens.AccessToken.JWTString)
+	}
+
+	if tokens.RefreshToken != nil {
+		req.Header.Set(RefreshHeaderName, tokens.RefreshToken.JWTString)
+	}
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	return resp
+}
+
+func serveJSON(
+	t *testing.T,
+	handler http.Handler,
+	url string,
+	tokens identity.TokenPair,
+	body any,
+) *httptest.ResponseRecorder {
+	t.Helper()
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("failed to marshal body: %s", err.Error())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, url, bytes.NewReader(raw))
+	if tokens.AccessToken != nil {
+		req.Header.Set(AccessHeaderName, tokens.AccessToken.JWTString)
+	}
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	return resp
 }
@@ -0,0 +1,121 @@
+package identity
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/yandzee/go-svc/identity"
+)
+
+func TestKeyringRotationKeepsTokensValid(t *testing.T) {
+	keys := testKeyring(t)
+	te := setupEndpoint(t, TestDescriptor{Keys: keys})
+	provider, handler := te.Provider, te.Handler
+
+	before := signinTestUser(t, provider, TestUsername, TestPassword)
+	if kid := before.Tokens.AccessToken.JWT.Header["kid"]; kid != keys.Active().Id {
+		t.Fatalf("expected token to carry active key id, got %v", kid)
+	}
+
+	if _, err := keys.Rotate(); err != nil {
+		t.Fatalf("rotation failed: %s", err.Error())
+	}
+
+	after := signinTestUser(t, provider, TestUsername, TestPassword)
+	if after.Tokens.AccessToken.JWT.Header["kid"] == before.Tokens.AccessToken.JWT.Header["kid"] {
+		t.Fatalf("expected token to be signed by the new key after rotation")
+	}
+
+	for _, tokens := range []identity.TokenPair{before.Tokens, after.Tokens} {
+		resp := serveWithTokens(handler, http.MethodGet, AuthCheckURL, identity.TokenPair{
+			AccessToken: tokens.AccessToken,
+		})
+
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected token to be valid, got %d: %s", resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func TestKeyringRetiredKeyExpiry(t *testing.T) {
+	keys := testKeyring(t)
+	keys.RetiredKeyTTL = time.Millisecond
+
+	te := setupEndpoint(t, TestDescriptor{Keys: keys})
+	provider, handler := te.Provider, te.Handler
+	signin := signinTestUser(t, provider, TestUsername, TestPassword)
+
+	if _, err := keys.Rotate(); err != nil {
+		t.Fatalf("rotation failed: %s", err.Error())
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	resp := serveWithTokens(handler, http.MethodGet, AuthCheckURL, identity.TokenPair{
+		AccessToken: signin.Tokens.AccessToken,
+	})
+
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("expected token of expired key to be rejected, got %d", resp.Code)
+	}
+}
+
+func TestJWKSEndpoint(t *testing.T) {
+	keys := testKeyring(t)
+	handler := setupEndpoint(t, TestDescriptor{Keys: keys}).Handler
+
+	first := keys.Active().Id
+	if _, err := keys.Rotate(); err != nil {
+		t.Fatalf("rotation failed: %s", err.Error())
+	}
+
+	resp := serveWithTokens(handler, http.MethodGet, JWKSURL, identity.TokenPair{})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("JWKS failed with %d: %s", resp.Code, resp.Body.String())
+	}
+
+	set := identity.JWKSet{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &set); err != nil {
+		t.Fatalf("failed to decode JWKS: %s", err.Error())
+	}
+
+	kids := []string{}
+	for _, jwk := range set.Keys {
+		if jwk.KeyType != "EC" || jwk.Algorithm != "ES256" || len(jwk.X) == 0 || len(jwk.Y) == 0 {
+			t.Fatalf("unexpected JWK: %+v", jwk)
+		}
+
+		kids = append(kids, jwk.KeyId)
+	}
+
+	if len(kids) != 2 || kids[0] != keys.Active().Id || kids[1] != first {
+		t.Fatalf("expected active and retired keys to be published, got %v", kids)
+	}
+}
+
+func TestSigningKeyIdIsThumbprint(t *testing.T) {
+	key, err := identity.GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err.Error())
+	}
+
+	same, err := identity.NewSigningKey(key.PrivateKey)
+	if err != nil {
+		t.Fatalf("NewSigningKey failed: %s", err.Error())
+	}
+
+	if len(key.Id) != 43 || key.Id != same.Id {
+		t.Fatalf("expected stable base64url sha256 key id, got %q and %q", key.Id, same.Id)
+	}
+}
+
+func testKeyring(t *testing.T) *identity.Keyring {
+	key, err := identity.GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err.Error())
+	}
+
+	return identity.NewKeyring(key)
+}
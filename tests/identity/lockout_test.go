@@ -0,0 +1,208 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yandzee/go-svc/identity"
+)
+
+func TestLockoutBackoffAndLock(t *testing.T) {
+	lockout := identity.NewLockout()
+	lockout.FreeAttempts = 2
+	lockout.MaxFailures = 4
+	lockout.BackoffBase = 50 * time.Millisecond
+	lockout.LockDuration = time.Minute
+
+	locked := []string{}
+	lockout.OnLock = func(ctx context.Context, identifier string, until time.Time) {
+		locked = append(locked, identifier)
+	}
+
+	handler := setupEndpoint(t, TestDescriptor{Lockout: lockout}).Handler
+	wrong := SigninAttempt{Password: "wrong", Expected: http.StatusUnauthorized}
+
+	attemptSignin(t, handler, wrong)
+	attemptSignin(t, handler, wrong)
+	attemptSignin(t, handler, wrong)
+
+	// NOTE: Third failure exceeds free attempts, so next one is delayed
+	attemptSignin(t, handler, SigninAttempt{Expected: http.StatusTooManyRequests, RetryAfter: "1"})
+
+	time.Sleep(60 * time.Millisecond)
+	attemptSignin(t, handler, SigninAttempt{Username: "ALICE", Password: "wrong", Expected: http.StatusUnauthorized})
+
+	if len(locked) != 1 || locked[0] != "ALICE" {
+		t.Fatalf("expected lock hook to be called once, got %v", locked)
+	}
+
+	attemptSignin(t, handler, SigninAttempt{Expected: http.StatusLocked, RetryAfter: "60"})
+
+	if err := lockout.Unlock(t.Context(), "alice"); err != nil {
+		t.Fatalf("unlock failed: %s", err.Error())
+	}
+
+	attemptSignin(t, handler, SigninAttempt{})
+}
+
+func TestLockoutClientThrottling(t *testing.T) {
+	lockout := identity.NewLockout()
+	lockout.ClientMaxFailures = 3
+
+	runTests(t, []TestDescriptor{
+		{
+			Lockout: lockout,
+			Steps: func(h *StepsHandle) {
+				for _, username := range []string{"u1", "u2", "u3"} {
+					step := h.Signin(identity.Credentials{"username": username, "password": "wrong"})
+					step.ExpectStatus(http.StatusUnauthorized)
+				}
+
+				step := h.Signin(identity.Credentials{"username": TestUsername, "password": TestPassword})
+				step.ExpectStatus(http.StatusTooManyRequests)
+				step.ExpectHeader("Retry-After", "900")
+
+				// NOTE: Other client is not throttled
+				step = h.Signin(identity.Credentials{"username": TestUsername, "password": TestPassword})
+				step.Request.RemoteAddr = "198.51.100.7:4321"
+				step.ExpectStatus(http.StatusOK)
+			},
+		},
+	})
+}
+
+func TestLockoutResetOnSuccess(t *testing.T) {
+	lockout := identity.NewLockout()
+	lockout.FreeAttempts = 2
+	lockout.MaxFailures = 3
+
+	runTests(t, []TestDescriptor{
+		{
+			Lockout: lockout,
+			Steps: func(h *StepsHandle) {
+				for range 3 {
+					step := h.Signin(identity.Credentials{"username": TestUsername, "password": "wrong"})
+					step.ExpectStatus(http.StatusUnauthorized)
+
+					step = h.Signin(identity.Credentials{"username": TestUsername, "password": TestPassword})
+					step.ExpectStatus(http.StatusOK)
+					step.ExpectHeader("Retry-After", "")
+				}
+			},
+		},
+	})
+}
+
+func TestLockoutSkipsEmptyIdentifier(t *testing.T) {
+	lockout := identity.NewLockout()
+	lockout.MaxFailures = 2
+
+	// NOTE: Credentials carry no email, so no identifier is tracked
+	runTests(t, []TestDescriptor{
+		{
+			Lockout:                lockout,
+			LockoutIdentifierField: "email",
+			Steps: func(h *StepsHandle) {
+				for range 3 {
+					step := h.Signin(identity.Credentials{"username": TestUsername, "password": "wrong"})
+					step.ExpectStatus(http.StatusUnauthorized)
+				}
+
+				step := h.Signin(identity.Credentials{"username": TestUsername, "password": TestPassword})
+				step.Request.RemoteAddr = "198.51.100.7:4321"
+				step.ExpectStatus(http.StatusOK)
+			},
+		},
+	})
+}
+
+func TestLockoutReleasedOnRegistryError(t *testing.T) {
+	lockout := identity.NewLockout()
+	lockout.FreeAttempts = 1
+	lockout.BackoffBase = time.Hour
+
+	registry := &failingUserRegistry{}
+	te := setupEndpoint(t, TestDescriptor{
+		Lockout: lockout,
+		Registry: func(mr *MockUserRegistry) identity.UsersRegistry[TestUser] {
+			registry.MockUserRegistry = mr
+			return registry
+		},
+	})
+
+	registry.Err = errors.New("registry is down")
+
+	for range 3 {
+		_, err := te.Provider.SignIn(t.Context(), identity.SigninRequest{
+			Credentials: identity.Credentials{"username": TestUsername, "password": TestPassword},
+		})
+
+		if !errors.Is(err, registry.Err) {
+			t.Fatalf("expected registry error, got %v", err)
+		}
+	}
+
+	// NOTE: Failed lookups are not attempts, so no backoff is applied
+	registry.Err = nil
+	signinTestUser(t, te.Provider, TestUsername, TestPassword)
+}
+
+type failingUserRegistry struct {
+	*MockUserRegistry
+
+	Err error
+}
+
+func (r *failingUserRegistry) GetUserByCredentials(
+	ctx context.Context,
+	creds identity.Credentials,
+) (*TestUser, error) {
+	if r.Err != nil {
+		return nil, r.Err
+	}
+
+	return r.MockUserRegistry.GetUserByCredentials(ctx, creds)
+}
+
+func TestLockoutConcurrentAttempts(t *testing.T) {
+	for _, tc := range []struct {
+		FreeAttempts int
+		MaxFailures  int
+		Allowed      int
+	}{
+		{FreeAttempts: 2, MaxFailures: 10, Allowed: 3},
+		{FreeAttempts: 10, MaxFailures: 4, Allowed: 4},
+	} {
+		lockout := identity.NewLockout()
+		lockout.FreeAttempts = tc.FreeAttempts
+		lockout.MaxFailures = tc.MaxFailures
+		lockout.BackoffBase = time.Hour
+
+		var wg sync.WaitGroup
+		var allowed atomic.Int32
+
+		for range 20 {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				status, err := lockout.Check(t.Context(), "alice", "")
+				if err == nil && !status.IsBlocked() {
+					allowed.Add(1)
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if int(allowed.Load()) != tc.Allowed {
+			t.Fatalf("expected %d concurrent attempts to be allowed, got %d", tc.Allowed, allowed.Load())
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package identity
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yandzee/go-svc/identity"
+	id_http "github.com/yandzee/go-svc/identity/http"
+)
+
+func TestMagicLinkSignin(t *testing.T) {
+	mailer := identity.NewMemoryMailer()
+	handler := setupEndpoint(t, magicLinkDescriptor(mailer)).Handler
+
+	resp := serveJSON(t, handler, MagicLinkRequestURL, identity.TokenPair{}, id_http.MagicLinkRequestBody{
+		Email: "alice@example.com",
+	})
+
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("request: expected 202, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	nonce := magicLinkNonce(t, resp)
+
+	msg, sent := mailer.Last("alice@example.com")
+	if !sent || msg.Kind != identity.MessageMagicLink {
+		t.Fatalf("expected magic link email to be sent")
+	}
+
+	if msg.Link != "https://example.com/magic?token="+msg.Token {
+		t.Fatalf("unexpected magic link: %s", msg.Link)
+	}
+
+	cases := []struct {
+		Name     string
+		Nonce    string
+		Expected int
+	}{
+		{"no device cookie", "", http.StatusUnauthorized},
+		{"other device", "other-device", http.StatusUnauthorized},
+		{"requesting device", nonce, http.StatusOK},
+		{"reused link", nonce, http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		resp := magicLinkSignin(handler, msg.Token, tc.Nonce)
+
+		if resp.Code != tc.Expected {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.Name, tc.Expected, resp.Code, resp.Body.String())
+		}
+
+		if resp.Code == http.StatusOK && len(resp.Header().Get(AccessHeaderName)) == 0 {
+			t.Fatalf("%s: expected access token in response", tc.Name)
+		}
+	}
+}
+
+func TestMagicLinkUnknownEmail(t *testing.T) {
+	mailer := identity.NewMemoryMailer()
+	handler := setupEndpoint(t, magicLinkDescriptor(mailer)).Handler
+
+	resp := serveJSON(t, handler, MagicLinkRequestURL, identity.TokenPair{}, id_http.MagicLinkRequestBody{
+		Email: "nobody@example.com",
+	})
+
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("request: expected 202, got %d", resp.Code)
+	}
+
+	if len(mailer.Messages()) != 0 {
+		t.Fatalf("expected no emails for unknown address")
+	}
+}
+
+func TestMagicLinkRejectsOtherTokens(t *testing.T) {
+	handler := setupEndpoint(t, magicLinkDescriptor(identity.NewMemoryMailer())).Handler
+
+	resp := serveJSON(t, handler, MagicLinkRequestURL, identity.TokenPair{}, id_http.MagicLinkRequestBody{
+		Email: "alice@example.com",
+	})
+
+	nonce := magicLinkNonce(t, resp)
+
+	signin := attemptSignin(t, handler, SigninAttempt{Username: "alice@example.com"})
+	accessToken := signin.Header().Get(AccessHeaderName)
+
+	if resp := magicLinkSignin(handler, accessToken, nonce); resp.Code != http.StatusBadRequest {
+		t.Fatalf("access token as magic link: expected 400, got %d", resp.Code)
+	}
+}
+
+func magicLinkDescriptor(mailer identity.Mailer) TestDescriptor {
+	links := identity.NewMagicLinkOptions(mailer)
+	links.Link = func(token string) string {
+		return "https://example.com/magic?token=" + token
+	}
+
+	return TestDescriptor{
+		Registry:   withAccountRegistry,
+		MagicLinks: links,
+		Users: []TestUser{
+			{Username: "alice@example.com", Password: "password"},
+		},
+	}
+}
+
+func magicLinkNonce(t *testing.T, resp *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	for _, cookie := range resp.Result().Cookies() {
+		if cookie.Name == id_http.MagicLinkNonceCookie && len(cookie.Value) > 0 {
+			return cookie.Value
+		}
+	}
+
+	t.Fatalf("expected nonce cookie to be set")
+	return ""
+}
+
+func magicLinkSignin(handler http.Handler, token, nonce string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(id_http.TokenBody{Token: token})
+
+	req := httptest.NewRequest(http.MethodPost, MagicLinkSigninURL, bytes.NewReader(body))
+	if len(nonce) > 0 {
+		req.AddCookie(&http.Cookie{Name: id_http.MagicLinkNonceCookie, Value: nonce})
+	}
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	return resp
+}
@@ -0,0 +1,298 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yandzee/go-svc/identity"
+	id_http "github.com/yandzee/go-svc/identity/http"
+	"github.com/yandzee/go-svc/identity/totp"
+)
+
+type MockMFARegistry struct {
+	*MockUserRegistry
+
+	Settings map[uuid.UUID]identity.MFASettings
+}
+
+func (mr *MockMFARegistry) GetMFA(ctx context.Context, usr *TestUser) (*identity.MFASettings, error) {
+	settings, exists := mr.Settings[usr.Id]
+	if !exists {
+		return nil, nil
+	}
+
+	settings.RecoveryCodeHashes = append([]string{}, settings.RecoveryCodeHashes...)
+	return &settings, nil
+}
+
+func (mr *MockMFARegistry) SaveMFA(
+	ctx context.Context,
+	usr *TestUser,
+	settings *identity.MFASettings,
+) error {
+	if settings == nil {
+		delete(mr.Settings, usr.Id)
+		return nil
+	}
+
+	mr.Settings[usr.Id] = *settings
+	return nil
+}
+
+func withMFARegistry(mr *MockUserRegistry) identity.UsersRegistry[TestUser] {
+	return &MockMFARegistry{
+		MockUserRegistry: mr,
+		Settings:         map[uuid.UUID]identity.MFASettings{},
+	}
+}
+
+func TestMFAEnrollAndSignin(t *testing.T) {
+	te := setupEndpoint(t, TestDescriptor{
+		Denylist: identity.NewMemoryTokenDenylist(),
+		Registry: withMFARegistry,
+		MFA:      &identity.MFAOptions{Issuer: "go-svc"},
+	})
+
+	handler, registry := te.Handler, te.Provider.Registry.(*MockMFARegistry)
+	tokens := responseTokens(attemptSignin(t, handler, SigninAttempt{}))
+
+	enrollResp := serveWithTokens(handler, http.MethodPost, MFAEnrollURL, tokens)
+	if enrollResp.Code != http.StatusOK {
+		t.Fatalf("enroll: expected 200, got %d: %s", enrollResp.Code, enrollResp.Body.String())
+	}
+
+	enrollment := identity.MFAEnrollment{}
+	if err := json.Unmarshal(enrollResp.Body.Bytes(), &enrollment); err != nil {
+		t.Fatalf("failed to decode enrollment: %s", err.Error())
+	}
+
+	if len(enrollment.RecoveryCodes) != identity.DefaultRecoveryCodesCount {
+		t.Fatalf("expected %d recovery codes, got %d", identity.DefaultRecoveryCodesCount, len(enrollment.RecoveryCodes))
+	}
+
+	// NOTE: Enrollment is not effective until confirmed
+	attemptSignin(t, handler, SigninAttempt{})
+
+	resp := mfaCodeRequest(t, handler, MFAConfirmURL, tokens, "000000")
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("confirm with wrong code: expected 400, got %d", resp.Code)
+	}
+
+	code := totpCode(t, enrollment.Secret, 0)
+
+	resp = mfaCodeRequest(t, handler, MFAConfirmURL, tokens, code)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("confirm: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if len(registry.Settings) != 1 {
+		t.Fatalf("expected MFA settings to be saved")
+	}
+
+	pending := mfaChallenge(t, attemptSignin(t, handler, SigninAttempt{Expected: http.StatusAccepted}))
+	if !pending.MFARequired || len(pending.MFAToken) == 0 || pending.Tokens.AccessToken != nil {
+		t.Fatalf("expected MFA token instead of token pair: %+v", pending)
+	}
+
+	// NOTE: MFA token is not usable as access token
+	checkResp := serveWithTokens(handler, http.MethodGet, AuthCheckURL, identity.TokenPair{
+		AccessToken: &identity.Token{JWTString: pending.MFAToken},
+	})
+
+	if checkResp.Code != http.StatusUnauthorized {
+		t.Fatalf("MFA token as access token: expected 401, got %d", checkResp.Code)
+	}
+
+	// NOTE: Code used for confirmation is not accepted again
+	resp = mfaVerify(t, handler, pending.MFAToken, code)
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed code: expected 401, got %d", resp.Code)
+	}
+
+	resp = mfaVerify(t, handler, pending.MFAToken, totpCode(t, enrollment.Secret, totp.DefaultPeriod))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("verify: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if len(resp.Header().Get(AccessHeaderName)) == 0 || len(resp.Header().Get(RefreshHeaderName)) == 0 {
+		t.Fatalf("verify: expected token pair in response headers")
+	}
+}
+
+func TestMFARecoveryCodes(t *testing.T) {
+	te := setupEndpoint(t, TestDescriptor{
+		Denylist: identity.NewMemoryTokenDenylist(),
+		Registry: withMFARegistry,
+		MFA:      &identity.MFAOptions{Issuer: "go-svc"},
+	})
+
+	handler := te.Handler
+	tokens := responseTokens(attemptSignin(t, handler, SigninAttempt{}))
+	enrollment := mfaEnroll(t, handler, tokens)
+
+	recovery := enrollment.RecoveryCodes[0]
+
+	pending := mfaChallenge(t, attemptSignin(t, handler, SigninAttempt{Expected: http.StatusAccepted}))
+	if resp := mfaVerify(t, handler, pending.MFAToken, recovery); resp.Code != http.StatusOK {
+		t.Fatalf("recovery code: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	pending = mfaChallenge(t, attemptSignin(t, handler, SigninAttempt{Expected: http.StatusAccepted}))
+	if resp := mfaVerify(t, handler, pending.MFAToken, recovery); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("used recovery code: expected 401, got %d", resp.Code)
+	}
+
+	if resp := mfaVerify(t, handler, pending.MFAToken, enrollment.RecoveryCodes[1]); resp.Code != http.StatusOK {
+		t.Fatalf("second recovery code: expected 200, got %d", resp.Code)
+	}
+}
+
+func TestMFADisable(t *testing.T) {
+	te := setupEndpoint(t, TestDescriptor{
+		Denylist: identity.NewMemoryTokenDenylist(),
+		Registry: withMFARegistry,
+		MFA:      &identity.MFAOptions{Issuer: "go-svc"},
+	})
+
+	handler, registry := te.Handler, te.Provider.Registry.(*MockMFARegistry)
+	tokens := responseTokens(attemptSignin(t, handler, SigninAttempt{}))
+	enrollment := mfaEnroll(t, handler, tokens)
+
+	resp := mfaCodeRequest(t, handler, MFADisableURL, tokens, "00000-00000")
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("disable with wrong code: expected 400, got %d", resp.Code)
+	}
+
+	resp = mfaCodeRequest(t, handler, MFADisableURL, tokens, enrollment.RecoveryCodes[0])
+	if resp.Code != http.StatusOK {
+		t.Fatalf("disable: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if len(registry.Settings) != 0 {
+		t.Fatalf("expected MFA settings to be removed")
+	}
+
+	attemptSignin(t, handler, SigninAttempt{})
+
+	resp = mfaCodeRequest(t, handler, MFADisableURL, tokens, enrollment.RecoveryCodes[1])
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("disable without MFA: expected 409, got %d", resp.Code)
+	}
+}
+
+func TestMFAAttemptsPerToken(t *testing.T) {
+	// NOTE: No Denylist and no Lockout, pending tokens are limited anyway
+	te := setupEndpoint(t, TestDescriptor{
+		Registry: withMFARegistry,
+		MFA:      &identity.MFAOptions{Issuer: "go-svc", MaxAttempts: 3},
+	})
+
+	handler := te.Handler
+	tokens := responseTokens(attemptSignin(t, handler, SigninAttempt{}))
+	enrollment := mfaEnroll(t, handler, tokens)
+
+	pending := mfaChallenge(t, attemptSignin(t, handler, SigninAttempt{Expected: http.StatusAccepted}))
+
+	for range 3 {
+		if resp := mfaVerify(t, handler, pending.MFAToken, "00000-00000"); resp.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong code: expected 401, got %d", resp.Code)
+		}
+	}
+
+	if resp := mfaVerify(t, handler, pending.MFAToken, enrollment.RecoveryCodes[0]); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("code beyond max attempts: expected 401, got %d", resp.Code)
+	}
+
+	pending = mfaChallenge(t, attemptSignin(t, handler, SigninAttempt{Expected: http.StatusAccepted}))
+
+	if resp := mfaVerify(t, handler, pending.MFAToken, enrollment.RecoveryCodes[0]); resp.Code != http.StatusOK {
+		t.Fatalf("verify: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if resp := mfaVerify(t, handler, pending.MFAToken, enrollment.RecoveryCodes[1]); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("used MFA token: expected 401, got %d", resp.Code)
+	}
+}
+
+func TestMFANotSupported(t *testing.T) {
+	handler := setupEndpoint(t, TestDescriptor{}).Handler
+	tokens := responseTokens(attemptSignin(t, handler, SigninAttempt{}))
+
+	resp := serveWithTokens(handler, http.MethodPost, MFAEnrollURL, tokens)
+	if resp.Code != http.StatusNotImplemented {
+		t.Fatalf("enroll without MFA registry: expected 501, got %d", resp.Code)
+	}
+}
+
+type mfaSigninResponse struct {
+	MFARequired bool               `json:"mfaRequired"`
+	MFAToken    string             `json:"mfaToken"`
+	Tokens      identity.TokenPair `json:"-"`
+}
+
+// NOTE: Decodes pending signin, which carries no token pair
+func mfaChallenge(t *testing.T, resp *httptest.ResponseRecorder) mfaSigninResponse {
+	t.Helper()
+
+	result := mfaSigninResponse{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode signin result: %s", err.Error())
+	}
+
+	result.Tokens = responseTokens(resp)
+	return result
+}
+
+func mfaEnroll(t *testing.T, handler http.Handler, tokens identity.TokenPair) identity.MFAEnrollment {
+	t.Helper()
+
+	resp := serveWithTokens(handler, http.MethodPost, MFAEnrollURL, tokens)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("enroll: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	enrollment := identity.MFAEnrollment{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &enrollment); err != nil {
+		t.Fatalf("failed to decode enrollment: %s", err.Error())
+	}
+
+	confirm := mfaCodeRequest(t, handler, MFAConfirmURL, tokens, totpCode(t, enrollment.Secret, 0))
+	if confirm.Code != http.StatusOK {
+		t.Fatalf("confirm: expected 200, got %d: %s", confirm.Code, confirm.Body.String())
+	}
+
+	return enrollment
+}
+
+func mfaVerify(t *testing.T, handler http.Handler, mfaToken, code string) *httptest.ResponseRecorder {
+	return serveJSON(t, handler, MFAVerifyURL, identity.TokenPair{}, id_http.MFAVerifyBody{
+		MFAToken: mfaToken,
+		Code:     code,
+	})
+}
+
+func mfaCodeRequest(
+	t *testing.T,
+	handler http.Handler,
+	url string,
+	tokens identity.TokenPair,
+	code string,
+) *httptest.ResponseRecorder {
+	return serveJSON(t, handler, url, tokens, id_http.MFACodeBody{Code: code})
+}
+
+func totpCode(t *testing.T, secret string, offset time.Duration) string {
+	t.Helper()
+
+	code, err := totp.Code(secret, time.Now().Add(offset))
+	if err != nil {
+		t.Fatalf("failed to generate TOTP code: %s", err.Error())
+	}
+
+	return code
+}
@@ -11,12 +11,17 @@ type TestUser struct {
 	Id       uuid.UUID
 	Username string
 	Password string
+	Roles    []string
 }
 
 func (tu TestUser) GetId() uuid.UUID {
 	return tu.Id
 }
 
+func (tu TestUser) GetRoles() []string {
+	return tu.Roles
+}
+
 type MockUserRegistry struct {
 	Users map[string]*TestUser
 }
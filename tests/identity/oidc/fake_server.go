@@ -0,0 +1,195 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yandzee/go-svc/crypto"
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/identity/oidc"
+)
+
+const (
+	FakeClientId     = "test-client"
+	FakeClientSecret = "test-secret"
+	FakeKeyId        = "fake-key-1"
+)
+
+// NOTE: In-process OpenID provider, users are authorized without prompts
+// as Subject / Email set on the server
+type FakeServer struct {
+	*httptest.Server
+
+	Key *rsa.PrivateKey
+
+	Subject       string
+	Email         string
+	EmailVerified bool
+
+	// NOTE: Allow tests to tamper with issued ID tokens
+	Nonce    string
+	Audience string
+
+	mx     sync.Mutex
+	grants map[string]fakeGrant
+}
+
+type fakeGrant struct {
+	RedirectURI string
+	Challenge   string
+	Nonce       string
+}
+
+func NewFakeServer(t *testing.T) *FakeServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate fake server key: %s", err.Error())
+	}
+
+	fs := &FakeServer{
+		Key:           key,
+		Subject:       "ext-user-1",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		grants:        map[string]fakeGrant{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+oidc.DiscoveryPath, fs.discovery)
+	mux.HandleFunc("GET /jwks", fs.jwks)
+	mux.HandleFunc("GET /authorize", fs.authorize)
+	mux.HandleFunc("POST /token", fs.token)
+
+	fs.Server = httptest.NewServer(mux)
+	t.Cleanup(fs.Close)
+
+	return fs
+}
+
+func (fs *FakeServer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, oidc.Discovery{
+		Issuer:                fs.URL,
+		AuthorizationEndpoint: fs.URL + "/authorize",
+		TokenEndpoint:         fs.URL + "/token",
+		JWKSURI:               fs.URL + "/jwks",
+		CodeChallengeMethods:  []string{oidc.CodeChallengeMethodS256},
+	})
+}
+
+func (fs *FakeServer) jwks(w http.ResponseWriter, r *http.Request) {
+	key, _ := identity.NewSigningKey(fs.Key, jwt.SigningMethodRS256)
+	jwk, _ := key.JWK()
+	jwk.KeyId = FakeKeyId
+
+	writeJSON(w, http.StatusOK, identity.JWKSet{Keys: []identity.JWK{jwk}})
+}
+
+func (fs *FakeServer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	if q.Get("client_id") != FakeClientId || q.Get("response_type") != "code" ||
+		q.Get("code_challenge_method") != oidc.CodeChallengeMethodS256 {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := crypto.RandomHex(16)
+
+	fs.mx.Lock()
+	fs.grants[code] = fakeGrant{
+		RedirectURI: q.Get("redirect_uri"),
+		Challenge:   q.Get("code_challenge"),
+		Nonce:       q.Get("nonce"),
+	}
+	fs.mx.Unlock()
+
+	redirect, _ := url.Parse(q.Get("redirect_uri"))
+	rq := redirect.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (fs *FakeServer) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+
+	if id != FakeClientId || secret != FakeClientSecret {
+		writeJSON(w, http.StatusUnauthorized, oidc.AuthError{Code: "invalid_client"})
+		return
+	}
+
+	code := r.PostFormValue("code")
+
+	fs.mx.Lock()
+	grant, exists := fs.grants[code]
+	delete(fs.grants, code)
+	fs.mx.Unlock()
+
+	switch {
+	case !exists, grant.RedirectURI != r.PostFormValue("redirect_uri"):
+		writeJSON(w, http.StatusBadRequest, oidc.AuthError{Code: "invalid_grant"})
+		return
+	case oidc.CodeChallenge(r.PostFormValue("code_verifier")) != grant.Challenge:
+		writeJSON(w, http.StatusBadRequest, oidc.AuthError{
+			Code:        "invalid_grant",
+			Description: "PKCE verification failed",
+		})
+		return
+	}
+
+	nonce, aud := grant.Nonce, FakeClientId
+	if len(fs.Nonce) > 0 {
+		nonce = fs.Nonce
+	}
+
+	if len(fs.Audience) > 0 {
+		aud = fs.Audience
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, oidc.IdTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    fs.URL,
+			Subject:   fs.Subject,
+			Audience:  jwt.ClaimStrings{aud},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+		Nonce:         nonce,
+		Email:         fs.Email,
+		EmailVerified: fs.EmailVerified,
+	})
+
+	idToken.Header["kid"] = FakeKeyId
+
+	signed, err := idToken.SignedString(fs.Key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, oidc.TokenResponse{
+		AccessToken: crypto.RandomHex(16),
+		TokenType:   "Bearer",
+		IdToken:     signed,
+		ExpiresIn:   60,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,339 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/yandzee/go-svc/identity"
+	id_http "github.com/yandzee/go-svc/identity/http"
+	"github.com/yandzee/go-svc/identity/oidc"
+	"github.com/yandzee/go-svc/router"
+	stdrouter "github.com/yandzee/go-svc/router/std"
+	idtest "github.com/yandzee/go-svc/tests/identity"
+)
+
+const (
+	ConnectorName = "fake"
+	LoginURL      = "/auth/oidc/fake"
+	CallbackURL   = "/auth/oidc/callback"
+	RedirectURL   = "http://app.test" + CallbackURL
+)
+
+// NOTE: Usernames are used as email addresses
+type LinkingRegistry struct {
+	*idtest.MockUserRegistry
+
+	Links map[string]*idtest.TestUser
+}
+
+func (lr *LinkingRegistry) GetUserByExternalIdentity(
+	ctx context.Context,
+	provider, subject string,
+) (*idtest.TestUser, error) {
+	return lr.Links[provider+"|"+subject], nil
+}
+
+func (lr *LinkingRegistry) LinkExternalIdentity(
+	ctx context.Context,
+	usr *idtest.TestUser,
+	ext oidc.ExternalIdentity,
+) error {
+	lr.Links[ext.Provider+"|"+ext.Subject] = usr
+	return nil
+}
+
+func (lr *LinkingRegistry) GetUserByEmail(ctx context.Context, email string) (*idtest.TestUser, error) {
+	return lr.Users[email], nil
+}
+
+func (lr *LinkingRegistry) GetUserEmail(ctx context.Context, usr *idtest.TestUser) (identity.UserEmail, error) {
+	return identity.UserEmail{Address: usr.Username, IsVerified: true}, nil
+}
+
+func (lr *LinkingRegistry) MarkEmailVerified(ctx context.Context, usr *idtest.TestUser, email string) error {
+	return nil
+}
+
+func (lr *LinkingRegistry) UpdateCredentials(
+	ctx context.Context,
+	usr *idtest.TestUser,
+	creds identity.Credentials,
+) error {
+	return nil
+}
+
+func TestOIDCSignupAndLinkedSignin(t *testing.T) {
+	fake := NewFakeServer(t)
+	fake.Email = "new@example.com"
+
+	handler, registry := oidcSetup(t, fake)
+
+	resp := oidcLogin(t, handler, fake)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("oidc signin: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if len(resp.Header().Get(idtest.AccessHeaderName)) == 0 {
+		t.Fatalf("expected access token to be issued")
+	}
+
+	created, isLinked := registry.Links[ConnectorName+"|"+fake.Subject]
+	if !isLinked || created.Username != "new@example.com" {
+		t.Fatalf("expected user to be created and linked, got %+v", created)
+	}
+
+	// NOTE: Email change at the provider does not matter once linked
+	fake.Email = "changed@example.com"
+
+	if resp := oidcLogin(t, handler, fake); resp.Code != http.StatusOK {
+		t.Fatalf("linked signin: expected 200, got %d", resp.Code)
+	}
+
+	if len(registry.Users) != 2 {
+		t.Fatalf("expected no extra users to be created, got %d", len(registry.Users))
+	}
+}
+
+func TestOIDCLinksByVerifiedEmail(t *testing.T) {
+	fake := NewFakeServer(t)
+	handler, registry := oidcSetup(t, fake)
+
+	existing := registry.Users["alice@example.com"]
+
+	if resp := oidcLogin(t, handler, fake); resp.Code != http.StatusOK {
+		t.Fatalf("oidc signin: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if registry.Links[ConnectorName+"|"+fake.Subject] != existing {
+		t.Fatalf("expected existing user to be linked")
+	}
+
+	// NOTE: Unverified email must not take over local accounts
+	fake.Subject = "ext-user-2"
+	fake.EmailVerified = false
+
+	resp := oidcLogin(t, handler, fake)
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("unverified email: expected 401, got %d", resp.Code)
+	}
+
+	if _, isLinked := registry.Links[ConnectorName+"|ext-user-2"]; isLinked {
+		t.Fatalf("unverified identity must not be linked")
+	}
+}
+
+func TestOIDCRejectsTamperedIdTokens(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Tamper func(*FakeServer)
+	}{
+		{"nonce mismatch", func(fs *FakeServer) { fs.Nonce = "other-nonce" }},
+		{"wrong audience", func(fs *FakeServer) { fs.Audience = "other-client" }},
+		{"foreign signing key", func(fs *FakeServer) {
+			other := NewFakeServer(t)
+			fs.Key = other.Key
+		}},
+	}
+
+	for _, tc := range cases {
+		fake := NewFakeServer(t)
+		handler, _ := oidcSetup(t, fake)
+
+		// NOTE: Keys are fetched before tampering, as a real client would have
+		if resp := oidcLogin(t, handler, fake); resp.Code != http.StatusOK {
+			t.Fatalf("%s: initial signin failed with %d", tc.Name, resp.Code)
+		}
+
+		tc.Tamper(fake)
+
+		if resp := oidcLogin(t, handler, fake); resp.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: expected 401, got %d", tc.Name, resp.Code)
+		}
+	}
+}
+
+func TestOIDCStateChecks(t *testing.T) {
+	fake := NewFakeServer(t)
+	handler, _ := oidcSetup(t, fake)
+
+	state, callback := oidcAuthorize(t, handler, fake)
+
+	if resp := oidcCallback(handler, callback, "other-state"); resp.Code != http.StatusBadRequest {
+		t.Fatalf("cookie mismatch: expected 400, got %d", resp.Code)
+	}
+
+	if resp := oidcCallback(handler, callback, state); resp.Code != http.StatusOK {
+		t.Fatalf("callback: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if resp := oidcCallback(handler, callback, state); resp.Code != http.StatusBadRequest {
+		t.Fatalf("replayed state: expected 400, got %d", resp.Code)
+	}
+
+	state, _ = oidcAuthorize(t, handler, fake)
+	denied := CallbackURL + "?" + url.Values{
+		"state": {state},
+		"error": {"access_denied"},
+	}.Encode()
+
+	if resp := oidcCallback(handler, denied, state); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("provider error: expected 401, got %d", resp.Code)
+	}
+}
+
+func TestOIDCPKCEVerifierMismatch(t *testing.T) {
+	fake := NewFakeServer(t)
+
+	conn := oidc.NewConnector(oidc.Config{
+		Name:         ConnectorName,
+		Issuer:       fake.URL,
+		ClientId:     FakeClientId,
+		ClientSecret: FakeClientSecret,
+		RedirectURL:  RedirectURL,
+	})
+
+	authURL, err := conn.AuthCodeURL(t.Context(), "state", "nonce", oidc.NewCodeVerifier())
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed: %s", err.Error())
+	}
+
+	code := fakeAuthorize(t, authURL).Query().Get("code")
+
+	_, err = conn.Exchange(t.Context(), code, oidc.NewCodeVerifier())
+
+	authErr := &oidc.AuthError{}
+	if !errors.As(err, &authErr) || authErr.Code != "invalid_grant" {
+		t.Fatalf("expected invalid_grant error, got %v", err)
+	}
+}
+
+func oidcSetup(t *testing.T, fake *FakeServer) (http.Handler, *LinkingRegistry) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err.Error())
+	}
+
+	registry := &LinkingRegistry{
+		MockUserRegistry: &idtest.MockUserRegistry{
+			Users: map[string]*idtest.TestUser{},
+		},
+		Links: map[string]*idtest.TestUser{},
+	}
+
+	_, _ = registry.CreateUser(t.Context(), &identity.UserStub{
+		Credentials: identity.Credentials{
+			"username": "alice@example.com",
+			"password": "password",
+		},
+	})
+
+	provider := oidc.New(&identity.RegistryProvider[idtest.TestUser]{
+		Registry:             registry,
+		TokenPrivateKey:      key,
+		AccessTokenDuration:  time.Minute,
+		RefreshTokenDuration: time.Hour,
+	}, oidc.NewConnector(oidc.Config{
+		Name:         ConnectorName,
+		Issuer:       fake.URL,
+		ClientId:     FakeClientId,
+		ClientSecret: FakeClientSecret,
+		RedirectURL:  RedirectURL,
+		HTTPClient:   fake.Client(),
+	}))
+
+	ep := &id_http.IdentityEndpoint[idtest.TestUser]{
+		Provider:           provider,
+		AccessTokenHeader:  idtest.AccessHeaderName,
+		RefreshTokenHeader: idtest.RefreshHeaderName,
+		TokenPrivateKey:    key,
+	}
+
+	r := router.NewBuilder()
+	r.Get(LoginURL, ep.OIDCLogin(ConnectorName))
+	r.Get(CallbackURL, ep.OIDCCallback())
+
+	return stdrouter.Build(&r), registry
+}
+
+func oidcLogin(t *testing.T, handler http.Handler, fake *FakeServer) *httptest.ResponseRecorder {
+	t.Helper()
+
+	state, callback := oidcAuthorize(t, handler, fake)
+	return oidcCallback(handler, callback, state)
+}
+
+// NOTE: Returns state cookie and callback URL the provider redirected to
+func oidcAuthorize(t *testing.T, handler http.Handler, fake *FakeServer) (string, string) {
+	t.Helper()
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, LoginURL, nil))
+
+	if resp.Code != http.StatusFound {
+		t.Fatalf("login: expected 302, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	state := ""
+	for _, cookie := range resp.Result().Cookies() {
+		if cookie.Name == id_http.OIDCStateCookie {
+			state = cookie.Value
+		}
+	}
+
+	if len(state) == 0 {
+		t.Fatalf("login: expected state cookie to be set")
+	}
+
+	callback := fakeAuthorize(t, resp.Header().Get("Location"))
+	if callback.Query().Get("state") != state {
+		t.Fatalf("provider returned unexpected state")
+	}
+
+	return state, callback.RequestURI()
+}
+
+func fakeAuthorize(t *testing.T, authURL string) *url.URL {
+	t.Helper()
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize request failed: %s", err.Error())
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: expected 302, got %d", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize: invalid redirect: %s", err.Error())
+	}
+
+	return location
+}
+
+func oidcCallback(handler http.Handler, callback, state string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, callback, nil)
+	req.AddCookie(&http.Cookie{Name: id_http.OIDCStateCookie, Value: state})
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	return resp
+}
@@ -0,0 +1,175 @@
+package password
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/identity/password"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// NOTE: Cheap parameters to keep tests fast
+var testParams = password.Argon2idParams{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestArgon2idHashAndVerify(t *testing.T) {
+	h := password.NewHasher(testParams)
+
+	encoded, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("hash failed: %s", err.Error())
+	}
+
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("unexpected PHC string: %s", encoded)
+	}
+
+	again, _ := h.Hash("correct horse")
+	if again == encoded {
+		t.Fatalf("expected random salt to produce different hashes")
+	}
+
+	v, err := h.Verify("correct horse", encoded)
+	if err != nil || !v.IsMatch || v.NeedsRehash {
+		t.Fatalf("expected match without rehash, got %+v, %v", v, err)
+	}
+
+	v, err = h.Verify("wrong horse", encoded)
+	if err != nil || v.IsMatch {
+		t.Fatalf("expected mismatch, got %+v, %v", v, err)
+	}
+}
+
+func TestRehashOnParamsChange(t *testing.T) {
+	old := password.NewHasher(testParams)
+
+	encoded, err := old.Hash("secret")
+	if err != nil {
+		t.Fatalf("hash failed: %s", err.Error())
+	}
+
+	stronger := testParams
+	stronger.Iterations = 2
+
+	h := password.NewHasher(stronger)
+	stored := encoded
+
+	ok, err := h.Check("secret", stored, func(rehashed string) error {
+		stored = rehashed
+		return nil
+	})
+
+	if err != nil || !ok {
+		t.Fatalf("check failed: %v", err)
+	}
+
+	if stored == encoded || !strings.Contains(stored, "t=2") {
+		t.Fatalf("expected hash to be upgraded, got %s", stored)
+	}
+
+	ok, err = h.Check("secret", stored, func(string) error {
+		t.Fatalf("up to date hash must not be rehashed")
+		return nil
+	})
+
+	if err != nil || !ok {
+		t.Fatalf("check of upgraded hash failed: %v", err)
+	}
+
+	ok, _ = h.Check("wrong", stored, func(string) error {
+		t.Fatalf("mismatched password must not be rehashed")
+		return nil
+	})
+
+	if ok {
+		t.Fatalf("expected mismatch")
+	}
+}
+
+func TestLegacyBcrypt(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt failed: %s", err.Error())
+	}
+
+	h := password.NewHasher(testParams)
+
+	v, err := h.Verify("secret", string(legacy))
+	if err != nil || !v.IsMatch || !v.NeedsRehash {
+		t.Fatalf("expected bcrypt match with rehash, got %+v, %v", v, err)
+	}
+
+	v, err = h.Verify("wrong", string(legacy))
+	if err != nil || v.IsMatch {
+		t.Fatalf("expected bcrypt mismatch, got %+v, %v", v, err)
+	}
+}
+
+func TestLegacyScrypt(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+
+	key, err := scrypt.Key([]byte("secret"), salt, 1<<10, 8, 1, 32)
+	if err != nil {
+		t.Fatalf("scrypt failed: %s", err.Error())
+	}
+
+	b64 := base64.RawStdEncoding
+	legacy := fmt.Sprintf("$scrypt$ln=10,r=8,p=1$%s$%s", b64.EncodeToString(salt), b64.EncodeToString(key))
+
+	h := password.NewHasher(testParams)
+
+	v, err := h.Verify("secret", legacy)
+	if err != nil || !v.IsMatch || !v.NeedsRehash {
+		t.Fatalf("expected scrypt match with rehash, got %+v, %v", v, err)
+	}
+
+	v, err = h.Verify("wrong", legacy)
+	if err != nil || v.IsMatch {
+		t.Fatalf("expected scrypt mismatch, got %+v, %v", v, err)
+	}
+}
+
+func TestMalformedHashes(t *testing.T) {
+	h := password.NewHasher(testParams)
+
+	cases := map[string]error{
+		"plain":                                 password.ErrUnknownFormat,
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA":  password.ErrMalformedHash,
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdA$aGk": password.ErrMalformedHash,
+		"$argon2id$v=19$m=1024,t=1,p=1$!!$aGk":  password.ErrMalformedHash,
+		"$scrypt$ln=99,r=8,p=1$c2FsdA$aGk":      password.ErrMalformedHash,
+		"$2b$10$short":                          password.ErrMalformedHash,
+	}
+
+	for encoded, expected := range cases {
+		if _, err := h.Verify("secret", encoded); !errors.Is(err, expected) {
+			t.Fatalf("%q: expected %v, got %v", encoded, expected, err)
+		}
+	}
+}
+
+func TestUtilsPasswordHasher(t *testing.T) {
+	hasher := &identity.Utils{
+		Passwords: password.NewHasher(testParams),
+	}
+
+	encoded, err := hasher.HashPassword("secret")
+	if err != nil {
+		t.Fatalf("hash failed: %s", err.Error())
+	}
+
+	ok, err := hasher.CheckPassword("secret", encoded, nil)
+	if err != nil || !ok {
+		t.Fatalf("expected password to match: %v", err)
+	}
+}
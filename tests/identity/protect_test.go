@@ -0,0 +1,97 @@
+package identity
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/yandzee/go-svc/identity"
+	id_http "github.com/yandzee/go-svc/identity/http"
+	"github.com/yandzee/go-svc/router"
+)
+
+func TestProtectInjectsUser(t *testing.T) {
+	guardCalls := 0
+
+	whoami := func(rctx *router.RequestContext) {
+		usr, isOk := id_http.UserFrom[TestUser](rctx)
+		if !isOk {
+			rctx.Response.String(http.StatusOK, "anonymous")
+			return
+		}
+
+		rctx.Response.String(http.StatusOK, usr.Username)
+	}
+
+	counting := func(next router.Handler) router.Handler {
+		return func(rctx *router.RequestContext) {
+			if _, isOk := id_http.GuardResultFrom[TestUser](rctx); isOk {
+				guardCalls += 1
+			}
+
+			next(rctx)
+		}
+	}
+
+	te := setupEndpoint(t, TestDescriptor{
+		Routes: func(b *router.Builder, ep *id_http.IdentityEndpoint[TestUser]) {
+			b.Get("/protected", ep.Protect(whoami))
+			b.Get("/optional", whoami).Use(ep.Middleware(id_http.GuardOptions{IsOptional: true}))
+			b.Get("/chained", whoami).Use(ep.Middleware(), counting)
+			b.Get("/plain", whoami)
+		},
+	})
+
+	handler := te.Handler
+	signin := signinTestUser(t, te.Provider, TestUsername, TestPassword)
+
+	cases := []struct {
+		Path     string
+		Tokens   identity.TokenPair
+		Expected int
+		Body     string
+	}{
+		{"/protected", signin.Tokens, http.StatusOK, TestUsername},
+		{"/protected", identity.TokenPair{}, http.StatusUnauthorized, ""},
+		{"/optional", identity.TokenPair{}, http.StatusOK, "anonymous"},
+		{"/optional", signin.Tokens, http.StatusOK, TestUsername},
+		{"/chained", signin.Tokens, http.StatusOK, TestUsername},
+		{"/plain", signin.Tokens, http.StatusOK, "anonymous"},
+	}
+
+	for _, tc := range cases {
+		resp := serveWithTokens(handler, http.MethodGet, tc.Path, tc.Tokens)
+
+		if resp.Code != tc.Expected {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.Path, tc.Expected, resp.Code, resp.Body.String())
+		}
+
+		if len(tc.Body) > 0 && strings.TrimSpace(resp.Body.String()) != tc.Body {
+			t.Fatalf("%s: expected body %q, got %q", tc.Path, tc.Body, resp.Body.String())
+		}
+	}
+
+	if guardCalls != 1 {
+		t.Fatalf("expected guard result to be visible to inner middleware, got %d", guardCalls)
+	}
+}
+
+func TestProtectRejectsMissingUser(t *testing.T) {
+	te := setupEndpoint(t, TestDescriptor{
+		Routes: func(b *router.Builder, ep *id_http.IdentityEndpoint[TestUser]) {
+			b.Get("/protected", ep.Protect(func(rctx *router.RequestContext) {
+				rctx.Response.String(http.StatusOK, "ok")
+			}))
+		},
+	})
+
+	signin := signinTestUser(t, te.Provider, TestUsername, TestPassword)
+
+	registry := te.Provider.Registry.(*MockUserRegistry)
+	delete(registry.Users, TestUsername)
+
+	resp := serveWithTokens(te.Handler, http.MethodGet, "/protected", signin.Tokens)
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for deleted user, got %d", resp.Code)
+	}
+}
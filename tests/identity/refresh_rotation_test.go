@@ -0,0 +1,94 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yandzee/go-svc/identity"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	provider := setupEndpoint(t, TestDescriptor{
+		RefreshTokens: identity.NewMemoryRefreshTokenStore(),
+	}).Provider
+	ctx := t.Context()
+
+	signin := signinTestUser(t, provider, TestUsername, TestPassword)
+	first := signin.Tokens.RefreshToken
+
+	second, err := provider.Refresh(ctx, first)
+	if err != nil {
+		t.Fatalf("first refresh failed: %s", err.Error())
+	}
+
+	if _, err := provider.Refresh(ctx, second.RefreshToken); err != nil {
+		t.Fatalf("refresh with rotated token failed: %s", err.Error())
+	}
+
+	if _, err := provider.Refresh(ctx, first); !errors.Is(err, identity.ErrRefreshTokenReused) {
+		t.Fatalf("expected reuse to be detected, got %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	provider := setupEndpoint(t, TestDescriptor{
+		RefreshTokens: identity.NewMemoryRefreshTokenStore(),
+	}).Provider
+	ctx := t.Context()
+
+	reused := 0
+	provider.OnRefreshTokenReuse = func(context.Context, *identity.RefreshTokenRecord) {
+		reused += 1
+	}
+
+	signin := signinTestUser(t, provider, TestUsername, TestPassword)
+	stolen := signin.Tokens.RefreshToken
+
+	legit, err := provider.Refresh(ctx, stolen)
+	if err != nil {
+		t.Fatalf("refresh failed: %s", err.Error())
+	}
+
+	if _, err := provider.Refresh(ctx, stolen); !errors.Is(err, identity.ErrRefreshTokenReused) {
+		t.Fatalf("expected reuse to be detected, got %v", err)
+	}
+
+	_, err = provider.Refresh(ctx, legit.RefreshToken)
+	if !errors.Is(err, identity.ErrRefreshTokenRevoked) {
+		t.Fatalf("expected whole family to be revoked, got %v", err)
+	}
+
+	if reused != 1 {
+		t.Fatalf("expected reuse hook to be called once, got %d", reused)
+	}
+
+	// NOTE: Other families of the same user are not affected
+	other := signinTestUser(t, provider, TestUsername, TestPassword)
+	if _, err := provider.Refresh(ctx, other.Tokens.RefreshToken); err != nil {
+		t.Fatalf("refresh of other family failed: %s", err.Error())
+	}
+}
+
+func TestRefreshEndpointRejectsReuse(t *testing.T) {
+	te := setupEndpoint(t, TestDescriptor{
+		RefreshTokens: identity.NewMemoryRefreshTokenStore(),
+	})
+
+	signin := signinTestUser(t, te.Provider, TestUsername, TestPassword)
+	rtoken := signin.Tokens.RefreshToken.JWTString
+
+	for _, expected := range []int{http.StatusOK, http.StatusUnauthorized} {
+		req := httptest.NewRequest(http.MethodPost, RefreshURL, nil)
+		req.Header.Set(RefreshHeaderName, rtoken)
+		resp := httptest.NewRecorder()
+
+		te.Handler.ServeHTTP(resp, req)
+
+		if resp.Code != expected {
+			t.Fatalf("expected status %d, got %d: %s", expected, resp.Code, resp.Body.String())
+		}
+	}
+}
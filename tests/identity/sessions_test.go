@@ -0,0 +1,292 @@
+package identity
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yandzee/go-svc/identity"
+)
+
+func TestSessionSignin(t *testing.T) {
+	te := setupEndpoint(t, TestDescriptor{
+		Sessions: identity.NewSessionOptions(identity.NewMemorySessionStore()),
+	})
+
+	handler, provider := te.Handler, te.Provider
+	signin := attemptSignin(t, handler, SigninAttempt{})
+
+	session := signin.Header().Get(AccessHeaderName)
+	if !identity.IsSessionToken(session) {
+		t.Fatalf("signin: expected session token, got %q", session)
+	}
+
+	if len(signin.Header().Get(RefreshHeaderName)) > 0 {
+		t.Fatalf("signin: expected no refresh token for sessions")
+	}
+
+	tokens := responseTokens(signin)
+
+	for _, url := range []string{AuthCheckURL, UserURL} {
+		if resp := serveWithTokens(handler, http.MethodGet, url, tokens); resp.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", url, resp.Code, resp.Body.String())
+		}
+	}
+
+	if resp := serveWithTokens(handler, http.MethodPost, RefreshURL, tokens); resp.Code != http.StatusBadRequest {
+		t.Fatalf("refresh: expected 400 without refresh token, got %d", resp.Code)
+	}
+
+	if resp := serveWithTokens(handler, http.MethodPost, SignoutURL, tokens); resp.Code != http.StatusOK {
+		t.Fatalf("signout: expected 200, got %d", resp.Code)
+	}
+
+	if resp := serveWithTokens(handler, http.MethodGet, AuthCheckURL, tokens); resp.Code != http.StatusUnauthorized {
+		t.Fatalf("check after signout: expected 401, got %d", resp.Code)
+	}
+
+	sessions, err := provider.ListSessions(t.Context(), te.User(t, TestUsername))
+	if err != nil || len(sessions) != 0 {
+		t.Fatalf("expected no sessions after signout, got %d", len(sessions))
+	}
+}
+
+func TestSessionSlidingExpiry(t *testing.T) {
+	sessions := identity.NewSessionOptions(identity.NewMemorySessionStore())
+	sessions.IdleTimeout = time.Hour
+	sessions.MaxLifetime = 90 * time.Minute
+	sessions.TouchInterval = time.Nanosecond
+
+	provider := setupEndpoint(t, TestDescriptor{Sessions: sessions}).Provider
+	tokens := signinTestUser(t, provider, TestUsername, TestPassword).Tokens
+	raw := tokens.AccessToken.JWTString
+
+	first := validateSession(t, provider, raw)
+	time.Sleep(time.Millisecond)
+	second := validateSession(t, provider, raw)
+
+	if !second.LastSeenAt.After(first.LastSeenAt) {
+		t.Fatalf("expected session last use to be updated")
+	}
+
+	if !second.ExpiresAt.After(first.ExpiresAt) {
+		t.Fatalf("expected session to be extended: %s -> %s", first.ExpiresAt, second.ExpiresAt)
+	}
+
+	id, _, _ := identity.ParseSessionToken(raw)
+
+	sess := second
+	sess.CreatedAt = time.Now().Add(-89 * time.Minute)
+	if err := provider.Sessions.Store.SaveSession(t.Context(), sess); err != nil {
+		t.Fatalf("failed to save session: %s", err.Error())
+	}
+
+	capped := validateSession(t, provider, raw)
+	if deadline := sess.CreatedAt.Add(90 * time.Minute); !capped.ExpiresAt.Equal(deadline) {
+		t.Fatalf("expected expiration capped by max lifetime %s, got %s", deadline, capped.ExpiresAt)
+	}
+
+	sess.ExpiresAt = time.Now().Add(-time.Second)
+	if err := provider.Sessions.Store.SaveSession(t.Context(), sess); err != nil {
+		t.Fatalf("failed to save session: %s", err.Error())
+	}
+
+	validated, err := provider.ValidateSessionToken(t.Context(), raw)
+	if err != nil || validated.IsValid() {
+		t.Fatalf("expected expired session to be rejected")
+	}
+
+	other, _ := identity.NewSession(uuid.New(), time.Now())
+	_, secret, _ := identity.ParseSessionToken(other)
+
+	forged := id + "." + secret
+	if validated, _ := provider.ValidateSessionToken(t.Context(), forged); validated.IsValid() {
+		t.Fatalf("expected session with wrong secret to be rejected")
+	}
+}
+
+func TestSessionRevokedDuringValidation(t *testing.T) {
+	store := &revokingSessionStore{MemorySessionStore: identity.NewMemorySessionStore()}
+
+	sessions := identity.NewSessionOptions(store)
+	sessions.TouchInterval = time.Nanosecond
+
+	provider := setupEndpoint(t, TestDescriptor{Sessions: sessions}).Provider
+	raw := signinTestUser(t, provider, TestUsername, TestPassword).Tokens.AccessToken.JWTString
+
+	time.Sleep(time.Millisecond)
+
+	validated, err := provider.ValidateSessionToken(t.Context(), raw)
+	if err != nil || validated.IsValid() {
+		t.Fatalf("expected session revoked during validation to be rejected: %v", err)
+	}
+
+	id, _, _ := identity.ParseSessionToken(raw)
+	if sess, _ := store.MemorySessionStore.GetSession(t.Context(), id); sess != nil {
+		t.Fatalf("expected revoked session not to be recreated")
+	}
+}
+
+func TestSessionListingAndSignoutAll(t *testing.T) {
+	te := setupEndpoint(t, TestDescriptor{
+		Sessions: identity.NewSessionOptions(identity.NewMemorySessionStore()),
+	})
+
+	handler, provider, usr := te.Handler, te.Provider, te.User(t, TestUsername)
+
+	var last *httptest.ResponseRecorder
+
+	for _, agent := range []string{"laptop", "phone"} {
+		last = attemptSignin(t, handler, SigninAttempt{UserAgent: agent})
+		time.Sleep(time.Millisecond)
+	}
+
+	sessions, err := provider.ListSessions(t.Context(), usr)
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	if sessions[0].Client.UserAgent != "phone" || sessions[1].Client.UserAgent != "laptop" {
+		t.Fatalf("expected most recent sessions first with client info: %+v", sessions)
+	}
+
+	if resp := serveWithTokens(handler, http.MethodPost, SignoutURL+"?all=true", responseTokens(last)); resp.Code != http.StatusOK {
+		t.Fatalf("signout all: expected 200, got %d", resp.Code)
+	}
+
+	if sessions, _ := provider.ListSessions(t.Context(), usr); len(sessions) != 0 {
+		t.Fatalf("expected all sessions to be removed, got %d", len(sessions))
+	}
+}
+
+func TestFileSessionStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sessions")
+
+	store, err := identity.NewFileSessionStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %s", err.Error())
+	}
+
+	userId := uuid.New()
+	now := time.Now()
+
+	raw, sess := identity.NewSession(userId, now)
+	sess.ExpiresAt = now.Add(time.Hour)
+	sess.Claims = map[string]any{"roles": []any{"admin"}}
+
+	_, other := identity.NewSession(userId, now)
+	other.ExpiresAt = now.Add(time.Hour)
+
+	for _, s := range []*identity.Session{sess, other} {
+		if err := store.SaveSession(t.Context(), s); err != nil {
+			t.Fatalf("failed to save session: %s", err.Error())
+		}
+	}
+
+	reopened, _ := identity.NewFileSessionStore(dir)
+
+	loaded, err := reopened.GetSession(t.Context(), sess.Id)
+	if err != nil || loaded == nil {
+		t.Fatalf("expected session to survive reopening: %v", err)
+	}
+
+	_, secret, _ := identity.ParseSessionToken(raw)
+	if !loaded.CheckSecret(secret) || loaded.Claims["roles"] == nil {
+		t.Fatalf("expected secret hash and claims to be persisted: %+v", loaded)
+	}
+
+	if sessions, _ := reopened.ListSessions(t.Context(), userId); len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	if touched, _ := reopened.TouchSession(t.Context(), other.Id, now, now.Add(2*time.Hour)); !touched {
+		t.Fatalf("expected stored session to be touched")
+	}
+
+	if loaded, _ := reopened.GetSession(t.Context(), other.Id); !loaded.ExpiresAt.Equal(now.Add(2 * time.Hour)) {
+		t.Fatalf("expected touched session to be extended, got %s", loaded.ExpiresAt)
+	}
+
+	if deleted, _ := reopened.DeleteSession(t.Context(), sess.Id); !deleted {
+		t.Fatalf("expected session to be deleted")
+	}
+
+	if touched, _ := reopened.TouchSession(t.Context(), sess.Id, now, now.Add(time.Hour)); touched {
+		t.Fatalf("expected deleted session not to be touched")
+	}
+
+	if loaded, _ := reopened.GetSession(t.Context(), sess.Id); loaded != nil {
+		t.Fatalf("expected deleted session not to be recreated")
+	}
+
+	if loaded, _ := reopened.GetSession(t.Context(), "../../etc/passwd"); loaded != nil {
+		t.Fatalf("expected invalid id to be rejected")
+	}
+
+	if err := reopened.DeleteUserSessions(t.Context(), userId); err != nil {
+		t.Fatalf("failed to delete user sessions: %s", err.Error())
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Fatalf("expected no session files left, got %d", len(entries))
+	}
+}
+
+func TestSessionsWithFileStore(t *testing.T) {
+	store, err := identity.NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %s", err.Error())
+	}
+
+	handler := setupEndpoint(t, TestDescriptor{
+		Sessions: identity.NewSessionOptions(store),
+	}).Handler
+
+	tokens := responseTokens(attemptSignin(t, handler, SigninAttempt{}))
+
+	if resp := serveWithTokens(handler, http.MethodGet, UserURL, tokens); resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+// NOTE: Deletes every session right after it is read, as if it was revoked
+// by a concurrent request
+type revokingSessionStore struct {
+	*identity.MemorySessionStore
+}
+
+func (s *revokingSessionStore) GetSession(ctx context.Context, id string) (*identity.Session, error) {
+	sess, err := s.MemorySessionStore.GetSession(ctx, id)
+	if sess != nil {
+		_, err = s.MemorySessionStore.DeleteSession(ctx, id)
+	}
+
+	return sess, err
+}
+
+// NOTE: Returns session as stored after validation
+func validateSession(
+	t *testing.T,
+	provider *identity.RegistryProvider[TestUser],
+	raw string,
+) *identity.Session {
+	t.Helper()
+
+	validated, err := provider.ValidateSessionToken(t.Context(), raw)
+	if err != nil || !validated.IsValid() {
+		t.Fatalf("expected session to be valid: %v", err)
+	}
+
+	sess, err := provider.Sessions.Store.GetSession(t.Context(), validated.Token.Claims().ID)
+	if err != nil || sess == nil {
+		t.Fatalf("expected session to be stored")
+	}
+
+	return sess
+}
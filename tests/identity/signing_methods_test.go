@@ -0,0 +1,168 @@
+package identity
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yandzee/go-svc/identity"
+)
+
+func TestSigningMethods(t *testing.T) {
+	methods := []struct {
+		Method  jwt.SigningMethod
+		KeyType string
+	}{
+		{jwt.SigningMethodES256, "EC"},
+		{jwt.SigningMethodES384, "EC"},
+		{jwt.SigningMethodES512, "EC"},
+		{jwt.SigningMethodRS256, "RSA"},
+		{jwt.SigningMethodPS256, "RSA"},
+		{jwt.SigningMethodEdDSA, "OKP"},
+		{jwt.SigningMethodHS256, ""},
+		{jwt.SigningMethodHS512, ""},
+	}
+
+	for _, tc := range methods {
+		t.Run(tc.Method.Alg(), func(t *testing.T) {
+			key, err := identity.GenerateSigningKey(tc.Method)
+			if err != nil {
+				t.Fatalf("key generation failed: %s", err.Error())
+			}
+
+			te := setupEndpoint(t, TestDescriptor{Keys: identity.NewKeyring(key)})
+			provider, handler := te.Provider, te.Handler
+			signin := signinTestUser(t, provider, TestUsername, TestPassword)
+
+			if alg := signin.Tokens.AccessToken.JWT.Header["alg"]; alg != tc.Method.Alg() {
+				t.Fatalf("expected token to be signed with %s, got %v", tc.Method.Alg(), alg)
+			}
+
+			resp := serveWithTokens(handler, http.MethodGet, AuthCheckURL, identity.TokenPair{
+				AccessToken: signin.Tokens.AccessToken,
+			})
+
+			if resp.Code != http.StatusOK {
+				t.Fatalf("expected token to be valid, got %d: %s", resp.Code, resp.Body.String())
+			}
+
+			resp = serveWithTokens(handler, http.MethodGet, JWKSURL, identity.TokenPair{})
+
+			set := identity.JWKSet{}
+			if err := json.Unmarshal(resp.Body.Bytes(), &set); err != nil {
+				t.Fatalf("failed to decode JWKS: %s", err.Error())
+			}
+
+			if len(tc.KeyType) == 0 {
+				if len(set.Keys) != 0 {
+					t.Fatalf("HMAC secret must not be published: %+v", set.Keys)
+				}
+
+				return
+			}
+
+			if len(set.Keys) != 1 {
+				t.Fatalf("expected single published key, got %+v", set.Keys)
+			}
+
+			jwk := set.Keys[0]
+			if jwk.KeyType != tc.KeyType || jwk.Algorithm != tc.Method.Alg() || jwk.KeyId != key.Id {
+				t.Fatalf("unexpected JWK: %+v", jwk)
+			}
+		})
+	}
+}
+
+func TestTokenPrivateKeySigningMethod(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err.Error())
+	}
+
+	te := setupEndpoint(t, TestDescriptor{
+		PrivateKey:    rsaKey,
+		SigningMethod: jwt.SigningMethodRS384,
+	})
+
+	provider, handler := te.Provider, te.Handler
+
+	signin := signinTestUser(t, provider, TestUsername, TestPassword)
+	if alg := signin.Tokens.AccessToken.JWT.Header["alg"]; alg != "RS384" {
+		t.Fatalf("expected RS384 token, got %v", alg)
+	}
+
+	resp := serveWithTokens(handler, http.MethodGet, AuthCheckURL, identity.TokenPair{
+		AccessToken: signin.Tokens.AccessToken,
+	})
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected token to be valid, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestSigningMethodConfusionRejected(t *testing.T) {
+	key, err := identity.GenerateSigningKey(jwt.SigningMethodRS256)
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err.Error())
+	}
+
+	handler := setupEndpoint(t, TestDescriptor{Keys: identity.NewKeyring(key)}).Handler
+
+	// NOTE: HS256 token using public key as secret must not pass
+	pub := key.VerificationKey().(*rsa.PublicKey)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   "0198d3d2-7a4f-7000-8000-000000000000",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	})
+	token.Header["kid"] = key.Id
+
+	forged, err := token.SignedString(pub.N.Bytes())
+	if err != nil {
+		t.Fatalf("failed to sign forged token: %s", err.Error())
+	}
+
+	resp := serveWithTokens(handler, http.MethodGet, AuthCheckURL, identity.TokenPair{
+		AccessToken: &identity.Token{JWTString: forged},
+	})
+
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("expected forged token to be rejected, got %d", resp.Code)
+	}
+}
+
+func TestSigningKeyValidation(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err.Error())
+	}
+
+	weakRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("key generation failed: %s", err.Error())
+	}
+
+	invalid := []struct {
+		Name   string
+		Key    any
+		Method jwt.SigningMethod
+	}{
+		{"CurveMismatch", p256, jwt.SigningMethodES384},
+		{"KeyTypeMismatch", p256, jwt.SigningMethodRS256},
+		{"WeakRSA", weakRSA, jwt.SigningMethodRS256},
+		{"ShortSecret", []byte("short"), jwt.SigningMethodHS256},
+		{"UnknownKeyType", "secret", nil},
+	}
+
+	for _, tc := range invalid {
+		if _, err := identity.NewSigningKey(tc.Key, tc.Method); err == nil {
+			t.Fatalf("%s: expected NewSigningKey to fail", tc.Name)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package identity
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/yandzee/go-svc/identity"
+)
+
+func TestSignoutRevokesTokens(t *testing.T) {
+	te := setupEndpoint(t, TestDescriptor{
+		RefreshTokens: identity.NewMemoryRefreshTokenStore(),
+		Denylist:      identity.NewMemoryTokenDenylist(),
+	})
+	handler := te.Handler
+	signin := signinTestUser(t, te.Provider, TestUsername, TestPassword)
+
+	resp := serveWithTokens(handler, http.MethodPost, SignoutURL, signin.Tokens)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("signout failed with %d: %s", resp.Code, resp.Body.String())
+	}
+
+	cleared := false
+	for _, c := range resp.Result().Cookies() {
+		if c.Name == AccessHeaderName && c.MaxAge < 0 && len(c.Value) == 0 {
+			cleared = true
+		}
+	}
+
+	if !cleared {
+		t.Fatalf("expected access token cookie to be cleared")
+	}
+
+	resp = serveWithTokens(handler, http.MethodGet, AuthCheckURL, identity.TokenPair{
+		AccessToken: signin.Tokens.AccessToken,
+	})
+
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("expected revoked access token to be rejected, got %d", resp.Code)
+	}
+
+	resp = serveWithTokens(handler, http.MethodPost, RefreshURL, identity.TokenPair{
+		RefreshToken: signin.Tokens.RefreshToken,
+	})
+
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("expected revoked refresh token to be rejected, got %d", resp.Code)
+	}
+}
+
+func TestSignoutAllSessions(t *testing.T) {
+	te := setupEndpoint(t, TestDescriptor{
+		RefreshTokens: identity.NewMemoryRefreshTokenStore(),
+		Denylist:      identity.NewMemoryTokenDenylist(),
+	})
+	handler := te.Handler
+
+	first := signinTestUser(t, te.Provider, TestUsername, TestPassword)
+	second := signinTestUser(t, te.Provider, TestUsername, TestPassword)
+
+	resp := serveWithTokens(handler, http.MethodPost, SignoutURL+"?all=true", first.Tokens)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("signout failed with %d: %s", resp.Code, resp.Body.String())
+	}
+
+	resp = serveWithTokens(handler, http.MethodPost, RefreshURL, identity.TokenPair{
+		RefreshToken: second.Tokens.RefreshToken,
+	})
+
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("expected refresh token of other session to be revoked, got %d", resp.Code)
+	}
+
+	// NOTE: Access token of other session is not known to the denylist
+	resp = serveWithTokens(handler, http.MethodGet, AuthCheckURL, identity.TokenPair{
+		AccessToken: second.Tokens.AccessToken,
+	})
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected access token of other session to stay valid, got %d", resp.Code)
+	}
+}
+
+func TestSignoutAllSessionsWithoutStore(t *testing.T) {
+	te := setupEndpoint(t, TestDescriptor{
+		Denylist: identity.NewMemoryTokenDenylist(),
+	})
+
+	signin := signinTestUser(t, te.Provider, TestUsername, TestPassword)
+
+	err := te.Provider.SignOut(t.Context(), identity.SignoutRequest{
+		AccessToken: signin.Tokens.AccessToken,
+		AllSessions: true,
+	})
+
+	if !errors.Is(err, identity.ErrRefreshTokensNotEnabled) {
+		t.Fatalf("expected ErrRefreshTokensNotEnabled, got %v", err)
+	}
+
+	resp := serveWithTokens(te.Handler, http.MethodPost, SignoutURL+"?all=true", signin.Tokens)
+	if resp.Code != http.StatusNotImplemented {
+		t.Fatalf("expected signout of all sessions to be unsupported, got %d", resp.Code)
+	}
+
+	// NOTE: Unsupported signout has no side effects
+	resp = serveWithTokens(te.Handler, http.MethodGet, AuthCheckURL, signin.Tokens)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected access token to stay valid, got %d", resp.Code)
+	}
+}
+
+func TestRefreshDeniedWithoutStore(t *testing.T) {
+	te := setupEndpoint(t, TestDescriptor{
+		Denylist: identity.NewMemoryTokenDenylist(),
+	})
+
+	signin := signinTestUser(t, te.Provider, TestUsername, TestPassword)
+
+	err := te.Provider.SignOut(t.Context(), identity.SignoutRequest{
+		RefreshToken: signin.Tokens.RefreshToken,
+	})
+
+	if err != nil {
+		t.Fatalf("signout failed: %s", err.Error())
+	}
+
+	_, err = te.Provider.Refresh(t.Context(), signin.Tokens.RefreshToken)
+	if !errors.Is(err, identity.ErrRefreshTokenRevoked) {
+		t.Fatalf("expected ErrRefreshTokenRevoked, got %v", err)
+	}
+}
+
+func TestSignoutWithoutTokens(t *testing.T) {
+	runTests(t, []TestDescriptor{
+		{
+			RefreshTokens: identity.NewMemoryRefreshTokenStore(),
+			Denylist:      identity.NewMemoryTokenDenylist(),
+			Steps: func(h *StepsHandle) {
+				step := h.Signout(identity.TokenPair{}, false)
+				step.ExpectStatus(http.StatusOK)
+
+				// NOTE: Signout of all sessions requires access token
+				step = h.Signout(identity.TokenPair{}, true)
+				step.ExpectStatus(http.StatusUnauthorized)
+			},
+		},
+	})
+}
+
+func TestSignoutNotSupported(t *testing.T) {
+	te := setupEndpoint(t, TestDescriptor{})
+	signin := signinTestUser(t, te.Provider, TestUsername, TestPassword)
+
+	// NOTE: Provider implements only the core interface
+	te.Endpoint.Provider = struct{ identity.Provider[TestUser] }{te.Provider}
+
+	resp := serveWithTokens(te.Handler, http.MethodPost, SignoutURL, signin.Tokens)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected signout to succeed, got %d", resp.Code)
+	}
+
+	resp = serveWithTokens(te.Handler, http.MethodPost, SignoutURL+"?all=true", signin.Tokens)
+	if resp.Code != http.StatusNotImplemented {
+		t.Fatalf("expected signout of all sessions to be unsupported, got %d", resp.Code)
+	}
+}
+
+func TestMemoryTokenDenylist(t *testing.T) {
+	dl := identity.NewMemoryTokenDenylist()
+	ctx := t.Context()
+
+	if err := dl.Deny(ctx, "active", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("deny failed: %s", err.Error())
+	}
+
+	if err := dl.Deny(ctx, "expired", time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("deny failed: %s", err.Error())
+	}
+
+	for id, expected := range map[string]bool{
+		"active":  true,
+		"expired": false,
+		"unknown": false,
+	} {
+		isDenied, err := dl.IsDenied(ctx, id)
+		if err != nil {
+			t.Fatalf("IsDenied failed: %s", err.Error())
+		}
+
+		if isDenied != expected {
+			t.Fatalf("expected %q denied to be %v", id, expected)
+		}
+	}
+}
@@ -10,6 +10,39 @@ import (
 	"github.com/yandzee/go-svc/identity"
 )
 
+const (
+	AccessHeaderName  = "X-Test-Access-Token"
+	RefreshHeaderName = "X-Test-Refresh-Token"
+
+	AuthCheckURL = "/auth"
+	UserURL      = "/auth/user"
+	SignupURL    = "/auth/signup"
+	SigninURL    = "/auth/signin"
+	RefreshURL   = "/auth/refresh"
+	SignoutURL   = "/auth/signout"
+	JWKSURL      = "/auth/jwks"
+
+	MFAVerifyURL  = "/auth/mfa/verify"
+	MFAEnrollURL  = "/auth/mfa/enroll"
+	MFAConfirmURL = "/auth/mfa/confirm"
+	MFADisableURL = "/auth/mfa/disable"
+
+	VerifyEmailURL          = "/auth/email/verify"
+	EmailVerificationURL    = "/auth/email/verification"
+	PasswordResetRequestURL = "/auth/password/forgot"
+	PasswordResetURL        = "/auth/password/reset"
+
+	MagicLinkRequestURL = "/auth/magic/request"
+	MagicLinkSigninURL  = "/auth/magic/signin"
+
+	ApiKeysURL      = "/auth/keys"
+	ApiKeysListURL  = "/auth/keys/list"
+	ApiKeyRevokeURL = "/auth/keys/revoke"
+
+	SessionsURL      = "/auth/sessions"
+	SessionRevokeURL = "/auth/sessions/revoke"
+)
+
 type StepsHandle struct {
 	t *testing.T
 
@@ -34,7 +67,23 @@ func (sh *StepsHandle) CheckAuth(tokens identity.TokenPair, body any) *Step {
 
 func (sh *StepsHandle) Signin(creds identity.Credentials) *Step {
 	step := &Step{
-		Request: sh.Request(http.MethodPost, SigninURL, identity.TokenPair{}, identity.SigninRequest{}),
+		Request: sh.Request(http.MethodPost, SigninURL, identity.TokenPair{}, identity.SigninRequest{
+			Credentials: creds,
+		}),
+	}
+
+	sh.steps = append(sh.steps, step)
+	return step
+}
+
+func (sh *StepsHandle) Signout(tokens identity.TokenPair, allSessions bool) *Step {
+	url := SignoutURL
+	if allSessions {
+		url += "?all=true"
+	}
+
+	step := &Step{
+		Request: sh.Request(http.MethodPost, url, tokens, nil),
 	}
 
 	sh.steps = append(sh.steps, step)
@@ -42,7 +91,29 @@ func (sh *StepsHandle) Signin(creds identity.Credentials) *Step {
 }
 
 func (s *Step) ExpectStatus(statusCode int) {
-	s.ResponseCheckFn = makeRespChecker(statusCode)
+	s.expect(makeRespChecker(statusCode))
+}
+
+func (s *Step) ExpectHeader(name, value string) {
+	s.expect(func(t *testing.T, rr *httptest.ResponseRecorder) {
+		if got := rr.Header().Get(name); got != value {
+			t.Fatalf("RespChecker: expected header %s %q, but got %q", name, value, got)
+		}
+	})
+}
+
+// NOTE: Checks are run in order they were added
+func (s *Step) expect(check ResponseCheckFn) {
+	prev := s.ResponseCheckFn
+	if prev == nil {
+		s.ResponseCheckFn = check
+		return
+	}
+
+	s.ResponseCheckFn = func(t *testing.T, rr *httptest.ResponseRecorder) {
+		prev(t, rr)
+		check(t, rr)
+	}
 }
 
 func makeRespChecker(status int) ResponseCheckFn {
@@ -70,6 +141,9 @@ func (sh *StepsHandle) Request(
 		t.Fatalf("makeRequest failed on creaing new request: %s", err.Error())
 	}
 
+	// NOTE: Same client address as httptest requests have
+	req.RemoteAddr = "192.0.2.1:1234"
+
 	if tokens.AccessToken != nil {
 		req.Header.Add(AccessHeaderName, tokens.AccessToken.JWTString)
 
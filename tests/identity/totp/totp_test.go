@@ -0,0 +1,123 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/yandzee/go-svc/identity/totp"
+)
+
+// NOTE: Test vectors from RFC 6238 Appendix B
+func TestCodeRFCVectors(t *testing.T) {
+	secrets := map[totp.Algorithm]string{
+		totp.AlgorithmSHA1:   "12345678901234567890",
+		totp.AlgorithmSHA256: "12345678901234567890123456789012",
+		totp.AlgorithmSHA512: "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+
+	cases := []struct {
+		Unix      int64
+		Algorithm totp.Algorithm
+		Expected  string
+	}{
+		{59, totp.AlgorithmSHA1, "94287082"},
+		{59, totp.AlgorithmSHA256, "46119246"},
+		{59, totp.AlgorithmSHA512, "90693936"},
+		{1111111109, totp.AlgorithmSHA1, "07081804"},
+		{1111111109, totp.AlgorithmSHA256, "68084774"},
+		{1111111109, totp.AlgorithmSHA512, "25091201"},
+		{1234567890, totp.AlgorithmSHA1, "89005924"},
+		{1234567890, totp.AlgorithmSHA256, "91819424"},
+		{1234567890, totp.AlgorithmSHA512, "93441116"},
+	}
+
+	for _, tc := range cases {
+		secret := base32.StdEncoding.EncodeToString([]byte(secrets[tc.Algorithm]))
+		opts := totp.Options{Digits: 8, Algorithm: tc.Algorithm}
+
+		code, err := totp.Code(secret, time.Unix(tc.Unix, 0), opts)
+		if err != nil {
+			t.Fatalf("code generation failed: %s", err.Error())
+		}
+
+		if code != tc.Expected {
+			t.Fatalf("%s at %d: expected %s, got %s", tc.Algorithm, tc.Unix, tc.Expected, code)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	secret := totp.GenerateSecret()
+	now := time.Unix(1_700_000_000, 0)
+
+	cases := []struct {
+		Offset  time.Duration
+		IsValid bool
+	}{
+		{0, true},
+		{-30 * time.Second, true},
+		{30 * time.Second, true},
+		{-60 * time.Second, false},
+		{60 * time.Second, false},
+	}
+
+	for _, tc := range cases {
+		at := now.Add(tc.Offset)
+
+		code, err := totp.Code(secret, at)
+		if err != nil {
+			t.Fatalf("code generation failed: %s", err.Error())
+		}
+
+		step, isOk := totp.Validate(secret, code, now)
+		if isOk != tc.IsValid {
+			t.Fatalf("offset %s: expected validity %v, got %v", tc.Offset, tc.IsValid, isOk)
+		}
+
+		if isOk && step != totp.Step(at, totp.DefaultPeriod) {
+			t.Fatalf("offset %s: unexpected step %d", tc.Offset, step)
+		}
+	}
+
+	if _, isOk := totp.Validate(secret, "12345", now); isOk {
+		t.Fatalf("code of wrong length must be rejected")
+	}
+
+	if _, isOk := totp.Validate("not base32!", "123456", now); isOk {
+		t.Fatalf("invalid secret must be rejected")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := totp.URI("JBSWY3DPEHPK3PXP", "Example Co", "alice@example.com")
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("failed to parse uri: %s", err.Error())
+	}
+
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" {
+		t.Fatalf("unexpected uri prefix: %s", uri)
+	}
+
+	if parsed.Path != "/Example Co:alice@example.com" {
+		t.Fatalf("unexpected label: %s", parsed.Path)
+	}
+
+	q := parsed.Query()
+	expected := map[string]string{
+		"secret":    "JBSWY3DPEHPK3PXP",
+		"issuer":    "Example Co",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	}
+
+	for key, val := range expected {
+		if q.Get(key) != val {
+			t.Fatalf("expected %s=%s, got %q", key, val, q.Get(key))
+		}
+	}
+}
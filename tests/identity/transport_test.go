@@ -0,0 +1,190 @@
+package identity
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yandzee/go-svc/identity"
+	id_http "github.com/yandzee/go-svc/identity/http"
+)
+
+func TestBearerAccessToken(t *testing.T) {
+	handler := setupEndpoint(t, TestDescriptor{}).Handler
+	signin := attemptSignin(t, handler, SigninAttempt{})
+
+	req := httptest.NewRequest(http.MethodGet, AuthCheckURL, nil)
+	req.Header.Set("Authorization", "Bearer "+signin.Header().Get(AccessHeaderName))
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("bearer: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	handler = setupEndpoint(t, TestDescriptor{
+		Transport: &id_http.TokenTransport{BearerDisabled: true},
+	}).Handler
+	signin = attemptSignin(t, handler, SigninAttempt{})
+
+	req = httptest.NewRequest(http.MethodGet, AuthCheckURL, nil)
+	req.Header.Set("Authorization", "Bearer "+signin.Header().Get(AccessHeaderName))
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("bearer disabled: expected 401, got %d", resp.Code)
+	}
+}
+
+func TestCookieTransport(t *testing.T) {
+	handler := setupEndpoint(t, TestDescriptor{
+		Transport: &id_http.TokenTransport{
+			HeadersDisabled: true,
+			AccessCookie:    "access",
+			RefreshCookie:   "refresh",
+			Cookie: identity.CookieOptions{
+				Domain:   "example.com",
+				Secure:   true,
+				SameSite: http.SameSiteLaxMode,
+			},
+			RefreshCookieOptions: &identity.CookieOptions{
+				Path:   RefreshURL,
+				Secure: true,
+			},
+		},
+	}).Handler
+
+	signin := attemptSignin(t, handler, SigninAttempt{})
+
+	if len(signin.Header().Get(AccessHeaderName)) > 0 || len(signin.Header().Get(RefreshHeaderName)) > 0 {
+		t.Fatalf("expected no token headers when headers are disabled")
+	}
+
+	cookies := responseCookies(signin)
+	access, refresh := cookies["access"], cookies["refresh"]
+
+	if access == nil || refresh == nil {
+		t.Fatalf("expected access and refresh cookies, got %v", cookies)
+	}
+
+	if !access.Secure || !access.HttpOnly || access.Domain != "example.com" ||
+		access.SameSite != http.SameSiteLaxMode || access.Path != "/" {
+		t.Fatalf("unexpected access cookie: %+v", access)
+	}
+
+	if !refresh.Secure || refresh.Path != RefreshURL || refresh.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("unexpected refresh cookie: %+v", refresh)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, AuthCheckURL, nil)
+	req.AddCookie(&http.Cookie{Name: access.Name, Value: access.Value})
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("check by cookie: expected 200, got %d", resp.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, RefreshURL, nil)
+	req.AddCookie(&http.Cookie{Name: refresh.Name, Value: refresh.Value})
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK || responseCookies(resp)["refresh"] == nil {
+		t.Fatalf("refresh by cookie: expected 200 with new refresh cookie, got %d", resp.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, SignoutURL, nil)
+	req.AddCookie(&http.Cookie{Name: access.Name, Value: access.Value})
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	cookies = responseCookies(resp)
+
+	for _, name := range []string{"access", "refresh"} {
+		if cookies[name] == nil || cookies[name].MaxAge >= 0 {
+			t.Fatalf("signout: expected %s cookie to be cleared, got %+v", name, cookies[name])
+		}
+	}
+
+	if cookies["refresh"].Path != RefreshURL {
+		t.Fatalf("signout: expected refresh cookie to be cleared on its path")
+	}
+}
+
+func TestJSONBodyTransport(t *testing.T) {
+	handler := setupEndpoint(t, TestDescriptor{
+		Transport: &id_http.TokenTransport{
+			HeadersDisabled:      true,
+			AccessCookieDisabled: true,
+			JSONBody:             true,
+		},
+	}).Handler
+
+	signin := attemptSignin(t, handler, SigninAttempt{})
+
+	if len(responseCookies(signin)) > 0 {
+		t.Fatalf("expected no cookies in JSON body mode")
+	}
+
+	result := struct {
+		Tokens identity.StringTokenPair `json:"tokens"`
+	}{}
+
+	if err := json.Unmarshal(signin.Body.Bytes(), &result); err != nil || len(result.Tokens.RefreshToken) == 0 {
+		t.Fatalf("expected tokens in signin body: %s", signin.Body.String())
+	}
+
+	raw, _ := json.Marshal(id_http.RefreshTokenBody{RefreshToken: result.Tokens.RefreshToken})
+	req := httptest.NewRequest(http.MethodPost, RefreshURL, bytes.NewReader(raw))
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("refresh: expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	refreshed := identity.StringTokenPair{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &refreshed); err != nil || len(refreshed.AccessToken) == 0 {
+		t.Fatalf("expected tokens in refresh body: %s", resp.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, RefreshURL, bytes.NewReader([]byte("{")))
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("malformed body: expected 400, got %d", resp.Code)
+	}
+}
+
+func TestTokenCookieDefaults(t *testing.T) {
+	provider := setupEndpoint(t, TestDescriptor{}).Provider
+	tokens := signinTestUser(t, provider, TestUsername, TestPassword).Tokens
+	cookie := tokens.AccessToken.AsCookie("access")
+
+	if cookie.Path != "/" || !cookie.HttpOnly || cookie.Secure ||
+		cookie.SameSite != http.SameSiteStrictMode || cookie.MaxAge <= 0 {
+		t.Fatalf("unexpected default cookie: %+v", cookie)
+	}
+}
+
+func responseCookies(resp *httptest.ResponseRecorder) map[string]*http.Cookie {
+	cookies := map[string]*http.Cookie{}
+
+	for _, cookie := range resp.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+
+	return cookies
+}
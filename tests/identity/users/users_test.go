@@ -0,0 +1,269 @@
+package users
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yandzee/go-svc/identity"
+	"github.com/yandzee/go-svc/identity/password"
+	"github.com/yandzee/go-svc/identity/users"
+	_ "modernc.org/sqlite"
+)
+
+type Registry interface {
+	identity.UsersRegistry[users.User]
+	SetRoles(context.Context, uuid.UUID, []string) (bool, error)
+	DeleteUser(context.Context, uuid.UUID) (bool, error)
+}
+
+// NOTE: Cheap parameters, so tests do not spend time on hashing
+var fastHasher = password.NewHasher(password.Argon2idParams{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+})
+
+func TestMemoryRegistry(t *testing.T) {
+	testRegistry(t, users.NewMemoryRegistry(users.Options{Passwords: fastHasher}))
+}
+
+func TestSQLiteRegistry(t *testing.T) {
+	testRegistry(t, openSQLiteRegistry(t, openSQLite(t), users.Options{Passwords: fastHasher}))
+}
+
+func TestSQLiteMigrationsAreIdempotent(t *testing.T) {
+	db := openSQLite(t)
+	reg := openSQLiteRegistry(t, db, users.Options{Passwords: fastHasher})
+
+	created := createUser(t, reg, "alice", "password")
+
+	if err := reg.Migrate(t.Context()); err != nil {
+		t.Fatalf("second migration run failed: %s", err.Error())
+	}
+
+	if usr, _ := reg.GetUserById(t.Context(), &created.Id); usr == nil {
+		t.Fatalf("expected user to survive repeated migration")
+	}
+
+	versions := 0
+	if err := db.QueryRow("SELECT COUNT(*) FROM users_migrations").Scan(&versions); err != nil || versions != 1 {
+		t.Fatalf("expected single applied migration, got %d: %v", versions, err)
+	}
+
+	if _, err := users.NewSQLRegistry(db, users.SQLite, users.SQLOptions{Table: "users; DROP TABLE users"}); err == nil {
+		t.Fatalf("expected invalid table name to be rejected")
+	}
+}
+
+func TestPasswordRehash(t *testing.T) {
+	db := openSQLite(t)
+
+	legacy := openSQLiteRegistry(t, db, users.Options{Passwords: fastHasher})
+	created := createUser(t, legacy, "alice", "password")
+
+	upgraded := password.NewHasher(fastHasher.Params)
+	upgraded.Params.Iterations = 2
+
+	reg := openSQLiteRegistry(t, db, users.Options{Passwords: upgraded})
+	if !hasCredentials(t, reg, created, "password") {
+		t.Fatalf("expected legacy hash to match")
+	}
+
+	usr, _ := reg.GetUserById(t.Context(), &created.Id)
+	if usr.PasswordHash == created.PasswordHash || !strings.Contains(usr.PasswordHash, "t=2") {
+		t.Fatalf("expected password to be rehashed with new params: %s", usr.PasswordHash)
+	}
+
+	if !hasCredentials(t, reg, usr, "password") {
+		t.Fatalf("expected rehashed password to match")
+	}
+}
+
+func TestRegistryWithProvider(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err.Error())
+	}
+
+	provider := &identity.RegistryProvider[users.User]{
+		Registry:             openSQLiteRegistry(t, openSQLite(t), users.Options{Passwords: fastHasher}),
+		TokenPrivateKey:      key,
+		AccessTokenDuration:  time.Minute,
+		RefreshTokenDuration: time.Hour,
+	}
+
+	creds := identity.Credentials{"username": "alice", "password": "password"}
+
+	signup, err := provider.SignUp(t.Context(), identity.SignupRequest{Credentials: creds})
+	if err != nil || !signup.IsSuccess() {
+		t.Fatalf("signup failed: %+v, %v", signup, err)
+	}
+
+	signin, err := provider.SignIn(t.Context(), identity.SigninRequest{Credentials: creds})
+	if err != nil || signin.User == nil || signin.User.Id != signup.User.Id || signin.Tokens.AccessToken == nil {
+		t.Fatalf("signin failed: %+v, %v", signin, err)
+	}
+
+	creds["password"] = "wrong"
+
+	signin, err = provider.SignIn(t.Context(), identity.SigninRequest{Credentials: creds})
+	if err != nil || !signin.CredentialsMismatch {
+		t.Fatalf("expected credentials mismatch: %+v, %v", signin, err)
+	}
+}
+
+func testRegistry(t *testing.T, reg Registry) {
+	ctx := t.Context()
+	alice := createUser(t, reg, "Alice", "password")
+
+	if alice.PasswordHash == "password" || !strings.HasPrefix(alice.PasswordHash, "$argon2id$") {
+		t.Fatalf("expected password to be hashed, got %q", alice.PasswordHash)
+	}
+
+	dup, err := reg.CreateUser(ctx, &identity.UserStub{
+		Credentials: identity.Credentials{"username": "alice", "password": "other"},
+	})
+	if err != nil || !dup.AlreadyExists || dup.User.Id != alice.Id {
+		t.Fatalf("expected username to be unique case-insensitively: %+v, %v", dup, err)
+	}
+
+	found, err := reg.GetUserByCredentials(ctx, identity.Credentials{"username": "ALICE"})
+	if err != nil || found == nil || found.Id != alice.Id || found.Username != "Alice" {
+		t.Fatalf("expected user to be found by username: %+v, %v", found, err)
+	}
+
+	if !found.CreatedAt.Equal(alice.CreatedAt) {
+		t.Fatalf("expected creation time to be kept: %s != %s", found.CreatedAt, alice.CreatedAt)
+	}
+
+	if !hasCredentials(t, reg, found, "password") || hasCredentials(t, reg, found, "other") {
+		t.Fatalf("expected only original password to match")
+	}
+
+	missing := uuid.New()
+	if usr, err := reg.GetUserById(ctx, &missing); err != nil || usr != nil {
+		t.Fatalf("expected unknown user to be nil: %+v, %v", usr, err)
+	}
+
+	if updated, err := reg.SetRoles(ctx, alice.Id, []string{"admin"}); err != nil || !updated {
+		t.Fatalf("failed to set roles: %v", err)
+	}
+
+	usr, _ := reg.GetUserById(ctx, &alice.Id)
+	if len(usr.GetRoles()) != 1 || usr.GetRoles()[0] != "admin" {
+		t.Fatalf("expected roles to be stored, got %v", usr.GetRoles())
+	}
+
+	check, _ := reg.CheckFieldsCorrectness(ctx, identity.Credentials{"username": " ", "password": "x"})
+	if incorrect, has := check.HasIncorrect(); !has || !strings.Contains(incorrect.Details, "username") {
+		t.Fatalf("expected blank username to be incorrect: %+v", check)
+	}
+
+	// NOTE: Concurrent signups of the same username create single user
+	var wg sync.WaitGroup
+	created := make(chan uuid.UUID, 8)
+
+	for i := range 8 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			res, err := reg.CreateUser(ctx, &identity.UserStub{
+				Credentials: identity.Credentials{"username": "bob", "password": fmt.Sprint(i)},
+			})
+
+			if err == nil && !res.AlreadyExists {
+				created <- res.User.Id
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(created)
+
+	if len(created) != 1 {
+		t.Fatalf("expected exactly one user created, got %d", len(created))
+	}
+
+	if deleted, err := reg.DeleteUser(ctx, alice.Id); err != nil || !deleted {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+
+	if usr, _ := reg.GetUserByCredentials(ctx, identity.Credentials{"username": "alice"}); usr != nil {
+		t.Fatalf("expected deleted user not to be found")
+	}
+
+	recreated := createUser(t, reg, "alice", "password")
+	if recreated.Id == alice.Id {
+		t.Fatalf("expected new user to be created after deletion")
+	}
+}
+
+func createUser(t *testing.T, reg identity.UsersRegistry[users.User], username, pwd string) *users.User {
+	t.Helper()
+
+	res, err := reg.CreateUser(t.Context(), &identity.UserStub{
+		Credentials: identity.Credentials{"username": username, "password": pwd},
+	})
+	if err != nil || res.AlreadyExists || res.User == nil {
+		t.Fatalf("failed to create user %s: %+v, %v", username, res, err)
+	}
+
+	return res.User
+}
+
+func hasCredentials(t *testing.T, reg identity.UsersRegistry[users.User], usr *users.User, pwd string) bool {
+	t.Helper()
+
+	has, err := reg.UserHasCredentials(t.Context(), usr, identity.Credentials{"password": pwd})
+	if err != nil {
+		t.Fatalf("credentials check failed: %s", err.Error())
+	}
+
+	return has
+}
+
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := filepath.Join(t.TempDir(), "users.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %s", err.Error())
+	}
+
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	return db
+}
+
+func openSQLiteRegistry(t *testing.T, db *sql.DB, opts users.Options) *users.SQLRegistry {
+	t.Helper()
+
+	reg, err := users.NewSQLRegistry(db, users.SQLite, users.SQLOptions{Options: opts})
+	if err != nil {
+		t.Fatalf("failed to create registry: %s", err.Error())
+	}
+
+	if err := reg.Migrate(t.Context()); err != nil {
+		t.Fatalf("failed to migrate: %s", err.Error())
+	}
+
+	return reg
+}
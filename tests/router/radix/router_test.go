@@ -0,0 +1,193 @@
+package radix
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yandzee/go-svc/router"
+	radixrouter "github.com/yandzee/go-svc/router/radix"
+	"github.com/yandzee/go-svc/router/routertest"
+)
+
+func TestConformance(t *testing.T) {
+	routertest.Run(t, func(b *router.Builder) http.Handler {
+		return radixrouter.Build(b)
+	})
+}
+
+func TestConstrainedParams(t *testing.T) {
+	r := router.NewBuilder()
+	r.Get("/items/{id:uuid}", paramsHandler("uuid", "id"))
+	r.Get("/items/{n:int}", paramsHandler("int", "n"))
+	r.Get("/items/{code:[a-z]{3}}", paramsHandler("regex", "code"))
+	r.Get("/items/{name}", paramsHandler("any", "name"))
+	r.Get("/items/new", paramsHandler("static"))
+
+	handler := radixrouter.Build(&r)
+
+	for path, expected := range map[string]string{
+		"/items/0196a3b0-7c1e-7a9b-8f00-0123456789ab": "uuid:0196a3b0-7c1e-7a9b-8f00-0123456789ab",
+		"/items/42":    "int:42",
+		"/items/-7":    "int:-7",
+		"/items/abc":   "regex:abc",
+		"/items/abcd":  "any:abcd",
+		"/items/new":   "static",
+		"/items/4.2":   "any:4.2",
+		"/items/ABC":   "any:ABC",
+		"/items/":      "",
+		"/items/a/b/c": "",
+	} {
+		resp := serve(handler, http.MethodGet, path)
+
+		if expected == "" {
+			if resp.Code != http.StatusNotFound {
+				t.Fatalf("%s: expected 404, got %d", path, resp.Code)
+			}
+
+			continue
+		}
+
+		if body := resp.Body.String(); body != expected {
+			t.Fatalf("%s: expected %q, got %q (%d)", path, expected, body, resp.Code)
+		}
+	}
+}
+
+func TestCatchAll(t *testing.T) {
+	r := router.NewBuilder()
+	r.Get("/static/{path...}", paramsHandler("catch", "path"))
+	r.Get("/docs/{section}/{rest...}", paramsHandler("docs", "section", "rest"))
+	r.Get("/exact/{$}", paramsHandler("exact"))
+
+	handler := radixrouter.Build(&r)
+
+	for path, expected := range map[string]string{
+		"/static/css/app.css": "catch:css/app.css",
+		"/static/":            "catch:",
+		"/docs/api/v1/users":  "docs:api,v1/users",
+		"/exact/":             "exact",
+	} {
+		if body := serve(handler, http.MethodGet, path).Body.String(); body != expected {
+			t.Fatalf("%s: expected %q, got %q", path, expected, body)
+		}
+	}
+
+	if resp := serve(handler, http.MethodGet, "/exact/more"); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected anchored pattern not to match subtree, got %d", resp.Code)
+	}
+}
+
+func TestTrailingSlashPolicy(t *testing.T) {
+	r := router.NewBuilder()
+	r.Get("/users", paramsHandler("users"))
+	r.Post("/groups/", paramsHandler("groups"))
+
+	redirecting := radixrouter.Build(&r)
+
+	resp := serve(redirecting, http.MethodGet, "/users/")
+	if resp.Code != http.StatusMovedPermanently || resp.Header().Get("Location") != "/users" {
+		t.Fatalf("expected redirect to /users, got %d %q", resp.Code, resp.Header().Get("Location"))
+	}
+
+	resp = serve(redirecting, http.MethodPost, "/groups")
+	if resp.Code != http.StatusPermanentRedirect || resp.Header().Get("Location") != "/groups/" {
+		t.Fatalf("expected 308 redirect to /groups/, got %d %q", resp.Code, resp.Header().Get("Location"))
+	}
+
+	strict := radixrouter.Build(&r, radixrouter.Options{
+		TrailingSlash: radixrouter.TrailingSlashStrict,
+	})
+
+	if resp := serve(strict, http.MethodGet, "/users/"); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 with strict policy, got %d", resp.Code)
+	}
+
+	ignoring := radixrouter.Build(&r, radixrouter.Options{
+		TrailingSlash: radixrouter.TrailingSlashIgnore,
+	})
+
+	if body := serve(ignoring, http.MethodGet, "/users/").Body.String(); body != "users" {
+		t.Fatalf("expected route to be served with ignore policy, got %q", body)
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	r := router.NewBuilder()
+	r.Get("/Users/{name}", paramsHandler("user", "name"))
+
+	sensitive := radixrouter.Build(&r)
+	if resp := serve(sensitive, http.MethodGet, "/users/Bob"); resp.Code != http.StatusNotFound {
+		t.Fatalf("expected case sensitive matching by default, got %d", resp.Code)
+	}
+
+	insensitive := radixrouter.Build(&r, radixrouter.Options{
+		IsCaseInsensitive: true,
+	})
+
+	// NOTE: Param values keep their original case
+	if body := serve(insensitive, http.MethodGet, "/USERS/Bob").Body.String(); body != "user:Bob" {
+		t.Fatalf("expected case insensitive match, got %q", body)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	r := router.NewBuilder()
+	r.Get("/res", paramsHandler("get"))
+	r.Put("/res", paramsHandler("put"))
+
+	resp := serve(radixrouter.Build(&r), http.MethodDelete, "/res")
+
+	if resp.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", resp.Code)
+	}
+
+	if allow := resp.Header().Get("Allow"); allow != "GET, HEAD, PUT" {
+		t.Fatalf("unexpected Allow header %q", allow)
+	}
+}
+
+func TestInvalidPatterns(t *testing.T) {
+	for _, p := range []string{
+		"/a{id}",
+		"/{id",
+		"/{rest...}/more",
+		"/{n:[}",
+		"/{}",
+	} {
+		r := router.NewBuilder()
+		r.Get(p, paramsHandler("x"))
+
+		if _, err := radixrouter.TryBuild(&r); err == nil {
+			t.Fatalf("expected pattern %q to be rejected", p)
+		}
+	}
+}
+
+func paramsHandler(name string, params ...string) router.Handler {
+	return func(rctx *router.RequestContext) {
+		values := []string{}
+
+		for _, p := range params {
+			v, _ := rctx.Request.PathParam(p)
+			values = append(values, v)
+		}
+
+		if len(values) == 0 {
+			rctx.Response.Stringf(http.StatusOK, "%s", name)
+			return
+		}
+
+		rctx.Response.Stringf(http.StatusOK, "%s", fmt.Sprintf("%s:%s", name, strings.Join(values, ",")))
+	}
+}
+
+func serve(handler http.Handler, method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	resp := httptest.NewRecorder()
+
+	handler.ServeHTTP(resp, req)
+	return resp
+}
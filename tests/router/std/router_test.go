@@ -1,297 +1,12 @@
 package server
 
 import (
-	"net/http"
-	"net/http/httptest"
-	"strings"
 	"testing"
 
-	"testing/fstest"
-
-	"github.com/yandzee/go-svc/router"
+	"github.com/yandzee/go-svc/router/routertest"
 	stdrouter "github.com/yandzee/go-svc/router/std"
-	httputils "github.com/yandzee/go-svc/utils/http"
-)
-
-const (
-	BaseURL         = "/test"
-	ExtendBaseURL   = "/extended"
-	AttachedBaseURL = "/attached"
-	FilesURL        = "/files/"
-	SingleFileURL   = "/single-file"
-	MissingFileURL  = "/missing-file"
-
-	TestFilename1     = "testfile1.dat"
-	TestFilename2     = "testfile2.dat"
-	TestFileContent1  = "test file content 1"
-	TestFileContent2  = "test file content 2"
-	SingleFileName    = "data.txt"
-	SingleFileContent = "single file content"
-
-	CompressURL = "/compress"
 )
 
-// Large enough to trigger gzhttp compression (min ~1400 bytes)
-var largeBody = strings.Repeat("hello world ", 200)
-
-type TestOutputs struct {
-	// Mapping from route path to number of times handler was called
-	Counter map[string]int
-}
-
-func TestMethods(t *testing.T) {
-	handler, outs := buildRouter(t)
-
-	for _, method := range httputils.AllMethods {
-		for _, baseUrl := range baseUrls() {
-			path := baseUrl + "/" + strings.ToLower(method)
-			req := httptest.NewRequest(method, path, nil)
-			resp := httptest.NewRecorder()
-
-			handler.ServeHTTP(resp, req)
-
-			if num := outs.Counter[path]; num != 1 {
-				t.Fatalf(
-					"%s request to '%s' is handled wrong number of times: %d\n%v",
-					method,
-					path,
-					num,
-					outs,
-				)
-			}
-		}
-	}
-}
-
-func TestFiles(t *testing.T) {
-	req1 := httptest.NewRequest(http.MethodGet, FilesURL+TestFilename1, nil)
-	req2 := httptest.NewRequest(http.MethodGet, AttachedBaseURL+FilesURL+TestFilename2, nil)
-	expectedContent := []string{TestFileContent1, TestFileContent2}
-
-	for i, req := range []*http.Request{req1, req2} {
-		handler, _ := buildRouter(t)
-		resp := httptest.NewRecorder()
-
-		handler.ServeHTTP(resp, req)
-		if resp.Code != http.StatusOK {
-			t.Fatalf("wrong response code %d for file '%s'", resp.Code, req.URL.Path)
-			return
-		}
-
-		if s := resp.Body.String(); s != expectedContent[i] {
-			t.Fatalf("wrong response '%s' for file '%s'", s, req.URL.Path)
-			return
-		}
-	}
-}
-
-func TestFile(t *testing.T) {
-	handler, _ := buildRouter(t)
-
-	req := httptest.NewRequest(http.MethodGet, SingleFileURL, nil)
-	resp := httptest.NewRecorder()
-
-	handler.ServeHTTP(resp, req)
-
-	if resp.Code != http.StatusOK {
-		t.Fatalf("wrong response code %d for file '%s'", resp.Code, req.URL.Path)
-	}
-
-	if s := resp.Body.String(); s != SingleFileContent {
-		t.Fatalf("wrong response '%s' for file '%s'", s, req.URL.Path)
-	}
-}
-
-func TestFileMissing(t *testing.T) {
-	handler, _ := buildRouter(t)
-
-	req := httptest.NewRequest(http.MethodGet, MissingFileURL, nil)
-	resp := httptest.NewRecorder()
-
-	handler.ServeHTTP(resp, req)
-
-	if resp.Code != http.StatusNotFound {
-		t.Fatalf("expected 404 for missing file, got %d", resp.Code)
-	}
-}
-
-func TestCompressionInherited(t *testing.T) {
-	r := router.NewBuilder()
-	r.Compression(true)
-	r.Get(CompressURL, largeResponseHandler)
-	handler := stdrouter.Build(&r)
-
-	for _, enc := range []string{"gzip", "zstd"} {
-		req := httptest.NewRequest(http.MethodGet, CompressURL, nil)
-		req.Header.Set("Accept-Encoding", enc)
-		resp := httptest.NewRecorder()
-
-		handler.ServeHTTP(resp, req)
-
-		if ce := resp.Header().Get("Content-Encoding"); ce != enc {
-			t.Fatalf("expected Content-Encoding %q, got %q", enc, ce)
-		}
-	}
-}
-
-func TestCompressionZstdDisabled(t *testing.T) {
-	r := router.NewBuilder()
-	r.Compression(true, &router.CompressionOptions{ZstdDisabled: true})
-	r.Get(CompressURL, largeResponseHandler)
-	handler := stdrouter.Build(&r)
-
-	// gzip should still work
-	req := httptest.NewRequest(http.MethodGet, CompressURL, nil)
-	req.Header.Set("Accept-Encoding", "gzip")
-	resp := httptest.NewRecorder()
-
-	handler.ServeHTTP(resp, req)
-
-	if ce := resp.Header().Get("Content-Encoding"); ce != "gzip" {
-		t.Fatalf("expected Content-Encoding %q, got %q", "gzip", ce)
-	}
-
-	// zstd should not be applied
-	req = httptest.NewRequest(http.MethodGet, CompressURL, nil)
-	req.Header.Set("Accept-Encoding", "zstd")
-	resp = httptest.NewRecorder()
-
-	handler.ServeHTTP(resp, req)
-
-	if ce := resp.Header().Get("Content-Encoding"); ce == "zstd" {
-		t.Fatal("expected zstd compression to be disabled, but got Content-Encoding: zstd")
-	}
-}
-
-func TestCompressionRouterEnabledRouteDisabled(t *testing.T) {
-	r := router.NewBuilder()
-	r.Compression(true)
-	r.Get(CompressURL, largeResponseHandler).Compression(false)
-	handler := stdrouter.Build(&r)
-
-	for _, enc := range []string{"gzip", "zstd"} {
-		req := httptest.NewRequest(http.MethodGet, CompressURL, nil)
-		req.Header.Set("Accept-Encoding", enc)
-		resp := httptest.NewRecorder()
-
-		handler.ServeHTTP(resp, req)
-
-		if ce := resp.Header().Get("Content-Encoding"); ce != "" {
-			t.Fatalf("expected no compression, got Content-Encoding %q", ce)
-		}
-	}
-}
-
-func TestCompressionRouterDisabledRouteEnabled(t *testing.T) {
-	r := router.NewBuilder()
-	r.Get(CompressURL, largeResponseHandler).Compression(true)
-	handler := stdrouter.Build(&r)
-
-	for _, enc := range []string{"gzip", "zstd"} {
-		req := httptest.NewRequest(http.MethodGet, CompressURL, nil)
-		req.Header.Set("Accept-Encoding", enc)
-		resp := httptest.NewRecorder()
-
-		handler.ServeHTTP(resp, req)
-
-		if ce := resp.Header().Get("Content-Encoding"); ce != enc {
-			t.Fatalf("expected Content-Encoding %q, got %q", enc, ce)
-		}
-	}
-}
-
-func TestCompressionExtendedRoute(t *testing.T) {
-	r := router.NewBuilder()
-
-	ext := router.NewBuilder()
-	ext.Get(CompressURL, largeResponseHandler).Compression(true)
-
-	if err := r.Extend(ext.IterRoutes()); err != nil {
-		t.Fatalf("Failed to extend routes: %s", err.Error())
-	}
-
-	handler := stdrouter.Build(&r)
-
-	for _, enc := range []string{"gzip", "zstd"} {
-		req := httptest.NewRequest(http.MethodGet, CompressURL, nil)
-		req.Header.Set("Accept-Encoding", enc)
-		resp := httptest.NewRecorder()
-
-		handler.ServeHTTP(resp, req)
-
-		if ce := resp.Header().Get("Content-Encoding"); ce != enc {
-			t.Fatalf("expected Content-Encoding %q, got %q", enc, ce)
-		}
-	}
-}
-
-func largeResponseHandler(rctx *router.RequestContext) {
-	rctx.Response.String(http.StatusOK, largeBody)
-}
-
-func buildRouter(t *testing.T) (http.Handler, *TestOutputs) {
-	r := router.NewBuilder()
-	ext := router.NewBuilder()
-	att := router.NewBuilder()
-
-	outs := &TestOutputs{
-		Counter: make(map[string]int),
-	}
-
-	for _, method := range httputils.AllMethods {
-		methodStr := strings.ToLower(method)
-		path := BaseURL + "/" + methodStr
-
-		r.Method(method, path, func(rctx *router.RequestContext) {
-			outs.Counter[path] += 1
-		})
-
-		extPath := ExtendBaseURL + "/" + methodStr
-		ext.Method(method, extPath, func(rctx *router.RequestContext) {
-			outs.Counter[extPath] += 1
-		})
-
-		att.Method(method, "/"+methodStr, func(ctx *router.RequestContext) {
-			path := AttachedBaseURL + "/" + methodStr
-			outs.Counter[path] += 1
-		})
-	}
-
-	r.Files(FilesURL, fstest.MapFS{
-		TestFilename1: {
-			Data: []byte(TestFileContent1),
-		},
-	})
-
-	r.File(SingleFileURL, fstest.MapFS{
-		SingleFileName: {
-			Data: []byte(SingleFileContent),
-		},
-	}, SingleFileName)
-
-	r.File(MissingFileURL, fstest.MapFS{}, "nonexistent.txt")
-
-	att.Files(FilesURL, fstest.MapFS{
-		TestFilename2: {
-			Data: []byte(TestFileContent2),
-		},
-	})
-
-	if err := r.Extend(ext.IterRoutes()); err != nil {
-		t.Fatalf("Failed to extend routes: %s", err.Error())
-	}
-
-	if err := r.Extend(att.IterRoutes(), AttachedBaseURL); err != nil {
-		t.Fatalf("Failed to attach routes: %s", err.Error())
-	}
-
-	return stdrouter.Build(&r), outs
-}
-
-func baseUrls() []string {
-	return []string{
-		BaseURL,
-		ExtendBaseURL,
-		AttachedBaseURL,
-	}
+func TestConformance(t *testing.T) {
+	routertest.Run(t, stdrouter.Build)
 }
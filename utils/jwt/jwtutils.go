@@ -12,6 +12,10 @@ type TokenValidation struct {
 	IsExpired    bool
 	IsMalformed  bool
 	IsParseError bool
+
+	// NOTE: Not set by ValidateTokenParseError, token is valid by itself
+	// but has been revoked before its expiration
+	IsRevoked bool
 }
 
 func ValidateTokenParseError(err error) (TokenValidation, error) {
@@ -58,5 +62,5 @@ func ValidateTokenParseError(err error) (TokenValidation, error) {
 }
 
 func (tv *TokenValidation) IsOk() bool {
-	return tv.Error == nil && !tv.IsExpired && !tv.IsMalformed && !tv.IsParseError
+	return tv.Error == nil && !tv.IsExpired && !tv.IsMalformed && !tv.IsParseError && !tv.IsRevoked
 }